@@ -18,41 +18,71 @@ package main
 
 import (
 	"fmt"
-	"errors"
-	"github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric/protos/msp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"crypto/x509"
-	"encoding/pem"
 )
 
-func getTxCreatorInfo(creator []byte) (string, string, error) {
-	var certASN1 *pem.Block
-	var cert *x509.Certificate
+
+func getTxCreatorInfo(stub shim.ChaincodeStubInterface) (string, string, error) {
+	var mspid string
 	var err error
+	var cert *x509.Certificate
 
-	creatorSerializedId := &msp.SerializedIdentity{}
-	err = proto.Unmarshal(creator, creatorSerializedId)
+	mspid, err = cid.GetMSPID(stub)
 	if err != nil {
-		fmt.Printf("Error unmarshalling creator identity: %s\n", err.Error())
+		fmt.Printf("Error getting MSP identity: %s\n", err.Error())
 		return "", "", err
 	}
 
-	if len(creatorSerializedId.IdBytes) == 0 {
-		return "", "", errors.New("Empty certificate")
-	}
-	certASN1, _ = pem.Decode(creatorSerializedId.IdBytes)
-	cert, err = x509.ParseCertificate(certASN1.Bytes)
+	cert, err = cid.GetX509Certificate(stub)
 	if err != nil {
+		fmt.Printf("Error getting client certificate: %s\n", err.Error())
 		return "", "", err
 	}
 
-	return creatorSerializedId.Mspid, cert.Issuer.CommonName, nil
+	return mspid, cert.Issuer.CommonName, nil
+}
+
+// The common name in the caller's certificate identifies the caller within its organization
+func getTxCreatorName(stub shim.ChaincodeStubInterface) (string, error) {
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		fmt.Printf("Error getting client certificate: %s\n", err.Error())
+		return "", err
+	}
+	return cert.Subject.CommonName, nil
 }
 
+func isTxCreatorApprover(stub shim.ChaincodeStubInterface) (bool, error) {
+	value, found, err := cid.GetAttributeValue(stub, APPROVER_ATTRIBUTE)
+	if err != nil {
+		fmt.Printf("Error getting attribute %s: %s\n", APPROVER_ATTRIBUTE, err.Error())
+		return false, err
+	}
+	return found && value == "true", nil
+}
 
 // For now, just hardcode an ACL
 // We will support attribute checks in an upgrade
 
+func authenticateExportingEntityOrg(mspID string, certCN string) bool {
+	return (mspID == "ExportingEntityOrgMSP") && (certCN == "ca.exportingentityorg.trade.com")
+}
+
+// The exporting entity role is played by the Exporter Org unless a dedicated Exporting Entity Org has been enabled on the ledger
+func authenticateExportingEntity(stub shim.ChaincodeStubInterface, mspID string, certCN string) bool {
+	enabled, err := isFeatureEnabled(stub, EXPORTING_ENTITY_FEATURE)
+	if err != nil {
+		fmt.Printf("Error reading feature %s: %s\n", EXPORTING_ENTITY_FEATURE, err.Error())
+		return false
+	}
+	if enabled {
+		return authenticateExportingEntityOrg(mspID, certCN)
+	}
+	return authenticateExporterOrg(mspID, certCN)
+}
+
 func authenticateExporterOrg(mspID string, certCN string) bool {
 	return (mspID == "ExporterOrgMSP") && (certCN == "ca.exporterorg.trade.com")
 }
@@ -68,3 +98,26 @@ func authenticateCarrierOrg(mspID string, certCN string) bool {
 func authenticateRegulatorOrg(mspID string, certCN string) bool {
 	return (mspID == "RegulatorOrgMSP") && (certCN == "ca.regulatororg.trade.com")
 }
+
+// The insurer's organization is recorded on the ledger when the insurer is registered; an insurer named in 'init' belongs to InsurerOrg
+func authenticateInsurerOrg(stub shim.ChaincodeStubInterface, mspID string, certCN string) bool {
+	insurerMSP, err := stub.GetState(insMspKey)
+	if err != nil {
+		fmt.Printf("Error reading key %s: %s\n", insMspKey, err.Error())
+		return false
+	}
+	insurerCA, err := stub.GetState(insCAKey)
+	if err != nil {
+		fmt.Printf("Error reading key %s: %s\n", insCAKey, err.Error())
+		return false
+	}
+	if len(insurerMSP) == 0 {
+		return (mspID == "InsurerOrgMSP") && (certCN == "ca.insurerorg.trade.com")
+	}
+	return (mspID == string(insurerMSP)) && (certCN == string(insurerCA))
+}
+
+func authenticateTradeParticipantOrg(stub shim.ChaincodeStubInterface, mspID string, certCN string) bool {
+	return authenticateExportingEntityOrg(mspID, certCN) || authenticateExporterOrg(mspID, certCN) || authenticateImporterOrg(mspID, certCN) ||
+		authenticateCarrierOrg(mspID, certCN) || authenticateRegulatorOrg(mspID, certCN) || authenticateInsurerOrg(stub, mspID, certCN)
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Where the funds of the trade participants are held and moved. Accounts are identified by their balance keys.
+type settlement interface {
+	getBalance(stub shim.ChaincodeStubInterface, balanceKey string) (int, error)
+	openAccount(stub shim.ChaincodeStubInterface, balanceKey string) error
+	transfer(stub shim.ChaincodeStubInterface, fromBalKey string, toBalKey string, amount int) error
+	// Debit one account and credit another with a different amount, as when a payment is converted between currencies
+	exchange(stub shim.ChaincodeStubInterface, fromBalKey string, fromAmount int, toBalKey string, toAmount int) error
+}
+
+// Balances kept as integers on this chaincode's own ledger
+type internalSettlement struct {
+}
+
+// Balances kept by a fungible-token chaincode on the channel, which exposes
+//   transfer {From, To, Amount} and balanceOf {Account}
+// and whose accounts are named after the trade participants
+type tokenSettlement struct {
+	chaincodeName	string
+	channel		string
+}
+
+// Funds are held on this ledger unless a token chaincode is configured
+func getSettlement(stub shim.ChaincodeStubInterface) (settlement, error) {
+	tokenChaincode, err := getSetting(stub, TOKEN_CHAINCODE_SETTING)
+	if err != nil {
+		return nil, err
+	}
+	if tokenChaincode == "" {
+		return &internalSettlement{}, nil
+	}
+
+	parts := strings.SplitN(tokenChaincode, "/", 2)
+	if len(parts) == 2 {
+		return &tokenSettlement{parts[0], parts[1]}, nil
+	}
+	return &tokenSettlement{parts[0], ""}, nil
+}
+
+func (s *internalSettlement) getBalance(stub shim.ChaincodeStubInterface, balanceKey string) (int, error) {
+	balanceBytes, err := stub.GetState(balanceKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(balanceBytes) == 0 {
+		return 0, errors.New("No record found for " + balanceKey)
+	}
+	return strconv.Atoi(string(balanceBytes))
+}
+
+// Open an account with a zero balance, unless it already exists
+func (s *internalSettlement) openAccount(stub shim.ChaincodeStubInterface, balanceKey string) error {
+	balanceBytes, err := stub.GetState(balanceKey)
+	if err != nil {
+		return err
+	}
+	if len(balanceBytes) != 0 {
+		return nil
+	}
+	return stub.PutState(balanceKey, []byte(strconv.Itoa(0)))
+}
+
+func (s *internalSettlement) transfer(stub shim.ChaincodeStubInterface, fromBalKey string, toBalKey string, amount int) error {
+	return s.exchange(stub, fromBalKey, amount, toBalKey, amount)
+}
+
+func (s *internalSettlement) exchange(stub shim.ChaincodeStubInterface, fromBalKey string, fromAmount int, toBalKey string, toAmount int) error {
+	fromBal, err := s.getBalance(stub, fromBalKey)
+	if err != nil {
+		return err
+	}
+	toBal, err := s.getBalance(stub, toBalKey)
+	if err != nil {
+		return err
+	}
+
+	if fromBal < fromAmount {
+		fmt.Printf("Balance %d of %s is insufficient to cover amount %d\n", fromBal, fromBalKey, fromAmount)
+	}
+	fromBal -= fromAmount
+	toBal += toAmount
+
+	err = stub.PutState(fromBalKey, []byte(strconv.Itoa(fromBal)))
+	if err != nil {
+		return err
+	}
+	return stub.PutState(toBalKey, []byte(strconv.Itoa(toBal)))
+}
+
+// Token accounts are named after the participant: the exporter and importer for their accounts at their banks,
+// and the bank or beneficiary named in the key of any other account; escrow accounts are named after their trade
+func getTokenAccount(stub shim.ChaincodeStubInterface, balanceKey string) (string, error) {
+	var accountBytes []byte
+	var err error
+
+	switch balanceKey {
+	case expBalKey:
+		accountBytes, err = stub.GetState(expKey)
+	case impBalKey:
+		accountBytes, err = stub.GetState(impKey)
+	default:
+		objectType, attributes, err := stub.SplitCompositeKey(balanceKey)
+		if err != nil {
+			return "", err
+		}
+		if len(attributes) != 1 {
+			return "", errors.New(fmt.Sprintf("No token account for %s", balanceKey))
+		}
+		if objectType == "EscrowAccountBalance" {
+			return "escrow:" + attributes[0], nil
+		}
+		return attributes[0], nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(accountBytes), nil
+}
+
+func (s *tokenSettlement) getBalance(stub shim.ChaincodeStubInterface, balanceKey string) (int, error) {
+	account, err := getTokenAccount(stub, balanceKey)
+	if err != nil {
+		return 0, err
+	}
+	response := stub.InvokeChaincode(s.chaincodeName, [][]byte{[]byte("balanceOf"), []byte(account)}, s.channel)
+	if response.Status != shim.OK {
+		return 0, errors.New(fmt.Sprintf("Token chaincode %s failed to get the balance of %s: %s", s.chaincodeName, account, response.Message))
+	}
+	return strconv.Atoi(string(response.Payload))
+}
+
+// Token accounts come into existence when they are first credited
+func (s *tokenSettlement) openAccount(stub shim.ChaincodeStubInterface, balanceKey string) error {
+	return nil
+}
+
+func (s *tokenSettlement) transfer(stub shim.ChaincodeStubInterface, fromBalKey string, toBalKey string, amount int) error {
+	from, err := getTokenAccount(stub, fromBalKey)
+	if err != nil {
+		return err
+	}
+	to, err := getTokenAccount(stub, toBalKey)
+	if err != nil {
+		return err
+	}
+	response := stub.InvokeChaincode(s.chaincodeName, [][]byte{[]byte("transfer"), []byte(from), []byte(to), []byte(strconv.Itoa(amount))}, s.channel)
+	if response.Status != shim.OK {
+		return errors.New(fmt.Sprintf("Token chaincode %s failed to transfer %d from %s to %s: %s", s.chaincodeName, amount, from, to, response.Message))
+	}
+	return nil
+}
+
+// A token transfer moves the same amount of a single token; conversions are not supported
+func (s *tokenSettlement) exchange(stub shim.ChaincodeStubInterface, fromBalKey string, fromAmount int, toBalKey string, toAmount int) error {
+	if fromAmount != toAmount {
+		return errors.New(fmt.Sprintf("Token chaincode %s cannot settle a payment converted between currencies", s.chaincodeName))
+	}
+	return s.transfer(stub, fromBalKey, toBalKey, fromAmount)
+}
+
+func getBalance(stub shim.ChaincodeStubInterface, balanceKey string) (int, error) {
+	settlement, err := getSettlement(stub)
+	if err != nil {
+		return 0, err
+	}
+	return settlement.getBalance(stub, balanceKey)
+}
+
+// Open an account with a zero balance, unless it already exists
+func openAccount(stub shim.ChaincodeStubInterface, balanceKey string) error {
+	settlement, err := getSettlement(stub)
+	if err != nil {
+		return err
+	}
+	return settlement.openAccount(stub, balanceKey)
+}
+
+// Move funds between two account balance keys
+func transferFunds(stub shim.ChaincodeStubInterface, fromBalKey string, toBalKey string, amount int) error {
+	settlement, err := getSettlement(stub)
+	if err != nil {
+		return err
+	}
+	return settlement.transfer(stub, fromBalKey, toBalKey, amount)
+}
+
+// Debit and credit two accounts with amounts in their own currencies
+func exchangeFunds(stub shim.ChaincodeStubInterface, fromBalKey string, fromAmount int, toBalKey string, toAmount int) error {
+	settlement, err := getSettlement(stub)
+	if err != nil {
+		return err
+	}
+	return settlement.exchange(stub, fromBalKey, fromAmount, toBalKey, toAmount)
+}
@@ -0,0 +1,436 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Ledger key of the bank of the given party
+func getBankRoleKey(party string) (string, error) {
+	switch party {
+	case IMPORTERS_BANK_PARTY:
+		return ibKey, nil
+	case EXPORTERS_BANK_PARTY:
+		return ebKey, nil
+	}
+	return "", errors.New(fmt.Sprintf("Invalid bank %s; expecting %s or %s", party, IMPORTERS_BANK_PARTY, EXPORTERS_BANK_PARTY))
+}
+
+// Ledger key of the bank whose actions a proposal holds
+func getProposalBankRoleKey(proposal *Proposal) string {
+	if proposal.Action == ISSUE_LC_ACTION || proposal.Action == MAKE_PAYMENT_ACTION || proposal.Action == PAY_LOT_ACTION {
+		return ibKey
+	}
+	return ebKey
+}
+
+// Check that the caller belongs to the organization of a bank
+func authenticateBankOrg(bankRoleKey string, creatorOrg string, creatorCertIssuer string) bool {
+	if bankRoleKey == ibKey {
+		return authenticateImporterOrg(creatorOrg, creatorCertIssuer)
+	}
+	return authenticateExporterOrg(creatorOrg, creatorCertIssuer)
+}
+
+func lookupApprovalPolicy(stub shim.ChaincodeStubInterface, bank string) (string, *ApprovalPolicy, error) {
+	var approvalPolicy *ApprovalPolicy
+
+	approvalPolicyKey, err := getApprovalPolicyKey(stub, bank)
+	if err != nil {
+		return "", nil, err
+	}
+	approvalPolicyBytes, err := getAssetState(stub, approvalPolicyKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(approvalPolicyBytes) == 0 {
+		return approvalPolicyKey, nil, nil
+	}
+
+	err = json.Unmarshal(approvalPolicyBytes, &approvalPolicy)
+	if err != nil {
+		return "", nil, err
+	}
+	return approvalPolicyKey, approvalPolicy, nil
+}
+
+func lookupProposal(stub shim.ChaincodeStubInterface, proposalID string) (string, *Proposal, error) {
+	var proposal *Proposal
+
+	proposalKey, err := getProposalKey(stub, proposalID)
+	if err != nil {
+		return "", nil, err
+	}
+	proposalBytes, err := getAssetState(stub, proposalKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(proposalBytes) == 0 {
+		return "", nil, errors.New(fmt.Sprintf("No record found for proposal ID %s", proposalID))
+	}
+
+	err = json.Unmarshal(proposalBytes, &proposal)
+	if err != nil {
+		return "", nil, err
+	}
+	return proposalKey, proposal, nil
+}
+
+// List the proposals that are still waiting for approvals
+func getPendingProposals(stub shim.ChaincodeStubInterface) ([]*Proposal, error) {
+	var proposal *Proposal
+
+	proposalsIterator, err := stub.GetStateByPartialCompositeKey("Proposal", []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer proposalsIterator.Close()
+
+	proposals := []*Proposal{}
+	for proposalsIterator.HasNext() {
+		proposalKV, err := proposalsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := upgradeAssetState(stub, proposalKV.Key, proposalKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(value, &proposal)
+		if err != nil {
+			return nil, err
+		}
+		if proposal.Status == PENDING {
+			proposals = append(proposals, proposal)
+		}
+		proposal = nil
+	}
+	return proposals, nil
+}
+
+// Record a proposal instead of performing a bank action whose amount exceeds the bank's approval threshold.
+// The marshaled proposal is returned if the action must wait; nil means that the action may proceed.
+func (t *TradeWorkflowChaincode) holdForApproval(stub shim.ChaincodeStubInterface, action string, args []string, bankRoleKey string, amount int) ([]byte, error) {
+	if t.approved {
+		return nil, nil
+	}
+
+	bankBytes, err := stub.GetState(bankRoleKey)
+	if err != nil {
+		return nil, err
+	}
+	_, approvalPolicy, err := lookupApprovalPolicy(stub, string(bankBytes))
+	if err != nil {
+		return nil, err
+	}
+	if approvalPolicy == nil || approvalPolicy.RequiredApprovals == 0 || amount <= approvalPolicy.Threshold {
+		return nil, nil
+	}
+
+	// The same action cannot be proposed twice
+	proposals, err := getPendingProposals(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, proposal := range proposals {
+		if proposal.Action == action && strings.Join(proposal.Args, "\x00") == strings.Join(args, "\x00") {
+			return nil, errors.New(fmt.Sprintf("%s already awaiting approval as proposal %s", action, proposal.Id))
+		}
+	}
+
+	proposer, err := getTxCreatorName(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := &Proposal{stub.GetTxID(), action, args, amount, approvalPolicy.Bank, proposer, approvalPolicy.RequiredApprovals, []string{}, PENDING}
+	proposalKey, err := getProposalKey(stub, proposal.Id)
+	if err != nil {
+		return nil, err
+	}
+	proposalBytes, err := json.Marshal(proposal)
+	if err != nil {
+		return nil, errors.New("Error marshaling proposal structure")
+	}
+	err = putAssetState(stub, proposalKey, proposalBytes)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("%s of %d recorded as proposal %s, awaiting %d approvals\n", action, amount, proposal.Id, proposal.RequiredApprovals)
+
+	return proposalBytes, nil
+}
+
+// A held action succeeds, so that its proposal is committed, but its response is marked PENDING and carries the
+// proposal; an action that is performed responds with neither
+func awaitingApproval(proposalBytes []byte) pb.Response {
+	return pb.Response{Status: shim.OK, Message: PENDING, Payload: proposalBytes}
+}
+
+// Set the amount above which a bank's actions need approval, and the number of approvals; zero approvals switches approval off
+func (t *TradeWorkflowChaincode) setApprovalPolicy(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var bankRoleKey, approvalPolicyKey string
+	var bankBytes, approvalPolicyBytes []byte
+	var threshold, requiredApprovals int
+	var isApprover bool
+	var err error
+
+	if len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Bank, Threshold, Required Approvals}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	bankRoleKey, err = getBankRoleKey(strings.ToLower(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the bank's Org can invoke this transaction
+	if !t.testMode && !authenticateBankOrg(bankRoleKey, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the bank's Org. Access denied.")
+	}
+
+	// Only identities holding the approver attribute may change how many approvals the bank's actions need
+	isApprover, err = isTxCreatorApprover(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isApprover {
+		return shim.Error("Caller does not hold the " + APPROVER_ATTRIBUTE + " attribute. Access denied.")
+	}
+
+	threshold, err = strconv.Atoi(string(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	requiredApprovals, err = strconv.Atoi(string(args[2]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if threshold < 0 || requiredApprovals < 0 {
+		return shim.Error("Threshold and required approvals may not be negative")
+	}
+
+	bankBytes, err = stub.GetState(bankRoleKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	approvalPolicyKey, err = getApprovalPolicyKey(stub, string(bankBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	approvalPolicyBytes, err = json.Marshal(&ApprovalPolicy{string(bankBytes), threshold, requiredApprovals})
+	if err != nil {
+		return shim.Error("Error marshaling approval policy structure")
+	}
+	// Write the state to the ledger
+	err = putAssetState(stub, approvalPolicyKey, approvalPolicyBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Approval policy for %s recorded: %d approvals above %d\n", string(bankBytes), requiredApprovals, threshold)
+
+	return shim.Success(nil)
+}
+
+// Approve a pending proposal; the proposed action is performed once the last required approval is given
+func (t *TradeWorkflowChaincode) approveProposal(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var proposalKey, approver, bankRoleKey string
+	var proposalBytes []byte
+	var proposal *Proposal
+	var isApprover bool
+	var res pb.Response
+	var err error
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Proposal ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	proposalKey, proposal, err = lookupProposal(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bankRoleKey = getProposalBankRoleKey(proposal)
+
+	// Access control: Only a member of the bank's Org can invoke this transaction
+	if !t.testMode && !authenticateBankOrg(bankRoleKey, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the bank's Org. Access denied.")
+	}
+
+	if proposal.Status != PENDING {
+		err = errors.New(fmt.Sprintf("Proposal %s is %s", args[0], proposal.Status))
+		return shim.Error(err.Error())
+	}
+
+	// Only distinct identities holding the approver attribute, other than the proposer, may approve
+	isApprover, err = isTxCreatorApprover(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isApprover {
+		return shim.Error("Caller does not hold the " + APPROVER_ATTRIBUTE + " attribute. Access denied.")
+	}
+	approver, err = getTxCreatorName(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if approver == proposal.ProposedBy {
+		return shim.Error("A proposal cannot be approved by its proposer")
+	}
+	for _, approval := range proposal.Approvals {
+		if approval == approver {
+			err = errors.New(fmt.Sprintf("Proposal %s already approved by %s", args[0], approver))
+			return shim.Error(err.Error())
+		}
+	}
+	proposal.Approvals = append(proposal.Approvals, approver)
+
+	if len(proposal.Approvals) >= proposal.RequiredApprovals {
+		// Perform the proposed action, bypassing the approval check
+		executor := &TradeWorkflowChaincode{t.testMode, true}
+		switch proposal.Action {
+		case ISSUE_LC_ACTION:
+			res = executor.issueLC(stub, creatorOrg, creatorCertIssuer, proposal.Args)
+		case ACCEPT_LC_ACTION:
+			res = executor.acceptLC(stub, creatorOrg, creatorCertIssuer, proposal.Args)
+		case MAKE_PAYMENT_ACTION:
+			res = executor.makePayment(stub, creatorOrg, creatorCertIssuer, proposal.Args)
+		case PAY_LOT_ACTION:
+			res = executor.payLot(stub, creatorOrg, creatorCertIssuer, proposal.Args)
+		default:
+			err = errors.New(fmt.Sprintf("Unknown action %s in proposal %s", proposal.Action, args[0]))
+			return shim.Error(err.Error())
+		}
+		if res.Status != shim.OK {
+			return res
+		}
+		proposal.Status = APPROVED
+	}
+
+	proposalBytes, err = json.Marshal(proposal)
+	if err != nil {
+		return shim.Error("Error marshaling proposal structure")
+	}
+	// Write the state to the ledger
+	err = putAssetState(stub, proposalKey, proposalBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Proposal %s approved by %s (%d of %d)\n", args[0], approver, len(proposal.Approvals), proposal.RequiredApprovals)
+
+	return shim.Success(nil)
+}
+
+// Withdraw a pending proposal, e.g. one whose action can no longer be performed once approved
+func (t *TradeWorkflowChaincode) withdrawProposal(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var proposalKey, caller string
+	var proposalBytes []byte
+	var proposal *Proposal
+	var isApprover bool
+	var err error
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Proposal ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	proposalKey, proposal, err = lookupProposal(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the bank's Org can invoke this transaction
+	if !t.testMode && !authenticateBankOrg(getProposalBankRoleKey(proposal), creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the bank's Org. Access denied.")
+	}
+
+	if proposal.Status != PENDING {
+		err = errors.New(fmt.Sprintf("Proposal %s is %s", args[0], proposal.Status))
+		return shim.Error(err.Error())
+	}
+
+	// Only the proposer, or an identity holding the approver attribute, may withdraw
+	caller, err = getTxCreatorName(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if caller != proposal.ProposedBy {
+		isApprover, err = isTxCreatorApprover(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isApprover {
+			return shim.Error("Caller is neither the proposer nor holds the " + APPROVER_ATTRIBUTE + " attribute. Access denied.")
+		}
+	}
+	proposal.Status = WITHDRAWN
+
+	proposalBytes, err = json.Marshal(proposal)
+	if err != nil {
+		return shim.Error("Error marshaling proposal structure")
+	}
+	// Write the state to the ledger
+	err = putAssetState(stub, proposalKey, proposalBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Proposal %s withdrawn by %s\n", args[0], caller)
+
+	return shim.Success(nil)
+}
+
+// Get the proposals awaiting approval
+func (t *TradeWorkflowChaincode) getPendingApprovals(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var proposals []*Proposal
+	var proposalsBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 0 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	proposals, err = getPendingProposals(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposalsBytes, err = json.Marshal(proposals)
+	if err != nil {
+		return shim.Error("Error marshaling proposals")
+	}
+	fmt.Printf("Query Response:%s\n", string(proposalsBytes))
+	return shim.Success(proposalsBytes)
+}
@@ -21,6 +21,15 @@ type TradeAgreement struct {
 	DescriptionOfGoods	string		`json:"descriptionOfGoods"`
 	Status			string		`json:"status"`
 	Payment			int		`json:"payment"`
+	Deadlines		*Deadlines	`json:"deadlines,omitempty"`
+	Quantity		int		`json:"quantity,omitempty"`
+}
+
+// Contractual deadlines, as RFC 3339 timestamps
+type Deadlines struct {
+	LCIssuance		string		`json:"lcIssuance"`
+	Shipment		string		`json:"shipment"`
+	Payment			string		`json:"payment"`
 }
 
 type LetterOfCredit struct {
@@ -30,6 +39,19 @@ type LetterOfCredit struct {
 	Amount			int		`json:"amount"`
 	Documents		[]string	`json:"documents"`
 	Status			string		`json:"status"`
+	AdvisingBank		string		`json:"advisingBank,omitempty"`
+	ConfirmingBank		string		`json:"confirmingBank,omitempty"`
+	Advised			bool		`json:"advised,omitempty"`
+	Confirmed		bool		`json:"confirmed,omitempty"`
+	Transferable		bool		`json:"transferable,omitempty"`
+	Type			string		`json:"type,omitempty"`
+	ParentId		string		`json:"parentId,omitempty"`
+	Transferred		int		`json:"transferred,omitempty"`
+	BackToBack		int		`json:"backToBack,omitempty"`
+	Drawn			int		`json:"drawn,omitempty"`
+	TenorDays		int		`json:"tenorDays,omitempty"`
+	PartialShipments	bool		`json:"partialShipments,omitempty"`
+	Content			*DocumentContent	`json:"content,omitempty"`
 }
 
 type ExportLicense struct {
@@ -40,6 +62,7 @@ type ExportLicense struct {
 	DescriptionOfGoods	string		`json:"descriptionOfGoods"`
 	Approver		string		`json:"approver"`
 	Status			string		`json:"status"`
+	Content			*DocumentContent	`json:"content,omitempty"`
 }
 
 type BillOfLading struct {
@@ -52,4 +75,291 @@ type BillOfLading struct {
 	Beneficiary		string		`json:"beneficiary"`
 	SourcePort		string		`json:"sourcePort"`
 	DestinationPort		string		`json:"destinationPort"`
+	Status			string		`json:"status"`
+	IssueDate		string		`json:"issueDate,omitempty"`
+	Content			*DocumentContent	`json:"content,omitempty"`
+}
+
+// The file behind a document record, held off the ledger and identified by the SHA-256 digest of its content
+type DocumentContent struct {
+	Hash			string		`json:"hash"`
+	MimeType		string		`json:"mimeType"`
+	Uri			string		`json:"uri"`
+}
+
+type PaymentRequest struct {
+	Id			string		`json:"id"`
+	Amount			int		`json:"amount"`
+	Status			string		`json:"status"`
+	PaidBy			string		`json:"paidBy,omitempty"`
+	PaidTo			string		`json:"paidTo,omitempty"`
+	Rate			int		`json:"rate,omitempty"`
+	SettledAmount		int		`json:"settledAmount,omitempty"`
+	SettledCurrency		string		`json:"settledCurrency,omitempty"`
+}
+
+type Delivery struct {
+	Status			string		`json:"status"`
+	Condition		string		`json:"condition"`
+	Note			string		`json:"note"`
+}
+
+type Settlement struct {
+	ProposedBy		string		`json:"proposedBy"`
+	Refund			int		`json:"refund"`
+	Adjustment		int		`json:"adjustment"`
+}
+
+type Dispute struct {
+	RaisedBy		string		`json:"raisedBy"`
+	ReasonCode		string		`json:"reasonCode"`
+	EvidenceHashes		[]string	`json:"evidenceHashes"`
+	Status			string		`json:"status"`
+	Proposal		*Settlement	`json:"proposal"`
+	Resolution		*Settlement	`json:"resolution"`
+	ResolvedBy		string		`json:"resolvedBy"`
+}
+
+type Guarantee struct {
+	Id			string		`json:"id"`
+	Type			string		`json:"type"`
+	TradeId			string		`json:"tradeId"`
+	Applicant		string		`json:"applicant"`
+	Beneficiary		string		`json:"beneficiary"`
+	Guarantor		string		`json:"guarantor"`
+	Amount			int		`json:"amount"`
+	ExpirationDate		string		`json:"expirationDate"`
+	ClaimAmount		int		`json:"claimAmount"`
+	Status			string		`json:"status"`
+}
+
+type FacilityDrawing struct {
+	Counterparty		string		`json:"counterparty"`
+	Amount			int		`json:"amount"`
+}
+
+type CreditFacility struct {
+	Importer		string				`json:"importer"`
+	Bank			string				`json:"bank"`
+	Limit			int				`json:"limit"`
+	SingleTradeCap		int				`json:"singleTradeCap"`
+	CounterpartyLimits	map[string]int			`json:"counterpartyLimits"`
+	Utilisation		int				`json:"utilisation"`
+	CounterpartyUtilisation	map[string]int			`json:"counterpartyUtilisation"`
+	Drawings		map[string]*FacilityDrawing	`json:"drawings"`
+}
+
+// The exporter's grant of some of its workflow steps to another organization, or to one identity in it
+type Delegation struct {
+	Id			string		`json:"id"`
+	Delegator		string		`json:"delegator"`
+	DelegateOrg		string		`json:"delegateOrg"`
+	DelegateIdentity	string		`json:"delegateIdentity"`
+	Actions			[]string	`json:"actions"`
+	TradeId			string		`json:"tradeId"`
+	ValidFrom		string		`json:"validFrom"`
+	ValidUntil		string		`json:"validUntil"`
+	Status			string		`json:"status"`
+}
+
+// Actions of a bank above the threshold amount need the approval of the required number of distinct approvers
+type ApprovalPolicy struct {
+	Bank			string		`json:"bank"`
+	Threshold		int		`json:"threshold"`
+	RequiredApprovals	int		`json:"requiredApprovals"`
+}
+
+type Proposal struct {
+	Id			string		`json:"id"`
+	Action			string		`json:"action"`
+	Args			[]string	`json:"args"`
+	Amount			int		`json:"amount"`
+	Bank			string		`json:"bank"`
+	ProposedBy		string		`json:"proposedBy"`
+	RequiredApprovals	int		`json:"requiredApprovals"`
+	Approvals		[]string	`json:"approvals"`
+	Status			string		`json:"status"`
+}
+
+// A time draft accepted by the issuing bank under a usance L/C, payable at maturity
+type Draft struct {
+	TradeId			string		`json:"tradeId"`
+	Amount			int		`json:"amount"`
+	AcceptanceDate		string		`json:"acceptanceDate"`
+	MaturityDate		string		`json:"maturityDate"`
+	DiscountedBy		string		`json:"discountedBy"`
+	Discount		int		`json:"discount"`
+	Status			string		`json:"status"`
+}
+
+// One of several shipments of the goods of a trade, carrying its share of the quantity and amount
+type Lot struct {
+	Id			string		`json:"id"`
+	TradeId			string		`json:"tradeId"`
+	Quantity		int		`json:"quantity"`
+	Amount			int		`json:"amount"`
+	Location		string		`json:"location"`
+	Payment			int		`json:"payment"`
+}
+
+// A bank's charge for one of its services
+type Fee struct {
+	Type			string		`json:"type"`
+	Rate			int		`json:"rate"`
+	Minimum			int		`json:"minimum"`
+	Maximum			int		`json:"maximum"`
+	BorneBy			string		`json:"borneBy"`
+}
+
+// The fees a bank charges, by service
+type FeeSchedule struct {
+	Bank			string		`json:"bank"`
+	Fees			map[string]*Fee	`json:"fees"`
+}
+
+// A fee assessed on a trade
+type Charge struct {
+	Service			string		`json:"service"`
+	Bank			string		`json:"bank"`
+	Amount			int		`json:"amount"`
+	BorneBy			string		`json:"borneBy"`
+	Date			string		`json:"date"`
+}
+
+type ChargesStatement struct {
+	TradeId			string		`json:"tradeId"`
+	Charges			[]*Charge	`json:"charges"`
+	ApplicantTotal		int		`json:"applicantTotal"`
+	BeneficiaryTotal	int		`json:"beneficiaryTotal"`
+}
+
+// A registered source of exchange rates, identified by the key it signs its rates with
+type RatePublisher struct {
+	Id			string		`json:"id"`
+	PublicKey		string		`json:"publicKey"`
+	Status			string		`json:"status"`
+}
+
+// An exchange rate signed by a rate publisher: one unit of the base currency buys Rate / FX_RATE_SCALE units of the quote currency
+type FXRate struct {
+	Publisher		string		`json:"publisher"`
+	BaseCurrency		string		`json:"baseCurrency"`
+	QuoteCurrency		string		`json:"quoteCurrency"`
+	Rate			int		`json:"rate"`
+	ValidFrom		string		`json:"validFrom"`
+	ValidUntil		string		`json:"validUntil"`
+	Signature		string		`json:"signature"`
+}
+
+// The exporter's commercial invoice for a trade; once the B/L is issued it is a receivable that may be sold to a financier
+type Invoice struct {
+	Id			string		`json:"id"`
+	TradeId			string		`json:"tradeId"`
+	Exporter		string		`json:"exporter"`
+	Importer		string		`json:"importer"`
+	DescriptionOfGoods	string		`json:"descriptionOfGoods"`
+	Amount			int		`json:"amount"`
+	IssueDate		string		`json:"issueDate"`
+	AskingPrice		int		`json:"askingPrice"`
+	Financier		string		`json:"financier"`
+	PurchasePrice		int		`json:"purchasePrice"`
+	AssignmentDate		string		`json:"assignmentDate"`
+	Repaid			int		`json:"repaid"`
+	Status			string		`json:"status"`
+}
+
+// Funds set aside from the applicant's account when an L/C is issued; Margin is the percentage of the L/C amount
+// escrowed, and Amount and Balance are in the currency of the applicant's account
+type Escrow struct {
+	TradeId			string		`json:"tradeId"`
+	LcId			string		`json:"lcId"`
+	Margin			int		`json:"margin"`
+	Amount			int		`json:"amount"`
+	Balance			int		`json:"balance"`
+	Status			string		`json:"status"`
+}
+
+// Certificate of the cargo insurance of a trade; Coverage names the insured risks, e.g. the Institute Cargo Clauses
+type InsuranceCertificate struct {
+	Id			string		`json:"id"`
+	TradeId			string		`json:"tradeId"`
+	Insurer			string		`json:"insurer"`
+	PolicyId		string		`json:"policyId"`
+	InsuredValue		int		`json:"insuredValue"`
+	Coverage		string		`json:"coverage"`
+	ValidFrom		string		`json:"validFrom"`
+	ValidUntil		string		`json:"validUntil"`
+	ClaimAmount		int		`json:"claimAmount"`
+	ClaimReason		string		`json:"claimReason"`
+	Status			string		`json:"status"`
+}
+
+// The documents called for by the L/C of a trade, by whether they have been presented; those not tracked on the ledger are unverified
+type Presentation struct {
+	TradeId			string		`json:"tradeId"`
+	Presented		[]string	`json:"presented"`
+	Missing			[]string	`json:"missing"`
+	Unverified		[]string	`json:"unverified"`
+}
+
+// An organization registered to certify trades, e.g. a chamber of commerce or an inspection agency; its members are
+// identified by their MSP and the common name of the issuing CA
+type CertificateIssuer struct {
+	Id			string		`json:"id"`
+	MspId			string		`json:"mspId"`
+	CaName			string		`json:"caName"`
+	CertificateTypes	[]string	`json:"certificateTypes"`
+	Status			string		`json:"status"`
+}
+
+// A certificate issued by a third party for a trade; the document itself is kept off-chain and only its SHA-256 digest is recorded
+type TradeCertificate struct {
+	Id			string		`json:"id"`
+	TradeId			string		`json:"tradeId"`
+	Type			string		`json:"type"`
+	Issuer			string		`json:"issuer"`
+	DocumentHash		string		`json:"documentHash"`
+	IssueDate		string		`json:"issueDate"`
+	Status			string		`json:"status"`
+}
+
+// A file attached to a trade that is not one of the documents tracked on the ledger, e.g. an invoice or a packing list
+type Attachment struct {
+	TradeId			string		`json:"tradeId"`
+	Name			string		`json:"name"`
+	Content			*DocumentContent	`json:"content"`
+}
+
+// Index from the digest of a file to the document record it was anchored to
+type DocumentAnchor struct {
+	TradeId			string		`json:"tradeId"`
+	Record			string		`json:"record"`
+	Document		string		`json:"document"`
+	Id			string		`json:"id"`
+	Content			*DocumentContent	`json:"content"`
+	LotId			string		`json:"lotId,omitempty"`
+}
+
+// What the ledger knows about a file, identified by its digest
+type DocumentVerification struct {
+	Hash			string		`json:"hash"`
+	TradeId			string		`json:"tradeId"`
+	Document		string		`json:"document"`
+	Id			string		`json:"id"`
+	MimeType		string		`json:"mimeType,omitempty"`
+	Uri			string		`json:"uri,omitempty"`
+	Status			string		`json:"status,omitempty"`
+	Valid			bool		`json:"valid"`
+}
+
+// A party's signature over the canonical serialisation of a document it issued
+type DocumentSignature struct {
+	TradeId			string		`json:"tradeId"`
+	Document		string		`json:"document"`
+	Signer			string		`json:"signer"`
+	MspId			string		`json:"mspId"`
+	Certificate		string		`json:"certificate"`
+	Signature		string		`json:"signature"`
+	SignedAt		string		`json:"signedAt"`
+	PayloadVersion		int		`json:"payloadVersion"`
 }
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"errors"
+	"strconv"
+	"encoding/json"
+)
+
+// Assets are stored in a canonical JSON encoding, so that the bytes of a record depend only on its contents
+// and can be hashed or signed:
+//  - objects carry no insignificant whitespace, and their keys are sorted by byte value
+//  - numbers are integers, written in decimal without exponent; fractions are rejected
+//  - strings are escaped as by encoding/json, except that '<', '>' and '&' are written as is
+//  - every asset record carries its schema version in a "schemaVersion" field
+// The encoding does not depend on the declaration order of struct fields, so adding or reordering fields
+// changes the bytes of a record only by the fields it adds.
+
+// Encode a decoded value canonically
+func encodeCanonical(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	err := checkCanonicalNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// Decode a JSON value, keeping numbers as written
+func decodeCanonical(value []byte) (interface{}, error) {
+	var decoded interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	err := decoder.Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// Re-encode marshaled JSON canonically
+func canonicalizeJSON(value []byte) ([]byte, error) {
+	decoded, err := decodeCanonical(value)
+	if err != nil {
+		return nil, err
+	}
+	return encodeCanonical(decoded)
+}
+
+func checkCanonicalNumbers(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, field := range v {
+			err := checkCanonicalNumbers(field)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, element := range v {
+			err := checkCanonicalNumbers(element)
+			if err != nil {
+				return err
+			}
+		}
+	case json.Number:
+		_, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Number %s is not an integer", string(v)))
+		}
+	case float32, float64:
+		return errors.New(fmt.Sprintf("Number %v is not an integer", v))
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"time"
+	"strings"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupCertificateIssuer(stub shim.ChaincodeStubInterface, issuerID string) (string, *CertificateIssuer, error) {
+	var certificateIssuer *CertificateIssuer
+
+	certificateIssuerKey, err := getCertificateIssuerKey(stub, issuerID)
+	if err != nil {
+		return "", nil, err
+	}
+	certificateIssuerBytes, err := getAssetState(stub, certificateIssuerKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(certificateIssuerBytes) == 0 {
+		return certificateIssuerKey, nil, nil
+	}
+
+	err = json.Unmarshal(certificateIssuerBytes, &certificateIssuer)
+	if err != nil {
+		return "", nil, err
+	}
+	return certificateIssuerKey, certificateIssuer, nil
+}
+
+func putCertificateIssuer(stub shim.ChaincodeStubInterface, certificateIssuerKey string, certificateIssuer *CertificateIssuer) error {
+	certificateIssuerBytes, err := json.Marshal(certificateIssuer)
+	if err != nil {
+		return errors.New("Error marshaling certificate issuer structure")
+	}
+	return putAssetState(stub, certificateIssuerKey, certificateIssuerBytes)
+}
+
+func lookupTradeCertificate(stub shim.ChaincodeStubInterface, tradeID string, certificateID string) (string, *TradeCertificate, error) {
+	var tradeCertificate *TradeCertificate
+
+	tradeCertificateKey, err := getTradeCertificateKey(stub, tradeID, certificateID)
+	if err != nil {
+		return "", nil, err
+	}
+	tradeCertificateBytes, err := getAssetState(stub, tradeCertificateKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(tradeCertificateBytes) == 0 {
+		return tradeCertificateKey, nil, nil
+	}
+
+	err = json.Unmarshal(tradeCertificateBytes, &tradeCertificate)
+	if err != nil {
+		return "", nil, err
+	}
+	return tradeCertificateKey, tradeCertificate, nil
+}
+
+func putTradeCertificate(stub shim.ChaincodeStubInterface, tradeCertificateKey string, tradeCertificate *TradeCertificate) error {
+	tradeCertificateBytes, err := json.Marshal(tradeCertificate)
+	if err != nil {
+		return errors.New("Error marshaling certificate structure")
+	}
+	return putAssetState(stub, tradeCertificateKey, tradeCertificateBytes)
+}
+
+func getTradeCertificates(stub shim.ChaincodeStubInterface, tradeID string) ([]*TradeCertificate, error) {
+	var tradeCertificate *TradeCertificate
+
+	certificatesIterator, err := stub.GetStateByPartialCompositeKey("TradeCertificate", []string{tradeID})
+	if err != nil {
+		return nil, err
+	}
+	defer certificatesIterator.Close()
+
+	tradeCertificates := []*TradeCertificate{}
+	for certificatesIterator.HasNext() {
+		certificateKV, err := certificatesIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := upgradeAssetState(stub, certificateKV.Key, certificateKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(value, &tradeCertificate)
+		if err != nil {
+			return nil, err
+		}
+		tradeCertificates = append(tradeCertificates, tradeCertificate)
+		tradeCertificate = nil
+	}
+	return tradeCertificates, nil
+}
+
+// Whether any registered issuer certifies documents of the given type
+func isCertificateType(stub shim.ChaincodeStubInterface, certificateType string) (bool, error) {
+	var certificateIssuer *CertificateIssuer
+
+	issuersIterator, err := stub.GetStateByPartialCompositeKey("CertificateIssuer", []string{})
+	if err != nil {
+		return false, err
+	}
+	defer issuersIterator.Close()
+
+	for issuersIterator.HasNext() {
+		issuerKV, err := issuersIterator.Next()
+		if err != nil {
+			return false, err
+		}
+		value, err := upgradeAssetState(stub, issuerKV.Key, issuerKV.Value)
+		if err != nil {
+			return false, err
+		}
+		err = json.Unmarshal(value, &certificateIssuer)
+		if err != nil {
+			return false, err
+		}
+		if containsString(certificateIssuer.CertificateTypes, certificateType) {
+			return true, nil
+		}
+		certificateIssuer = nil
+	}
+	return false, nil
+}
+
+// Whether a certificate of the given type stands for the trade, i.e. has been issued and not revoked
+func isTradeCertified(stub shim.ChaincodeStubInterface, tradeID string, certificateType string) (bool, error) {
+	tradeCertificates, err := getTradeCertificates(stub, tradeID)
+	if err != nil {
+		return false, err
+	}
+	for _, tradeCertificate := range tradeCertificates {
+		if tradeCertificate.Type == certificateType && tradeCertificate.Status == ISSUED {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Split an optional trailing Require=<type>[,<type>...] argument from the arguments of a payment request or presentation query
+func splitRequiredCertificates(args []string) ([]string, []string, error) {
+	if len(args) == 0 {
+		return args, nil, nil
+	}
+	parts := strings.SplitN(args[len(args) - 1], "=", 2)
+	if len(parts) != 2 || parts[0] != REQUIRE_ARG {
+		return args, nil, nil
+	}
+
+	requiredTypes := []string{}
+	for _, certificateType := range strings.Split(parts[1], ",") {
+		if certificateType == "" {
+			return nil, nil, errors.New(fmt.Sprintf("Invalid certificate types %s", parts[1]))
+		}
+		if certificateType == LETTER_OF_CREDIT_DOC || certificateType == EXPORT_LICENSE_DOC || certificateType == BILL_OF_LADING_DOC || certificateType == INSURANCE_CERTIFICATE_DOC {
+			return nil, nil, errors.New(fmt.Sprintf("Documents of type %s are not issued as third-party certificates", certificateType))
+		}
+		if !containsString(requiredTypes, certificateType) {
+			requiredTypes = append(requiredTypes, certificateType)
+		}
+	}
+	return args[:len(args) - 1], requiredTypes, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Members of a certificate issuer's organization act for it
+func authenticateCertificateIssuer(certificateIssuer *CertificateIssuer, mspID string, certCN string) bool {
+	return mspID == certificateIssuer.MspId && certCN == certificateIssuer.CaName
+}
+
+// Register an organization as an issuer of certificates of the given types, or revise its registration
+func (t *TradeWorkflowChaincode) registerCertificateIssuer(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var certificateIssuerKey string
+	var err error
+
+	// Access control: Only a Regulator Org member can invoke this transaction
+	if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Regulator Org. Access denied.")
+	}
+
+	if len(args) < 4 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting at least 4: {Issuer ID, MSP ID, CA Name, Certificate Type} [Certificate Type...]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// The documents the ledger tracks in their own right cannot be certified by a third party
+	for _, certificateType := range args[3:] {
+		if certificateType == LETTER_OF_CREDIT_DOC || certificateType == EXPORT_LICENSE_DOC || certificateType == BILL_OF_LADING_DOC || certificateType == INSURANCE_CERTIFICATE_DOC {
+			err = errors.New(fmt.Sprintf("Documents of type %s are not issued as third-party certificates", certificateType))
+			return shim.Error(err.Error())
+		}
+	}
+
+	certificateIssuerKey, err = getCertificateIssuerKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putCertificateIssuer(stub, certificateIssuerKey, &CertificateIssuer{args[0], args[1], args[2], args[3:], ACTIVE})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Certificate issuer %s registered for %v\n", args[0], args[3:])
+
+	return shim.Success(nil)
+}
+
+// Revoke the registration of a certificate issuer; certificates it has already issued stand until revoked
+func (t *TradeWorkflowChaincode) revokeCertificateIssuer(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var certificateIssuerKey string
+	var certificateIssuer *CertificateIssuer
+	var err error
+
+	// Access control: Only a Regulator Org member can invoke this transaction
+	if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Regulator Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Issuer ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	certificateIssuerKey, certificateIssuer, err = lookupCertificateIssuer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if certificateIssuer == nil {
+		err = errors.New(fmt.Sprintf("No certificate issuer %s registered", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	certificateIssuer.Status = REVOKED
+	err = putCertificateIssuer(stub, certificateIssuerKey, certificateIssuer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Certificate issuer %s revoked\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Issue a certificate for a trade, recording the digest of the certificate document
+func (t *TradeWorkflowChaincode) issueCertificate(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeCertificateKey string
+	var certificateIssuer *CertificateIssuer
+	var tradeCertificate *TradeCertificate
+	var txTime time.Time
+	var err error
+
+	if len(args) != 5 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 5: {Trade ID, Certificate ID, Issuer ID, Certificate Type, Document Hash}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	_, certificateIssuer, err = lookupCertificateIssuer(stub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if certificateIssuer == nil || certificateIssuer.Status != ACTIVE {
+		err = errors.New(fmt.Sprintf("No active certificate issuer %s registered", args[2]))
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the issuer's Org can invoke this transaction
+	if !t.testMode && !authenticateCertificateIssuer(certificateIssuer, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the certificate issuer's Org. Access denied.")
+	}
+
+	if !containsString(certificateIssuer.CertificateTypes, args[3]) {
+		err = errors.New(fmt.Sprintf("Certificate issuer %s is not registered to issue %s certificates", args[2], args[3]))
+		return shim.Error(err.Error())
+	}
+	if !isValidEvidenceHash(args[4]) {
+		err = errors.New(fmt.Sprintf("Invalid document hash %s; expecting a hex-encoded SHA-256 digest", args[4]))
+		return shim.Error(err.Error())
+	}
+
+	// Verify that the certified trade exists
+	_, _, err = lookupTradeAgreement(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	tradeCertificateKey, tradeCertificate, err = lookupTradeCertificate(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if tradeCertificate != nil {
+		err = errors.New(fmt.Sprintf("Certificate %s already issued for trade %s", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tradeCertificate = &TradeCertificate{args[1], args[0], args[3], args[2], args[4], txTime.Format(time.RFC3339), ISSUED}
+	err = putTradeCertificate(stub, tradeCertificateKey, tradeCertificate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putDocumentAnchor(stub, args[0], "TradeCertificate", args[3], args[1], "", &DocumentContent{strings.ToLower(args[4]), "", ""})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("%s certificate %s issued by %s for trade %s\n", args[3], args[1], args[2], args[0])
+
+	return shim.Success(nil)
+}
+
+// Revoke a certificate issued for a trade
+func (t *TradeWorkflowChaincode) revokeCertificate(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeCertificateKey string
+	var certificateIssuer *CertificateIssuer
+	var tradeCertificate *TradeCertificate
+	var err error
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Certificate ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	tradeCertificateKey, tradeCertificate, err = lookupTradeCertificate(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if tradeCertificate == nil {
+		err = errors.New(fmt.Sprintf("No certificate %s found for trade %s", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the issuer's Org can invoke this transaction
+	_, certificateIssuer, err = lookupCertificateIssuer(stub, tradeCertificate.Issuer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !t.testMode && (certificateIssuer == nil || !authenticateCertificateIssuer(certificateIssuer, creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of the certificate issuer's Org. Access denied.")
+	}
+
+	if tradeCertificate.Status == REVOKED {
+		fmt.Printf("Certificate %s for trade %s already revoked", args[1], args[0])
+		return shim.Success(nil)
+	}
+
+	tradeCertificate.Status = REVOKED
+	err = putTradeCertificate(stub, tradeCertificateKey, tradeCertificate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Certificate %s for trade %s revoked\n", args[1], args[0])
+
+	return shim.Success(nil)
+}
+
+// Get the certificates issued for a trade
+func (t *TradeWorkflowChaincode) getCertificates(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeCertificates []*TradeCertificate
+	var tradeCertificatesBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	tradeCertificates, err = getTradeCertificates(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tradeCertificatesBytes, err = json.Marshal(tradeCertificates)
+	if err != nil {
+		return shim.Error("Error marshaling certificates")
+	}
+	fmt.Printf("Query Response:%s\n", string(tradeCertificatesBytes))
+	return shim.Success(tradeCertificatesBytes)
+}
@@ -26,6 +26,9 @@ const (
 	impBalKey	= "ImportersAccountBalance"
 	carKey		= "Carrier"
 	raKey		= "RegulatoryAuthority"
+	insKey		= "Insurer"
+	insMspKey	= "InsurerMSP"
+	insCAKey	= "InsurerCA"
 )
 
 // State values
@@ -33,6 +36,41 @@ const (
 	REQUESTED	= "REQUESTED"
 	ISSUED		= "ISSUED"
 	ACCEPTED	= "ACCEPTED"
+	PAID		= "PAID"
+	SURRENDERED	= "SURRENDERED"
+	DELIVERED	= "DELIVERED"
+	COMPLETED	= "COMPLETED"
+	OPEN		= "OPEN"
+	PROPOSED	= "PROPOSED"
+	RESOLVED	= "RESOLVED"
+	OVERDUE		= "OVERDUE"
+	DEFAULTED	= "DEFAULTED"
+	CLAIMED		= "CLAIMED"
+	EXPIRED		= "EXPIRED"
+	CANCELLED	= "CANCELLED"
+	ACTIVE		= "ACTIVE"
+	REVOKED		= "REVOKED"
+	PENDING		= "PENDING"
+	APPROVED	= "APPROVED"
+	WITHDRAWN	= "WITHDRAWN"
+	DISCOUNTED	= "DISCOUNTED"
+	OFFERED		= "OFFERED"
+	FINANCED	= "FINANCED"
+	REPAID		= "REPAID"
+	RELEASED	= "RELEASED"
+	SUPERSEDED	= "SUPERSEDED"
+)
+
+// ID given to a payment request recorded by the original chaincode, which carried none
+const (
+	LEGACY_PAYMENT_REQUEST_ID	= "legacy"
+)
+
+// Workflow steps bound by a deadline
+const (
+	LC_ISSUANCE_STEP	= "LC_ISSUANCE"
+	SHIPMENT_STEP		= "SHIPMENT"
+	PAYMENT_STEP		= "PAYMENT"
 )
 
 // Location values
@@ -40,3 +78,137 @@ const (
 	SOURCE		= "SOURCE"
 	DESTINATION	= "DESTINATION"
 )
+
+// Condition of goods on receipt
+const (
+	GOOD		= "GOOD"
+	DAMAGED		= "DAMAGED"
+	SHORT		= "SHORT"
+)
+
+// Dispute parties
+const (
+	IMPORTER_PARTY		= "importer"
+	IMPORTERS_BANK_PARTY	= "importersbank"
+	EXPORTER_PARTY		= "exporter"
+	EXPORTERS_BANK_PARTY	= "exportersbank"
+	ARBITER_PARTY		= "arbiter"
+)
+
+// Dispute reason codes
+const (
+	GOODS_DAMAGED		= "GOODS_DAMAGED"
+	GOODS_SHORT		= "GOODS_SHORT"
+	NON_DELIVERY		= "NON_DELIVERY"
+	DOCUMENT_DISCREPANCY	= "DOCUMENT_DISCREPANCY"
+	NON_PAYMENT		= "NON_PAYMENT"
+	OTHER			= "OTHER"
+)
+
+// Guarantee instrument types
+const (
+	STANDBY_LC		= "STANDBY_LC"
+	DEMAND_GUARANTEE	= "DEMAND_GUARANTEE"
+)
+
+// Types of L/C issued against another L/C
+const (
+	TRANSFERRED		= "TRANSFERRED"
+	BACK_TO_BACK		= "BACK_TO_BACK"
+)
+
+// Ledger-configured features
+const (
+	EXPORTING_ENTITY_FEATURE	= "ExportingEntity"
+	ROLE_RESET_FEATURE		= "RoleReset"
+)
+
+// Documents tracked on the ledger; an L/C may call for any of them but itself
+const (
+	LETTER_OF_CREDIT_DOC		= "L/C"
+	EXPORT_LICENSE_DOC		= "E/L"
+	BILL_OF_LADING_DOC		= "B/L"
+	INSURANCE_CERTIFICATE_DOC	= "I/C"
+)
+
+// Ledger-configured settings that take a value rather than on or off
+const (
+	TOKEN_CHAINCODE_SETTING		= "TokenChaincode"
+	ESCROW_MARGIN_SETTING		= "EscrowMargin"
+	STATE_FORMAT_SETTING		= "StateFormat"
+)
+
+// Encodings of asset records and query responses
+const (
+	JSON_FORMAT		= "json"
+	PROTOBUF_FORMAT		= "protobuf"
+)
+
+// Feature settings
+const (
+	FEATURE_ON		= "on"
+	FEATURE_OFF		= "off"
+)
+
+// Exporter's workflow steps that can be delegated
+const (
+	ACCEPT_TRADE_ACTION		= "acceptTrade"
+	REQUEST_EL_ACTION		= "requestEL"
+	PREPARE_SHIPMENT_ACTION		= "prepareShipment"
+	REQUEST_PAYMENT_ACTION		= "requestPayment"
+)
+
+// Bank actions that may require the approval of several identities
+const (
+	ISSUE_LC_ACTION		= "issueLC"
+	ACCEPT_LC_ACTION	= "acceptLC"
+	MAKE_PAYMENT_ACTION	= "makePayment"
+	PAY_LOT_ACTION		= "payLot"
+)
+
+// Services of the advising and confirming banks nominated in an L/C, which may carry a fee
+const (
+	ADVISE_LC_SERVICE	= "adviseLC"
+	CONFIRM_LC_SERVICE	= "confirmLC"
+)
+
+// Ways a bank fee is calculated; percentages are given in basis points
+const (
+	FLAT_FEE		= "flat"
+	PERCENTAGE_FEE		= "percentage"
+)
+
+// Parties that may bear a bank fee
+const (
+	APPLICANT		= "applicant"
+	BENEFICIARY		= "beneficiary"
+)
+
+// Exchange rates are fixed-point numbers with six decimal places
+const FX_RATE_SCALE = 1000000
+
+// Certificate attribute of the identities that may approve bank actions
+const APPROVER_ATTRIBUTE = "approver"
+
+// Discount rates are quoted in basis points per annum, on a 360-day year
+const DAYS_PER_YEAR = 360
+
+// Optional trailing argument of a document issuance, as 'Signature=<base64>', carrying the issuer's signature
+const SIGNATURE_ARG = "Signature"
+
+// Trailing argument of a held issuance, as 'SignedBy=<JSON>', carrying the signature verified when it was proposed
+const HELD_SIGNATURE_ARG = "SignedBy"
+
+// Versions of the serialisation a document is signed in: plain JSON, as marshaled with HTML characters escaped,
+// for the signatures recorded before assets were stored canonically, and canonical JSON since
+const (
+	JSON_SIGNING_PAYLOAD		= 0
+	CANONICAL_SIGNING_PAYLOAD	= 1
+)
+
+// Optional trailing argument of a payment request, as 'Require=<type>[,<type>...]', naming third-party certificate types
+// that must have been issued for the trade whether or not the L/C calls for them
+const REQUIRE_ARG = "Require"
+
+// Optional trailing argument of a query, as 'Format=json|protobuf', choosing the encoding of its response
+const FORMAT_ARG = "Format"
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type CreditFacilityStatus struct {
+	*CreditFacility
+	Headroom		int		`json:"headroom"`
+}
+
+// Lookup the credit facility of an importer; a nil facility means the importer's bank has not imposed limits
+func lookupCreditFacility(stub shim.ChaincodeStubInterface, importer string) (string, *CreditFacility, error) {
+	var creditFacility *CreditFacility
+
+	creditFacilityKey, err := getCreditFacilityKey(stub, importer)
+	if err != nil {
+		return "", nil, err
+	}
+	creditFacilityBytes, err := getAssetState(stub, creditFacilityKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(creditFacilityBytes) == 0 {
+		return creditFacilityKey, nil, nil
+	}
+
+	err = json.Unmarshal(creditFacilityBytes, &creditFacility)
+	if err != nil {
+		return "", nil, err
+	}
+	return creditFacilityKey, creditFacility, nil
+}
+
+// Lookup the credit facility of the importer recorded on the ledger
+func lookupImporterCreditFacility(stub shim.ChaincodeStubInterface) (string, *CreditFacility, error) {
+	importerBytes, err := stub.GetState(impKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return lookupCreditFacility(stub, string(importerBytes))
+}
+
+func putCreditFacility(stub shim.ChaincodeStubInterface, creditFacilityKey string, creditFacility *CreditFacility) error {
+	creditFacilityBytes, err := json.Marshal(creditFacility)
+	if err != nil {
+		return errors.New("Error marshaling credit facility structure")
+	}
+	return putAssetState(stub, creditFacilityKey, creditFacilityBytes)
+}
+
+// Check an amount against the single trade cap, the overall limit and the counterparty limit, reporting the headroom on a breach
+func checkCreditHeadroom(creditFacility *CreditFacility, counterparty string, amount int) error {
+	if amount > creditFacility.SingleTradeCap {
+		return errors.New(fmt.Sprintf("Amount %d exceeds the single trade cap %d for importer %s", amount, creditFacility.SingleTradeCap, creditFacility.Importer))
+	}
+
+	headroom := creditFacility.Limit - creditFacility.Utilisation
+	if amount > headroom {
+		return errors.New(fmt.Sprintf("Amount %d exceeds the credit limit for importer %s; remaining headroom %d", amount, creditFacility.Importer, headroom))
+	}
+
+	counterpartyLimit, ok := creditFacility.CounterpartyLimits[counterparty]
+	if ok {
+		headroom = counterpartyLimit - creditFacility.CounterpartyUtilisation[counterparty]
+		if amount > headroom {
+			return errors.New(fmt.Sprintf("Amount %d exceeds the credit limit for importer %s with counterparty %s; remaining headroom %d", amount, creditFacility.Importer, counterparty, headroom))
+		}
+	}
+	return nil
+}
+
+// Draw on the importer's credit facility for a trade's L/C
+func drawCredit(stub shim.ChaincodeStubInterface, tradeID string, amount int) error {
+	creditFacilityKey, creditFacility, err := lookupImporterCreditFacility(stub)
+	if err != nil || creditFacility == nil {
+		return err
+	}
+
+	exporterBytes, err := stub.GetState(expKey)
+	if err != nil {
+		return err
+	}
+	counterparty := string(exporterBytes)
+
+	err = checkCreditHeadroom(creditFacility, counterparty, amount)
+	if err != nil {
+		return err
+	}
+
+	creditFacility.Utilisation += amount
+	creditFacility.CounterpartyUtilisation[counterparty] += amount
+	creditFacility.Drawings[tradeID] = &FacilityDrawing{counterparty, amount}
+	return putCreditFacility(stub, creditFacilityKey, creditFacility)
+}
+
+// Release up to the given amount drawn for a trade back into the importer's credit facility
+func releaseCredit(stub shim.ChaincodeStubInterface, tradeID string, amount int) error {
+	creditFacilityKey, creditFacility, err := lookupImporterCreditFacility(stub)
+	if err != nil || creditFacility == nil {
+		return err
+	}
+
+	drawing, ok := creditFacility.Drawings[tradeID]
+	if !ok {
+		return nil
+	}
+	if amount > drawing.Amount {
+		amount = drawing.Amount
+	}
+
+	creditFacility.Utilisation -= amount
+	creditFacility.CounterpartyUtilisation[drawing.Counterparty] -= amount
+	if creditFacility.CounterpartyUtilisation[drawing.Counterparty] == 0 {
+		delete(creditFacility.CounterpartyUtilisation, drawing.Counterparty)
+	}
+	drawing.Amount -= amount
+	if drawing.Amount == 0 {
+		delete(creditFacility.Drawings, tradeID)
+	}
+	return putCreditFacility(stub, creditFacilityKey, creditFacility)
+}
+
+// Set up or revise the credit facility of the importer; utilisation is carried over
+func (t *TradeWorkflowChaincode) setCreditFacility(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var creditFacilityKey string
+	var importerBytes, bankBytes []byte
+	var creditFacility *CreditFacility
+	var limit, singleTradeCap, counterpartyLimit int
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	}
+
+	if len(args) < 2 || len(args) % 2 != 0 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting at least 2: {Limit, Single Trade Cap} [Counterparty, Counterparty Limit]... Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	limit, err = strconv.Atoi(string(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	singleTradeCap, err = strconv.Atoi(string(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if limit < 0 || singleTradeCap < 0 {
+		return shim.Error("Credit limits may not be negative")
+	}
+
+	// Lookup importer and importer's bank
+	importerBytes, err = stub.GetState(impKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bankBytes, err = stub.GetState(ibKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creditFacilityKey, creditFacility, err = lookupCreditFacility(stub, string(importerBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if creditFacility == nil {
+		creditFacility = &CreditFacility{string(importerBytes), string(bankBytes), 0, 0, nil, 0, map[string]int{}, map[string]*FacilityDrawing{}}
+	}
+
+	creditFacility.Limit = limit
+	creditFacility.SingleTradeCap = singleTradeCap
+	creditFacility.CounterpartyLimits = map[string]int{}
+	for i := 2; i < len(args); i += 2 {
+		counterpartyLimit, err = strconv.Atoi(string(args[i + 1]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if counterpartyLimit < 0 {
+			return shim.Error("Credit limits may not be negative")
+		}
+		creditFacility.CounterpartyLimits[args[i]] = counterpartyLimit
+	}
+
+	// Write the state to the ledger
+	err = putCreditFacility(stub, creditFacilityKey, creditFacility)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Credit facility for importer %s recorded: limit %d, single trade cap %d\n", creditFacility.Importer, limit, singleTradeCap)
+
+	return shim.Success(nil)
+}
+
+// Get the credit facility of the importer, with its utilisation and remaining headroom
+func (t *TradeWorkflowChaincode) getCreditFacility(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var creditFacilityKey, jsonResp string
+	var creditFacility *CreditFacility
+	var creditFacilityStatusBytes []byte
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	}
+
+	if len(args) != 0 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Get the state from the ledger
+	creditFacilityKey, creditFacility, err = lookupImporterCreditFacility(stub)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + creditFacilityKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	if creditFacility == nil {
+		jsonResp = "{\"Error\":\"No record found for " + creditFacilityKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	creditFacilityStatusBytes, err = json.Marshal(&CreditFacilityStatus{creditFacility, creditFacility.Limit - creditFacility.Utilisation})
+	if err != nil {
+		return shim.Error("Error marshaling credit facility structure")
+	}
+	fmt.Printf("Query Response:%s\n", string(creditFacilityStatusBytes))
+	return shim.Success(creditFacilityStatusBytes)
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type OverdueTrade struct {
+	TradeID			string		`json:"tradeId"`
+	Step			string		`json:"step"`
+	Deadline		string		`json:"deadline"`
+	Status			string		`json:"status"`
+}
+
+// The transaction timestamp is set by the client in the proposal and checked by the endorsers,
+// which makes it the only notion of time that all peers agree on
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+// Parse and validate the deadlines for L/C issuance, shipment and payment, in that order
+func getDeadlines(stub shim.ChaincodeStubInterface, args []string) (*Deadlines, error) {
+	var deadlines []time.Time
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		deadline, err := time.Parse(time.RFC3339, arg)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid deadline %s; expecting an RFC 3339 timestamp", arg))
+		}
+		if !deadline.After(txTime) {
+			return nil, errors.New(fmt.Sprintf("Deadline %s is not later than the transaction time %s", arg, txTime.Format(time.RFC3339)))
+		}
+		if len(deadlines) > 0 && deadline.Before(deadlines[len(deadlines) - 1]) {
+			return nil, errors.New(fmt.Sprintf("Deadline %s precedes the deadline of the previous step", arg))
+		}
+		deadlines = append(deadlines, deadline)
+	}
+
+	return &Deadlines{args[0], args[1], args[2]}, nil
+}
+
+// Determine which deadline-bound step the trade is waiting for, and its deadline
+func getNextTradeStep(stub shim.ChaincodeStubInterface, tradeID string, tradeAgreement *TradeAgreement) (string, string, error) {
+	var letterOfCredit *LetterOfCredit
+
+	if tradeAgreement.Deadlines == nil || tradeAgreement.Status == COMPLETED {
+		return "", "", nil
+	}
+
+	lcKey, err := getLCKey(stub, tradeID)
+	if err != nil {
+		return "", "", err
+	}
+	letterOfCreditBytes, err := getAssetState(stub, lcKey)
+	if err != nil {
+		return "", "", err
+	}
+	if len(letterOfCreditBytes) == 0 {
+		return LC_ISSUANCE_STEP, tradeAgreement.Deadlines.LCIssuance, nil
+	}
+	err = json.Unmarshal(letterOfCreditBytes, &letterOfCredit)
+	if err != nil {
+		return "", "", err
+	}
+	if letterOfCredit.Status == REQUESTED {
+		return LC_ISSUANCE_STEP, tradeAgreement.Deadlines.LCIssuance, nil
+	}
+
+	// The goods are shipped when the carrier issues the B/L
+	blKey, err := getBLKey(stub, tradeID)
+	if err != nil {
+		return "", "", err
+	}
+	billOfLadingBytes, err := getAssetState(stub, blKey)
+	if err != nil {
+		return "", "", err
+	}
+	if len(billOfLadingBytes) == 0 {
+		return SHIPMENT_STEP, tradeAgreement.Deadlines.Shipment, nil
+	}
+
+	if tradeAgreement.Payment < tradeAgreement.Amount {
+		return PAYMENT_STEP, tradeAgreement.Deadlines.Payment, nil
+	}
+	return "", "", nil
+}
+
+// Check whether the trade has missed the deadline of its next step as of the transaction time
+func getLateTradeStep(stub shim.ChaincodeStubInterface, tradeID string, tradeAgreement *TradeAgreement) (string, string, error) {
+	step, deadline, err := getNextTradeStep(stub, tradeID, tradeAgreement)
+	if err != nil || step == "" {
+		return "", "", err
+	}
+
+	deadlineTime, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return "", "", err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return "", "", err
+	}
+	if !txTime.After(deadlineTime) {
+		return "", "", nil
+	}
+	return step, deadline, nil
+}
+
+// A trade marked late keeps its status: it cannot be accepted or advanced, and a trade in default completes only once
+// it is paid in full, so that penalties or cancellation can follow
+func isTradeLate(tradeAgreement *TradeAgreement) bool {
+	return tradeAgreement.Status == OVERDUE || tradeAgreement.Status == DEFAULTED
+}
+
+// Mark a trade as late; a trade that misses its payment deadline is in default
+func (t *TradeWorkflowChaincode) markOverdue(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeKey, step, status string
+	var tradeAgreementBytes []byte
+	var tradeAgreement *TradeAgreement
+	var err error
+
+	// Access control: Any trade participant can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a trade participant. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup trade agreement from the ledger
+	tradeKey, err = getTradeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	step, _, err = getLateTradeStep(stub, args[0], tradeAgreement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if step == "" {
+		err = errors.New(fmt.Sprintf("Trade %s is not overdue", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	status = OVERDUE
+	if step == PAYMENT_STEP {
+		status = DEFAULTED
+	}
+	if tradeAgreement.Status == status {
+		fmt.Printf("Trade %s already marked %s", args[0], status)
+		return shim.Success(nil)
+	}
+
+	tradeAgreement.Status = status
+	tradeAgreementBytes, err = json.Marshal(tradeAgreement)
+	if err != nil {
+		return shim.Error("Error marshaling trade agreement structure")
+	}
+	// Write the state to the ledger
+	err = putAssetState(stub, tradeKey, tradeAgreementBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Trade %s marked %s: %s deadline missed\n", args[0], status, step)
+
+	return shim.Success(nil)
+}
+
+// List the trades whose next step is past its deadline
+func (t *TradeWorkflowChaincode) getOverdueTrades(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeAgreement *TradeAgreement
+	var overdueTradesBytes []byte
+	var err error
+
+	// Access control: Any trade participant can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a trade participant. Access denied.")
+	}
+
+	if len(args) != 0 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	tradesIterator, err := stub.GetStateByPartialCompositeKey("Trade", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer tradesIterator.Close()
+
+	overdueTrades := []OverdueTrade{}
+	for tradesIterator.HasNext() {
+		tradeKV, err := tradesIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(tradeKV.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		value, err := upgradeAssetState(stub, tradeKV.Key, tradeKV.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = json.Unmarshal(value, &tradeAgreement)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		step, deadline, err := getLateTradeStep(stub, keyParts[0], tradeAgreement)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if step != "" {
+			overdueTrades = append(overdueTrades, OverdueTrade{keyParts[0], step, deadline, tradeAgreement.Status})
+		}
+		tradeAgreement = nil
+	}
+
+	overdueTradesBytes, err = json.Marshal(overdueTrades)
+	if err != nil {
+		return shim.Error("Error marshaling overdue trades")
+	}
+	fmt.Printf("Query Response:%s\n", string(overdueTradesBytes))
+	return shim.Success(overdueTradesBytes)
+}
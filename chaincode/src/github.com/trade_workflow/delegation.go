@@ -0,0 +1,321 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func isDelegableAction(action string) bool {
+	switch action {
+	case ACCEPT_TRADE_ACTION, REQUEST_EL_ACTION, PREPARE_SHIPMENT_ACTION, REQUEST_PAYMENT_ACTION:
+		return true
+	}
+	return false
+}
+
+func lookupDelegation(stub shim.ChaincodeStubInterface, delegationID string) (string, *Delegation, error) {
+	var delegation *Delegation
+
+	delegationKey, err := getDelegationKey(stub, delegationID)
+	if err != nil {
+		return "", nil, err
+	}
+	delegationBytes, err := getAssetState(stub, delegationKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(delegationBytes) == 0 {
+		return delegationKey, nil, nil
+	}
+
+	err = json.Unmarshal(delegationBytes, &delegation)
+	if err != nil {
+		return "", nil, err
+	}
+	return delegationKey, delegation, nil
+}
+
+func putDelegation(stub shim.ChaincodeStubInterface, delegationKey string, delegation *Delegation) error {
+	delegationBytes, err := json.Marshal(delegation)
+	if err != nil {
+		return errors.New("Error marshaling delegation structure")
+	}
+	return putAssetState(stub, delegationKey, delegationBytes)
+}
+
+// Check whether a delegation is in force for the caller, the action and the trade at the transaction time
+func isDelegationInForce(delegation *Delegation, action string, tradeID string, mspID string, identity string, txTime time.Time) bool {
+	if delegation.Status != ACTIVE || delegation.DelegateOrg != mspID {
+		return false
+	}
+	if delegation.DelegateIdentity != "" && delegation.DelegateIdentity != identity {
+		return false
+	}
+	if delegation.TradeId != "" && delegation.TradeId != tradeID {
+		return false
+	}
+
+	validFrom, err := time.Parse(time.RFC3339, delegation.ValidFrom)
+	if err != nil || txTime.Before(validFrom) {
+		return false
+	}
+	validUntil, err := time.Parse(time.RFC3339, delegation.ValidUntil)
+	if err != nil || txTime.After(validUntil) {
+		return false
+	}
+
+	for _, delegatedAction := range delegation.Actions {
+		if delegatedAction == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Find a delegation that permits the caller to perform an action on a trade
+func findDelegation(stub shim.ChaincodeStubInterface, action string, tradeID string, mspID string, identity string) (*Delegation, error) {
+	var delegation *Delegation
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	delegationsIterator, err := stub.GetStateByPartialCompositeKey("Delegation", []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer delegationsIterator.Close()
+
+	for delegationsIterator.HasNext() {
+		delegationKV, err := delegationsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := upgradeAssetState(stub, delegationKV.Key, delegationKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(value, &delegation)
+		if err != nil {
+			return nil, err
+		}
+		if isDelegationInForce(delegation, action, tradeID, mspID, identity, txTime) {
+			return delegation, nil
+		}
+		delegation = nil
+	}
+	return nil, nil
+}
+
+// The exporter, and the exporting entity where that role is enabled, may perform the exporter's workflow steps;
+// other organizations or identities may perform the steps that the exporter has delegated to them
+func authorizeExporterAction(stub shim.ChaincodeStubInterface, action string, args []string, mspID string, certCN string) bool {
+	var tradeID string
+
+	if authenticateExporterOrg(mspID, certCN) || authenticateExportingEntity(stub, mspID, certCN) {
+		return true
+	}
+
+	if len(args) > 0 {
+		tradeID = args[0]
+	}
+	identity, err := getTxCreatorName(stub)
+	if err != nil {
+		return false
+	}
+	delegation, err := findDelegation(stub, action, tradeID, mspID, identity)
+	if err != nil {
+		fmt.Printf("Error looking up delegations: %s\n", err.Error())
+		return false
+	}
+	if delegation == nil {
+		return false
+	}
+	fmt.Printf("%s on trade %s performed by %s of %s under delegation %s\n", action, tradeID, identity, mspID, delegation.Id)
+	return true
+}
+
+// Grant another organization, or one identity in it, some of the exporter's workflow steps until an expiry time
+func (t *TradeWorkflowChaincode) grantDelegation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var delegationKey, tradeKey string
+	var delegatorBytes, tradeAgreementBytes []byte
+	var delegation *Delegation
+	var actions []string
+	var txTime, validUntil time.Time
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	}
+
+	if len(args) != 6 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 6: {Delegation ID, Delegate Org MSP ID, Delegate Identity, Actions, Trade ID, Valid Until}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	if args[1] == "" {
+		return shim.Error("Delegate organization must be specified")
+	}
+
+	// Actions are given as a comma-separated list
+	for _, action := range strings.Split(args[3], ",") {
+		action = strings.TrimSpace(action)
+		if !isDelegableAction(action) {
+			err = errors.New(fmt.Sprintf("Action %s cannot be delegated", action))
+			return shim.Error(err.Error())
+		}
+		actions = append(actions, action)
+	}
+
+	// An empty trade ID delegates the actions for all trades
+	if args[4] != "" {
+		tradeKey, err = getTradeKey(stub, args[4])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(tradeAgreementBytes) == 0 {
+			err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[4]))
+			return shim.Error(err.Error())
+		}
+	}
+
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	validUntil, err = time.Parse(time.RFC3339, args[5])
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Invalid expiry %s; expecting an RFC 3339 timestamp", args[5]))
+		return shim.Error(err.Error())
+	}
+	if !validUntil.After(txTime) {
+		err = errors.New(fmt.Sprintf("Expiry %s is not later than the transaction time %s", args[5], txTime.Format(time.RFC3339)))
+		return shim.Error(err.Error())
+	}
+
+	delegationKey, delegation, err = lookupDelegation(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegation != nil {
+		err = errors.New(fmt.Sprintf("Delegation %s already exists", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	delegatorBytes, err = stub.GetState(expKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	delegation = &Delegation{args[0], string(delegatorBytes), args[1], args[2], actions, args[4], txTime.Format(time.RFC3339), args[5], ACTIVE}
+	err = putDelegation(stub, delegationKey, delegation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Delegation %s granted to %s: %s\n", args[0], args[1], args[3])
+
+	return shim.Success(nil)
+}
+
+// Revoke a delegation before its expiry
+func (t *TradeWorkflowChaincode) revokeDelegation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var delegationKey string
+	var delegation *Delegation
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Delegation ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	delegationKey, delegation, err = lookupDelegation(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegation == nil {
+		err = errors.New(fmt.Sprintf("No record found for delegation ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	if delegation.Status == REVOKED {
+		fmt.Printf("Delegation %s already revoked\n", args[0])
+		return shim.Success(nil)
+	}
+
+	delegation.Status = REVOKED
+	err = putDelegation(stub, delegationKey, delegation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Delegation %s revoked\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Get a delegation record
+func (t *TradeWorkflowChaincode) getDelegation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var delegationKey, jsonResp string
+	var delegationBytes []byte
+	var err error
+
+	// Access control: Any trade participant can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a trade participant. Access denied.")
+	}
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1: <delegation ID>")
+	}
+
+	// Get the state from the ledger
+	delegationKey, err = getDelegationKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	delegationBytes, err = getAssetState(stub, delegationKey)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + delegationKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	if len(delegationBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + delegationKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(delegationBytes))
+	return shim.Success(delegationBytes)
+}
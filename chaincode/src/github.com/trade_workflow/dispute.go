@@ -0,0 +1,515 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func isValidDisputeParty(party string) bool {
+	switch party {
+	case IMPORTER_PARTY, IMPORTERS_BANK_PARTY, EXPORTER_PARTY, EXPORTERS_BANK_PARTY:
+		return true
+	}
+	return false
+}
+
+// Check that the caller belongs to the organization of the named dispute party
+func authenticateDisputeParty(stub shim.ChaincodeStubInterface, party string, creatorOrg string, creatorCertIssuer string) bool {
+	switch party {
+	case IMPORTER_PARTY, IMPORTERS_BANK_PARTY:
+		return authenticateImporterOrg(creatorOrg, creatorCertIssuer)
+	case EXPORTER_PARTY:
+		return authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer)
+	case EXPORTERS_BANK_PARTY:
+		return authenticateExporterOrg(creatorOrg, creatorCertIssuer)
+	}
+	return false
+}
+
+// A settlement must be accepted by the opposite side of the trade from the one that proposed it
+func isImporterSide(party string) bool {
+	return party == IMPORTER_PARTY || party == IMPORTERS_BANK_PARTY
+}
+
+func isValidReasonCode(reasonCode string) bool {
+	switch reasonCode {
+	case GOODS_DAMAGED, GOODS_SHORT, NON_DELIVERY, DOCUMENT_DISCREPANCY, NON_PAYMENT, OTHER:
+		return true
+	}
+	return false
+}
+
+// Evidence is kept off-chain; only its SHA-256 digest is recorded
+func isValidEvidenceHash(hash string) bool {
+	decoded, err := hex.DecodeString(hash)
+	return err == nil && len(decoded) == 32
+}
+
+// Payment and B/L transactions are frozen while any dispute on the trade is unresolved
+func checkNoOpenDispute(stub shim.ChaincodeStubInterface, tradeID string) error {
+	var dispute *Dispute
+
+	disputesIterator, err := stub.GetStateByPartialCompositeKey("Dispute", []string{tradeID})
+	if err != nil {
+		return err
+	}
+	defer disputesIterator.Close()
+
+	for disputesIterator.HasNext() {
+		disputeKV, err := disputesIterator.Next()
+		if err != nil {
+			return err
+		}
+		value, err := upgradeAssetState(stub, disputeKV.Key, disputeKV.Value)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(value, &dispute)
+		if err != nil {
+			return err
+		}
+		if dispute.Status != RESOLVED {
+			return errors.New(fmt.Sprintf("Trade %s is frozen by an unresolved dispute", tradeID))
+		}
+	}
+	return nil
+}
+
+func lookupDispute(stub shim.ChaincodeStubInterface, tradeID string, disputeID string) (string, *Dispute, error) {
+	var dispute *Dispute
+
+	disputeKey, err := getDisputeKey(stub, tradeID, disputeID)
+	if err != nil {
+		return "", nil, err
+	}
+	disputeBytes, err := getAssetState(stub, disputeKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(disputeBytes) == 0 {
+		return "", nil, errors.New(fmt.Sprintf("No dispute %s found for trade ID %s", disputeID, tradeID))
+	}
+
+	err = json.Unmarshal(disputeBytes, &dispute)
+	if err != nil {
+		return "", nil, err
+	}
+	return disputeKey, dispute, nil
+}
+
+// Parse the refund and the optional payment adjustment of a settlement; a settlement either refunds the importer or
+// adjusts the payment to the exporter upwards, not both
+func parseSettlementAmounts(args []string) (int, int, error) {
+	var refund, adjustment int
+	var err error
+
+	refund, err = strconv.Atoi(args[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(args) > 1 {
+		adjustment, err = strconv.Atoi(args[1])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if refund < 0 || adjustment < 0 {
+		return 0, 0, errors.New(fmt.Sprintf("Invalid refund %d or adjustment %d; settlement amounts cannot be negative", refund, adjustment))
+	}
+	if refund > 0 && adjustment > 0 {
+		return 0, 0, errors.New("A settlement may refund the importer or adjust the payment to the exporter, but not both")
+	}
+	return refund, adjustment, nil
+}
+
+// Apply a settlement: the refund moves funds from the exporter back to the importer, credited in the importer's currency,
+// and the agreed trade amount and the amount paid are reduced alike. Credit drawn for the refunded amount is released to the importer's facility.
+// An adjustment is an additional payment from the importer to the exporter, debited in the importer's currency, by which the agreed
+// trade amount and the amount paid are raised alike.
+func applySettlement(stub shim.ChaincodeStubInterface, tradeID string, settlement *Settlement) error {
+	var tradeAgreement *TradeAgreement
+
+	tradeKey, err := getTradeKey(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	tradeAgreementBytes, err := getAssetState(stub, tradeKey)
+	if err != nil {
+		return err
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		return errors.New(fmt.Sprintf("No record found for trade ID %s", tradeID))
+	}
+
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return err
+	}
+
+	if settlement.Adjustment > 0 {
+		return applySettlementAdjustment(stub, tradeID, tradeKey, tradeAgreement, settlement.Adjustment)
+	}
+
+	refund := settlement.Refund
+	if refund < 0 {
+		return errors.New(fmt.Sprintf("Invalid refund %d; refunds cannot be negative", refund))
+	}
+	if refund > tradeAgreement.Payment {
+		return errors.New(fmt.Sprintf("Refund %d exceeds amount paid %d for trade %s", refund, tradeAgreement.Payment, tradeID))
+	}
+	expBal, err := getBalance(stub, expBalKey)
+	if err != nil {
+		return err
+	}
+	if expBal < refund {
+		return errors.New(fmt.Sprintf("Exporter's balance %d is insufficient to refund %d for trade %s", expBal, refund, tradeID))
+	}
+	creditAmount, _, _, err := convertImporterPayment(stub, refund)
+	if err != nil {
+		return err
+	}
+
+	tradeAgreement.Amount -= refund
+	tradeAgreement.Payment -= refund
+
+	// Update ledger state
+	tradeAgreementBytes, err = json.Marshal(tradeAgreement)
+	if err != nil {
+		return errors.New("Error marshaling trade agreement structure")
+	}
+	err = putAssetState(stub, tradeKey, tradeAgreementBytes)
+	if err != nil {
+		return err
+	}
+	if creditAmount == refund {
+		err = transferFunds(stub, expBalKey, impBalKey, refund)
+	} else {
+		err = exchangeFunds(stub, expBalKey, refund, impBalKey, creditAmount)
+	}
+	if err != nil {
+		return err
+	}
+	return releaseCredit(stub, tradeID, refund)
+}
+
+// The importer pays the adjustment from the funds in its account
+func applySettlementAdjustment(stub shim.ChaincodeStubInterface, tradeID string, tradeKey string, tradeAgreement *TradeAgreement, adjustment int) error {
+	debitAmount, _, _, err := convertImporterPayment(stub, adjustment)
+	if err != nil {
+		return err
+	}
+	impBal, err := getBalance(stub, impBalKey)
+	if err != nil {
+		return err
+	}
+	if impBal < debitAmount {
+		return errors.New(fmt.Sprintf("Importer's balance %d is insufficient to pay the adjustment of %d for trade %s", impBal, debitAmount, tradeID))
+	}
+
+	tradeAgreement.Amount += adjustment
+	tradeAgreement.Payment += adjustment
+	err = putTradeAgreement(stub, tradeKey, tradeAgreement)
+	if err != nil {
+		return err
+	}
+	if debitAmount == adjustment {
+		return transferFunds(stub, impBalKey, expBalKey, adjustment)
+	}
+	return exchangeFunds(stub, impBalKey, debitAmount, expBalKey, adjustment)
+}
+
+func resolveDispute(stub shim.ChaincodeStubInterface, tradeID string, disputeKey string, dispute *Dispute, settlement *Settlement, resolvedBy string) error {
+	err := applySettlement(stub, tradeID, settlement)
+	if err != nil {
+		return err
+	}
+
+	dispute.Resolution = settlement
+	dispute.ResolvedBy = resolvedBy
+	dispute.Status = RESOLVED
+	disputeBytes, err := json.Marshal(dispute)
+	if err != nil {
+		return errors.New("Error marshaling dispute structure")
+	}
+	return putAssetState(stub, disputeKey, disputeBytes)
+}
+
+// Raise a dispute on a trade
+func (t *TradeWorkflowChaincode) raiseDispute(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeKey, disputeKey, party string
+	var tradeAgreementBytes, disputeBytes []byte
+	var dispute *Dispute
+	var err error
+
+	if len(args) < 4 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting at least 4: {Trade ID, Dispute ID, Party, Reason Code} [List of Evidence Hashes]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	party = strings.ToLower(args[2])
+	if !isValidDisputeParty(party) {
+		err = errors.New(fmt.Sprintf("Invalid party %s; Permissible values: {%s, %s, %s, %s}", args[2], IMPORTER_PARTY, IMPORTERS_BANK_PARTY, EXPORTER_PARTY, EXPORTERS_BANK_PARTY))
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the raising party's Org can invoke this transaction
+	if !t.testMode && !authenticateDisputeParty(stub, party, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the raising party's Org. Access denied.")
+	}
+
+	if !isValidReasonCode(args[3]) {
+		err = errors.New(fmt.Sprintf("Invalid reason code %s", args[3]))
+		return shim.Error(err.Error())
+	}
+	for _, evidenceHash := range args[4:] {
+		if !isValidEvidenceHash(evidenceHash) {
+			err = errors.New(fmt.Sprintf("Invalid evidence hash %s; expecting a hex-encoded SHA-256 digest", evidenceHash))
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Verify that the trade exists
+	tradeKey, err = getTradeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Check that the dispute ID is not in use
+	disputeKey, err = getDisputeKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	disputeBytes, err = getAssetState(stub, disputeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(disputeBytes) != 0 {
+		err = errors.New(fmt.Sprintf("Dispute %s already raised for trade ID %s", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+
+	dispute = &Dispute{party, args[3], args[4:], OPEN, nil, nil, ""}
+	disputeBytes, err = json.Marshal(dispute)
+	if err != nil {
+		return shim.Error("Error marshaling dispute structure")
+	}
+
+	// Write the state to the ledger
+	err = putAssetState(stub, disputeKey, disputeBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Dispute %s for trade %s raised by %s\n", args[1], args[0], party)
+
+	return shim.Success(nil)
+}
+
+// Propose a settlement for a dispute; a later proposal replaces an earlier one
+func (t *TradeWorkflowChaincode) proposeSettlement(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var disputeKey, party string
+	var disputeBytes []byte
+	var dispute *Dispute
+	var refund, adjustment int
+	var err error
+
+	if len(args) != 4 && len(args) != 5 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 4 or 5: {Trade ID, Dispute ID, Party, Refund} [Adjustment]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	party = strings.ToLower(args[2])
+	if !isValidDisputeParty(party) {
+		err = errors.New(fmt.Sprintf("Invalid party %s; Permissible values: {%s, %s, %s, %s}", args[2], IMPORTER_PARTY, IMPORTERS_BANK_PARTY, EXPORTER_PARTY, EXPORTERS_BANK_PARTY))
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the proposing party's Org can invoke this transaction
+	if !t.testMode && !authenticateDisputeParty(stub, party, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the proposing party's Org. Access denied.")
+	}
+
+	refund, adjustment, err = parseSettlementAmounts(args[3:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	disputeKey, dispute, err = lookupDispute(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if dispute.Status == RESOLVED {
+		err = errors.New(fmt.Sprintf("Dispute %s for trade ID %s already resolved", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+
+	dispute.Proposal = &Settlement{party, refund, adjustment}
+	dispute.Status = PROPOSED
+	disputeBytes, err = json.Marshal(dispute)
+	if err != nil {
+		return shim.Error("Error marshaling dispute structure")
+	}
+
+	// Write the state to the ledger
+	err = putAssetState(stub, disputeKey, disputeBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Settlement for dispute %s on trade %s proposed by %s: refund %d, adjustment %d\n", args[1], args[0], party, refund, adjustment)
+
+	return shim.Success(nil)
+}
+
+// Accept the counterparty's settlement proposal, resolving the dispute
+func (t *TradeWorkflowChaincode) acceptSettlement(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var disputeKey, party string
+	var dispute *Dispute
+	var err error
+
+	if len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Trade ID, Dispute ID, Party}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	party = strings.ToLower(args[2])
+	if !isValidDisputeParty(party) {
+		err = errors.New(fmt.Sprintf("Invalid party %s; Permissible values: {%s, %s, %s, %s}", args[2], IMPORTER_PARTY, IMPORTERS_BANK_PARTY, EXPORTER_PARTY, EXPORTERS_BANK_PARTY))
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the accepting party's Org can invoke this transaction
+	if !t.testMode && !authenticateDisputeParty(stub, party, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the accepting party's Org. Access denied.")
+	}
+
+	disputeKey, dispute, err = lookupDispute(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if dispute.Status != PROPOSED {
+		err = errors.New(fmt.Sprintf("No settlement proposal pending for dispute %s on trade ID %s", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+	if isImporterSide(party) == isImporterSide(dispute.Proposal.ProposedBy) {
+		return shim.Error("Settlement must be accepted by the counterparty of the proposer")
+	}
+
+	err = resolveDispute(stub, args[0], disputeKey, dispute, dispute.Proposal, party)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Settlement for dispute %s on trade %s accepted by %s\n", args[1], args[0], party)
+
+	return shim.Success(nil)
+}
+
+// Decide a dispute by arbitration; the Regulatory Authority acts as arbiter
+func (t *TradeWorkflowChaincode) decideDispute(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var disputeKey string
+	var dispute *Dispute
+	var refund, adjustment int
+	var err error
+
+	// Access control: Only a Regulator Org member can invoke this transaction
+	if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Regulator Org. Access denied.")
+	}
+
+	if len(args) != 3 && len(args) != 4 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3 or 4: {Trade ID, Dispute ID, Refund} [Adjustment]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	refund, adjustment, err = parseSettlementAmounts(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	disputeKey, dispute, err = lookupDispute(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if dispute.Status == RESOLVED {
+		err = errors.New(fmt.Sprintf("Dispute %s for trade ID %s already resolved", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+
+	err = resolveDispute(stub, args[0], disputeKey, dispute, &Settlement{ARBITER_PARTY, refund, adjustment}, ARBITER_PARTY)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Dispute %s for trade %s decided by arbiter: refund %d, adjustment %d\n", args[1], args[0], refund, adjustment)
+
+	return shim.Success(nil)
+}
+
+// Get a dispute record
+func (t *TradeWorkflowChaincode) getDispute(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var disputeKey, jsonResp string
+	var disputeBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter or Exporting Entity or Regulator Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) || authenticateRegulatorOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity or Regulator Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2: {Trade ID, Dispute ID}")
+	}
+
+	// Get the state from the ledger
+	disputeKey, err = getDisputeKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	disputeBytes, err = getAssetState(stub, disputeKey)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + disputeKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	if len(disputeBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + disputeKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(disputeBytes))
+	return shim.Success(disputeBytes)
+}
@@ -0,0 +1,439 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"mime"
+	"net/url"
+	"strings"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Validate the digest, MIME type and URI of an off-chain file; digests are kept in lower case so that they index consistently
+func parseDocumentContent(hash string, mimeType string, uri string) (*DocumentContent, error) {
+	if !isValidEvidenceHash(hash) {
+		return nil, errors.New(fmt.Sprintf("Invalid document hash %s; expecting a hex-encoded SHA-256 digest", hash))
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil || strings.Count(mediaType, "/") != 1 || strings.HasPrefix(mediaType, "/") || strings.HasSuffix(mediaType, "/") {
+		return nil, errors.New(fmt.Sprintf("Invalid MIME type %s", mimeType))
+	}
+	location, err := url.Parse(uri)
+	if err != nil || location.Scheme == "" {
+		return nil, errors.New(fmt.Sprintf("Invalid document URI %s; expecting an absolute URI", uri))
+	}
+	return &DocumentContent{strings.ToLower(hash), mimeType, uri}, nil
+}
+
+func lookupExportLicense(stub shim.ChaincodeStubInterface, tradeID string) (string, *ExportLicense, error) {
+	var exportLicense *ExportLicense
+
+	elKey, err := getELKey(stub, tradeID)
+	if err != nil {
+		return "", nil, err
+	}
+	exportLicenseBytes, err := getAssetState(stub, elKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(exportLicenseBytes) == 0 {
+		return elKey, nil, nil
+	}
+
+	err = json.Unmarshal(exportLicenseBytes, &exportLicense)
+	if err != nil {
+		return "", nil, err
+	}
+	return elKey, exportLicense, nil
+}
+
+func lookupBillOfLading(stub shim.ChaincodeStubInterface, tradeID string) (string, *BillOfLading, error) {
+	var billOfLading *BillOfLading
+
+	blKey, err := getBLKey(stub, tradeID)
+	if err != nil {
+		return "", nil, err
+	}
+	billOfLadingBytes, err := getAssetState(stub, blKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(billOfLadingBytes) == 0 {
+		return blKey, nil, nil
+	}
+
+	err = json.Unmarshal(billOfLadingBytes, &billOfLading)
+	if err != nil {
+		return "", nil, err
+	}
+	return blKey, billOfLading, nil
+}
+
+// Lookup the B/L of a lot of a trade shipped in lots
+func lookupLotBillOfLading(stub shim.ChaincodeStubInterface, tradeID string, lotID string) (string, *BillOfLading, error) {
+	var billOfLading *BillOfLading
+
+	lotBLKey, err := getLotBLKey(stub, tradeID, lotID)
+	if err != nil {
+		return "", nil, err
+	}
+	billOfLadingBytes, err := getAssetState(stub, lotBLKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(billOfLadingBytes) == 0 {
+		return lotBLKey, nil, nil
+	}
+
+	err = json.Unmarshal(billOfLadingBytes, &billOfLading)
+	if err != nil {
+		return "", nil, err
+	}
+	return lotBLKey, billOfLading, nil
+}
+
+func lookupAttachment(stub shim.ChaincodeStubInterface, tradeID string, name string) (string, *Attachment, error) {
+	var attachment *Attachment
+
+	attachmentKey, err := getAttachmentKey(stub, tradeID, name)
+	if err != nil {
+		return "", nil, err
+	}
+	attachmentBytes, err := getAssetState(stub, attachmentKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(attachmentBytes) == 0 {
+		return attachmentKey, nil, nil
+	}
+
+	err = json.Unmarshal(attachmentBytes, &attachment)
+	if err != nil {
+		return "", nil, err
+	}
+	return attachmentKey, attachment, nil
+}
+
+// Marshal a document record and write it to the ledger
+func putDocumentRecord(stub shim.ChaincodeStubInterface, key string, record interface{}) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return errors.New("Error marshaling document structure")
+	}
+	return putAssetState(stub, key, recordBytes)
+}
+
+// Index a file by its digest so that it can be traced back to the document record it was anchored to.
+// Anchors are never removed: a file that has been replaced still verifies, as superseded.
+func putDocumentAnchor(stub shim.ChaincodeStubInterface, tradeID string, record string, document string, id string, lotID string, content *DocumentContent) error {
+	documentAnchorKey, err := getDocumentAnchorKey(stub, content.Hash, tradeID, record, id)
+	if err != nil {
+		return err
+	}
+	documentAnchorBytes, err := json.Marshal(&DocumentAnchor{tradeID, record, document, id, content, lotID})
+	if err != nil {
+		return errors.New("Error marshaling document anchor structure")
+	}
+	return putAssetState(stub, documentAnchorKey, documentAnchorBytes)
+}
+
+// Check an anchored file against the current state of the document record it was anchored to
+func verifyDocumentAnchor(stub shim.ChaincodeStubInterface, documentAnchor *DocumentAnchor) (*DocumentVerification, error) {
+	var content *DocumentContent
+	var id, status string
+	var validStatuses []string
+
+	switch documentAnchor.Record {
+	case "LetterOfCredit":
+		lcKey, err := getLCKey(stub, documentAnchor.TradeId)
+		if err != nil {
+			return nil, err
+		}
+		letterOfCredit, err := lookupLetterOfCredit(stub, lcKey)
+		if err != nil {
+			return nil, err
+		}
+		// An L/C issued against the trade's L/C is keyed by its own ID
+		if letterOfCredit == nil || letterOfCredit.Id != documentAnchor.Id {
+			childLCKey, err := getChildLCKey(stub, documentAnchor.TradeId, documentAnchor.Id)
+			if err != nil {
+				return nil, err
+			}
+			childLC, err := lookupLetterOfCredit(stub, childLCKey)
+			if err != nil {
+				return nil, err
+			}
+			if childLC != nil {
+				letterOfCredit = childLC
+			}
+		}
+		if letterOfCredit != nil {
+			content, id, status = letterOfCredit.Content, letterOfCredit.Id, letterOfCredit.Status
+		}
+		validStatuses = []string{ISSUED, ACCEPTED}
+	case "ExportLicense":
+		_, exportLicense, err := lookupExportLicense(stub, documentAnchor.TradeId)
+		if err != nil {
+			return nil, err
+		}
+		if exportLicense != nil {
+			content, id, status = exportLicense.Content, exportLicense.Id, exportLicense.Status
+		}
+		validStatuses = []string{ISSUED}
+	case "BillOfLading":
+		var billOfLading *BillOfLading
+		var err error
+		if documentAnchor.LotId != "" {
+			_, billOfLading, err = lookupLotBillOfLading(stub, documentAnchor.TradeId, documentAnchor.LotId)
+		} else {
+			_, billOfLading, err = lookupBillOfLading(stub, documentAnchor.TradeId)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if billOfLading != nil {
+			content, id, status = billOfLading.Content, billOfLading.Id, billOfLading.Status
+		}
+		validStatuses = []string{ISSUED}
+	case "TradeCertificate":
+		_, tradeCertificate, err := lookupTradeCertificate(stub, documentAnchor.TradeId, documentAnchor.Id)
+		if err != nil {
+			return nil, err
+		}
+		if tradeCertificate != nil {
+			content, id, status = &DocumentContent{strings.ToLower(tradeCertificate.DocumentHash), "", ""}, tradeCertificate.Id, tradeCertificate.Status
+		}
+		validStatuses = []string{ISSUED}
+	case "Attachment":
+		_, attachment, err := lookupAttachment(stub, documentAnchor.TradeId, documentAnchor.Id)
+		if err != nil {
+			return nil, err
+		}
+		if attachment != nil {
+			content, id = attachment.Content, attachment.Name
+		}
+		validStatuses = []string{""}
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown document record %s", documentAnchor.Record))
+	}
+
+	// A record that now carries another file, or has been reissued under another ID, no longer vouches for this one
+	if content == nil || content.Hash != documentAnchor.Content.Hash || id != documentAnchor.Id {
+		status = SUPERSEDED
+	}
+	return &DocumentVerification{documentAnchor.Content.Hash, documentAnchor.TradeId, documentAnchor.Document, documentAnchor.Id,
+				     documentAnchor.Content.MimeType, documentAnchor.Content.Uri, status, containsString(validStatuses, status)}, nil
+}
+
+// Anchor the off-chain file behind a trade document to its record on the ledger
+func (t *TradeWorkflowChaincode) anchorDocument(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var content *DocumentContent
+	var record, id, lcKey, blKey, lotID string
+	var letterOfCredit *LetterOfCredit
+	var billOfLading *BillOfLading
+	var err error
+
+	if len(args) != 5 && len(args) != 6 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 5 or 6: {Trade ID, Document, Document Hash, MIME Type, URI} [L/C ID | Lot ID]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+	// An L/C issued against the trade's L/C is identified by its ID, and the B/L of a lot by the lot ID
+	if len(args) == 6 && args[1] != LETTER_OF_CREDIT_DOC && args[1] != BILL_OF_LADING_DOC {
+		err = errors.New(fmt.Sprintf("Document %s is not identified by an L/C or lot ID", args[1]))
+		return shim.Error(err.Error())
+	}
+
+	content, err = parseDocumentContent(args[2], args[3], args[4])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Each document is anchored by the party that issued it; any other file is attached by the importer or exporter
+	switch args[1] {
+	case LETTER_OF_CREDIT_DOC:
+		if len(args) == 6 {
+			// Access control: Only an Exporter Org member can anchor an L/C issued against the trade's L/C
+			if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+				return shim.Error("Caller not a member of Exporter Org. Access denied.")
+			}
+			lcKey, err = getChildLCKey(stub, args[0], args[5])
+		} else {
+			// Access control: Only an Importer Org member can anchor the trade's L/C
+			if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+				return shim.Error("Caller not a member of Importer Org. Access denied.")
+			}
+			lcKey, err = getLCKey(stub, args[0])
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if letterOfCredit == nil || letterOfCredit.Id == "" {
+			err = errors.New(fmt.Sprintf("No L/C issued for trade %s", args[0]))
+			return shim.Error(err.Error())
+		}
+		letterOfCredit.Content = content
+		err = putLetterOfCredit(stub, lcKey, letterOfCredit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		record, id = "LetterOfCredit", letterOfCredit.Id
+	case EXPORT_LICENSE_DOC:
+		// Access control: Only a Regulator Org member can invoke this transaction
+		if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+			return shim.Error("Caller not a member of Regulator Org. Access denied.")
+		}
+		elKey, exportLicense, err := lookupExportLicense(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if exportLicense == nil || exportLicense.Status != ISSUED {
+			err = errors.New(fmt.Sprintf("No E/L issued for trade %s", args[0]))
+			return shim.Error(err.Error())
+		}
+		exportLicense.Content = content
+		err = putDocumentRecord(stub, elKey, exportLicense)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		record, id = "ExportLicense", exportLicense.Id
+	case BILL_OF_LADING_DOC:
+		// Access control: Only a Carrier Org member can invoke this transaction
+		if !t.testMode && !authenticateCarrierOrg(creatorOrg, creatorCertIssuer) {
+			return shim.Error("Caller not a member of Carrier Org. Access denied.")
+		}
+		if len(args) == 6 {
+			lotID = args[5]
+			blKey, billOfLading, err = lookupLotBillOfLading(stub, args[0], lotID)
+		} else {
+			blKey, billOfLading, err = lookupBillOfLading(stub, args[0])
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if billOfLading == nil {
+			err = errors.New(fmt.Sprintf("No B/L issued for trade %s", args[0]))
+			return shim.Error(err.Error())
+		}
+		billOfLading.Content = content
+		err = putDocumentRecord(stub, blKey, billOfLading)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		record, id = "BillOfLading", billOfLading.Id
+	default:
+		// Access control: Only an Importer or Exporter Org member can invoke this transaction
+		if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+			return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+		}
+		_, _, err = lookupTradeAgreement(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		attachmentKey, err := getAttachmentKey(stub, args[0], args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = putDocumentRecord(stub, attachmentKey, &Attachment{args[0], args[1], content})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		record, id = "Attachment", args[1]
+	}
+
+	err = putDocumentAnchor(stub, args[0], record, args[1], id, lotID, content)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("%s for trade %s anchored to %s\n", args[1], args[0], content.Uri)
+
+	return shim.Success(nil)
+}
+
+// Trace a file by its digest to the trade documents it was anchored to, and whether each still stands
+func (t *TradeWorkflowChaincode) verifyDocument(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var documentAnchor *DocumentAnchor
+	var verifications []*DocumentVerification
+	var verificationsBytes []byte
+	var hash, jsonResp string
+	var err error
+
+	// Access control: Only a trade participant Org member can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of a trade participant Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Document Hash}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+	if !isValidEvidenceHash(args[0]) {
+		err = errors.New(fmt.Sprintf("Invalid document hash %s; expecting a hex-encoded SHA-256 digest", args[0]))
+		return shim.Error(err.Error())
+	}
+	hash = strings.ToLower(args[0])
+
+	anchorsIterator, err := stub.GetStateByPartialCompositeKey("DocumentAnchor", []string{hash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer anchorsIterator.Close()
+
+	for anchorsIterator.HasNext() {
+		anchorKV, err := anchorsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		value, err := upgradeAssetState(stub, anchorKV.Key, anchorKV.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		documentAnchor = nil
+		err = json.Unmarshal(value, &documentAnchor)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		verification, err := verifyDocumentAnchor(stub, documentAnchor)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		verifications = append(verifications, verification)
+	}
+
+	if len(verifications) == 0 {
+		jsonResp = "{\"Error\":\"No document found for hash " + hash + "\"}"
+		return shim.Error(jsonResp)
+	}
+	verificationsBytes, err = json.Marshal(verifications)
+	if err != nil {
+		return shim.Error("Error marshaling document verifications")
+	}
+	fmt.Printf("Query Response:%s\n", string(verificationsBytes))
+	return shim.Success(verificationsBytes)
+}
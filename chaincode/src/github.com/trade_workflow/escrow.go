@@ -0,0 +1,302 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The escrow margin is a percentage between 0, i.e. no escrow, and 100; the full L/C amount is escrowed if it is not set
+func parseEscrowMargin(value string) (int, error) {
+	if value == "" {
+		return 100, nil
+	}
+	margin, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if margin < 0 || margin > 100 {
+		return 0, errors.New(fmt.Sprintf("Invalid escrow margin %d; expecting a percentage between 0 and 100", margin))
+	}
+	return margin, nil
+}
+
+func lookupEscrow(stub shim.ChaincodeStubInterface, tradeID string) (string, *Escrow, error) {
+	var escrow *Escrow
+
+	escrowKey, err := getEscrowKey(stub, tradeID)
+	if err != nil {
+		return "", nil, err
+	}
+	escrowBytes, err := getAssetState(stub, escrowKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(escrowBytes) == 0 {
+		return escrowKey, nil, nil
+	}
+
+	err = json.Unmarshal(escrowBytes, &escrow)
+	if err != nil {
+		return "", nil, err
+	}
+	return escrowKey, escrow, nil
+}
+
+func putEscrow(stub shim.ChaincodeStubInterface, escrowKey string, escrow *Escrow) error {
+	escrowBytes, err := json.Marshal(escrow)
+	if err != nil {
+		return errors.New("Error marshaling escrow structure")
+	}
+	return putAssetState(stub, escrowKey, escrowBytes)
+}
+
+// Move the escrow margin of a newly issued L/C from the applicant's account into the L/C's escrow account
+func escrowLCFunds(stub shim.ChaincodeStubInterface, tradeID string, letterOfCredit *LetterOfCredit) error {
+	marginSetting, err := getSetting(stub, ESCROW_MARGIN_SETTING)
+	if err != nil {
+		return err
+	}
+	margin, err := parseEscrowMargin(marginSetting)
+	if err != nil {
+		return err
+	}
+	if letterOfCredit.Amount * margin / 100 == 0 {
+		return nil
+	}
+
+	// Funds are escrowed in the currency of the applicant's account
+	amount, _, _, err := convertImporterPayment(stub, letterOfCredit.Amount * margin / 100)
+	if err != nil {
+		return err
+	}
+	impBal, err := getBalance(stub, impBalKey)
+	if err != nil {
+		return err
+	}
+	if impBal < amount {
+		return errors.New(fmt.Sprintf("Applicant's balance %d is insufficient to escrow %d for the L/C of trade %s", impBal, amount, tradeID))
+	}
+
+	escrowBalanceKey, err := getEscrowBalanceKey(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	err = openAccount(stub, escrowBalanceKey)
+	if err != nil {
+		return err
+	}
+	err = transferFunds(stub, impBalKey, escrowBalanceKey, amount)
+	if err != nil {
+		return err
+	}
+
+	escrowKey, err := getEscrowKey(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	err = putEscrow(stub, escrowKey, &Escrow{tradeID, letterOfCredit.Id, margin, amount, amount, ACTIVE})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d escrowed from the applicant's account for the L/C of trade %s\n", amount, tradeID)
+	return nil
+}
+
+// Funds still held in escrow for a trade's L/C
+func getEscrowBalance(stub shim.ChaincodeStubInterface, tradeID string) (int, error) {
+	_, escrow, err := lookupEscrow(stub, tradeID)
+	if err != nil || escrow == nil || escrow.Status != ACTIVE {
+		return 0, err
+	}
+	return escrow.Balance, nil
+}
+
+// Return up to the given amount from escrow to the applicant's account, ahead of a payment out of that account
+func drawEscrow(stub shim.ChaincodeStubInterface, tradeID string, amount int) error {
+	escrowKey, escrow, err := lookupEscrow(stub, tradeID)
+	if err != nil || escrow == nil || escrow.Status != ACTIVE {
+		return err
+	}
+	if amount > escrow.Balance {
+		amount = escrow.Balance
+	}
+	if amount == 0 {
+		return nil
+	}
+
+	escrowBalanceKey, err := getEscrowBalanceKey(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	err = transferFunds(stub, escrowBalanceKey, impBalKey, amount)
+	if err != nil {
+		return err
+	}
+	escrow.Balance -= amount
+	return putEscrow(stub, escrowKey, escrow)
+}
+
+// Return whatever remains in escrow to the applicant's account once the L/C can no longer be drawn
+func releaseEscrow(stub shim.ChaincodeStubInterface, tradeID string) error {
+	escrowKey, escrow, err := lookupEscrow(stub, tradeID)
+	if err != nil || escrow == nil || escrow.Status != ACTIVE {
+		return err
+	}
+
+	if escrow.Balance > 0 {
+		escrowBalanceKey, err := getEscrowBalanceKey(stub, tradeID)
+		if err != nil {
+			return err
+		}
+		err = transferFunds(stub, escrowBalanceKey, impBalKey, escrow.Balance)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d released from escrow for the L/C of trade %s\n", escrow.Balance, tradeID)
+	}
+	escrow.Balance = 0
+	escrow.Status = RELEASED
+	return putEscrow(stub, escrowKey, escrow)
+}
+
+// L/C expiry dates are given as MM/DD/YYYY, or as RFC 3339 timestamps
+func isLCExpired(stub shim.ChaincodeStubInterface, letterOfCredit *LetterOfCredit) (bool, error) {
+	expirationDate, err := time.Parse("1/2/2006", letterOfCredit.ExpirationDate)
+	if err == nil {
+		// A date with no time of day runs to its end
+		expirationDate = expirationDate.AddDate(0, 0, 1)
+	} else {
+		expirationDate, err = time.Parse(time.RFC3339, letterOfCredit.ExpirationDate)
+		if err != nil {
+			return false, err
+		}
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return false, err
+	}
+	return !txTime.Before(expirationDate), nil
+}
+
+// Record the expiry of a trade's L/C, releasing the funds held in escrow and the undrawn credit
+func (t *TradeWorkflowChaincode) expireLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lcKey string
+	var letterOfCredit *LetterOfCredit
+	var expired bool
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit == nil {
+		err = errors.New(fmt.Sprintf("No L/C found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	if letterOfCredit.Status == EXPIRED {
+		fmt.Printf("L/C for trade %s already expired", args[0])
+		return shim.Success(nil)
+	}
+	if letterOfCredit.Status != ISSUED && letterOfCredit.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("L/C for trade %s cannot expire in status %s", args[0], letterOfCredit.Status))
+		return shim.Error(err.Error())
+	}
+
+	expired, err = isLCExpired(stub, letterOfCredit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !expired {
+		err = errors.New(fmt.Sprintf("L/C for trade %s is valid until %s", args[0], letterOfCredit.ExpirationDate))
+		return shim.Error(err.Error())
+	}
+
+	err = releaseEscrow(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = releaseCredit(stub, args[0], letterOfCredit.Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	letterOfCredit.Status = EXPIRED
+	err = putLetterOfCredit(stub, lcKey, letterOfCredit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("L/C for trade %s expired\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Get the escrow held for a trade's L/C
+func (t *TradeWorkflowChaincode) getEscrow(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var escrowKey, jsonResp string
+	var escrowBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	escrowKey, err = getEscrowKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	escrowBytes, err = getAssetState(stub, escrowKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(escrowBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + escrowKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(escrowBytes))
+	return shim.Success(escrowBytes)
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Features are switched on or off only through Init, i.e. by an instantiation or upgrade that every
+// organization has endorsed; a feature that was never set is off.
+//   ExportingEntity: the exporting entity role is played by the Exporting Entity Org rather than the Exporter Org
+//   RoleReset: an upgrade may overwrite the participant names and account balances recorded on the ledger
+var features = []string{EXPORTING_ENTITY_FEATURE, ROLE_RESET_FEATURE}
+
+func isValidFeature(feature string) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+func isFeatureEnabled(stub shim.ChaincodeStubInterface, feature string) (bool, error) {
+	featureKey, err := getFeatureKey(stub, feature)
+	if err != nil {
+		return false, err
+	}
+	settingBytes, err := stub.GetState(featureKey)
+	if err != nil {
+		return false, err
+	}
+	return string(settingBytes) == FEATURE_ON, nil
+}
+
+// Record a feature setting of the form <Feature>=on|off
+func setFeature(stub shim.ChaincodeStubInterface, featureArg string) error {
+	parts := strings.SplitN(featureArg, "=", 2)
+	if len(parts) != 2 {
+		return errors.New(fmt.Sprintf("Invalid feature setting %s; expecting <Feature>=%s|%s", featureArg, FEATURE_ON, FEATURE_OFF))
+	}
+	if !isValidFeature(parts[0]) {
+		return errors.New(fmt.Sprintf("Unknown feature %s", parts[0]))
+	}
+	if parts[1] != FEATURE_ON && parts[1] != FEATURE_OFF {
+		return errors.New(fmt.Sprintf("Invalid setting %s for feature %s; expecting %s or %s", parts[1], parts[0], FEATURE_ON, FEATURE_OFF))
+	}
+
+	featureKey, err := getFeatureKey(stub, parts[0])
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(featureKey, []byte(parts[1]))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Feature %s: %s\n", parts[0], parts[1])
+	return nil
+}
+
+// Settings are also recorded through Init, in the form <Setting>=<value>; a setting that was never made is empty.
+//   TokenChaincode: funds are held in the named fungible-token chaincode, given as <name> or <name>/<channel>,
+//                   rather than in account balances on this ledger
+//   EscrowMargin: the percentage of an L/C's amount escrowed from the applicant's account when it is issued; 100 if not set
+//   StateFormat: the format, json or protobuf, in which trades, L/Cs, E/Ls and B/Ls are written; json if not set
+var settings = []string{TOKEN_CHAINCODE_SETTING, ESCROW_MARGIN_SETTING, STATE_FORMAT_SETTING}
+
+func isValidSetting(setting string) bool {
+	for _, s := range settings {
+		if s == setting {
+			return true
+		}
+	}
+	return false
+}
+
+func getSetting(stub shim.ChaincodeStubInterface, setting string) (string, error) {
+	settingKey, err := getSettingKey(stub, setting)
+	if err != nil {
+		return "", err
+	}
+	valueBytes, err := stub.GetState(settingKey)
+	if err != nil {
+		return "", err
+	}
+	return string(valueBytes), nil
+}
+
+// Record a setting of the form <Setting>=<value>, or a feature setting
+func setConfiguration(stub shim.ChaincodeStubInterface, configArg string) error {
+	parts := strings.SplitN(configArg, "=", 2)
+	if len(parts) != 2 || !isValidSetting(parts[0]) {
+		return setFeature(stub, configArg)
+	}
+	if parts[0] == ESCROW_MARGIN_SETTING {
+		_, err := parseEscrowMargin(parts[1])
+		if err != nil {
+			return err
+		}
+	}
+	if parts[0] == STATE_FORMAT_SETTING && !isValidFormat(parts[1]) {
+		return errors.New(fmt.Sprintf("Invalid state format %s; Permissible values: {%s, %s}", parts[1], JSON_FORMAT, PROTOBUF_FORMAT))
+	}
+
+	settingKey, err := getSettingKey(stub, parts[0])
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(settingKey, []byte(parts[1]))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Setting %s: %s\n", parts[0], parts[1])
+	return nil
+}
+
+// The ledger has been initialized once the participant roles are recorded
+func isLedgerInitialized(stub shim.ChaincodeStubInterface) (bool, error) {
+	importerBytes, err := stub.GetState(impKey)
+	if err != nil {
+		return false, err
+	}
+	return len(importerBytes) > 0, nil
+}
+
+// Get the settings of all features
+func (t *TradeWorkflowChaincode) getFeatures(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var featuresBytes []byte
+	var enabled bool
+	var err error
+
+	// Access control: Any trade participant can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a trade participant. Access denied.")
+	}
+
+	if len(args) != 0 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	settings := map[string]string{}
+	for _, feature := range features {
+		enabled, err = isFeatureEnabled(stub, feature)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		settings[feature] = FEATURE_OFF
+		if enabled {
+			settings[feature] = FEATURE_ON
+		}
+	}
+
+	featuresBytes, err = json.Marshal(settings)
+	if err != nil {
+		return shim.Error("Error marshaling feature settings")
+	}
+	fmt.Printf("Query Response:%s\n", string(featuresBytes))
+	return shim.Success(featuresBytes)
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupFeeSchedule(stub shim.ChaincodeStubInterface, bank string) (string, *FeeSchedule, error) {
+	var feeSchedule *FeeSchedule
+
+	feeScheduleKey, err := getFeeScheduleKey(stub, bank)
+	if err != nil {
+		return "", nil, err
+	}
+	feeScheduleBytes, err := getAssetState(stub, feeScheduleKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(feeScheduleBytes) == 0 {
+		return feeScheduleKey, nil, nil
+	}
+
+	err = json.Unmarshal(feeScheduleBytes, &feeSchedule)
+	if err != nil {
+		return "", nil, err
+	}
+	return feeScheduleKey, feeSchedule, nil
+}
+
+func getTradeCharges(stub shim.ChaincodeStubInterface, tradeID string) ([]*Charge, error) {
+	var charge *Charge
+
+	chargesIterator, err := stub.GetStateByPartialCompositeKey("Charge", []string{tradeID})
+	if err != nil {
+		return nil, err
+	}
+	defer chargesIterator.Close()
+
+	charges := []*Charge{}
+	for chargesIterator.HasNext() {
+		chargeKV, err := chargesIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := upgradeAssetState(stub, chargeKV.Key, chargeKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(value, &charge)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, charge)
+		charge = nil
+	}
+	return charges, nil
+}
+
+// Fee on a given amount, within the fee's minimum and maximum where these are set
+func calculateFee(fee *Fee, amount int) int {
+	var feeAmount int
+
+	if fee.Type == PERCENTAGE_FEE {
+		feeAmount = amount * fee.Rate / 10000
+	} else {
+		feeAmount = fee.Rate
+	}
+	if fee.Minimum > 0 && feeAmount < fee.Minimum {
+		feeAmount = fee.Minimum
+	}
+	if fee.Maximum > 0 && feeAmount > fee.Maximum {
+		feeAmount = fee.Maximum
+	}
+	return feeAmount
+}
+
+// Charge the fee a bank has scheduled for a service on a trade, if any, to the party bearing it,
+// credit it to the bank's account and record it against the trade
+func assessFee(stub shim.ChaincodeStubInterface, tradeID string, service string, bank string, amount int) error {
+	_, feeSchedule, err := lookupFeeSchedule(stub, bank)
+	if err != nil || feeSchedule == nil {
+		return err
+	}
+	fee, ok := feeSchedule.Fees[service]
+	if !ok {
+		return nil
+	}
+	feeAmount := calculateFee(fee, amount)
+	if feeAmount == 0 {
+		return nil
+	}
+
+	// Fees are in the trade currency; the applicant's account is debited in its own currency, converted at the latest published rate
+	payerBalKey := impBalKey
+	debitAmount := feeAmount
+	if fee.BorneBy == BENEFICIARY {
+		payerBalKey = expBalKey
+	} else {
+		debitAmount, _, _, err = convertImporterPayment(stub, feeAmount)
+		if err != nil {
+			return err
+		}
+	}
+	bankBalanceKey, err := getBankBalanceKey(stub, bank)
+	if err != nil {
+		return err
+	}
+	err = openAccount(stub, bankBalanceKey)
+	if err != nil {
+		return err
+	}
+	if debitAmount == feeAmount {
+		err = transferFunds(stub, payerBalKey, bankBalanceKey, feeAmount)
+	} else {
+		err = exchangeFunds(stub, payerBalKey, debitAmount, bankBalanceKey, feeAmount)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Charges are numbered in the order they are assessed on the trade
+	charges, err := getTradeCharges(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	chargeKey, err := getChargeKey(stub, tradeID, fmt.Sprintf("%06d", len(charges) + 1))
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	chargeBytes, err := json.Marshal(&Charge{service, bank, feeAmount, fee.BorneBy, txTime.Format(time.RFC3339)})
+	if err != nil {
+		return errors.New("Error marshaling charge structure")
+	}
+	err = putAssetState(stub, chargeKey, chargeBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s fee of %d charged by %s on trade %s to the %s\n", service, feeAmount, bank, tradeID, fee.BorneBy)
+	return nil
+}
+
+// Set a bank's fee for one of its services; a zero rate with no minimum removes the fee.
+// The advising and confirming banks nominated in L/Cs are named rather than given by their role.
+func (t *TradeWorkflowChaincode) setFeeSchedule(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var bankRoleKey, feeScheduleKey string
+	var bankBytes, feeScheduleBytes []byte
+	var feeSchedule *FeeSchedule
+	var fee *Fee
+	var rate, minimum, maximum int
+	var err error
+
+	if len(args) != 7 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 7: {Bank, Service, Fee Type, Rate, Minimum, Maximum, Borne By}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	bankRoleKey, err = getBankRoleKey(strings.ToLower(args[0]))
+	if err != nil && (args[0] == "" || args[1] != ADVISE_LC_SERVICE && args[1] != CONFIRM_LC_SERVICE) {
+		return shim.Error(err.Error())
+	}
+
+	// Access control: Only a member of the bank's Org, or of the Exporter Org for a nominated bank, can invoke this transaction
+	if !t.testMode && !authenticateBankOrg(bankRoleKey, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of the bank's Org. Access denied.")
+	}
+
+	if args[1] != ISSUE_LC_ACTION && args[1] != ACCEPT_LC_ACTION && args[1] != MAKE_PAYMENT_ACTION && args[1] != ADVISE_LC_SERVICE && args[1] != CONFIRM_LC_SERVICE {
+		err = errors.New(fmt.Sprintf("Invalid service %s; expecting %s, %s, %s, %s or %s", args[1], ISSUE_LC_ACTION, ACCEPT_LC_ACTION, MAKE_PAYMENT_ACTION, ADVISE_LC_SERVICE, CONFIRM_LC_SERVICE))
+		return shim.Error(err.Error())
+	}
+	if args[2] != FLAT_FEE && args[2] != PERCENTAGE_FEE {
+		err = errors.New(fmt.Sprintf("Invalid fee type %s; expecting %s or %s", args[2], FLAT_FEE, PERCENTAGE_FEE))
+		return shim.Error(err.Error())
+	}
+	rate, err = strconv.Atoi(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	minimum, err = strconv.Atoi(args[4])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	maximum, err = strconv.Atoi(args[5])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rate < 0 || minimum < 0 || maximum < 0 {
+		return shim.Error("Rate, minimum and maximum may not be negative")
+	}
+	if maximum > 0 && maximum < minimum {
+		return shim.Error("Maximum may not be less than the minimum")
+	}
+	if args[6] != APPLICANT && args[6] != BENEFICIARY {
+		err = errors.New(fmt.Sprintf("Invalid party %s; expecting %s or %s", args[6], APPLICANT, BENEFICIARY))
+		return shim.Error(err.Error())
+	}
+
+	if bankRoleKey == "" {
+		bankBytes = []byte(args[0])
+	} else {
+		bankBytes, err = stub.GetState(bankRoleKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	feeScheduleKey, feeSchedule, err = lookupFeeSchedule(stub, string(bankBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if feeSchedule == nil {
+		feeSchedule = &FeeSchedule{string(bankBytes), map[string]*Fee{}}
+	}
+
+	if rate == 0 && minimum == 0 {
+		delete(feeSchedule.Fees, args[1])
+	} else {
+		fee = &Fee{args[2], rate, minimum, maximum, args[6]}
+		feeSchedule.Fees[args[1]] = fee
+	}
+
+	feeScheduleBytes, err = json.Marshal(feeSchedule)
+	if err != nil {
+		return shim.Error("Error marshaling fee schedule structure")
+	}
+	// Write the state to the ledger
+	err = putAssetState(stub, feeScheduleKey, feeScheduleBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Fee schedule of %s for %s recorded\n", string(bankBytes), args[1])
+
+	return shim.Success(nil)
+}
+
+// Get the fee schedule of a bank
+func (t *TradeWorkflowChaincode) getFeeSchedule(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var feeScheduleKey, jsonResp string
+	var feeScheduleBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bank}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	feeScheduleKey, err = getFeeScheduleKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	feeScheduleBytes, err = getAssetState(stub, feeScheduleKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(feeScheduleBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + feeScheduleKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(feeScheduleBytes))
+	return shim.Success(feeScheduleBytes)
+}
+
+// Get the statement of the fees charged on a trade, with the totals borne by the applicant and the beneficiary
+func (t *TradeWorkflowChaincode) getCharges(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var statement *ChargesStatement
+	var statementBytes []byte
+	var charges []*Charge
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	charges, err = getTradeCharges(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	statement = &ChargesStatement{args[0], charges, 0, 0}
+	for _, charge := range charges {
+		if charge.BorneBy == BENEFICIARY {
+			statement.BeneficiaryTotal += charge.Amount
+		} else {
+			statement.ApplicantTotal += charge.Amount
+		}
+	}
+
+	statementBytes, err = json.Marshal(statement)
+	if err != nil {
+		return shim.Error("Error marshaling charges statement")
+	}
+	fmt.Printf("Query Response:%s\n", string(statementBytes))
+	return shim.Success(statementBytes)
+}
@@ -0,0 +1,462 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"math/big"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupRatePublisher(stub shim.ChaincodeStubInterface, publisherID string) (string, *RatePublisher, error) {
+	var ratePublisher *RatePublisher
+
+	ratePublisherKey, err := getRatePublisherKey(stub, publisherID)
+	if err != nil {
+		return "", nil, err
+	}
+	ratePublisherBytes, err := getAssetState(stub, ratePublisherKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(ratePublisherBytes) == 0 {
+		return ratePublisherKey, nil, nil
+	}
+
+	err = json.Unmarshal(ratePublisherBytes, &ratePublisher)
+	if err != nil {
+		return "", nil, err
+	}
+	return ratePublisherKey, ratePublisher, nil
+}
+
+func parsePublisherKey(publicKeyPEM string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, errors.New("Publisher key is not PEM encoded")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Publisher key is not an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// The publisher signs the SHA-256 digest of the rate's fields, separated by '|'
+func getFXRateMessage(publisherID string, baseCurrency string, quoteCurrency string, rate string, validFrom string, validUntil string) []byte {
+	digest := sha256.Sum256([]byte(strings.Join([]string{publisherID, baseCurrency, quoteCurrency, rate, validFrom, validUntil}, "|")))
+	return digest[:]
+}
+
+// An ECDSA signature as encoded in ASN.1 DER
+type ecdsaSignature struct {
+	R, S	*big.Int
+}
+
+// Check an ASN.1 DER-encoded ECDSA signature over a hash
+func verifyECDSASignature(publicKey *ecdsa.PublicKey, hash []byte, signatureBytes []byte) bool {
+	var signature ecdsaSignature
+
+	rest, err := asn1.Unmarshal(signatureBytes, &signature)
+	if err != nil || len(rest) != 0 || signature.R == nil || signature.S == nil {
+		return false
+	}
+	return ecdsa.Verify(publicKey, hash, signature.R, signature.S)
+}
+
+// Check that a rate was signed with the current key of an active publisher
+func verifyFXRate(ratePublisher *RatePublisher, baseCurrency string, quoteCurrency string, rate string, validFrom string, validUntil string, signature string) error {
+	if ratePublisher == nil || ratePublisher.Status != ACTIVE {
+		return errors.New("No active rate publisher registered")
+	}
+	publicKey, err := parsePublisherKey(ratePublisher.PublicKey)
+	if err != nil {
+		return err
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	if !verifyECDSASignature(publicKey, getFXRateMessage(ratePublisher.Id, baseCurrency, quoteCurrency, rate, validFrom, validUntil), signatureBytes) {
+		return errors.New(fmt.Sprintf("Invalid signature of rate publisher %s", ratePublisher.Id))
+	}
+	return nil
+}
+
+// Find the most recent rate for a currency pair that is valid at the given time
+func getLatestFXRate(stub shim.ChaincodeStubInterface, baseCurrency string, quoteCurrency string, at time.Time) (*FXRate, error) {
+	var fxRate, latestRate *FXRate
+
+	ratesIterator, err := stub.GetStateByPartialCompositeKey("FXRate", []string{baseCurrency, quoteCurrency})
+	if err != nil {
+		return nil, err
+	}
+	defer ratesIterator.Close()
+
+	for ratesIterator.HasNext() {
+		rateKV, err := ratesIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := upgradeAssetState(stub, rateKV.Key, rateKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(value, &fxRate)
+		if err != nil {
+			return nil, err
+		}
+		validFrom, err := time.Parse(time.RFC3339, fxRate.ValidFrom)
+		if err != nil {
+			return nil, err
+		}
+		validUntil, err := time.Parse(time.RFC3339, fxRate.ValidUntil)
+		if err != nil {
+			return nil, err
+		}
+		if !at.Before(validFrom) && at.Before(validUntil) {
+			// Rates of a revoked publisher, or signed with a key it has since replaced, are no longer trusted
+			_, ratePublisher, err := lookupRatePublisher(stub, fxRate.Publisher)
+			if err != nil {
+				return nil, err
+			}
+			if verifyFXRate(ratePublisher, fxRate.BaseCurrency, fxRate.QuoteCurrency, strconv.Itoa(fxRate.Rate), fxRate.ValidFrom, fxRate.ValidUntil, fxRate.Signature) == nil {
+				latestRate = fxRate
+			}
+		}
+		fxRate = nil
+	}
+	return latestRate, nil
+}
+
+// Convert an amount between two currencies at the latest valid rate, quoted either way round.
+// The rate applied, in units of the target currency per unit of the source currency, is returned with the converted amount.
+func convertAmount(stub shim.ChaincodeStubInterface, amount int, fromCurrency string, toCurrency string) (int, int, error) {
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fxRate, err := getLatestFXRate(stub, fromCurrency, toCurrency, txTime)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fxRate != nil {
+		return amount * fxRate.Rate / FX_RATE_SCALE, fxRate.Rate, nil
+	}
+
+	fxRate, err = getLatestFXRate(stub, toCurrency, fromCurrency, txTime)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fxRate != nil {
+		return amount * FX_RATE_SCALE / fxRate.Rate, FX_RATE_SCALE * FX_RATE_SCALE / fxRate.Rate, nil
+	}
+	return 0, 0, errors.New(fmt.Sprintf("No valid %s/%s exchange rate", fromCurrency, toCurrency))
+}
+
+// Amount to debit from the importer's account for a payment of the given trade amount.
+// If the importer's account is held in another currency than the exporter's, the rate applied and the account currency are also returned.
+func convertImporterPayment(stub shim.ChaincodeStubInterface, amount int) (int, int, string, error) {
+	tradeCurrency, err := getAccountCurrency(stub, EXPORTER_PARTY)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	importerCurrency, err := getAccountCurrency(stub, IMPORTER_PARTY)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if tradeCurrency == "" || importerCurrency == "" || tradeCurrency == importerCurrency {
+		return amount, 0, "", nil
+	}
+
+	converted, rate, err := convertAmount(stub, amount, tradeCurrency, importerCurrency)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return converted, rate, importerCurrency, nil
+}
+
+// Currency an account is held in, or "" if none has been set
+func getAccountCurrency(stub shim.ChaincodeStubInterface, party string) (string, error) {
+	accountCurrencyKey, err := getAccountCurrencyKey(stub, party)
+	if err != nil {
+		return "", err
+	}
+	currencyBytes, err := stub.GetState(accountCurrencyKey)
+	if err != nil {
+		return "", err
+	}
+	return string(currencyBytes), nil
+}
+
+// Set the currency of the importer's or exporter's account; trade amounts are in the exporter's currency
+func (t *TradeWorkflowChaincode) setAccountCurrency(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var accountCurrencyKey string
+	var err error
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Account Holder, Currency}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	args[0] = strings.ToLower(args[0])
+	if args[0] == IMPORTER_PARTY {
+		// Access control: Only an Importer Org member can set the currency of the importer's account
+		if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+			return shim.Error("Caller not a member of Importer Org. Access denied.")
+		}
+	} else if args[0] == EXPORTER_PARTY {
+		// Access control: Only an Exporter Org member can set the currency of the exporter's account
+		if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+			return shim.Error("Caller not a member of Exporter Org. Access denied.")
+		}
+	} else {
+		err = errors.New(fmt.Sprintf("Invalid account holder %s; expecting %s or %s", args[0], IMPORTER_PARTY, EXPORTER_PARTY))
+		return shim.Error(err.Error())
+	}
+
+	if len(args[1]) != 3 || strings.ToUpper(args[1]) != args[1] {
+		err = errors.New(fmt.Sprintf("Invalid currency code %s", args[1]))
+		return shim.Error(err.Error())
+	}
+
+	accountCurrencyKey, err = getAccountCurrencyKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(accountCurrencyKey, []byte(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Account currency of the %s set to %s\n", args[0], args[1])
+
+	return shim.Success(nil)
+}
+
+// Register a rate publisher with the public key its rates are signed with, or replace the key of a registered publisher
+func (t *TradeWorkflowChaincode) registerRatePublisher(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var ratePublisherKey string
+	var ratePublisherBytes []byte
+	var err error
+
+	// Access control: Only a Regulator Org member can invoke this transaction
+	if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Regulator Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Publisher ID, Public Key (PEM)}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	_, err = parsePublisherKey(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ratePublisherKey, err = getRatePublisherKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ratePublisherBytes, err = json.Marshal(&RatePublisher{args[0], args[1], ACTIVE})
+	if err != nil {
+		return shim.Error("Error marshaling rate publisher structure")
+	}
+	err = putAssetState(stub, ratePublisherKey, ratePublisherBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Rate publisher %s registered\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Revoke a rate publisher; rates it has already posted stay on the ledger but are no longer accepted
+func (t *TradeWorkflowChaincode) revokeRatePublisher(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var ratePublisherKey string
+	var ratePublisherBytes []byte
+	var ratePublisher *RatePublisher
+	var err error
+
+	// Access control: Only a Regulator Org member can invoke this transaction
+	if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Regulator Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Publisher ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	ratePublisherKey, ratePublisher, err = lookupRatePublisher(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ratePublisher == nil {
+		err = errors.New(fmt.Sprintf("No rate publisher %s registered", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	ratePublisher.Status = REVOKED
+	ratePublisherBytes, err = json.Marshal(ratePublisher)
+	if err != nil {
+		return shim.Error("Error marshaling rate publisher structure")
+	}
+	err = putAssetState(stub, ratePublisherKey, ratePublisherBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Rate publisher %s revoked\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Post an exchange rate signed by a registered publisher; anyone may relay it, as only the signature is trusted
+func (t *TradeWorkflowChaincode) postFXRate(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var fxRateKey string
+	var fxRateBytes []byte
+	var ratePublisher *RatePublisher
+	var validFrom, validUntil time.Time
+	var rate int
+	var err error
+
+	if len(args) != 7 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 7: {Publisher ID, Base Currency, Quote Currency, Rate, Valid From, Valid Until, Signature}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	rate, err = strconv.Atoi(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rate <= 0 {
+		err = errors.New(fmt.Sprintf("Invalid rate %d", rate))
+		return shim.Error(err.Error())
+	}
+	if args[1] == args[2] {
+		return shim.Error("Base and quote currencies must differ")
+	}
+	validFrom, err = time.Parse(time.RFC3339, args[4])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	validUntil, err = time.Parse(time.RFC3339, args[5])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !validFrom.Before(validUntil) {
+		return shim.Error("Rate validity window is empty")
+	}
+
+	_, ratePublisher, err = lookupRatePublisher(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ratePublisher == nil {
+		err = errors.New(fmt.Sprintf("No rate publisher %s registered", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Rates are stored as signed so that the signature can be checked again whenever the rate is used.
+	// Validity times and the rate are normalised first, and the publisher must have signed them in that form.
+	args[3] = strconv.Itoa(rate)
+	args[4] = validFrom.UTC().Format(time.RFC3339)
+	args[5] = validUntil.UTC().Format(time.RFC3339)
+	err = verifyFXRate(ratePublisher, args[1], args[2], args[3], args[4], args[5], args[6])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Rates are keyed by the start of their validity, in UTC so that keys sort in time order
+	fxRateKey, err = getFXRateKey(stub, args[1], args[2], args[4])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fxRateBytes, err = json.Marshal(&FXRate{args[0], args[1], args[2], rate, args[4], args[5], args[6]})
+	if err != nil {
+		return shim.Error("Error marshaling exchange rate structure")
+	}
+	err = putAssetState(stub, fxRateKey, fxRateBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("%s/%s rate %d from %s to %s recorded\n", args[1], args[2], rate, args[4], args[5])
+
+	return shim.Success(nil)
+}
+
+// Get the exchange rate for a currency pair that is valid now
+func (t *TradeWorkflowChaincode) getFXRate(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var fxRate *FXRate
+	var fxRateBytes []byte
+	var txTime time.Time
+	var fxRateKey, jsonResp string
+	var err error
+
+	// Access control: Only a trade participant Org member can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of a trade participant Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Base Currency, Quote Currency}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fxRate, err = getLatestFXRate(stub, args[0], args[1], txTime)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if fxRate == nil {
+		jsonResp = "{\"Error\":\"No valid rate found for " + args[0] + "/" + args[1] + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	fxRateKey, err = getFXRateKey(stub, fxRate.BaseCurrency, fxRate.QuoteCurrency, fxRate.ValidFrom)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fxRateBytes, err = getAssetState(stub, fxRateKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Query Response:%s\n", string(fxRateBytes))
+	return shim.Success(fxRateBytes)
+}
@@ -0,0 +1,522 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupGuarantee(stub shim.ChaincodeStubInterface, guaranteeID string) (string, *Guarantee, error) {
+	var guarantee *Guarantee
+
+	guaranteeKey, err := getGuaranteeKey(stub, guaranteeID)
+	if err != nil {
+		return "", nil, err
+	}
+	guaranteeBytes, err := getAssetState(stub, guaranteeKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(guaranteeBytes) == 0 {
+		return "", nil, errors.New(fmt.Sprintf("No record found for guarantee ID %s", guaranteeID))
+	}
+
+	err = json.Unmarshal(guaranteeBytes, &guarantee)
+	if err != nil {
+		return "", nil, err
+	}
+	return guaranteeKey, guarantee, nil
+}
+
+func putGuarantee(stub shim.ChaincodeStubInterface, guaranteeKey string, guarantee *Guarantee) error {
+	guaranteeBytes, err := json.Marshal(guarantee)
+	if err != nil {
+		return errors.New("Error marshaling guarantee structure")
+	}
+	return putAssetState(stub, guaranteeKey, guaranteeBytes)
+}
+
+func isGuaranteeExpired(stub shim.ChaincodeStubInterface, guarantee *Guarantee) (bool, error) {
+	expirationDate, err := time.Parse(time.RFC3339, guarantee.ExpirationDate)
+	if err != nil {
+		return false, err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return false, err
+	}
+	return txTime.After(expirationDate), nil
+}
+
+// A guarantee backing a trade may only be called once the importer has defaulted on its payment
+func checkTradePaymentOverdue(stub shim.ChaincodeStubInterface, tradeID string) (int, error) {
+	var tradeAgreement *TradeAgreement
+
+	tradeKey, err := getTradeKey(stub, tradeID)
+	if err != nil {
+		return 0, err
+	}
+	tradeAgreementBytes, err := getAssetState(stub, tradeKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		return 0, errors.New(fmt.Sprintf("No record found for trade ID %s", tradeID))
+	}
+
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return 0, err
+	}
+
+	if tradeAgreement.Status != DEFAULTED {
+		step, _, err := getLateTradeStep(stub, tradeID, tradeAgreement)
+		if err != nil {
+			return 0, err
+		}
+		if step != PAYMENT_STEP {
+			return 0, errors.New(fmt.Sprintf("Payment for trade %s is not overdue", tradeID))
+		}
+	}
+	return tradeAgreement.Amount - tradeAgreement.Payment, nil
+}
+
+// Issue a standby L/C or demand guarantee in favour of the exporter, optionally backing a trade
+func (t *TradeWorkflowChaincode) issueGuarantee(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var guaranteeKey, tradeID, tradeKey string
+	var guaranteeBytes, tradeAgreementBytes, applicantBytes, beneficiaryBytes, guarantorBytes []byte
+	var guarantee *Guarantee
+	var amount int
+	var expirationDate time.Time
+	var txTime time.Time
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	}
+
+	if len(args) != 4 && len(args) != 5 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 4 or 5: {Guarantee ID, Type, Amount, Expiration Date} [Trade ID]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	if args[1] != STANDBY_LC && args[1] != DEMAND_GUARANTEE {
+		err = errors.New(fmt.Sprintf("Invalid guarantee type %s; Permissible values: {%s, %s}", args[1], STANDBY_LC, DEMAND_GUARANTEE))
+		return shim.Error(err.Error())
+	}
+
+	amount, err = strconv.Atoi(string(args[2]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount <= 0 {
+		return shim.Error("Guarantee amount must be positive")
+	}
+
+	expirationDate, err = time.Parse(time.RFC3339, args[3])
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Invalid expiration date %s; expecting an RFC 3339 timestamp", args[3]))
+		return shim.Error(err.Error())
+	}
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !expirationDate.After(txTime) {
+		return shim.Error("Guarantee expiration date must be in the future")
+	}
+
+	// Verify that the backed trade exists
+	if len(args) == 5 {
+		tradeID = args[4]
+		if tradeID == "" {
+			return shim.Error("Trade ID cannot be empty")
+		}
+		tradeKey, err = getTradeKey(stub, tradeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if len(tradeAgreementBytes) == 0 {
+			err = errors.New(fmt.Sprintf("No record found for trade ID %s", tradeID))
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Check that the guarantee ID is not in use
+	guaranteeKey, err = getGuaranteeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	guaranteeBytes, err = getAssetState(stub, guaranteeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(guaranteeBytes) != 0 {
+		err = errors.New(fmt.Sprintf("Guarantee %s already issued", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup importer (applicant), exporter (beneficiary) and importer's bank (guarantor)
+	applicantBytes, err = stub.GetState(impKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	beneficiaryBytes, err = stub.GetState(expKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	guarantorBytes, err = stub.GetState(ibKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	guarantee = &Guarantee{args[0], args[1], tradeID, string(applicantBytes), string(beneficiaryBytes), string(guarantorBytes), amount, args[3], 0, ISSUED}
+
+	// Write the state to the ledger
+	err = putGuarantee(stub, guaranteeKey, guarantee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Guarantee %s issued for amount %d\n", args[0], amount)
+
+	return shim.Success(nil)
+}
+
+// Accept a guarantee on behalf of the beneficiary
+func (t *TradeWorkflowChaincode) acceptGuarantee(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var guaranteeKey string
+	var guarantee *Guarantee
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Guarantee ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	guaranteeKey, guarantee, err = lookupGuarantee(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if guarantee.Status == ACCEPTED {
+		fmt.Printf("Guarantee %s already accepted", args[0])
+		return shim.Success(nil)
+	}
+	if guarantee.Status != ISSUED {
+		err = errors.New(fmt.Sprintf("Guarantee %s cannot be accepted in status %s", args[0], guarantee.Status))
+		return shim.Error(err.Error())
+	}
+
+	guarantee.Status = ACCEPTED
+	err = putGuarantee(stub, guaranteeKey, guarantee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Guarantee %s acceptance recorded\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Claim under a guarantee; a claim against a guarantee backing a trade requires the trade payment to be overdue
+func (t *TradeWorkflowChaincode) claimGuarantee(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var guaranteeKey string
+	var guarantee *Guarantee
+	var claimAmount, outstanding int
+	var expired bool
+	var err error
+
+	// Access control: Only an Exporting Entity Org member can invoke this transaction
+	if !t.testMode && !authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Guarantee ID, Claim Amount}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	claimAmount, err = strconv.Atoi(string(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	guaranteeKey, guarantee, err = lookupGuarantee(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if guarantee.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("Guarantee %s cannot be claimed in status %s", args[0], guarantee.Status))
+		return shim.Error(err.Error())
+	}
+
+	expired, err = isGuaranteeExpired(stub, guarantee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if expired {
+		err = errors.New(fmt.Sprintf("Guarantee %s expired on %s", args[0], guarantee.ExpirationDate))
+		return shim.Error(err.Error())
+	}
+
+	if claimAmount <= 0 || claimAmount > guarantee.Amount {
+		err = errors.New(fmt.Sprintf("Claim amount must be positive and may not exceed the guaranteed amount %d", guarantee.Amount))
+		return shim.Error(err.Error())
+	}
+
+	if guarantee.TradeId != "" {
+		outstanding, err = checkTradePaymentOverdue(stub, guarantee.TradeId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if claimAmount > outstanding {
+			err = errors.New(fmt.Sprintf("Claim amount %d exceeds the amount outstanding %d for trade %s", claimAmount, outstanding, guarantee.TradeId))
+			return shim.Error(err.Error())
+		}
+	}
+
+	guarantee.ClaimAmount = claimAmount
+	guarantee.Status = CLAIMED
+	err = putGuarantee(stub, guaranteeKey, guarantee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Claim of %d under guarantee %s recorded\n", claimAmount, args[0])
+
+	return shim.Success(nil)
+}
+
+// Pay out a claim; the guarantor debits the applicant's account and, for a trade-backed guarantee,
+// the payout counts towards the trade payment
+func (t *TradeWorkflowChaincode) payGuarantee(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var guaranteeKey, tradeKey, guarantorBalKey string
+	var tradeAgreementBytes []byte
+	var guarantee *Guarantee
+	var tradeAgreement *TradeAgreement
+	var guarantorBal int
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Guarantee ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	guaranteeKey, guarantee, err = lookupGuarantee(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if guarantee.Status == PAID {
+		err = errors.New(fmt.Sprintf("Claim under guarantee %s already paid", args[0]))
+		return shim.Error(err.Error())
+	}
+	if guarantee.Status != CLAIMED {
+		err = errors.New(fmt.Sprintf("No claim pending under guarantee %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// The guarantor pays the claim from the funds in its own account
+	guarantorBalKey, err = getBankBalanceKey(stub, guarantee.Guarantor)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	guarantorBal, err = getBalance(stub, guarantorBalKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if guarantorBal < guarantee.ClaimAmount {
+		err = errors.New(fmt.Sprintf("Guarantor's balance %d is insufficient to pay the claim of %d under guarantee %s", guarantorBal, guarantee.ClaimAmount, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	if guarantee.TradeId != "" {
+		// Payments on a trade are frozen while it is disputed
+		err = checkNoOpenDispute(stub, guarantee.TradeId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		tradeKey, err = getTradeKey(stub, guarantee.TradeId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if len(tradeAgreementBytes) == 0 {
+			err = errors.New(fmt.Sprintf("No record found for trade ID %s", guarantee.TradeId))
+			return shim.Error(err.Error())
+		}
+
+		err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// The trade may have been paid since the claim was made
+		if guarantee.ClaimAmount > tradeAgreement.Amount - tradeAgreement.Payment {
+			err = errors.New(fmt.Sprintf("Claim amount %d exceeds the amount outstanding %d for trade %s", guarantee.ClaimAmount, tradeAgreement.Amount - tradeAgreement.Payment, guarantee.TradeId))
+			return shim.Error(err.Error())
+		}
+
+		tradeAgreement.Payment += guarantee.ClaimAmount
+		tradeAgreementBytes, err = json.Marshal(tradeAgreement)
+		if err != nil {
+			return shim.Error("Error marshaling trade agreement structure")
+		}
+		err = putAssetState(stub, tradeKey, tradeAgreementBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// As for any other payment on the trade, the escrow and the credit drawn for the amount paid are released to the importer
+		err = drawEscrow(stub, guarantee.TradeId, guarantee.ClaimAmount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = releaseCredit(stub, guarantee.TradeId, guarantee.ClaimAmount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	err = transferFunds(stub, guarantorBalKey, expBalKey, guarantee.ClaimAmount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	guarantee.Status = PAID
+	err = putGuarantee(stub, guaranteeKey, guarantee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Claim of %d under guarantee %s paid\n", guarantee.ClaimAmount, args[0])
+
+	return shim.Success(nil)
+}
+
+// Expire an unclaimed guarantee once its expiration date has passed
+func (t *TradeWorkflowChaincode) expireGuarantee(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var guaranteeKey string
+	var guarantee *Guarantee
+	var expired bool
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Guarantee ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	guaranteeKey, guarantee, err = lookupGuarantee(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if guarantee.Status == EXPIRED {
+		fmt.Printf("Guarantee %s already expired", args[0])
+		return shim.Success(nil)
+	}
+	if guarantee.Status != ISSUED && guarantee.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("Guarantee %s cannot expire in status %s", args[0], guarantee.Status))
+		return shim.Error(err.Error())
+	}
+
+	expired, err = isGuaranteeExpired(stub, guarantee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !expired {
+		err = errors.New(fmt.Sprintf("Guarantee %s is valid until %s", args[0], guarantee.ExpirationDate))
+		return shim.Error(err.Error())
+	}
+
+	guarantee.Status = EXPIRED
+	err = putGuarantee(stub, guaranteeKey, guarantee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Guarantee %s expired\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Get a guarantee
+func (t *TradeWorkflowChaincode) getGuarantee(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var guaranteeKey, jsonResp string
+	var guaranteeBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter or Exporting Entity Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1: <guarantee ID>")
+	}
+
+	// Get the state from the ledger
+	guaranteeKey, err = getGuaranteeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	guaranteeBytes, err = getAssetState(stub, guaranteeKey)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + guaranteeKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	if len(guaranteeBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + guaranteeKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(guaranteeBytes))
+	return shim.Success(guaranteeBytes)
+}
@@ -0,0 +1,520 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupInsuranceCertificate(stub shim.ChaincodeStubInterface, tradeID string) (string, *InsuranceCertificate, error) {
+	var insuranceCertificate *InsuranceCertificate
+
+	insuranceCertificateKey, err := getInsuranceCertificateKey(stub, tradeID)
+	if err != nil {
+		return "", nil, err
+	}
+	insuranceCertificateBytes, err := getAssetState(stub, insuranceCertificateKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(insuranceCertificateBytes) == 0 {
+		return insuranceCertificateKey, nil, nil
+	}
+
+	err = json.Unmarshal(insuranceCertificateBytes, &insuranceCertificate)
+	if err != nil {
+		return "", nil, err
+	}
+	return insuranceCertificateKey, insuranceCertificate, nil
+}
+
+func putInsuranceCertificate(stub shim.ChaincodeStubInterface, insuranceCertificateKey string, insuranceCertificate *InsuranceCertificate) error {
+	insuranceCertificateBytes, err := json.Marshal(insuranceCertificate)
+	if err != nil {
+		return errors.New("Error marshaling insurance certificate structure")
+	}
+	return putAssetState(stub, insuranceCertificateKey, insuranceCertificateBytes)
+}
+
+// The B/Ls issued for the trade and for each of its lots
+func getIssuedBillsOfLading(stub shim.ChaincodeStubInterface, tradeID string) ([]*BillOfLading, error) {
+	var billOfLading *BillOfLading
+
+	blKeys := []string{}
+	blKey, err := getBLKey(stub, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	blKeys = append(blKeys, blKey)
+
+	lots, err := getTradeLots(stub, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, lot := range lots {
+		lotBLKey, err := getLotBLKey(stub, tradeID, lot.Id)
+		if err != nil {
+			return nil, err
+		}
+		blKeys = append(blKeys, lotBLKey)
+	}
+
+	billsOfLading := []*BillOfLading{}
+	for _, key := range blKeys {
+		billOfLadingBytes, err := getAssetState(stub, key)
+		if err != nil {
+			return nil, err
+		}
+		if len(billOfLadingBytes) == 0 {
+			continue
+		}
+		billOfLading = nil
+		err = json.Unmarshal(billOfLadingBytes, &billOfLading)
+		if err != nil {
+			return nil, err
+		}
+		billsOfLading = append(billsOfLading, billOfLading)
+	}
+	return billsOfLading, nil
+}
+
+// An insurance certificate is good for presentation while it has not expired, and only if it was in force
+// when each B/L was issued, that is when the goods it covers were shipped
+func isInsuranceCertificateInForce(stub shim.ChaincodeStubInterface, insuranceCertificate *InsuranceCertificate, billsOfLading []*BillOfLading) (bool, error) {
+	validFrom, err := time.Parse(time.RFC3339, insuranceCertificate.ValidFrom)
+	if err != nil {
+		return false, err
+	}
+	validUntil, err := time.Parse(time.RFC3339, insuranceCertificate.ValidUntil)
+	if err != nil {
+		return false, err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return false, err
+	}
+	if txTime.After(validUntil) {
+		return false, nil
+	}
+	for _, billOfLading := range billsOfLading {
+		if billOfLading.IssueDate == "" {
+			continue
+		}
+		issueDate, err := time.Parse(time.RFC3339, billOfLading.IssueDate)
+		if err != nil {
+			return false, err
+		}
+		if issueDate.Before(validFrom) || issueDate.After(validUntil) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Check each document the L/C calls for, and each required certificate type, against the records on the ledger;
+// an insurance certificate is only good if it insures at least the L/C amount and is in force, and a required
+// certificate type is missing unless a registered issuer has certified the trade, even if the L/C does not call for it
+func getPresentation(stub shim.ChaincodeStubInterface, tradeID string, letterOfCredit *LetterOfCredit, requiredTypes []string) (*Presentation, error) {
+	var exportLicense *ExportLicense
+	var presented bool
+
+	documents := []string{}
+	if letterOfCredit != nil {
+		documents = append(documents, letterOfCredit.Documents...)
+	}
+	for _, certificateType := range requiredTypes {
+		if !containsString(documents, certificateType) {
+			documents = append(documents, certificateType)
+		}
+	}
+
+	presentation := &Presentation{tradeID, []string{}, []string{}, []string{}}
+	for _, document := range documents {
+		switch document {
+		case EXPORT_LICENSE_DOC:
+			elKey, err := getELKey(stub, tradeID)
+			if err != nil {
+				return nil, err
+			}
+			exportLicenseBytes, err := getAssetState(stub, elKey)
+			if err != nil {
+				return nil, err
+			}
+			exportLicense = nil
+			if len(exportLicenseBytes) != 0 {
+				err = json.Unmarshal(exportLicenseBytes, &exportLicense)
+				if err != nil {
+					return nil, err
+				}
+			}
+			presented = exportLicense != nil && exportLicense.Status == ISSUED
+		case BILL_OF_LADING_DOC:
+			billsOfLading, err := getIssuedBillsOfLading(stub, tradeID)
+			if err != nil {
+				return nil, err
+			}
+			presented = len(billsOfLading) > 0
+		case INSURANCE_CERTIFICATE_DOC:
+			_, insuranceCertificate, err := lookupInsuranceCertificate(stub, tradeID)
+			if err != nil {
+				return nil, err
+			}
+			presented = insuranceCertificate != nil && insuranceCertificate.InsuredValue >= letterOfCredit.Amount
+			if presented {
+				billsOfLading, err := getIssuedBillsOfLading(stub, tradeID)
+				if err != nil {
+					return nil, err
+				}
+				presented, err = isInsuranceCertificateInForce(stub, insuranceCertificate, billsOfLading)
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			// Documents certified by registered third parties are verified against the certificates issued for the trade
+			certificateType, err := isCertificateType(stub, document)
+			if err != nil {
+				return nil, err
+			}
+			if !certificateType && !containsString(requiredTypes, document) {
+				presentation.Unverified = append(presentation.Unverified, document)
+				continue
+			}
+			certified, err := isTradeCertified(stub, tradeID, document)
+			if err != nil {
+				return nil, err
+			}
+			presented = certified
+		}
+
+		if presented {
+			presentation.Presented = append(presentation.Presented, document)
+		} else {
+			presentation.Missing = append(presentation.Missing, document)
+		}
+	}
+	return presentation, nil
+}
+
+// Payment is not due under an L/C calling for an insurance certificate or third-party certificates, nor while a required
+// certificate type is not certified, until they have been presented
+func checkDocumentsPresented(stub shim.ChaincodeStubInterface, tradeID string, letterOfCredit *LetterOfCredit, requiredTypes []string) error {
+	if letterOfCredit == nil && len(requiredTypes) == 0 {
+		return nil
+	}
+	presentation, err := getPresentation(stub, tradeID, letterOfCredit, requiredTypes)
+	if err != nil {
+		return err
+	}
+	for _, document := range presentation.Missing {
+		switch document {
+		case EXPORT_LICENSE_DOC, BILL_OF_LADING_DOC:
+			continue
+		case INSURANCE_CERTIFICATE_DOC:
+			return errors.New(fmt.Sprintf("No insurance certificate in force covering the L/C amount %d presented for trade %s", letterOfCredit.Amount, tradeID))
+		default:
+			return errors.New(fmt.Sprintf("No %s certificate presented for trade %s", document, tradeID))
+		}
+	}
+	return nil
+}
+
+// Register the insurer and the organization its members belong to, in place of any insurer named in 'init'
+func (t *TradeWorkflowChaincode) registerInsurer(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var err error
+
+	// Access control: Only a Regulator Org member can invoke this transaction
+	if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Regulator Org. Access denied.")
+	}
+
+	if len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Insurer, MSP ID, CA Name}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+	if args[0] == "" || args[1] == "" || args[2] == "" {
+		return shim.Error("Insurer, MSP ID and CA name must not be empty")
+	}
+
+	for i, roleKey := range []string{ insKey, insMspKey, insCAKey } {
+		err = stub.PutState(roleKey, []byte(args[i]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	fmt.Printf("Insurer %s registered for %s (%s)\n", args[0], args[1], args[2])
+
+	return shim.Success(nil)
+}
+
+// Issue the insurance certificate of a trade
+func (t *TradeWorkflowChaincode) issueInsuranceCertificate(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var insuranceCertificateKey string
+	var insurerBytes []byte
+	var insuranceCertificate *InsuranceCertificate
+	var insuredValue int
+	var validFrom, validUntil time.Time
+	var err error
+
+	// Access control: Only an Insurer Org member can invoke this transaction
+	if !t.testMode && !authenticateInsurerOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Insurer Org. Access denied.")
+	}
+
+	if len(args) != 7 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 7: {Trade ID, Certificate ID, Policy ID, Insured Value, Coverage, Valid From, Valid Until}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	insuredValue, err = strconv.Atoi(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if insuredValue <= 0 {
+		return shim.Error("Insured value must be positive")
+	}
+	validFrom, err = time.Parse(time.RFC3339, args[5])
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Invalid start of validity %s; expecting an RFC 3339 timestamp", args[5]))
+		return shim.Error(err.Error())
+	}
+	validUntil, err = time.Parse(time.RFC3339, args[6])
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Invalid end of validity %s; expecting an RFC 3339 timestamp", args[6]))
+		return shim.Error(err.Error())
+	}
+	if !validUntil.After(validFrom) {
+		return shim.Error("Insurance certificate must be valid until after it comes into force")
+	}
+
+	// The ledger must have an insurer among its participants
+	insurerBytes, err = stub.GetState(insKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(insurerBytes) == 0 {
+		return shim.Error("No insurer recorded on the ledger")
+	}
+
+	// Verify that the insured trade exists
+	_, _, err = lookupTradeAgreement(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	insuranceCertificateKey, insuranceCertificate, err = lookupInsuranceCertificate(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if insuranceCertificate != nil {
+		err = errors.New(fmt.Sprintf("Insurance certificate %s already issued for trade %s", insuranceCertificate.Id, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	insuranceCertificate = &InsuranceCertificate{args[1], args[0], string(insurerBytes), args[2], insuredValue, args[4], validFrom.UTC().Format(time.RFC3339), validUntil.UTC().Format(time.RFC3339), 0, "", ISSUED}
+	err = putInsuranceCertificate(stub, insuranceCertificateKey, insuranceCertificate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Insurance certificate %s for trade %s issued: insured value %d\n", args[1], args[0], insuredValue)
+
+	return shim.Success(nil)
+}
+
+// Claim on the insurance of a trade whose goods were reported damaged or short on delivery
+func (t *TradeWorkflowChaincode) raiseInsuranceClaim(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var insuranceCertificateKey, deliveryKey string
+	var deliveryBytes []byte
+	var insuranceCertificate *InsuranceCertificate
+	var delivery *Delivery
+	var claimAmount int
+	var validFrom, validUntil, txTime time.Time
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	}
+
+	if len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Trade ID, Claim Amount, Reason}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	claimAmount, err = strconv.Atoi(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if claimAmount <= 0 {
+		return shim.Error("Claim amount must be positive")
+	}
+
+	insuranceCertificateKey, insuranceCertificate, err = lookupInsuranceCertificate(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if insuranceCertificate == nil {
+		err = errors.New(fmt.Sprintf("No insurance certificate found for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	if insuranceCertificate.Status != ISSUED {
+		err = errors.New(fmt.Sprintf("Insurance certificate %s is %s", insuranceCertificate.Id, insuranceCertificate.Status))
+		return shim.Error(err.Error())
+	}
+	if claimAmount > insuranceCertificate.InsuredValue {
+		err = errors.New(fmt.Sprintf("Claim amount %d exceeds the insured value %d", claimAmount, insuranceCertificate.InsuredValue))
+		return shim.Error(err.Error())
+	}
+
+	// Claims are made within the validity of the certificate
+	validFrom, err = time.Parse(time.RFC3339, insuranceCertificate.ValidFrom)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	validUntil, err = time.Parse(time.RFC3339, insuranceCertificate.ValidUntil)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if txTime.Before(validFrom) || txTime.After(validUntil) {
+		err = errors.New(fmt.Sprintf("Insurance certificate %s is valid from %s until %s", insuranceCertificate.Id, insuranceCertificate.ValidFrom, insuranceCertificate.ValidUntil))
+		return shim.Error(err.Error())
+	}
+
+	// The importer must have reported the goods damaged or short on receipt
+	deliveryKey, err = getDeliveryKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	deliveryBytes, err = getAssetState(stub, deliveryKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(deliveryBytes) != 0 {
+		err = json.Unmarshal(deliveryBytes, &delivery)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if delivery == nil || (delivery.Condition != DAMAGED && delivery.Condition != SHORT) {
+		err = errors.New(fmt.Sprintf("No damage or shortage reported on delivery for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	insuranceCertificate.ClaimAmount = claimAmount
+	insuranceCertificate.ClaimReason = args[2]
+	insuranceCertificate.Status = CLAIMED
+	err = putInsuranceCertificate(stub, insuranceCertificateKey, insuranceCertificate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Claim of %d raised on insurance certificate %s for trade %s\n", claimAmount, insuranceCertificate.Id, args[0])
+
+	return shim.Success(nil)
+}
+
+// Get the insurance certificate of a trade
+func (t *TradeWorkflowChaincode) getInsuranceCertificate(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var insuranceCertificateKey, jsonResp string
+	var insuranceCertificateBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter or Insurer Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateInsurerOrg(stub, creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Insurer Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	insuranceCertificateKey, err = getInsuranceCertificateKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	insuranceCertificateBytes, err = getAssetState(stub, insuranceCertificateKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(insuranceCertificateBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + insuranceCertificateKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(insuranceCertificateBytes))
+	return shim.Success(insuranceCertificateBytes)
+}
+
+// Check the documents presented for a trade against those its L/C calls for, and any required certificate types
+func (t *TradeWorkflowChaincode) getDocumentPresentation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lcKey, jsonResp string
+	var presentationBytes []byte
+	var letterOfCredit *LetterOfCredit
+	var presentation *Presentation
+	var requiredTypes []string
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	args, requiredTypes, err = splitRequiredCertificates(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID} [Require=<type>[,<type>...]]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit == nil {
+		jsonResp = "{\"Error\":\"No record found for " + lcKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	presentation, err = getPresentation(stub, args[0], letterOfCredit, requiredTypes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	presentationBytes, err = json.Marshal(presentation)
+	if err != nil {
+		return shim.Error("Error marshaling document presentation")
+	}
+	fmt.Printf("Query Response:%s\n", string(presentationBytes))
+	return shim.Success(presentationBytes)
+}
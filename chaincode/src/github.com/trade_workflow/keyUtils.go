@@ -38,6 +38,16 @@ func getLCKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error)
 	}
 }
 
+// A trade's L/C and the L/Cs issued against it share the trade ID as the first attribute of their keys
+func getChildLCKey(stub shim.ChaincodeStubInterface, tradeID string, lcID string) (string, error) {
+	childLCKey, err := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID, lcID})
+	if err != nil {
+		return "", err
+	} else {
+		return childLCKey, nil
+	}
+}
+
 func getELKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
 	elKey, err := stub.CreateCompositeKey("ExportLicense", []string{tradeID})
 	if err != nil {
@@ -65,11 +75,263 @@ func getBLKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error)
 	}
 }
 
-func getPaymentKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
-	paymentKey, err := stub.CreateCompositeKey("Payment", []string{tradeID})
+func getDeliveryKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
+	deliveryKey, err := stub.CreateCompositeKey("Delivery", []string{tradeID})
+	if err != nil {
+		return "", err
+	} else {
+		return deliveryKey, nil
+	}
+}
+
+func getPaymentKey(stub shim.ChaincodeStubInterface, tradeID string, paymentRequestID string) (string, error) {
+	paymentKey, err := stub.CreateCompositeKey("Payment", []string{tradeID, paymentRequestID})
 	if err != nil {
 		return "", err
 	} else {
 		return paymentKey, nil
 	}
 }
+
+func getDisputeKey(stub shim.ChaincodeStubInterface, tradeID string, disputeID string) (string, error) {
+	disputeKey, err := stub.CreateCompositeKey("Dispute", []string{tradeID, disputeID})
+	if err != nil {
+		return "", err
+	} else {
+		return disputeKey, nil
+	}
+}
+
+func getGuaranteeKey(stub shim.ChaincodeStubInterface, guaranteeID string) (string, error) {
+	guaranteeKey, err := stub.CreateCompositeKey("Guarantee", []string{guaranteeID})
+	if err != nil {
+		return "", err
+	} else {
+		return guaranteeKey, nil
+	}
+}
+
+func getCreditFacilityKey(stub shim.ChaincodeStubInterface, importer string) (string, error) {
+	creditFacilityKey, err := stub.CreateCompositeKey("CreditFacility", []string{importer})
+	if err != nil {
+		return "", err
+	} else {
+		return creditFacilityKey, nil
+	}
+}
+
+func getFeatureKey(stub shim.ChaincodeStubInterface, feature string) (string, error) {
+	featureKey, err := stub.CreateCompositeKey("Feature", []string{feature})
+	if err != nil {
+		return "", err
+	} else {
+		return featureKey, nil
+	}
+}
+
+func getSettingKey(stub shim.ChaincodeStubInterface, setting string) (string, error) {
+	settingKey, err := stub.CreateCompositeKey("Setting", []string{setting})
+	if err != nil {
+		return "", err
+	} else {
+		return settingKey, nil
+	}
+}
+
+func getDelegationKey(stub shim.ChaincodeStubInterface, delegationID string) (string, error) {
+	delegationKey, err := stub.CreateCompositeKey("Delegation", []string{delegationID})
+	if err != nil {
+		return "", err
+	} else {
+		return delegationKey, nil
+	}
+}
+
+func getApprovalPolicyKey(stub shim.ChaincodeStubInterface, bank string) (string, error) {
+	approvalPolicyKey, err := stub.CreateCompositeKey("ApprovalPolicy", []string{bank})
+	if err != nil {
+		return "", err
+	} else {
+		return approvalPolicyKey, nil
+	}
+}
+
+func getProposalKey(stub shim.ChaincodeStubInterface, proposalID string) (string, error) {
+	proposalKey, err := stub.CreateCompositeKey("Proposal", []string{proposalID})
+	if err != nil {
+		return "", err
+	} else {
+		return proposalKey, nil
+	}
+}
+
+func getBankBalanceKey(stub shim.ChaincodeStubInterface, bank string) (string, error) {
+	bankBalanceKey, err := stub.CreateCompositeKey("BankAccountBalance", []string{bank})
+	if err != nil {
+		return "", err
+	} else {
+		return bankBalanceKey, nil
+	}
+}
+
+func getBeneficiaryBalanceKey(stub shim.ChaincodeStubInterface, beneficiary string) (string, error) {
+	beneficiaryBalanceKey, err := stub.CreateCompositeKey("BeneficiaryAccountBalance", []string{beneficiary})
+	if err != nil {
+		return "", err
+	} else {
+		return beneficiaryBalanceKey, nil
+	}
+}
+
+func getDraftKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
+	draftKey, err := stub.CreateCompositeKey("Draft", []string{tradeID})
+	if err != nil {
+		return "", err
+	} else {
+		return draftKey, nil
+	}
+}
+
+func getLotKey(stub shim.ChaincodeStubInterface, tradeID string, lotID string) (string, error) {
+	lotKey, err := stub.CreateCompositeKey("Lot", []string{tradeID, lotID})
+	if err != nil {
+		return "", err
+	} else {
+		return lotKey, nil
+	}
+}
+
+func getLotBLKey(stub shim.ChaincodeStubInterface, tradeID string, lotID string) (string, error) {
+	lotBLKey, err := stub.CreateCompositeKey("BillOfLading", []string{tradeID, lotID})
+	if err != nil {
+		return "", err
+	} else {
+		return lotBLKey, nil
+	}
+}
+
+func getFeeScheduleKey(stub shim.ChaincodeStubInterface, bank string) (string, error) {
+	feeScheduleKey, err := stub.CreateCompositeKey("FeeSchedule", []string{bank})
+	if err != nil {
+		return "", err
+	} else {
+		return feeScheduleKey, nil
+	}
+}
+
+func getChargeKey(stub shim.ChaincodeStubInterface, tradeID string, chargeID string) (string, error) {
+	chargeKey, err := stub.CreateCompositeKey("Charge", []string{tradeID, chargeID})
+	if err != nil {
+		return "", err
+	} else {
+		return chargeKey, nil
+	}
+}
+
+func getRatePublisherKey(stub shim.ChaincodeStubInterface, publisherID string) (string, error) {
+	ratePublisherKey, err := stub.CreateCompositeKey("RatePublisher", []string{publisherID})
+	if err != nil {
+		return "", err
+	} else {
+		return ratePublisherKey, nil
+	}
+}
+
+func getFXRateKey(stub shim.ChaincodeStubInterface, baseCurrency string, quoteCurrency string, validFrom string) (string, error) {
+	fxRateKey, err := stub.CreateCompositeKey("FXRate", []string{baseCurrency, quoteCurrency, validFrom})
+	if err != nil {
+		return "", err
+	} else {
+		return fxRateKey, nil
+	}
+}
+
+func getAccountCurrencyKey(stub shim.ChaincodeStubInterface, party string) (string, error) {
+	accountCurrencyKey, err := stub.CreateCompositeKey("AccountCurrency", []string{party})
+	if err != nil {
+		return "", err
+	} else {
+		return accountCurrencyKey, nil
+	}
+}
+
+func getInvoiceKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
+	invoiceKey, err := stub.CreateCompositeKey("Invoice", []string{tradeID})
+	if err != nil {
+		return "", err
+	} else {
+		return invoiceKey, nil
+	}
+}
+
+func getEscrowKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
+	escrowKey, err := stub.CreateCompositeKey("Escrow", []string{tradeID})
+	if err != nil {
+		return "", err
+	} else {
+		return escrowKey, nil
+	}
+}
+
+func getEscrowBalanceKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
+	escrowBalanceKey, err := stub.CreateCompositeKey("EscrowAccountBalance", []string{tradeID})
+	if err != nil {
+		return "", err
+	} else {
+		return escrowBalanceKey, nil
+	}
+}
+
+func getInsuranceCertificateKey(stub shim.ChaincodeStubInterface, tradeID string) (string, error) {
+	insuranceCertificateKey, err := stub.CreateCompositeKey("InsuranceCertificate", []string{tradeID})
+	if err != nil {
+		return "", err
+	} else {
+		return insuranceCertificateKey, nil
+	}
+}
+
+func getCertificateIssuerKey(stub shim.ChaincodeStubInterface, issuerID string) (string, error) {
+	certificateIssuerKey, err := stub.CreateCompositeKey("CertificateIssuer", []string{issuerID})
+	if err != nil {
+		return "", err
+	} else {
+		return certificateIssuerKey, nil
+	}
+}
+
+func getTradeCertificateKey(stub shim.ChaincodeStubInterface, tradeID string, certificateID string) (string, error) {
+	tradeCertificateKey, err := stub.CreateCompositeKey("TradeCertificate", []string{tradeID, certificateID})
+	if err != nil {
+		return "", err
+	} else {
+		return tradeCertificateKey, nil
+	}
+}
+
+func getAttachmentKey(stub shim.ChaincodeStubInterface, tradeID string, name string) (string, error) {
+	attachmentKey, err := stub.CreateCompositeKey("Attachment", []string{tradeID, name})
+	if err != nil {
+		return "", err
+	} else {
+		return attachmentKey, nil
+	}
+}
+
+func getDocumentAnchorKey(stub shim.ChaincodeStubInterface, hash string, tradeID string, record string, id string) (string, error) {
+	documentAnchorKey, err := stub.CreateCompositeKey("DocumentAnchor", []string{hash, tradeID, record, id})
+	if err != nil {
+		return "", err
+	} else {
+		return documentAnchorKey, nil
+	}
+}
+
+func getDocumentSignatureKey(stub shim.ChaincodeStubInterface, tradeID string, document string, signatureID string) (string, error) {
+	documentSignatureKey, err := stub.CreateCompositeKey("DocumentSignature", []string{tradeID, document, signatureID})
+	if err != nil {
+		return "", err
+	} else {
+		return documentSignatureKey, nil
+	}
+}
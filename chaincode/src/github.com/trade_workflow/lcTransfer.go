@@ -0,0 +1,402 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Lookup an L/C by its key; nil if there is none
+func lookupLetterOfCredit(stub shim.ChaincodeStubInterface, lcKey string) (*LetterOfCredit, error) {
+	var letterOfCredit *LetterOfCredit
+
+	letterOfCreditBytes, err := getAssetState(stub, lcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(letterOfCreditBytes) == 0 {
+		return nil, nil
+	}
+
+	err = json.Unmarshal(letterOfCreditBytes, &letterOfCredit)
+	if err != nil {
+		return nil, err
+	}
+	return letterOfCredit, nil
+}
+
+func putLetterOfCredit(stub shim.ChaincodeStubInterface, lcKey string, letterOfCredit *LetterOfCredit) error {
+	letterOfCreditBytes, err := json.Marshal(letterOfCredit)
+	if err != nil {
+		return errors.New("Error marshaling L/C structure")
+	}
+	return putAssetState(stub, lcKey, letterOfCreditBytes)
+}
+
+// Amount of a trade's L/C that is still available for a new L/C of the given type.
+// Transferred amounts are carved out of what the exporter may draw, while back-to-back L/Cs are only
+// secured by the original L/C; the L/Cs issued against it may never add up to more than its amount.
+func getChildLCHeadroom(letterOfCredit *LetterOfCredit, lcType string) int {
+	headroom := letterOfCredit.Amount - letterOfCredit.Transferred - letterOfCredit.BackToBack
+	if lcType == TRANSFERRED && letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred < headroom {
+		headroom = letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred
+	}
+	return headroom
+}
+
+// Record a new L/C linked to the L/C of a trade
+func issueChildLC(stub shim.ChaincodeStubInterface, lcType string, tradeID string, lcID string, beneficiary string, amountStr string, expirationDate string, documents []string) error {
+	var lcKey, childLCKey, beneficiaryBalanceKey string
+	var letterOfCredit, childLC *LetterOfCredit
+	var amount, headroom int
+	var err error
+
+	amount, err = strconv.Atoi(amountStr)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return errors.New(fmt.Sprintf("Invalid amount %d", amount))
+	}
+	if lcID == "" || beneficiary == "" {
+		return errors.New("L/C ID and beneficiary must be specified")
+	}
+
+	// Lookup the trade's L/C, which the new L/C is issued against
+	lcKey, err = getLCKey(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return err
+	}
+	if letterOfCredit == nil {
+		return errors.New(fmt.Sprintf("No L/C found for trade %s", tradeID))
+	}
+	if letterOfCredit.Status != ACCEPTED {
+		return errors.New(fmt.Sprintf("L/C for trade %s has not been accepted", tradeID))
+	}
+	if lcType == TRANSFERRED && !letterOfCredit.Transferable {
+		return errors.New(fmt.Sprintf("L/C for trade %s is not transferable", tradeID))
+	}
+	if lcID == letterOfCredit.Id {
+		return errors.New(fmt.Sprintf("L/C ID %s already in use", lcID))
+	}
+
+	childLCKey, err = getChildLCKey(stub, tradeID, lcID)
+	if err != nil {
+		return err
+	}
+	childLC, err = lookupLetterOfCredit(stub, childLCKey)
+	if err != nil {
+		return err
+	}
+	if childLC != nil {
+		return errors.New(fmt.Sprintf("L/C ID %s already in use", lcID))
+	}
+
+	headroom = getChildLCHeadroom(letterOfCredit, lcType)
+	if amount > headroom {
+		return errors.New(fmt.Sprintf("Amount %d exceeds the balance %d available under the L/C for trade %s", amount, headroom, tradeID))
+	}
+
+	if lcType == TRANSFERRED {
+		letterOfCredit.Transferred += amount
+	} else {
+		letterOfCredit.BackToBack += amount
+	}
+	err = putLetterOfCredit(stub, lcKey, letterOfCredit)
+	if err != nil {
+		return err
+	}
+
+	childLC = &LetterOfCredit{lcID, expirationDate, beneficiary, amount, documents, ISSUED, "", "", false, false, false, lcType, letterOfCredit.Id, 0, 0, 0, 0, false, nil}
+	err = putLetterOfCredit(stub, childLCKey, childLC)
+	if err != nil {
+		return err
+	}
+
+	// Open an account for the beneficiary to receive payments into
+	beneficiaryBalanceKey, err = getBeneficiaryBalanceKey(stub, beneficiary)
+	if err != nil {
+		return err
+	}
+	return openAccount(stub, beneficiaryBalanceKey)
+}
+
+// Transfer part or all of a transferable L/C to a second beneficiary
+func (t *TradeWorkflowChaincode) transferLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lcKey, expirationDate string
+	var letterOfCredit *LetterOfCredit
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	}
+
+	if len(args) != 4 && len(args) != 5 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 4 or 5: {Trade ID, L/C ID, Second Beneficiary, Amount} [Expiry Date]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// The transferred L/C carries the terms of the original unless an earlier expiry is given
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit == nil {
+		err = errors.New(fmt.Sprintf("No L/C found for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	expirationDate = letterOfCredit.ExpirationDate
+	if len(args) == 5 {
+		expirationDate = args[4]
+	}
+
+	err = issueChildLC(stub, TRANSFERRED, args[0], args[1], args[2], args[3], expirationDate, letterOfCredit.Documents)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Transfer of %s under L/C for trade %s to %s recorded as L/C %s\n", args[3], args[0], args[2], args[1])
+
+	return shim.Success(nil)
+}
+
+// Issue a back-to-back L/C in favour of the exporter's supplier, secured by the L/C of the trade
+func (t *TradeWorkflowChaincode) issueBackToBackLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	}
+
+	if len(args) < 5 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting at least 5: {Trade ID, L/C ID, Beneficiary, Amount, Expiry Date} [List of Documents]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	err = issueChildLC(stub, BACK_TO_BACK, args[0], args[1], args[2], args[3], args[4], args[5:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Back-to-back L/C %s of %s for trade %s issued to %s\n", args[1], args[3], args[0], args[2])
+
+	return shim.Success(nil)
+}
+
+// Pay the beneficiary of a transferred or back-to-back L/C.
+// The importer's bank pays under a transferred L/C, as part of the trade; the exporter's bank pays under a back-to-back L/C.
+func (t *TradeWorkflowChaincode) payChildLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var childLCKey, tradeKey, payerBalKey, beneficiaryBalanceKey string
+	var tradeAgreementBytes []byte
+	var childLC *LetterOfCredit
+	var tradeAgreement *TradeAgreement
+	var amount, debitAmount int
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Trade ID, L/C ID, Amount}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	amount, err = strconv.Atoi(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount <= 0 {
+		err = errors.New(fmt.Sprintf("Invalid amount %d", amount))
+		return shim.Error(err.Error())
+	}
+
+	childLCKey, err = getChildLCKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	childLC, err = lookupLetterOfCredit(stub, childLCKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if childLC == nil {
+		err = errors.New(fmt.Sprintf("No L/C %s found for trade %s", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+	if childLC.Status != ISSUED {
+		err = errors.New(fmt.Sprintf("L/C %s is %s", args[1], childLC.Status))
+		return shim.Error(err.Error())
+	}
+	if childLC.Drawn + amount > childLC.Amount {
+		err = errors.New(fmt.Sprintf("Amount %d exceeds the balance %d available under L/C %s", amount, childLC.Amount - childLC.Drawn, args[1]))
+		return shim.Error(err.Error())
+	}
+
+	if childLC.Type == TRANSFERRED {
+		// Access control: Only an Importer Org member can pay under a transferred L/C
+		if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+			return shim.Error("Caller not a member of Importer Org. Access denied.")
+		}
+
+		// Payments to the second beneficiary count towards the trade
+		tradeKey, err = getTradeKey(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if tradeAgreement.Payment + amount > tradeAgreement.Amount {
+			err = errors.New(fmt.Sprintf("Payment amount %d exceeds the amount outstanding %d for trade %s", amount, tradeAgreement.Amount - tradeAgreement.Payment, args[0]))
+			return shim.Error(err.Error())
+		}
+		tradeAgreement.Payment += amount
+		tradeAgreementBytes, err = json.Marshal(tradeAgreement)
+		if err != nil {
+			return shim.Error("Error marshaling trade agreement structure")
+		}
+		err = putAssetState(stub, tradeKey, tradeAgreementBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		err = releaseCredit(stub, args[0], amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// The importer's account is debited in its own currency, converted at the latest published rate
+		debitAmount, _, _, err = convertImporterPayment(stub, amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = drawEscrow(stub, args[0], debitAmount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		payerBalKey = impBalKey
+	} else {
+		// Access control: Only an Exporter Org member can pay under a back-to-back L/C
+		if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+			return shim.Error("Caller not a member of Exporter Org. Access denied.")
+		}
+		debitAmount = amount
+		payerBalKey = expBalKey
+	}
+
+	beneficiaryBalanceKey, err = getBeneficiaryBalanceKey(stub, childLC.Beneficiary)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if debitAmount == amount {
+		err = transferFunds(stub, payerBalKey, beneficiaryBalanceKey, amount)
+	} else {
+		err = exchangeFunds(stub, payerBalKey, debitAmount, beneficiaryBalanceKey, amount)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	childLC.Drawn += amount
+	if childLC.Drawn == childLC.Amount {
+		childLC.Status = PAID
+	}
+	err = putLetterOfCredit(stub, childLCKey, childLC)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Payment of %d under L/C %s for trade %s made to %s\n", amount, args[1], args[0], childLC.Beneficiary)
+
+	return shim.Success(nil)
+}
+
+// Get the L/Cs issued against the L/C of a trade
+func (t *TradeWorkflowChaincode) getChildLCs(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var letterOfCredit *LetterOfCredit
+	var childLCsBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	lcsIterator, err := stub.GetStateByPartialCompositeKey("LetterOfCredit", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer lcsIterator.Close()
+
+	childLCs := []*LetterOfCredit{}
+	for lcsIterator.HasNext() {
+		lcKV, err := lcsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		value, err := upgradeAssetState(stub, lcKV.Key, lcKV.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = json.Unmarshal(value, &letterOfCredit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if letterOfCredit.Type != "" {
+			childLCs = append(childLCs, letterOfCredit)
+		}
+		letterOfCredit = nil
+	}
+
+	childLCsBytes, err = json.Marshal(childLCs)
+	if err != nil {
+		return shim.Error("Error marshaling L/Cs")
+	}
+	fmt.Printf("Query Response:%s\n", string(childLCsBytes))
+	return shim.Success(childLCsBytes)
+}
@@ -0,0 +1,325 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/trade_workflow/tradepb"
+)
+
+// The trade agreement and its documents can be stored in the protobuf messages of tradepb/trade.proto rather
+// than in canonical JSON, as chosen by the StateFormat setting. Records of either format are decoded to canonical
+// JSON when read, so that transactions, migrations and signatures see the same bytes whatever the stored format,
+// and records are written in the configured format the next time they are updated or migrated.
+type protoCodec struct {
+	ObjectType		string
+	Encode			func(value []byte, version int) (proto.Message, error)
+	Decode			func(value []byte) (interface{}, int, error)
+}
+
+var protoCodecs = []protoCodec{
+	{"Trade", encodeTradeAgreement, decodeTradeAgreement},
+	{"LetterOfCredit", encodeLetterOfCredit, decodeLetterOfCredit},
+	{"ExportLicense", encodeExportLicense, decodeExportLicense},
+	{"BillOfLading", encodeBillOfLading, decodeBillOfLading},
+}
+
+func getProtoCodec(objectType string) *protoCodec {
+	for i := range protoCodecs {
+		if protoCodecs[i].ObjectType == objectType {
+			return &protoCodecs[i]
+		}
+	}
+	return nil
+}
+
+func isValidFormat(format string) bool {
+	return format == JSON_FORMAT || format == PROTOBUF_FORMAT
+}
+
+// The format in which asset records are written; JSON if not set
+func getStateFormat(stub shim.ChaincodeStubInterface) (string, error) {
+	format, err := getSetting(stub, STATE_FORMAT_SETTING)
+	if err != nil {
+		return "", err
+	}
+	if format == "" {
+		return JSON_FORMAT, nil
+	}
+	return format, nil
+}
+
+// Split an optional trailing Format=json|protobuf argument from the arguments of a query
+func splitFormat(args []string) ([]string, string, error) {
+	if len(args) == 0 || !strings.HasPrefix(args[len(args) - 1], FORMAT_ARG + "=") {
+		return args, JSON_FORMAT, nil
+	}
+	format := strings.TrimPrefix(args[len(args) - 1], FORMAT_ARG + "=")
+	if !isValidFormat(format) {
+		return nil, "", errors.New(fmt.Sprintf("Invalid format %s; Permissible values: {%s, %s}", format, JSON_FORMAT, PROTOBUF_FORMAT))
+	}
+	return args[:len(args) - 1], format, nil
+}
+
+// Records stored in protobuf are the ones of an asset type with a codec that are not JSON objects
+func isProtoRecord(objectType string, value []byte) bool {
+	return getProtoCodec(objectType) != nil && len(value) > 0 && !isStructuredRecord(value)
+}
+
+// Convert a JSON asset record to its protobuf message
+func encodeProtoMessage(objectType string, value []byte) (proto.Message, error) {
+	codec := getProtoCodec(objectType)
+	if codec == nil {
+		return nil, errors.New(fmt.Sprintf("%s has no protobuf encoding", objectType))
+	}
+	version, err := getSchemaVersion(value)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(value, version)
+}
+
+// Encode a JSON asset record in protobuf
+func encodeProtoRecord(objectType string, value []byte) ([]byte, error) {
+	message, err := encodeProtoMessage(objectType, value)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(message)
+}
+
+// Decode an asset record stored in protobuf to the canonical JSON of the same record
+func decodeProtoRecord(objectType string, value []byte) ([]byte, error) {
+	codec := getProtoCodec(objectType)
+	if codec == nil {
+		return nil, errors.New(fmt.Sprintf("%s has no protobuf encoding", objectType))
+	}
+	asset, version, err := codec.Decode(value)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error decoding %s record: %s", objectType, err.Error()))
+	}
+	assetBytes, err := json.Marshal(asset)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeCanonical(assetBytes)
+	if err != nil {
+		return nil, err
+	}
+	record := decoded.(map[string]interface{})
+	if version > 0 {
+		record["schemaVersion"] = version
+	}
+	return encodeCanonical(record)
+}
+
+// Encode a canonical JSON asset record in the given state format
+func encodeAssetRecord(objectType string, value []byte, format string) ([]byte, error) {
+	if format != PROTOBUF_FORMAT || getProtoCodec(objectType) == nil || !isStructuredRecord(value) {
+		return value, nil
+	}
+	return encodeProtoRecord(objectType, value)
+}
+
+// Respond to a query with its JSON response, or with the protobuf message built by toMessage
+func formatQueryResponse(format string, jsonResp []byte, toMessage func() (proto.Message, error)) pb.Response {
+	if format != PROTOBUF_FORMAT {
+		fmt.Printf("Query Response:%s\n", string(jsonResp))
+		return shim.Success(jsonResp)
+	}
+
+	message, err := toMessage()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	respBytes, err := proto.Marshal(message)
+	if err != nil {
+		return shim.Error("Error marshaling protobuf response")
+	}
+	fmt.Printf("Query Response:%s\n", message.String())
+	return shim.Success(respBytes)
+}
+
+func toProtoContent(content *DocumentContent) *tradepb.DocumentContent {
+	if content == nil {
+		return nil
+	}
+	return &tradepb.DocumentContent{Hash: content.Hash, MimeType: content.MimeType, Uri: content.Uri}
+}
+
+func fromProtoContent(content *tradepb.DocumentContent) *DocumentContent {
+	if content == nil {
+		return nil
+	}
+	return &DocumentContent{content.Hash, content.MimeType, content.Uri}
+}
+
+func encodeTradeAgreement(value []byte, version int) (proto.Message, error) {
+	var tradeAgreement TradeAgreement
+
+	err := json.Unmarshal(value, &tradeAgreement)
+	if err != nil {
+		return nil, err
+	}
+	message := &tradepb.TradeAgreement{
+		Amount:			int64(tradeAgreement.Amount),
+		DescriptionOfGoods:	tradeAgreement.DescriptionOfGoods,
+		Status:			tradeAgreement.Status,
+		Payment:		int64(tradeAgreement.Payment),
+		Quantity:		int64(tradeAgreement.Quantity),
+		SchemaVersion:		int32(version),
+	}
+	if tradeAgreement.Deadlines != nil {
+		message.Deadlines = &tradepb.Deadlines{LcIssuance: tradeAgreement.Deadlines.LCIssuance, Shipment: tradeAgreement.Deadlines.Shipment, Payment: tradeAgreement.Deadlines.Payment}
+	}
+	return message, nil
+}
+
+func decodeTradeAgreement(value []byte) (interface{}, int, error) {
+	var message tradepb.TradeAgreement
+
+	err := proto.Unmarshal(value, &message)
+	if err != nil {
+		return nil, 0, err
+	}
+	tradeAgreement := &TradeAgreement{int(message.Amount), message.DescriptionOfGoods, message.Status, int(message.Payment), nil, int(message.Quantity)}
+	if message.Deadlines != nil {
+		tradeAgreement.Deadlines = &Deadlines{message.Deadlines.LcIssuance, message.Deadlines.Shipment, message.Deadlines.Payment}
+	}
+	return tradeAgreement, int(message.SchemaVersion), nil
+}
+
+func encodeLetterOfCredit(value []byte, version int) (proto.Message, error) {
+	var letterOfCredit LetterOfCredit
+
+	err := json.Unmarshal(value, &letterOfCredit)
+	if err != nil {
+		return nil, err
+	}
+	return &tradepb.LetterOfCredit{
+		Id:			letterOfCredit.Id,
+		ExpirationDate:		letterOfCredit.ExpirationDate,
+		Beneficiary:		letterOfCredit.Beneficiary,
+		Amount:			int64(letterOfCredit.Amount),
+		Documents:		letterOfCredit.Documents,
+		Status:			letterOfCredit.Status,
+		AdvisingBank:		letterOfCredit.AdvisingBank,
+		ConfirmingBank:		letterOfCredit.ConfirmingBank,
+		Advised:		letterOfCredit.Advised,
+		Confirmed:		letterOfCredit.Confirmed,
+		Transferable:		letterOfCredit.Transferable,
+		Type:			letterOfCredit.Type,
+		ParentId:		letterOfCredit.ParentId,
+		Transferred:		int64(letterOfCredit.Transferred),
+		BackToBack:		int64(letterOfCredit.BackToBack),
+		Drawn:			int64(letterOfCredit.Drawn),
+		TenorDays:		int64(letterOfCredit.TenorDays),
+		PartialShipments:	letterOfCredit.PartialShipments,
+		Content:		toProtoContent(letterOfCredit.Content),
+		SchemaVersion:		int32(version),
+	}, nil
+}
+
+func decodeLetterOfCredit(value []byte) (interface{}, int, error) {
+	var message tradepb.LetterOfCredit
+
+	err := proto.Unmarshal(value, &message)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Protobuf does not tell an empty document list from a missing one; L/Cs are always written with a list
+	documents := message.Documents
+	if documents == nil {
+		documents = []string{}
+	}
+	letterOfCredit := &LetterOfCredit{message.Id, message.ExpirationDate, message.Beneficiary, int(message.Amount), documents, message.Status, message.AdvisingBank, message.ConfirmingBank, message.Advised, message.Confirmed, message.Transferable, message.Type, message.ParentId, int(message.Transferred), int(message.BackToBack), int(message.Drawn), int(message.TenorDays), message.PartialShipments, fromProtoContent(message.Content)}
+	return letterOfCredit, int(message.SchemaVersion), nil
+}
+
+func encodeExportLicense(value []byte, version int) (proto.Message, error) {
+	var exportLicense ExportLicense
+
+	err := json.Unmarshal(value, &exportLicense)
+	if err != nil {
+		return nil, err
+	}
+	return &tradepb.ExportLicense{
+		Id:			exportLicense.Id,
+		ExpirationDate:		exportLicense.ExpirationDate,
+		Exporter:		exportLicense.Exporter,
+		Carrier:		exportLicense.Carrier,
+		DescriptionOfGoods:	exportLicense.DescriptionOfGoods,
+		Approver:		exportLicense.Approver,
+		Status:			exportLicense.Status,
+		Content:		toProtoContent(exportLicense.Content),
+		SchemaVersion:		int32(version),
+	}, nil
+}
+
+func decodeExportLicense(value []byte) (interface{}, int, error) {
+	var message tradepb.ExportLicense
+
+	err := proto.Unmarshal(value, &message)
+	if err != nil {
+		return nil, 0, err
+	}
+	exportLicense := &ExportLicense{message.Id, message.ExpirationDate, message.Exporter, message.Carrier, message.DescriptionOfGoods, message.Approver, message.Status, fromProtoContent(message.Content)}
+	return exportLicense, int(message.SchemaVersion), nil
+}
+
+func encodeBillOfLading(value []byte, version int) (proto.Message, error) {
+	var billOfLading BillOfLading
+
+	err := json.Unmarshal(value, &billOfLading)
+	if err != nil {
+		return nil, err
+	}
+	return &tradepb.BillOfLading{
+		Id:			billOfLading.Id,
+		ExpirationDate:		billOfLading.ExpirationDate,
+		Exporter:		billOfLading.Exporter,
+		Carrier:		billOfLading.Carrier,
+		DescriptionOfGoods:	billOfLading.DescriptionOfGoods,
+		Amount:			int64(billOfLading.Amount),
+		Beneficiary:		billOfLading.Beneficiary,
+		SourcePort:		billOfLading.SourcePort,
+		DestinationPort:	billOfLading.DestinationPort,
+		Status:			billOfLading.Status,
+		IssueDate:		billOfLading.IssueDate,
+		Content:		toProtoContent(billOfLading.Content),
+		SchemaVersion:		int32(version),
+	}, nil
+}
+
+func decodeBillOfLading(value []byte) (interface{}, int, error) {
+	var message tradepb.BillOfLading
+
+	err := proto.Unmarshal(value, &message)
+	if err != nil {
+		return nil, 0, err
+	}
+	billOfLading := &BillOfLading{message.Id, message.ExpirationDate, message.Exporter, message.Carrier, message.DescriptionOfGoods, int(message.Amount), message.Beneficiary, message.SourcePort, message.DestinationPort, message.Status, message.IssueDate, fromProtoContent(message.Content)}
+	return billOfLading, int(message.SchemaVersion), nil
+}
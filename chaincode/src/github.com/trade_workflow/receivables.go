@@ -0,0 +1,346 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupInvoice(stub shim.ChaincodeStubInterface, tradeID string) (string, *Invoice, error) {
+	var invoice *Invoice
+
+	invoiceKey, err := getInvoiceKey(stub, tradeID)
+	if err != nil {
+		return "", nil, err
+	}
+	invoiceBytes, err := getAssetState(stub, invoiceKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(invoiceBytes) == 0 {
+		return invoiceKey, nil, nil
+	}
+
+	err = json.Unmarshal(invoiceBytes, &invoice)
+	if err != nil {
+		return "", nil, err
+	}
+	return invoiceKey, invoice, nil
+}
+
+func putInvoice(stub shim.ChaincodeStubInterface, invoiceKey string, invoice *Invoice) error {
+	invoiceBytes, err := json.Marshal(invoice)
+	if err != nil {
+		return errors.New("Error marshaling invoice structure")
+	}
+	return putAssetState(stub, invoiceKey, invoiceBytes)
+}
+
+// The invoice of a trade whose receivable has been sold and not yet repaid in full, if any
+func lookupFinancedInvoice(stub shim.ChaincodeStubInterface, tradeID string) (string, *Invoice, error) {
+	invoiceKey, invoice, err := lookupInvoice(stub, tradeID)
+	if err != nil || invoice == nil || invoice.Status != FINANCED {
+		return "", nil, err
+	}
+	return invoiceKey, invoice, nil
+}
+
+// Record the part of a payment under the L/C that went to the financier of the trade's receivable
+func repayFinancier(stub shim.ChaincodeStubInterface, invoiceKey string, invoice *Invoice, amount int) error {
+	invoice.Repaid += amount
+	if invoice.Repaid >= invoice.Amount {
+		invoice.Status = REPAID
+	}
+	fmt.Printf("Repayment of %d on invoice %s for trade %s made to %s\n", amount, invoice.Id, invoice.TradeId, invoice.Financier)
+	return putInvoice(stub, invoiceKey, invoice)
+}
+
+// Issue the commercial invoice of a trade for the amount still payable to the exporter under the L/C
+func (t *TradeWorkflowChaincode) issueInvoice(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var invoiceKey, lcKey, blKey string
+	var billOfLadingBytes, exporterBytes, importerBytes []byte
+	var tradeAgreement *TradeAgreement
+	var letterOfCredit *LetterOfCredit
+	var invoice *Invoice
+	var txTime time.Time
+	var err error
+
+	// Access control: Only an Exporting Entity Org member can invoke this transaction
+	if !t.testMode && !authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Invoice ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	invoiceKey, invoice, err = lookupInvoice(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice != nil {
+		fmt.Printf("Invoice for trade %s already issued", args[0])
+		return shim.Success(nil)
+	}
+
+	_, tradeAgreement, err = lookupTradeAgreement(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The receivable arises once the goods have been shipped
+	blKey, err = getBLKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	billOfLadingBytes, err = getAssetState(stub, blKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(billOfLadingBytes) == 0 {
+		fmt.Printf("B/L for trade %s has not been issued", args[0])
+		return shim.Error("B/L not issued yet")
+	}
+
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit == nil || letterOfCredit.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("No accepted L/C found for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred <= 0 {
+		err = errors.New(fmt.Sprintf("Nothing remains payable to the exporter for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	exporterBytes, err = stub.GetState(expKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	importerBytes, err = stub.GetState(impKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	invoice = &Invoice{args[1], args[0], string(exporterBytes), string(importerBytes), tradeAgreement.DescriptionOfGoods,
+			   letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred, txTime.Format(time.RFC3339), 0, "", 0, "", 0, ISSUED}
+	err = putInvoice(stub, invoiceKey, invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Invoice %s of %d for trade %s issued\n", args[1], invoice.Amount, args[0])
+
+	return shim.Success(nil)
+}
+
+// Offer the receivable of a trade for sale at a price below its face amount
+func (t *TradeWorkflowChaincode) offerReceivable(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var invoiceKey string
+	var invoice *Invoice
+	var draft *Draft
+	var price int
+	var err error
+
+	// Access control: Only an Exporting Entity Org member can invoke this transaction
+	if !t.testMode && !authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Asking Price}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	price, err = strconv.Atoi(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	invoiceKey, invoice, err = lookupInvoice(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice == nil {
+		err = errors.New(fmt.Sprintf("No invoice issued for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	if invoice.Status != ISSUED && invoice.Status != OFFERED {
+		err = errors.New(fmt.Sprintf("Invoice for trade %s is %s", args[0], invoice.Status))
+		return shim.Error(err.Error())
+	}
+	if price <= 0 || price > invoice.Amount {
+		err = errors.New(fmt.Sprintf("Asking price %d must be positive and no more than the invoice amount %d", price, invoice.Amount))
+		return shim.Error(err.Error())
+	}
+
+	// A receivable already sold by discounting the draft cannot be sold again
+	_, draft, err = lookupDraft(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if draft != nil && draft.Status == DISCOUNTED {
+		err = errors.New(fmt.Sprintf("Draft for trade %s has already been discounted", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	invoice.AskingPrice = price
+	invoice.Status = OFFERED
+	err = putInvoice(stub, invoiceKey, invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Receivable of %d for trade %s offered at %d\n", invoice.Amount, args[0], price)
+
+	return shim.Success(nil)
+}
+
+// Buy an offered receivable: the financier pays the exporter the asking price from its own account, and is assigned the proceeds of the L/C.
+// Only the banks registered for the trade's roles may finance receivables.
+func (t *TradeWorkflowChaincode) financeReceivable(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var invoiceKey, financierRoleKey, financierBalanceKey string
+	var financierBytes []byte
+	var invoice *Invoice
+	var financierBal int
+	var txTime time.Time
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 && len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1 or 2: {Trade ID} [Financing Bank]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	invoiceKey, invoice, err = lookupInvoice(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice == nil || invoice.Status != OFFERED {
+		err = errors.New(fmt.Sprintf("No receivable on offer for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// The exporter's bank finances the receivable unless the importer's bank is named
+	financierRoleKey = ebKey
+	if len(args) == 2 && args[1] != "" {
+		financierRoleKey, err = getBankRoleKey(strings.ToLower(args[1]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	financierBytes, err = stub.GetState(financierRoleKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(financierBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No bank registered to finance the receivable of trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	financierBalanceKey, err = getBankBalanceKey(stub, string(financierBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = openAccount(stub, financierBalanceKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	financierBal, err = getBalance(stub, financierBalanceKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if financierBal < invoice.AskingPrice {
+		err = errors.New(fmt.Sprintf("Financier's balance %d is insufficient to pay %d for the receivable of trade %s", financierBal, invoice.AskingPrice, args[0]))
+		return shim.Error(err.Error())
+	}
+	err = transferFunds(stub, financierBalanceKey, expBalKey, invoice.AskingPrice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice.Financier = string(financierBytes)
+	invoice.PurchasePrice = invoice.AskingPrice
+	invoice.AssignmentDate = txTime.Format(time.RFC3339)
+	invoice.Status = FINANCED
+	err = putInvoice(stub, invoiceKey, invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Receivable for trade %s assigned to %s for %d\n", args[0], invoice.Financier, invoice.PurchasePrice)
+
+	return shim.Success(nil)
+}
+
+// Get the commercial invoice of a trade
+func (t *TradeWorkflowChaincode) getInvoice(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var invoiceKey, jsonResp string
+	var invoiceBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter or Exporting Entity Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	invoiceKey, err = getInvoiceKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoiceBytes, err = getAssetState(stub, invoiceKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(invoiceBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + invoiceKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(invoiceBytes))
+	return shim.Success(invoiceBytes)
+}
@@ -0,0 +1,567 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// A migration upgrades a decoded record by one schema version
+type migration func(record map[string]interface{}) error
+
+// Assets are stored in canonical JSON under composite keys named after their object type, with the schema version of
+// the record in a "schemaVersion" field. Migrations[v] upgrades a record from version v to v + 1, so the
+// current version of an asset type is the number of its migrations. Records written before versioning
+// was introduced carry no version and are at version 0.
+type assetSchema struct {
+	ObjectType		string
+	Migrations		[]migration
+}
+
+// When the JSON shape of an asset changes, append a migration to its schema
+var assetSchemas = []assetSchema{
+	{"Trade", []migration{noMigration}},
+	{"LetterOfCredit", []migration{noMigration}},
+	{"ExportLicense", []migration{noMigration}},
+	{"BillOfLading", []migration{migrateBillOfLadingStatus}},
+	{"Payment", []migration{noMigration}},
+	{"Delivery", []migration{noMigration}},
+	{"Dispute", []migration{noMigration, migrateSettlementAdjustment}},
+	{"Guarantee", []migration{noMigration}},
+	{"CreditFacility", []migration{noMigration}},
+	{"Delegation", []migration{noMigration}},
+	{"ApprovalPolicy", []migration{noMigration}},
+	{"Proposal", []migration{noMigration}},
+	{"Draft", []migration{noMigration}},
+	{"Lot", []migration{noMigration}},
+	{"FeeSchedule", []migration{noMigration}},
+	{"Charge", []migration{noMigration}},
+	{"RatePublisher", []migration{noMigration}},
+	{"FXRate", []migration{noMigration}},
+	{"Invoice", []migration{noMigration}},
+	{"Escrow", []migration{noMigration}},
+	{"InsuranceCertificate", []migration{noMigration}},
+	{"CertificateIssuer", []migration{noMigration}},
+	{"TradeCertificate", []migration{noMigration}},
+	{"Attachment", []migration{noMigration}},
+	{"DocumentAnchor", []migration{noMigration}},
+	{"DocumentSignature", []migration{noMigration, migrateSignaturePayloadVersion}},
+}
+
+type SchemaInfo struct {
+	ObjectType		string		`json:"objectType"`
+	CurrentVersion		int		`json:"currentVersion"`
+	Versions		map[int]int	`json:"versions"`
+	Unstructured		int		`json:"unstructured"`
+	Protobuf		int		`json:"protobuf"`
+}
+
+type MigrationProgress struct {
+	Scanned			int		`json:"scanned"`
+	Migrated		int		`json:"migrated"`
+	Cursor			string		`json:"cursor"`
+	Done			bool		`json:"done"`
+}
+
+// The version only records that the shape is current
+func noMigration(record map[string]interface{}) error {
+	return nil
+}
+
+// Bills of lading issued before their status was tracked have not been surrendered
+func migrateBillOfLadingStatus(record map[string]interface{}) error {
+	if _, ok := record["status"]; !ok {
+		record["status"] = ISSUED
+	}
+	return nil
+}
+
+// Signatures recorded before the signing payload was versioned were made over the plain JSON serialisation
+func migrateSignaturePayloadVersion(record map[string]interface{}) error {
+	if _, ok := record["payloadVersion"]; !ok {
+		record["payloadVersion"] = JSON_SIGNING_PAYLOAD
+	}
+	return nil
+}
+
+// Settlements recorded before adjustments were separated from refunds carried an additional payment to the exporter as a negative refund
+func migrateSettlementAdjustment(record map[string]interface{}) error {
+	for _, field := range []string{"proposal", "resolution"} {
+		settlement, ok := record[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		refund, err := strconv.Atoi(fmt.Sprint(settlement["refund"]))
+		if err != nil {
+			return err
+		}
+		settlement["adjustment"] = 0
+		if refund < 0 {
+			settlement["refund"] = 0
+			settlement["adjustment"] = -refund
+		}
+	}
+	return nil
+}
+
+func getAssetSchema(objectType string) *assetSchema {
+	for i := range assetSchemas {
+		if assetSchemas[i].ObjectType == objectType {
+			return &assetSchemas[i]
+		}
+	}
+	return nil
+}
+
+func getKeyAssetSchema(stub shim.ChaincodeStubInterface, key string) (*assetSchema, error) {
+	objectType, _, err := stub.SplitCompositeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return getAssetSchema(objectType), nil
+}
+
+// Values that are not JSON objects, such as legacy payment request markers, carry no schema
+func isStructuredRecord(value []byte) bool {
+	return len(value) > 0 && value[0] == '{'
+}
+
+func getSchemaVersion(value []byte) (int, error) {
+	var header struct {
+		SchemaVersion	int	`json:"schemaVersion"`
+	}
+
+	err := json.Unmarshal(value, &header)
+	if err != nil {
+		return 0, err
+	}
+	return header.SchemaVersion, nil
+}
+
+// Encode a marshaled record canonically, with the current schema version of its asset type
+func stampSchemaVersion(objectType string, value []byte) ([]byte, error) {
+	schema := getAssetSchema(objectType)
+	if schema == nil || !isStructuredRecord(value) {
+		return value, nil
+	}
+
+	decoded, err := decodeCanonical(value)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s record is not a JSON object", objectType))
+	}
+	record["schemaVersion"] = len(schema.Migrations)
+	return encodeCanonical(record)
+}
+
+// Upgrade a record to the current schema version of its asset type, reporting whether it changed; records stored
+// in protobuf are returned in canonical JSON
+func upgradeRecord(schema *assetSchema, key string, value []byte) ([]byte, bool, error) {
+	var err error
+
+	if schema != nil && isProtoRecord(schema.ObjectType, value) {
+		value, err = decodeProtoRecord(schema.ObjectType, value)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if schema == nil || !isStructuredRecord(value) {
+		return value, false, nil
+	}
+
+	version, err := getSchemaVersion(value)
+	if err != nil {
+		return nil, false, err
+	}
+	currentVersion := len(schema.Migrations)
+	if version == currentVersion {
+		return value, false, nil
+	}
+	if version > currentVersion {
+		return nil, false, errors.New(fmt.Sprintf("Record %s has schema version %d; this chaincode supports up to version %d", key, version, currentVersion))
+	}
+
+	// Decode numbers as they were written so that amounts survive the round trip
+	decoded, err := decodeCanonical(value)
+	if err != nil {
+		return nil, false, err
+	}
+	record, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, false, errors.New(fmt.Sprintf("Record %s is not a JSON object", key))
+	}
+	for ; version < currentVersion; version++ {
+		err = schema.Migrations[version](record)
+		if err != nil {
+			return nil, false, errors.New(fmt.Sprintf("Error migrating record %s to schema version %d: %s", key, version + 1, err.Error()))
+		}
+	}
+	record["schemaVersion"] = currentVersion
+
+	value, err = encodeCanonical(record)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Upgrade an asset record read from the ledger; the upgraded record is written back the next time the asset is updated
+func upgradeAssetState(stub shim.ChaincodeStubInterface, key string, value []byte) ([]byte, error) {
+	schema, err := getKeyAssetSchema(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err = upgradeRecord(schema, key, value)
+	return value, err
+}
+
+// Read an asset record in the current schema version
+func getAssetState(stub shim.ChaincodeStubInterface, key string) ([]byte, error) {
+	value, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	return upgradeAssetState(stub, key, value)
+}
+
+// Write an asset record, stamped with the current schema version, in the configured state format
+func putAssetState(stub shim.ChaincodeStubInterface, key string, value []byte) error {
+	objectType, _, err := stub.SplitCompositeKey(key)
+	if err != nil {
+		return err
+	}
+	value, err = stampSchemaVersion(objectType, value)
+	if err != nil {
+		return err
+	}
+	stateFormat, err := getStateFormat(stub)
+	if err != nil {
+		return err
+	}
+	value, err = encodeAssetRecord(objectType, value, stateFormat)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, value)
+}
+
+func encodeMigrationCursor(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+func decodeMigrationCursor(stub shim.ChaincodeStubInterface, cursor string) (string, int, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, errors.New(fmt.Sprintf("Invalid migration cursor %s", cursor))
+	}
+	key := string(keyBytes)
+	if len(key) == 0 || key[0] != 0 {
+		return "", 0, errors.New(fmt.Sprintf("Invalid migration cursor %s", cursor))
+	}
+	objectType, _, err := stub.SplitCompositeKey(key)
+	if err != nil {
+		return "", 0, err
+	}
+	for i := range assetSchemas {
+		if assetSchemas[i].ObjectType == objectType {
+			return key, i, nil
+		}
+	}
+	return "", 0, errors.New(fmt.Sprintf("Invalid migration cursor %s", cursor))
+}
+
+// Record a payment request marker left by the original chaincode as a payment request with a derived ID, for the
+// amount the original chaincode would have paid against it
+func migrateLegacyPaymentRequest(stub shim.ChaincodeStubInterface, key string) error {
+	var tradeAgreement *TradeAgreement
+	var paymentAmount int
+
+	_, keyParts, err := stub.SplitCompositeKey(key)
+	if err != nil {
+		return err
+	}
+	tradeID := keyParts[0]
+
+	tradeKey, err := getTradeKey(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	tradeAgreementBytes, err := getAssetState(stub, tradeKey)
+	if err != nil {
+		return err
+	}
+	if len(tradeAgreementBytes) == 0 {
+		return errors.New(fmt.Sprintf("No record found for trade ID %s", tradeID))
+	}
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return err
+	}
+
+	// The original chaincode paid half the amount while the goods were at the source and the remainder on arrival
+	shipmentLocationKey, err := getShipmentLocationKey(stub, tradeID)
+	if err != nil {
+		return err
+	}
+	shipmentLocationBytes, err := stub.GetState(shipmentLocationKey)
+	if err != nil {
+		return err
+	}
+	if string(shipmentLocationBytes) == SOURCE {
+		paymentAmount = tradeAgreement.Amount/2
+	} else {
+		paymentAmount = tradeAgreement.Amount - tradeAgreement.Payment
+	}
+	if paymentAmount <= 0 {
+		return errors.New(fmt.Sprintf("Payment request for trade %s has nothing left to pay and cannot be migrated", tradeID))
+	}
+
+	paymentKey, err := getPaymentKey(stub, tradeID, LEGACY_PAYMENT_REQUEST_ID)
+	if err != nil {
+		return err
+	}
+	paymentBytes, err := stub.GetState(paymentKey)
+	if err != nil {
+		return err
+	}
+	if len(paymentBytes) != 0 {
+		return errors.New(fmt.Sprintf("Payment request %s for trade %s already recorded", LEGACY_PAYMENT_REQUEST_ID, tradeID))
+	}
+
+	paymentRequest := &PaymentRequest{LEGACY_PAYMENT_REQUEST_ID, paymentAmount, REQUESTED, "", "", 0, 0, ""}
+	paymentBytes, err = json.Marshal(paymentRequest)
+	if err != nil {
+		return errors.New("Error marshaling payment request structure")
+	}
+	err = putAssetState(stub, paymentKey, paymentBytes)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Payment request for trade %s migrated as request %s: amount %d\n", tradeID, LEGACY_PAYMENT_REQUEST_ID, paymentAmount)
+	return nil
+}
+
+func migrateLegacyPaymentRequests(stub shim.ChaincodeStubInterface, keys []string) error {
+	for _, key := range keys {
+		err := migrateLegacyPaymentRequest(stub, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upgrade a batch of asset records to their current schema versions and rewrite them in the configured state format,
+// resuming after the cursor returned by the previous batch
+func (t *TradeWorkflowChaincode) migrate(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var cursorKey, stateFormat string
+	var schemaIndex, batchSize int
+	var value, progressBytes []byte
+	var migrated bool
+	var legacyPaymentKeys []string
+	var err error
+
+	// Access control: Only a Regulator Org member can invoke this transaction, as for the other administrative transactions
+	if !t.testMode && !authenticateRegulatorOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Regulator Org. Access denied.")
+	}
+
+	if len(args) != 1 && len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1 or 2: {Batch Size} [Cursor]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	batchSize, err = strconv.Atoi(string(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if batchSize <= 0 {
+		return shim.Error("Batch size must be positive")
+	}
+
+	if len(args) == 2 && args[1] != "" {
+		cursorKey, schemaIndex, err = decodeMigrationCursor(stub, args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	stateFormat, err = getStateFormat(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	progress := MigrationProgress{0, 0, "", false}
+	for ; schemaIndex < len(assetSchemas); schemaIndex++ {
+		schema := &assetSchemas[schemaIndex]
+		recordsIterator, err := stub.GetStateByPartialCompositeKey(schema.ObjectType, []string{})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		for recordsIterator.HasNext() {
+			recordKV, err := recordsIterator.Next()
+			if err != nil {
+				recordsIterator.Close()
+				return shim.Error(err.Error())
+			}
+			// Skip the records handled by previous batches
+			if cursorKey != "" && recordKV.Key <= cursorKey {
+				continue
+			}
+
+			if progress.Scanned == batchSize {
+				recordsIterator.Close()
+				err = migrateLegacyPaymentRequests(stub, legacyPaymentKeys)
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+				progressBytes, err = json.Marshal(progress)
+				if err != nil {
+					return shim.Error("Error marshaling migration progress")
+				}
+				fmt.Printf("Migration Progress:%s\n", string(progressBytes))
+				return shim.Success(progressBytes)
+			}
+
+			// Payment request markers left by the original chaincode are rewritten under new keys once the scan is over
+			if schema.ObjectType == "Payment" && !isStructuredRecord(recordKV.Value) {
+				legacyPaymentKeys = append(legacyPaymentKeys, recordKV.Key)
+				progress.Migrated++
+				progress.Scanned++
+				progress.Cursor = encodeMigrationCursor(recordKV.Key)
+				continue
+			}
+
+			value, migrated, err = upgradeRecord(schema, recordKV.Key, recordKV.Value)
+			if err != nil {
+				recordsIterator.Close()
+				return shim.Error(err.Error())
+			}
+			// A record also needs rewriting when it is stored in a format other than the configured one
+			if isProtoRecord(schema.ObjectType, recordKV.Value) != (stateFormat == PROTOBUF_FORMAT && getProtoCodec(schema.ObjectType) != nil && isStructuredRecord(value)) {
+				migrated = true
+			}
+			if migrated {
+				value, err = encodeAssetRecord(schema.ObjectType, value, stateFormat)
+				if err != nil {
+					recordsIterator.Close()
+					return shim.Error(err.Error())
+				}
+				err = stub.PutState(recordKV.Key, value)
+				if err != nil {
+					recordsIterator.Close()
+					return shim.Error(err.Error())
+				}
+				progress.Migrated++
+			}
+			progress.Scanned++
+			progress.Cursor = encodeMigrationCursor(recordKV.Key)
+		}
+		recordsIterator.Close()
+		cursorKey = ""
+	}
+	err = migrateLegacyPaymentRequests(stub, legacyPaymentKeys)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	progress.Cursor = ""
+	progress.Done = true
+	progressBytes, err = json.Marshal(progress)
+	if err != nil {
+		return shim.Error("Error marshaling migration progress")
+	}
+	fmt.Printf("Migration Progress:%s\n", string(progressBytes))
+	return shim.Success(progressBytes)
+}
+
+// Report the current schema version of each asset type, how many records are stored in each version and how many in protobuf
+func (t *TradeWorkflowChaincode) getSchemaInfo(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var schemaInfoBytes []byte
+	var err error
+
+	// Access control: Any trade participant can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a trade participant. Access denied.")
+	}
+
+	if len(args) != 0 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	schemaInfo := []SchemaInfo{}
+	for _, schema := range assetSchemas {
+		info := SchemaInfo{schema.ObjectType, len(schema.Migrations), map[int]int{}, 0, 0}
+
+		recordsIterator, err := stub.GetStateByPartialCompositeKey(schema.ObjectType, []string{})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		for recordsIterator.HasNext() {
+			recordKV, err := recordsIterator.Next()
+			if err != nil {
+				recordsIterator.Close()
+				return shim.Error(err.Error())
+			}
+			value := recordKV.Value
+			if isProtoRecord(schema.ObjectType, value) {
+				info.Protobuf++
+				value, err = decodeProtoRecord(schema.ObjectType, value)
+				if err != nil {
+					recordsIterator.Close()
+					return shim.Error(err.Error())
+				}
+			}
+			if !isStructuredRecord(value) {
+				info.Unstructured++
+				continue
+			}
+			version, err := getSchemaVersion(value)
+			if err != nil {
+				recordsIterator.Close()
+				return shim.Error(err.Error())
+			}
+			info.Versions[version]++
+		}
+		recordsIterator.Close()
+
+		schemaInfo = append(schemaInfo, info)
+	}
+
+	schemaInfoBytes, err = json.Marshal(schemaInfo)
+	if err != nil {
+		return shim.Error("Error marshaling schema info")
+	}
+	fmt.Printf("Query Response:%s\n", string(schemaInfoBytes))
+	return shim.Success(schemaInfoBytes)
+}
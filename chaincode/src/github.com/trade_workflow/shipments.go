@@ -0,0 +1,579 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupTradeAgreement(stub shim.ChaincodeStubInterface, tradeID string) (string, *TradeAgreement, error) {
+	var tradeAgreement *TradeAgreement
+
+	tradeKey, err := getTradeKey(stub, tradeID)
+	if err != nil {
+		return "", nil, err
+	}
+	tradeAgreementBytes, err := getAssetState(stub, tradeKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		return "", nil, errors.New(fmt.Sprintf("No record found for trade ID %s", tradeID))
+	}
+
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return "", nil, err
+	}
+	return tradeKey, tradeAgreement, nil
+}
+
+func putTradeAgreement(stub shim.ChaincodeStubInterface, tradeKey string, tradeAgreement *TradeAgreement) error {
+	tradeAgreementBytes, err := json.Marshal(tradeAgreement)
+	if err != nil {
+		return errors.New("Error marshaling trade agreement structure")
+	}
+	return putAssetState(stub, tradeKey, tradeAgreementBytes)
+}
+
+func lookupLot(stub shim.ChaincodeStubInterface, tradeID string, lotID string) (string, *Lot, error) {
+	var lot *Lot
+
+	lotKey, err := getLotKey(stub, tradeID, lotID)
+	if err != nil {
+		return "", nil, err
+	}
+	lotBytes, err := getAssetState(stub, lotKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(lotBytes) == 0 {
+		return lotKey, nil, nil
+	}
+
+	err = json.Unmarshal(lotBytes, &lot)
+	if err != nil {
+		return "", nil, err
+	}
+	return lotKey, lot, nil
+}
+
+func putLot(stub shim.ChaincodeStubInterface, lotKey string, lot *Lot) error {
+	lotBytes, err := json.Marshal(lot)
+	if err != nil {
+		return errors.New("Error marshaling lot structure")
+	}
+	return putAssetState(stub, lotKey, lotBytes)
+}
+
+// A trade ships either in lots or as a single shipment, never both
+func getTradeLots(stub shim.ChaincodeStubInterface, tradeID string) ([]*Lot, error) {
+	var lot *Lot
+
+	lotsIterator, err := stub.GetStateByPartialCompositeKey("Lot", []string{tradeID})
+	if err != nil {
+		return nil, err
+	}
+	defer lotsIterator.Close()
+
+	lots := []*Lot{}
+	for lotsIterator.HasNext() {
+		lotKV, err := lotsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := upgradeAssetState(stub, lotKV.Key, lotKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(value, &lot)
+		if err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+		lot = nil
+	}
+	return lots, nil
+}
+
+// The B/Ls a trade ships under: one per lot if the trade ships in lots, otherwise the trade's single B/L.
+// The B/L of a lot, or of the trade, that has not been issued yet is nil.
+func lookupTradeBillsOfLading(stub shim.ChaincodeStubInterface, tradeID string, lots []*Lot) ([]string, []*BillOfLading, error) {
+	var blKey string
+	var billOfLadingBytes []byte
+	var billOfLading *BillOfLading
+	var err error
+
+	blKeys := []string{}
+	billsOfLading := []*BillOfLading{}
+	if len(lots) == 0 {
+		blKey, err = getBLKey(stub, tradeID)
+		if err != nil {
+			return nil, nil, err
+		}
+		billOfLadingBytes, err = getAssetState(stub, blKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(billOfLadingBytes) != 0 {
+			err = json.Unmarshal(billOfLadingBytes, &billOfLading)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return []string{blKey}, []*BillOfLading{billOfLading}, nil
+	}
+
+	for _, lot := range lots {
+		blKey, billOfLading, err = lookupLotBillOfLading(stub, tradeID, lot.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		blKeys = append(blKeys, blKey)
+		billsOfLading = append(billsOfLading, billOfLading)
+	}
+	return blKeys, billsOfLading, nil
+}
+
+// Prepare one lot of a trade's goods for shipment; its share of the trade amount is in proportion to its quantity,
+// with any rounding difference carried by the lot that completes the trade quantity
+func (t *TradeWorkflowChaincode) prepareLot(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var elKey, lcKey, shipmentLocationKey, lotKey string
+	var shipmentLocationBytes, exportLicenseBytes []byte
+	var tradeAgreement *TradeAgreement
+	var exportLicense *ExportLicense
+	var letterOfCredit *LetterOfCredit
+	var lot *Lot
+	var lots []*Lot
+	var quantity, shippedQuantity, apportionedAmount, amount int
+	var err error
+
+	// Access control: Only an Exporting Entity Org member, or a delegate of the exporter, can invoke this transaction
+	if !t.testMode && !authorizeExporterAction(stub, PREPARE_SHIPMENT_ACTION, args, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org nor a delegate of the exporter. Access denied.")
+	}
+
+	if len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Trade ID, Lot ID, Quantity}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	quantity, err = strconv.Atoi(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if quantity <= 0 {
+		err = errors.New(fmt.Sprintf("Invalid quantity %d", quantity))
+		return shim.Error(err.Error())
+	}
+
+	_, tradeAgreement, err = lookupTradeAgreement(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if tradeAgreement.Quantity == 0 {
+		err = errors.New(fmt.Sprintf("Trade %s has no quantity to ship in lots", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	lotKey, lot, err = lookupLot(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lot != nil {
+		fmt.Printf("Lot %s for trade %s has already been prepared", args[1], args[0])
+		return shim.Success(nil)
+	}
+
+	// Lots may not be added to a trade already shipped in one consignment
+	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(shipmentLocationBytes) != 0 {
+		err = errors.New(fmt.Sprintf("Trade %s has already been shipped in a single consignment", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup E/L from the ledger
+	elKey, err = getELKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	exportLicenseBytes, err = getAssetState(stub, elKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(exportLicenseBytes) == 0 {
+		fmt.Printf("E/L for trade %s has not been issued", args[0])
+		return shim.Error("E/L not issued yet")
+	}
+	err = json.Unmarshal(exportLicenseBytes, &exportLicense)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if exportLicense.Status != ISSUED {
+		fmt.Printf("E/L for trade %s has not been issued", args[0])
+		return shim.Error("E/L not issued yet")
+	}
+
+	// The L/C decides whether the goods may be shipped in more than one lot
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit == nil || letterOfCredit.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("No accepted L/C found for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	if !letterOfCredit.PartialShipments && quantity != tradeAgreement.Quantity {
+		err = errors.New(fmt.Sprintf("L/C for trade %s prohibits partial shipments", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	lots, err = getTradeLots(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, shippedLot := range lots {
+		shippedQuantity += shippedLot.Quantity
+		apportionedAmount += shippedLot.Amount
+	}
+	if shippedQuantity + quantity > tradeAgreement.Quantity {
+		err = errors.New(fmt.Sprintf("Quantity %d exceeds the quantity %d left to ship for trade %s", quantity, tradeAgreement.Quantity - shippedQuantity, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	if shippedQuantity + quantity == tradeAgreement.Quantity {
+		amount = tradeAgreement.Amount - apportionedAmount
+	} else {
+		amount = tradeAgreement.Amount * quantity / tradeAgreement.Quantity
+	}
+
+	lot = &Lot{args[1], args[0], quantity, amount, SOURCE, 0}
+	err = putLot(stub, lotKey, lot)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Lot %s of %d for trade %s prepared, apportioned amount %d\n", args[1], quantity, args[0], amount)
+
+	return shim.Success(nil)
+}
+
+// Accept a lot and issue a B/L for it
+func (t *TradeWorkflowChaincode) acceptLotAndIssueBL(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lotBLKey string
+	var billOfLadingBytes, exporterBytes, carrierBytes, beneficiaryBytes []byte
+	var tradeAgreement *TradeAgreement
+	var lot *Lot
+	var billOfLading *BillOfLading
+	var txTime time.Time
+	var err error
+
+	// Access control: Only an Carrier Org member can invoke this transaction
+	if !t.testMode && !authenticateCarrierOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Carrier Org. Access denied.")
+	}
+
+	if len(args) != 6 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 6: {Trade ID, Lot ID, B/L ID, Expiration Date, Source Port, Destination Port}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, lot, err = lookupLot(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lot == nil {
+		fmt.Printf("Lot %s for trade %s has not been prepared yet", args[1], args[0])
+		return shim.Error("Lot not prepared yet")
+	}
+	if lot.Location != SOURCE {
+		fmt.Printf("Lot %s for trade %s has passed the preparation stage", args[1], args[0])
+		return shim.Error("Lot past the preparation stage")
+	}
+
+	// A lot's B/L is issued once; it is not replaced while the lot awaits departure
+	lotBLKey, err = getLotBLKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	billOfLadingBytes, err = getAssetState(stub, lotBLKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(billOfLadingBytes) != 0 {
+		err = errors.New(fmt.Sprintf("B/L for lot %s of trade %s already issued", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+
+	_, tradeAgreement, err = lookupTradeAgreement(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup exporter, carrier and importer's bank
+	exporterBytes, err = stub.GetState(expKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	carrierBytes, err = stub.GetState(carKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	beneficiaryBytes, err = stub.GetState(ibKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The B/L is dated with the transaction timestamp
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The B/L covers the lot's share of the trade amount
+	billOfLading = &BillOfLading{args[2], args[3], string(exporterBytes), string(carrierBytes), tradeAgreement.DescriptionOfGoods,
+				     lot.Amount, string(beneficiaryBytes), args[4], args[5], ISSUED, txTime.Format(time.RFC3339), nil}
+	billOfLadingBytes, err = json.Marshal(billOfLading)
+	if err != nil {
+		return shim.Error("Error marshaling bill of lading structure")
+	}
+
+	err = putAssetState(stub, lotBLKey, billOfLadingBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Bill of Lading for lot %s of trade %s recorded\n", args[1], args[0])
+
+	return shim.Success(nil)
+}
+
+// Update the location of a lot
+func (t *TradeWorkflowChaincode) updateLotLocation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lotKey string
+	var lot *Lot
+	var err error
+
+	// Access control: Only a Carrier Org member can invoke this transaction
+	if !t.testMode && !authenticateCarrierOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Carrier Org. Access denied.")
+	}
+
+	if len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Trade ID, Lot ID, Location}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	lotKey, lot, err = lookupLot(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lot == nil {
+		fmt.Printf("Lot %s for trade %s has not been prepared yet", args[1], args[0])
+		return shim.Error("Lot not prepared yet")
+	}
+	if lot.Location == args[2] {
+		fmt.Printf("Lot %s for trade %s is already in location %s", args[1], args[0], args[2])
+	}
+
+	lot.Location = args[2]
+	err = putLot(stub, lotKey, lot)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Location of lot %s for trade %s recorded\n", args[1], args[0])
+
+	return shim.Success(nil)
+}
+
+// Pay the exporter for a lot: half of the lot's amount once its B/L is issued, the rest once it reaches its destination.
+// Lot payments are settled like any other payment under the L/C, and recorded as payments <Lot ID>-1 and <Lot ID>-2 of the trade.
+func (t *TradeWorkflowChaincode) payLot(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeKey, lotKey, lotBLKey, lcKey, paymentKey string
+	var billOfLadingBytes, proposalBytes []byte
+	var tradeAgreement *TradeAgreement
+	var lot *Lot
+	var letterOfCredit *LetterOfCredit
+	var paymentRequest *PaymentRequest
+	var payment, paymentNumber int
+	var err error
+
+	// Access control: Only an Importer Org member, or an Exporter Org member on behalf of a confirming bank, can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Lot ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lotKey, lot, err = lookupLot(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lot == nil {
+		fmt.Printf("Lot %s for trade %s has not been prepared yet", args[1], args[0])
+		return shim.Error("Lot not prepared yet")
+	}
+
+	lotBLKey, err = getLotBLKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	billOfLadingBytes, err = getAssetState(stub, lotBLKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(billOfLadingBytes) == 0 {
+		fmt.Printf("B/L for lot %s of trade %s has not been issued", args[1], args[0])
+		return shim.Error("B/L not issued yet")
+	}
+
+	if lot.Location == DESTINATION {
+		payment = lot.Amount - lot.Payment
+	} else {
+		payment = lot.Amount / 2 - lot.Payment
+	}
+	if payment <= 0 {
+		fmt.Printf("Payment for lot %s of trade %s already settled", args[1], args[0])
+		return shim.Error("Payment already settled")
+	}
+
+	// Lot payments are drawn under the trade's L/C, at sight
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit == nil || letterOfCredit.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("No accepted L/C found for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit.TenorDays != 0 {
+		err = errors.New(fmt.Sprintf("L/C for trade %s is not payable at sight", args[0]))
+		return shim.Error(err.Error())
+	}
+	err = checkDocumentsPresented(stub, args[0], letterOfCredit, nil)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit.Drawn + letterOfCredit.Transferred + payment > letterOfCredit.Amount {
+		err = errors.New(fmt.Sprintf("Payment amount %d exceeds the balance %d available under the L/C for trade %s", payment, letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	tradeKey, tradeAgreement, err = lookupTradeAgreement(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if tradeAgreement.Payment + payment > tradeAgreement.Amount {
+		err = errors.New(fmt.Sprintf("Payment amount %d exceeds the amount outstanding %d for trade %s", payment, tradeAgreement.Amount - tradeAgreement.Payment, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// A lot is paid for in at most two payments
+	paymentNumber = 1
+	if lot.Payment != 0 {
+		paymentNumber = 2
+	}
+	paymentRequest = &PaymentRequest{fmt.Sprintf("%s-%d", args[1], paymentNumber), payment, REQUESTED, "", "", 0, 0, ""}
+	paymentKey, err = getPaymentKey(stub, args[0], paymentRequest.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Settle the payment, unless it is held for the approval of the importer's bank
+	proposalBytes, err = t.settlePayment(stub, creatorOrg, creatorCertIssuer, PAY_LOT_ACTION, args, tradeKey, tradeAgreement, lcKey, letterOfCredit, nil, paymentKey, paymentRequest)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if proposalBytes != nil {
+		return awaitingApproval(proposalBytes)
+	}
+
+	lot.Payment += payment
+	err = putLot(stub, lotKey, lot)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Payment of %d for lot %s of trade %s recorded\n", payment, args[1], args[0])
+
+	return shim.Success(nil)
+}
+
+// Get the lots shipped under a trade
+func (t *TradeWorkflowChaincode) getLots(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lots []*Lot
+	var lotsBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter or Exporting Entity or Carrier Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) || authenticateCarrierOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity or Carrier Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	lots, err = getTradeLots(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lotsBytes, err = json.Marshal(lots)
+	if err != nil {
+		return shim.Error("Error marshaling lots")
+	}
+	fmt.Printf("Query Response:%s\n", string(lotsBytes))
+	return shim.Success(lotsBytes)
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"time"
+	"strconv"
+	"strings"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// A document record together with the signatures that verify against its current contents
+type SignedDocument struct {
+	TradeId			string		`json:"tradeId"`
+	Document		string		`json:"document"`
+	Record			json.RawMessage	`json:"record"`
+	Signatures		[]*DocumentSignature	`json:"signatures"`
+}
+
+// Separate the optional trailing signature argument from the arguments of a document issuance
+func splitSignature(args []string) ([]string, string) {
+	if len(args) > 0 {
+		parts := strings.SplitN(args[len(args) - 1], "=", 2)
+		if len(parts) == 2 && parts[0] == SIGNATURE_ARG {
+			return args[:len(args) - 1], parts[1]
+		}
+	}
+	return args, ""
+}
+
+// Separate the signature carried by the arguments of an approved proposal; it is verified against the proposer's
+// certificate when the proposal is recorded, and recorded itself only when the proposed issuance is performed
+func splitHeldSignature(args []string) ([]string, *DocumentSignature, error) {
+	var documentSignature *DocumentSignature
+
+	if len(args) > 0 {
+		parts := strings.SplitN(args[len(args) - 1], "=", 2)
+		if len(parts) == 2 && parts[0] == HELD_SIGNATURE_ARG {
+			err := json.Unmarshal([]byte(parts[1]), &documentSignature)
+			if err != nil {
+				return nil, nil, err
+			}
+			return args[:len(args) - 1], documentSignature, nil
+		}
+	}
+	return args, nil, nil
+}
+
+// Append a verified signature to the arguments of an issuance held for approval
+func appendHeldSignature(args []string, documentSignature *DocumentSignature) ([]string, error) {
+	if documentSignature == nil {
+		return args, nil
+	}
+	documentSignatureBytes, err := json.Marshal(documentSignature)
+	if err != nil {
+		return nil, errors.New("Error marshaling document signature structure")
+	}
+	return append(args[:len(args):len(args)], HELD_SIGNATURE_ARG + "=" + string(documentSignatureBytes)), nil
+}
+
+// A document is signed in its canonical serialisation: a JSON array of the document type, the trade ID and
+// the fields fixed at issuance, in declaration order, with numbers and flags written as strings.
+// Fields that change over the life of the document, such as its status, are not signed.
+// Signatures made in the earlier plain JSON serialisation are verified in that serialisation.
+func getSigningPayload(tradeID string, document string, record interface{}, payloadVersion int) ([]byte, error) {
+	var fields []interface{}
+
+	switch r := record.(type) {
+	case *LetterOfCredit:
+		fields = []interface{}{LETTER_OF_CREDIT_DOC, tradeID, r.Id, r.ExpirationDate, r.Beneficiary, strconv.Itoa(r.Amount), r.Documents,
+				       r.AdvisingBank, r.ConfirmingBank, strconv.FormatBool(r.Transferable), strconv.Itoa(r.TenorDays), strconv.FormatBool(r.PartialShipments)}
+	case *ExportLicense:
+		fields = []interface{}{EXPORT_LICENSE_DOC, tradeID, r.Id, r.ExpirationDate, r.Exporter, r.Carrier, r.DescriptionOfGoods, r.Approver}
+	case *BillOfLading:
+		fields = []interface{}{BILL_OF_LADING_DOC, tradeID, r.Id, r.ExpirationDate, r.Exporter, r.Carrier, r.DescriptionOfGoods,
+				       strconv.Itoa(r.Amount), r.Beneficiary, r.SourcePort, r.DestinationPort}
+	default:
+		return nil, errors.New(fmt.Sprintf("Document %s cannot be signed", document))
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	switch payloadVersion {
+	case JSON_SIGNING_PAYLOAD:
+		return payload, nil
+	case CANONICAL_SIGNING_PAYLOAD:
+		return canonicalizeJSON(payload)
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown signing payload version %d", payloadVersion))
+	}
+}
+
+// Check a base64-encoded ECDSA signature over the SHA-256 digest of a payload
+func verifyPayloadSignature(cert *x509.Certificate, payload []byte, signature string) error {
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("Signer certificate does not carry an ECDSA key")
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("Signature is not base64 encoded")
+	}
+	digest := sha256.Sum256(payload)
+	if !verifyECDSASignature(publicKey, digest[:], signatureBytes) {
+		return errors.New(fmt.Sprintf("Invalid signature of %s", cert.Subject.CommonName))
+	}
+	return nil
+}
+
+// Verify the invoker's signature over a document against the certificate it invoked with
+func verifyDocumentSignature(stub shim.ChaincodeStubInterface, tradeID string, document string, record interface{}, signature string) (*DocumentSignature, error) {
+	payload, err := getSigningPayload(tradeID, document, record, CANONICAL_SIGNING_PAYLOAD)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyPayloadSignature(cert, payload, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentSignature{tradeID, document, cert.Subject.CommonName, mspID, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+				  signature, txTime.Format(time.RFC3339), CANONICAL_SIGNING_PAYLOAD}, nil
+}
+
+// Verify the invoker's signature over a document against the certificate it invoked with, and record it
+func putDocumentSignature(stub shim.ChaincodeStubInterface, tradeID string, document string, record interface{}, signature string) error {
+	documentSignature, err := verifyDocumentSignature(stub, tradeID, document, record, signature)
+	if err != nil {
+		return err
+	}
+	return recordDocumentSignature(stub, documentSignature)
+}
+
+// Record a verified document signature
+func recordDocumentSignature(stub shim.ChaincodeStubInterface, documentSignature *DocumentSignature) error {
+	documentSignatureKey, err := getDocumentSignatureKey(stub, documentSignature.TradeId, documentSignature.Document, stub.GetTxID())
+	if err != nil {
+		return err
+	}
+	documentSignatureBytes, err := json.Marshal(documentSignature)
+	if err != nil {
+		return errors.New("Error marshaling document signature structure")
+	}
+	err = putAssetState(stub, documentSignatureKey, documentSignatureBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s for trade %s signed by %s\n", documentSignature.Document, documentSignature.TradeId, documentSignature.Signer)
+	return nil
+}
+
+// The signatures recorded for a document that still verify against its current contents
+func getDocumentSignatures(stub shim.ChaincodeStubInterface, tradeID string, document string, record interface{}) ([]*DocumentSignature, error) {
+	var documentSignature *DocumentSignature
+
+	// Each signature is checked against the serialisation it was made over
+	payloads := map[int][]byte{}
+
+	signaturesIterator, err := stub.GetStateByPartialCompositeKey("DocumentSignature", []string{tradeID, document})
+	if err != nil {
+		return nil, err
+	}
+	defer signaturesIterator.Close()
+
+	documentSignatures := []*DocumentSignature{}
+	for signaturesIterator.HasNext() {
+		signatureKV, err := signaturesIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := upgradeAssetState(stub, signatureKV.Key, signatureKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		documentSignature = nil
+		err = json.Unmarshal(value, &documentSignature)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode([]byte(documentSignature.Certificate))
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		payload, ok := payloads[documentSignature.PayloadVersion]
+		if !ok {
+			payload, err = getSigningPayload(tradeID, document, record, documentSignature.PayloadVersion)
+			if err != nil {
+				return nil, err
+			}
+			payloads[documentSignature.PayloadVersion] = payload
+		}
+		if verifyPayloadSignature(cert, payload, documentSignature.Signature) == nil {
+			documentSignatures = append(documentSignatures, documentSignature)
+		}
+	}
+	return documentSignatures, nil
+}
+
+// Get an issued L/C, E/L or B/L together with its verified signatures
+func (t *TradeWorkflowChaincode) getSignedDocument(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var key, id, jsonResp string
+	var recordBytes, signedDocumentBytes []byte
+	var record interface{}
+	var documentSignatures []*DocumentSignature
+	var err error
+
+	// Access control: Only a trade participant Org member can invoke this transaction
+	if !t.testMode && !authenticateTradeParticipantOrg(stub, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of a trade participant Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Document}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	switch args[1] {
+	case LETTER_OF_CREDIT_DOC:
+		key, err = getLCKey(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		letterOfCredit, err := lookupLetterOfCredit(stub, key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if letterOfCredit != nil {
+			record, id = letterOfCredit, letterOfCredit.Id
+		}
+	case EXPORT_LICENSE_DOC:
+		elKey, exportLicense, err := lookupExportLicense(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if exportLicense != nil {
+			key, record, id = elKey, exportLicense, exportLicense.Id
+		}
+	case BILL_OF_LADING_DOC:
+		blKey, billOfLading, err := lookupBillOfLading(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if billOfLading != nil {
+			key, record, id = blKey, billOfLading, billOfLading.Id
+		}
+	default:
+		err = errors.New(fmt.Sprintf("Document %s cannot be signed", args[1]))
+		return shim.Error(err.Error())
+	}
+
+	// Only issued documents are signed
+	if id == "" {
+		jsonResp = "{\"Error\":\"No " + args[1] + " issued for trade " + args[0] + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	recordBytes, err = getAssetState(stub, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	documentSignatures, err = getDocumentSignatures(stub, args[0], args[1], record)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// The record is returned byte for byte as stored, without escaping the '<', '>' and '&' it may contain
+	signedDocumentBytes, err = encodeCanonical(&SignedDocument{args[0], args[1], recordBytes, documentSignatures})
+	if err != nil {
+		return shim.Error("Error marshaling signed document")
+	}
+	fmt.Printf("Query Response:%s\n", string(signedDocumentBytes))
+	return shim.Success(signedDocumentBytes)
+}
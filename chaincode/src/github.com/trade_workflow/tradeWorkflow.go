@@ -21,46 +21,104 @@ import (
 	"errors"
 	"strconv"
 	"strings"
+	"time"
 	"encoding/json"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/trade_workflow/tradepb"
 )
 
 // TradeWorkflowChaincode implementation
 type TradeWorkflowChaincode struct {
 	testMode bool
+	approved bool	// Set while executing a proposal that has received its approvals
 }
 
 func (t *TradeWorkflowChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("Initializing Trade Workflow")
 	_, args := stub.GetFunctionAndParameters()
+	var roleArgs, featureArgs []string
+	var initialized, roleReset bool
 	var err error
 
-	if len(args) != 8 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 8: {" +
-					     "Exporter, " +
-					     "Exporter's Bank, " +
-					     "Exporter's Account Balance, " +
-					     "Importer, " +
-					     "Importer's Bank, " +
-					     "Importer's Account Balance, " +
-					     "Carrier, " +
-					     "Regulatory Authority" +
-					     "}. Found %d", len(args)))
+	// The participant roles come first, followed by any feature settings of the form <Feature>=on|off or settings of the form <Setting>=<value>
+	roleArgs = args
+	for i, arg := range args {
+		if strings.Contains(arg, "=") {
+			roleArgs = args[:i]
+			featureArgs = args[i:]
+			break
+		}
+	}
+
+	initialized, err = isLedgerInitialized(stub)
+	if err != nil {
 		return shim.Error(err.Error())
 	}
 
+	if len(roleArgs) == 0 {
+		// Upgrade Mode 1: leave ledger state as it was
+		// Records in an older schema are upgraded when read, or in batches through 'migrate'
+		if !initialized {
+			return shim.Error("Ledger not initialized. Expecting 8 or 9 arguments: {Exporter, Exporter's Bank, Exporter's Account Balance, Importer, Importer's Bank, Importer's Account Balance, Carrier, Regulatory Authority} [Insurer]")
+		}
+	} else {
+		// Instantiation, or upgrade mode 2: change all the names and account balances
+		roleReset, err = isFeatureEnabled(stub, ROLE_RESET_FEATURE)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if initialized && !roleReset {
+			return shim.Error("Roles and balances cannot be reset on this ledger. Feature " + ROLE_RESET_FEATURE + " is off")
+		}
+
+		err = initRoles(stub, roleArgs)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Record feature settings and other settings on the ledger
+	for _, featureArg := range featureArgs {
+		err = setConfiguration(stub, featureArg)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	return shim.Success(nil)
+}
+
+// Map participant identities to their roles on the ledger, with the initial account balances; the insurer is optional
+func initRoles(stub shim.ChaincodeStubInterface, args []string) error {
+	var err error
+
+	if len(args) != 8 && len(args) != 9 {
+		return errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 8 or 9: {" +
+					      "Exporter, " +
+					      "Exporter's Bank, " +
+					      "Exporter's Account Balance, " +
+					      "Importer, " +
+					      "Importer's Bank, " +
+					      "Importer's Account Balance, " +
+					      "Carrier, " +
+					      "Regulatory Authority" +
+					      "} [Insurer]. Found %d", len(args)))
+	}
+
 	// Type checks
 	_, err = strconv.Atoi(string(args[2]))
 	if err != nil {
 		fmt.Printf("Exporter's account balance must be an integer. Found %s\n", args[2])
-		return shim.Error(err.Error())
+		return err
 	}
 	_, err = strconv.Atoi(string(args[5]))
 	if err != nil {
 		fmt.Printf("Importer's account balance must be an integer. Found %s\n", args[5])
-		return shim.Error(err.Error())
+		return err
 	}
 
 	fmt.Printf("Exporter: %s\n", args[0])
@@ -72,33 +130,31 @@ func (t *TradeWorkflowChaincode) Init(stub shim.ChaincodeStubInterface) pb.Respo
 	fmt.Printf("Carrier: %s\n", args[6])
 	fmt.Printf("Regulatory Authority: %s\n", args[7])
 
-	// Map participant identities to their roles on the ledger
 	roleKeys := []string{ expKey, ebKey, expBalKey, impKey, ibKey, impBalKey, carKey, raKey }
+	if len(args) == 9 {
+		fmt.Printf("Insurer: %s\n", args[8])
+		roleKeys = append(roleKeys, insKey)
+	}
 	for i, roleKey := range roleKeys {
 		err = stub.PutState(roleKey, []byte(args[i]))
 		if err != nil {
-			fmt.Errorf("Error recording key %s: %s\n", roleKey, err.Error())
-			return shim.Error(err.Error())
+			fmt.Printf("Error recording key %s: %s\n", roleKey, err.Error())
+			return err
 		}
 	}
-
-	return shim.Success(nil)
+	return nil
 }
 
 func (t *TradeWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	var creatorOrg, creatorCertIssuer string
+	var err error
+
 	fmt.Println("TradeWorkflow Invoke")
 
-	creator, err := stub.GetCreator()
-	if err != nil {
-		fmt.Errorf("Error getting transaction creator: %s\n", err.Error())
-		return shim.Error(err.Error())
-	}
-	creatorOrg := ""
-	creatorCertIssuer := ""
 	if !t.testMode {
-		creatorOrg, creatorCertIssuer, err = getTxCreatorInfo(creator)
+		creatorOrg, creatorCertIssuer, err = getTxCreatorInfo(stub)
 		if err != nil {
-			fmt.Errorf("Error extracting creator identity info: %s\n", err.Error())
+			fmt.Printf("Error extracting creator identity info: %s\n", err.Error())
 			return shim.Error(err.Error())
 		}
 		fmt.Printf("TradeWorkflow Invoke by '%s', '%s'\n", creatorOrg, creatorCertIssuer)
@@ -120,6 +176,33 @@ func (t *TradeWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Res
 	} else if function == "acceptLC" {
 		// Exporter's Bank accepts an L/C
 		return t.acceptLC(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "adviseLC" {
+		// Advising Bank advises an L/C to the exporter
+		return t.adviseLC(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "confirmLC" {
+		// Confirming Bank adds its undertaking to an L/C
+		return t.confirmLC(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "transferLC" {
+		// Exporter's Bank transfers part of an L/C to a second beneficiary
+		return t.transferLC(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "issueBackToBackLC" {
+		// Exporter's Bank issues a back-to-back L/C to the exporter's supplier
+		return t.issueBackToBackLC(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "payChildLC" {
+		// Bank pays the beneficiary of a transferred or back-to-back L/C
+		return t.payChildLC(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "acceptDraft" {
+		// Importer's Bank accepts the draft drawn under a usance L/C
+		return t.acceptDraft(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "discountDraft" {
+		// Exporter's Bank discounts an accepted draft
+		return t.discountDraft(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "cancelLC" {
+		// Importer's Bank cancels an L/C that has not been accepted
+		return t.cancelLC(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "expireLC" {
+		// Importer or Exporter records the expiry of an L/C, releasing its escrow
+		return t.expireLC(stub, creatorOrg, creatorCertIssuer, args)
 	} else if function == "requestEL" {
 		// Exporter requests an E/L
 		return t.requestEL(stub, creatorOrg, creatorCertIssuer, args)
@@ -141,12 +224,138 @@ func (t *TradeWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Res
 	} else if function == "updateShipmentLocation" {
 		// Carrier updates the shipment location
 		return t.updateShipmentLocation(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "prepareLot" {
+		// Exporter prepares one lot of a trade shipped in lots
+		return t.prepareLot(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "acceptLotAndIssueBL" {
+		// Carrier validates a lot and issues a B/L for it
+		return t.acceptLotAndIssueBL(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "updateLotLocation" {
+		// Carrier updates the location of a lot
+		return t.updateLotLocation(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "payLot" {
+		// Importer's Bank pays for a lot
+		return t.payLot(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "issueInvoice" {
+		// Exporter issues the commercial invoice of a trade
+		return t.issueInvoice(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "offerReceivable" {
+		// Exporter offers the receivable of a trade for sale
+		return t.offerReceivable(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "financeReceivable" {
+		// Financier buys an offered receivable
+		return t.financeReceivable(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "surrenderBL" {
+		// Importer surrenders the B/L to the carrier
+		return t.surrenderBL(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "deliverShipment" {
+		// Carrier delivers the shipment against the surrendered B/L
+		return t.deliverShipment(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "confirmReceipt" {
+		// Importer confirms receipt of the goods
+		return t.confirmReceipt(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "registerInsurer" {
+		// Regulatory Authority registers the insurer and its organization
+		return t.registerInsurer(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "issueInsuranceCertificate" {
+		// Insurer issues the insurance certificate of a trade
+		return t.issueInsuranceCertificate(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "raiseInsuranceClaim" {
+		// Importer claims on the insurance after reporting damaged or short goods
+		return t.raiseInsuranceClaim(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "issueCertificate" {
+		// Registered certificate issuer certifies a document for a trade
+		return t.issueCertificate(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "revokeCertificate" {
+		// Certificate issuer revokes a certificate it issued
+		return t.revokeCertificate(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "anchorDocument" {
+		// Issuer of a trade document, or the importer or exporter for any other file, anchors its off-chain content
+		return t.anchorDocument(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "raiseDispute" {
+		// Importer, Exporter or either bank raises a dispute
+		return t.raiseDispute(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "proposeSettlement" {
+		// A disputing party proposes a settlement
+		return t.proposeSettlement(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "acceptSettlement" {
+		// The counterparty accepts a proposed settlement
+		return t.acceptSettlement(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "decideDispute" {
+		// Regulatory Authority decides a dispute as arbiter
+		return t.decideDispute(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "markOverdue" {
+		// Any party marks a trade that missed a deadline as late or defaulted
+		return t.markOverdue(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "issueGuarantee" {
+		// Importer's Bank issues a standby L/C or demand guarantee
+		return t.issueGuarantee(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "acceptGuarantee" {
+		// Exporter's Bank accepts a guarantee
+		return t.acceptGuarantee(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "claimGuarantee" {
+		// Exporter claims under a guarantee
+		return t.claimGuarantee(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "payGuarantee" {
+		// Importer's Bank pays out a claim
+		return t.payGuarantee(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "expireGuarantee" {
+		// Importer's or Exporter's Bank expires an unclaimed guarantee
+		return t.expireGuarantee(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "setCreditFacility" {
+		// Importer's Bank sets the importer's credit limits
+		return t.setCreditFacility(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "migrate" {
+		// Regulatory Authority upgrades a batch of records to the current schema
+		return t.migrate(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "grantDelegation" {
+		// Exporter delegates some of its workflow steps
+		return t.grantDelegation(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "revokeDelegation" {
+		// Exporter revokes a delegation
+		return t.revokeDelegation(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "setFeeSchedule" {
+		// Bank sets the fee it charges for one of its services
+		return t.setFeeSchedule(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "setAccountCurrency" {
+		// Importer or Exporter sets the currency its account is held in
+		return t.setAccountCurrency(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "registerRatePublisher" {
+		// Regulatory Authority registers a source of signed exchange rates
+		return t.registerRatePublisher(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "revokeRatePublisher" {
+		// Regulatory Authority revokes a source of exchange rates
+		return t.revokeRatePublisher(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "registerCertificateIssuer" {
+		// Regulatory Authority registers an issuer of third-party certificates
+		return t.registerCertificateIssuer(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "revokeCertificateIssuer" {
+		// Regulatory Authority revokes an issuer of third-party certificates
+		return t.revokeCertificateIssuer(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "postFXRate" {
+		// Any party relays an exchange rate signed by a rate publisher
+		return t.postFXRate(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "setApprovalPolicy" {
+		// Bank sets the threshold and number of approvals for its high-value actions
+		return t.setApprovalPolicy(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "approveProposal" {
+		// Bank approver approves a pending high-value action
+		return t.approveProposal(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "withdrawProposal" {
+		// Proposer or bank approver withdraws a pending high-value action
+		return t.withdrawProposal(stub, creatorOrg, creatorCertIssuer, args)
 	} else if function == "getTradeStatus" {
 		// Get status of trade agreement
 		return t.getTradeStatus(stub, creatorOrg, creatorCertIssuer, args)
 	} else if function == "getLCStatus" {
 		// Get the L/C status
 		return t.getLCStatus(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getChildLCs" {
+		// Get the L/Cs issued against a trade's L/C
+		return t.getChildLCs(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getDraft" {
+		// Get the draft drawn under a usance L/C
+		return t.getDraft(stub, creatorOrg, creatorCertIssuer, args)
 	} else if function == "getELStatus" {
 		// Get the E/L status
 		return t.getELStatus(stub, creatorOrg, creatorCertIssuer, args)
@@ -156,9 +365,66 @@ func (t *TradeWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Res
 	} else if function == "getBillOfLading" {
 		// Get the bill of lading
 		return t.getBillOfLading(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getLots" {
+		// Get the lots of a trade shipped in lots
+		return t.getLots(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getInvoice" {
+		// Get the commercial invoice of a trade
+		return t.getInvoice(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getInsuranceCertificate" {
+		// Get the insurance certificate of a trade
+		return t.getInsuranceCertificate(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getDocumentPresentation" {
+		// Check the documents presented for a trade against its L/C
+		return t.getDocumentPresentation(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getCertificates" {
+		// Get the third-party certificates issued for a trade
+		return t.getCertificates(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "verifyDocument" {
+		// Trace a file by its digest to the trade documents it was anchored to
+		return t.verifyDocument(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getSignedDocument" {
+		// Get an issued L/C, E/L or B/L with the signatures of the parties who issued it
+		return t.getSignedDocument(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getEscrow" {
+		// Get the funds escrowed for the L/C of a trade
+		return t.getEscrow(stub, creatorOrg, creatorCertIssuer, args)
 	} else if function == "getAccountBalance" {
 		// Get account balance: Exporter/Importer
 		return t.getAccountBalance(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getDispute" {
+		// Get a dispute record
+		return t.getDispute(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getOverdueTrades" {
+		// Get trades whose next step is past its deadline
+		return t.getOverdueTrades(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getGuarantee" {
+		// Get a guarantee
+		return t.getGuarantee(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getCreditFacility" {
+		// Get the importer's credit facility and headroom
+		return t.getCreditFacility(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getFeeSchedule" {
+		// Get the fee schedule of a bank
+		return t.getFeeSchedule(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getCharges" {
+		// Get the statement of fees charged on a trade
+		return t.getCharges(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getFXRate" {
+		// Get the exchange rate valid now for a currency pair
+		return t.getFXRate(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getPendingApprovals" {
+		// Get the proposals awaiting approval
+		return t.getPendingApprovals(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getDelegation" {
+		// Get a delegation record
+		return t.getDelegation(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getFeatures" {
+		// Get the features configured on the ledger
+		return t.getFeatures(stub, creatorOrg, creatorCertIssuer, args)
+	} else if function == "getSchemaInfo" {
+		// Get the schema versions of the records on the ledger
+		return t.getSchemaInfo(stub, creatorOrg, creatorCertIssuer, args)
 	/*} else if function == "delete" {
 		// Deletes an entity from its state
 		return t.delete(stub, creatorOrg, creatorCertIssuer, args)*/
@@ -171,17 +437,25 @@ func (t *TradeWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Res
 func (t *TradeWorkflowChaincode) requestTrade(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
 	var tradeKey string
 	var tradeAgreement *TradeAgreement
-	var tradeAgreementBytes []byte
-	var amount int
+	var tradeAgreementBytes, exporterBytes []byte
+	var creditFacility *CreditFacility
+	var deadlines *Deadlines
+	var amount, quantity int
 	var err error
 
+	// Retrieve the importer's credit facility; trades are only limited if the importer's bank has set one up
+	_, creditFacility, err = lookupImporterCreditFacility(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Access control: Only an Importer Org member can invoke this transaction
 	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
 		return shim.Error("Caller not a member of Importer Org. Access denied.")
 	}
 
-	if len(args) != 3 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {ID, Amount, Description of Goods}. Found %d", len(args)))
+	if len(args) != 3 && len(args) != 4 && len(args) != 6 && len(args) != 7 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3, 4, 6 or 7: {ID, Amount, Description of Goods} [L/C Issuance Deadline, Shipment Deadline, Payment Deadline] [Quantity]. Found %d", len(args)))
 		return shim.Error(err.Error())
 	}
 
@@ -190,7 +464,38 @@ func (t *TradeWorkflowChaincode) requestTrade(stub shim.ChaincodeStubInterface,
 		return shim.Error(err.Error())
 	}
 
-	tradeAgreement = &TradeAgreement{amount, args[2], REQUESTED, 0}
+	if len(args) >= 6 {
+		deadlines, err = getDeadlines(stub, args[3:6])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// The quantity of goods is only needed for trades shipped in lots
+	if len(args) == 4 || len(args) == 7 {
+		quantity, err = strconv.Atoi(args[len(args) - 1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if quantity <= 0 {
+			err = errors.New(fmt.Sprintf("Invalid quantity %d", quantity))
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Check the trade amount against the importer's credit limits
+	if creditFacility != nil {
+		exporterBytes, err = stub.GetState(expKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkCreditHeadroom(creditFacility, string(exporterBytes), amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	tradeAgreement = &TradeAgreement{amount, args[2], REQUESTED, 0, deadlines, quantity}
 	tradeAgreementBytes, err = json.Marshal(tradeAgreement)
 	if err != nil {
 		return shim.Error("Error marshaling trade agreement structure")
@@ -201,7 +506,7 @@ func (t *TradeWorkflowChaincode) requestTrade(stub shim.ChaincodeStubInterface,
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	err = stub.PutState(tradeKey, tradeAgreementBytes)
+	err = putAssetState(stub, tradeKey, tradeAgreementBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -217,9 +522,9 @@ func (t *TradeWorkflowChaincode) acceptTrade(stub shim.ChaincodeStubInterface, c
 	var tradeAgreementBytes []byte
 	var err error
 
-	// Access control: Only an Exporter Org member can invoke this transaction
-	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	// Access control: Only an Exporting Entity Org member, or a delegate of the exporter, can invoke this transaction
+	if !t.testMode && !authorizeExporterAction(stub, ACCEPT_TRADE_ACTION, args, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org nor a delegate of the exporter. Access denied.")
 	}
 
 	if len(args) != 1 {
@@ -232,7 +537,7 @@ func (t *TradeWorkflowChaincode) acceptTrade(stub shim.ChaincodeStubInterface, c
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	tradeAgreementBytes, err = stub.GetState(tradeKey)
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -248,19 +553,30 @@ func (t *TradeWorkflowChaincode) acceptTrade(stub shim.ChaincodeStubInterface, c
 		return shim.Error(err.Error())
 	}
 
+	if isTradeLate(tradeAgreement) {
+		err = errors.New(fmt.Sprintf("Trade %s is marked %s and cannot be accepted", args[0], tradeAgreement.Status))
+		return shim.Error(err.Error())
+	}
+
 	if tradeAgreement.Status == ACCEPTED {
 		fmt.Printf("Trade %s already accepted", args[0])
-	} else {
-		tradeAgreement.Status = ACCEPTED
-		tradeAgreementBytes, err = json.Marshal(tradeAgreement)
-		if err != nil {
-			return shim.Error("Error marshaling trade agreement structure")
-		}
-		// Write the state to the ledger
-		err = stub.PutState(tradeKey, tradeAgreementBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+		return shim.Success(nil)
+	}
+	// Only a requested trade can be accepted; a completed trade is never reopened
+	if tradeAgreement.Status != REQUESTED {
+		err = errors.New(fmt.Sprintf("Trade %s is %s and cannot be accepted", args[0], tradeAgreement.Status))
+		return shim.Error(err.Error())
+	}
+
+	tradeAgreement.Status = ACCEPTED
+	tradeAgreementBytes, err = json.Marshal(tradeAgreement)
+	if err != nil {
+		return shim.Error("Error marshaling trade agreement structure")
+	}
+	// Write the state to the ledger
+	err = putAssetState(stub, tradeKey, tradeAgreementBytes)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 	fmt.Printf("Trade %s acceptance recorded\n", args[0])
 
@@ -269,10 +585,12 @@ func (t *TradeWorkflowChaincode) acceptTrade(stub shim.ChaincodeStubInterface, c
 
 // Request an L/C
 func (t *TradeWorkflowChaincode) requestLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var tradeKey, lcKey string
+	var tradeKey, lcKey, advisingBank, confirmingBank string
 	var tradeAgreementBytes, letterOfCreditBytes, exporterBytes []byte
 	var tradeAgreement *TradeAgreement
 	var letterOfCredit *LetterOfCredit
+	var transferable, partialShipments bool
+	var tenorDays int
 	var err error
 
 	// Access control: Only an Importer Org member can invoke this transaction
@@ -280,17 +598,47 @@ func (t *TradeWorkflowChaincode) requestLC(stub shim.ChaincodeStubInterface, cre
 		return shim.Error("Caller not a member of Importer Org. Access denied.")
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+	if len(args) < 1 || len(args) > 6 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1 to 6: {Trade ID} [Advising Bank] [Confirming Bank] [Transferable] [Tenor Days] [Partial Shipments]. Found %d", len(args)))
 		return shim.Error(err.Error())
 	}
 
+	// The advising and confirming banks are optional; L/Cs are not transferable unless requested, are payable at sight unless a tenor is given,
+	// and prohibit partial shipments unless they are allowed
+	if len(args) > 1 {
+		advisingBank = args[1]
+	}
+	if len(args) > 2 {
+		confirmingBank = args[2]
+	}
+	if len(args) > 3 && args[3] != "" {
+		transferable, err = strconv.ParseBool(args[3])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if len(args) > 4 {
+		tenorDays, err = strconv.Atoi(args[4])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if tenorDays < 0 {
+			return shim.Error("Tenor may not be negative")
+		}
+	}
+	if len(args) > 5 && args[5] != "" {
+		partialShipments, err = strconv.ParseBool(args[5])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
 	// Lookup trade agreement from the ledger
 	tradeKey, err = getTradeKey(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	tradeAgreementBytes, err = stub.GetState(tradeKey)
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -317,7 +665,7 @@ func (t *TradeWorkflowChaincode) requestLC(stub shim.ChaincodeStubInterface, cre
 		return shim.Error(err.Error())
 	}
 
-	letterOfCredit = &LetterOfCredit{"", "", string(exporterBytes), tradeAgreement.Amount, []string{}, REQUESTED}
+	letterOfCredit = &LetterOfCredit{"", "", string(exporterBytes), tradeAgreement.Amount, []string{}, REQUESTED, advisingBank, confirmingBank, false, false, transferable, "", "", 0, 0, 0, tenorDays, partialShipments, nil}
 	letterOfCreditBytes, err = json.Marshal(letterOfCredit)
 	if err != nil {
 		return shim.Error("Error marshaling letter of credit structure")
@@ -328,7 +676,7 @@ func (t *TradeWorkflowChaincode) requestLC(stub shim.ChaincodeStubInterface, cre
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	err = stub.PutState(lcKey, letterOfCreditBytes)
+	err = putAssetState(stub, lcKey, letterOfCreditBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -341,8 +689,11 @@ func (t *TradeWorkflowChaincode) requestLC(stub shim.ChaincodeStubInterface, cre
 // We don't need to check the trade status if the L/C request has already been recorded
 func (t *TradeWorkflowChaincode) issueLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
 	var lcKey string
-	var letterOfCreditBytes []byte
+	var letterOfCreditBytes, proposalBytes, bankBytes []byte
 	var letterOfCredit *LetterOfCredit
+	var documentSignature *DocumentSignature
+	var proposalArgs []string
+	var signature string
 	var err error
 
 	// Access control: Only an Importer Org member can invoke this transaction
@@ -350,8 +701,17 @@ func (t *TradeWorkflowChaincode) issueLC(stub shim.ChaincodeStubInterface, creat
 		return shim.Error("Caller not a member of Importer Org. Access denied.")
 	}
 
+	// An issuance performed on approval carries the signature verified when it was proposed
+	args, documentSignature, err = splitHeldSignature(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if documentSignature != nil && !t.approved {
+		return shim.Error("Only an approved proposal may carry a held signature")
+	}
+	args, signature = splitSignature(args)
 	if len(args) < 3 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting at least 3: {Trade ID, L/C ID, Expiry Date} [List of Documents]. Found %d", len(args)))
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting at least 3: {Trade ID, L/C ID, Expiry Date} [List of Documents] [Signature=<signature>]. Found %d", len(args)))
 		return shim.Error(err.Error())
 	}
 
@@ -360,7 +720,7 @@ func (t *TradeWorkflowChaincode) issueLC(stub shim.ChaincodeStubInterface, creat
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	letterOfCreditBytes, err = stub.GetState(lcKey)
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -375,17 +735,76 @@ func (t *TradeWorkflowChaincode) issueLC(stub shim.ChaincodeStubInterface, creat
 		fmt.Printf("L/C for trade %s already issued", args[0])
 	} else if letterOfCredit.Status == ACCEPTED {
 		fmt.Printf("L/C for trade %s already accepted", args[0])
+	} else if letterOfCredit.Status == CANCELLED {
+		fmt.Printf("L/C for trade %s has been cancelled", args[0])
+		return shim.Error("L/C cancelled")
+	} else if letterOfCredit.Status == EXPIRED {
+		fmt.Printf("L/C for trade %s has expired", args[0])
+		return shim.Error("L/C expired")
 	} else {
+		// The signer vouches for the L/C as it is to be issued, whether now or once approved
+		if signature != "" {
+			issuedLC := *letterOfCredit
+			issuedLC.Id, issuedLC.ExpirationDate, issuedLC.Documents = args[1], args[2], args[3:]
+			documentSignature, err = verifyDocumentSignature(stub, args[0], LETTER_OF_CREDIT_DOC, &issuedLC, signature)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+
+		// High-value issuances wait for the approval of the importer's bank, carrying the verified signature with them
+		proposalArgs, err = appendHeldSignature(args, documentSignature)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		proposalBytes, err = t.holdForApproval(stub, ISSUE_LC_ACTION, proposalArgs, ibKey, letterOfCredit.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if proposalBytes != nil {
+			return awaitingApproval(proposalBytes)
+		}
+
+		// The L/C amount is drawn on the importer's credit facility
+		err = drawCredit(stub, args[0], letterOfCredit.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
 		letterOfCredit.Id = args[1]
 		letterOfCredit.ExpirationDate = args[2]
 		letterOfCredit.Documents = args[3:]
 		letterOfCredit.Status = ISSUED
+
+		// The applicant's funds covering the L/C are set aside in escrow
+		err = escrowLCFunds(stub, args[0], letterOfCredit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 		letterOfCreditBytes, err = json.Marshal(letterOfCredit)
 		if err != nil {
 			return shim.Error("Error marshaling L/C structure")
 		}
 		// Write the state to the ledger
-		err = stub.PutState(lcKey, letterOfCreditBytes)
+		err = putAssetState(stub, lcKey, letterOfCreditBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// The signature is recorded with the L/C it was given for
+		if documentSignature != nil {
+			err = recordDocumentSignature(stub, documentSignature)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+
+		// The importer's bank charges its issuance commission
+		bankBytes, err = stub.GetState(ibKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = assessFee(stub, args[0], ISSUE_LC_ACTION, string(bankBytes), letterOfCredit.Amount)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -398,7 +817,7 @@ func (t *TradeWorkflowChaincode) issueLC(stub shim.ChaincodeStubInterface, creat
 // Accept an L/C
 func (t *TradeWorkflowChaincode) acceptLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
 	var lcKey string
-	var letterOfCreditBytes []byte
+	var letterOfCreditBytes, proposalBytes, bankBytes []byte
 	var letterOfCredit *LetterOfCredit
 	var err error
 
@@ -417,7 +836,7 @@ func (t *TradeWorkflowChaincode) acceptLC(stub shim.ChaincodeStubInterface, crea
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	letterOfCreditBytes, err = stub.GetState(lcKey)
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -433,14 +852,42 @@ func (t *TradeWorkflowChaincode) acceptLC(stub shim.ChaincodeStubInterface, crea
 	} else if letterOfCredit.Status == REQUESTED {
 		fmt.Printf("L/C for trade %s has not been issued", args[0])
 		return shim.Error("L/C not issued yet")
+	} else if letterOfCredit.Status == CANCELLED {
+		fmt.Printf("L/C for trade %s has been cancelled", args[0])
+		return shim.Error("L/C cancelled")
+	} else if letterOfCredit.Status == EXPIRED {
+		fmt.Printf("L/C for trade %s has expired", args[0])
+		return shim.Error("L/C expired")
+	} else if letterOfCredit.AdvisingBank != "" && !letterOfCredit.Advised {
+		fmt.Printf("L/C for trade %s has not been advised by %s", args[0], letterOfCredit.AdvisingBank)
+		return shim.Error("L/C not advised yet")
 	} else {
+		// High-value acceptances wait for the approval of the exporter's bank
+		proposalBytes, err = t.holdForApproval(stub, ACCEPT_LC_ACTION, args, ebKey, letterOfCredit.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if proposalBytes != nil {
+			return awaitingApproval(proposalBytes)
+		}
+
 		letterOfCredit.Status = ACCEPTED
 		letterOfCreditBytes, err = json.Marshal(letterOfCredit)
 		if err != nil {
 			return shim.Error("Error marshaling L/C structure")
 		}
 		// Write the state to the ledger
-		err = stub.PutState(lcKey, letterOfCreditBytes)
+		err = putAssetState(stub, lcKey, letterOfCreditBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// The exporter's bank charges its commission for taking up the L/C
+		bankBytes, err = stub.GetState(ebKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = assessFee(stub, args[0], ACCEPT_LC_ACTION, string(bankBytes), letterOfCredit.Amount)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -450,13 +897,11 @@ func (t *TradeWorkflowChaincode) acceptLC(stub shim.ChaincodeStubInterface, crea
 	return shim.Success(nil)
 }
 
-// Request an E/L
-func (t *TradeWorkflowChaincode) requestEL(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var tradeKey, lcKey, elKey string
-	var tradeAgreementBytes, letterOfCreditBytes, exportLicenseBytes, exporterBytes, carrierBytes, approverBytes []byte
-	var tradeAgreement *TradeAgreement
+// Advise an L/C: the advising bank authenticates the issued L/C to the beneficiary
+func (t *TradeWorkflowChaincode) adviseLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lcKey string
+	var letterOfCreditBytes []byte
 	var letterOfCredit *LetterOfCredit
-	var exportLicense *ExportLicense
 	var err error
 
 	// Access control: Only an Exporter Org member can invoke this transaction
@@ -474,7 +919,7 @@ func (t *TradeWorkflowChaincode) requestEL(stub shim.ChaincodeStubInterface, cre
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	letterOfCreditBytes, err = stub.GetState(lcKey)
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -485,82 +930,320 @@ func (t *TradeWorkflowChaincode) requestEL(stub shim.ChaincodeStubInterface, cre
 		return shim.Error(err.Error())
 	}
 
-	// Verify that the L/C has already been accepted
-	if letterOfCredit.Status != ACCEPTED {
-		fmt.Printf("L/C for trade %s has not been accepted", args[0])
-		return shim.Error("L/C not accepted yet")
-	}
+	if letterOfCredit.AdvisingBank == "" {
+		fmt.Printf("L/C for trade %s has no advising bank", args[0])
+		return shim.Error("No advising bank nominated")
+	} else if letterOfCredit.Advised {
+		fmt.Printf("L/C for trade %s already advised", args[0])
+	} else if letterOfCredit.Status == REQUESTED {
+		fmt.Printf("L/C for trade %s has not been issued", args[0])
+		return shim.Error("L/C not issued yet")
+	} else if letterOfCredit.Status == CANCELLED {
+		fmt.Printf("L/C for trade %s has been cancelled", args[0])
+		return shim.Error("L/C cancelled")
+	} else if letterOfCredit.Status == EXPIRED {
+		fmt.Printf("L/C for trade %s has expired", args[0])
+		return shim.Error("L/C expired")
+	} else {
+		letterOfCredit.Advised = true
+		letterOfCreditBytes, err = json.Marshal(letterOfCredit)
+		if err != nil {
+			return shim.Error("Error marshaling L/C structure")
+		}
+		// Write the state to the ledger
+		err = putAssetState(stub, lcKey, letterOfCreditBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 
-	// Lookup trade agreement from the ledger
-	tradeKey, err = getTradeKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	tradeAgreementBytes, err = stub.GetState(tradeKey)
-	if err != nil {
-		return shim.Error(err.Error())
+		// The advising bank charges its advising commission
+		err = assessFee(stub, args[0], ADVISE_LC_SERVICE, letterOfCredit.AdvisingBank, letterOfCredit.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
+	fmt.Printf("L/C advice for trade %s recorded\n", args[0])
 
-	if len(tradeAgreementBytes) == 0 {
-		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(nil)
+}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
-	if err != nil {
-		return shim.Error(err.Error())
+// Confirm an L/C: the confirming bank adds its own undertaking to pay should the issuing bank default
+func (t *TradeWorkflowChaincode) confirmLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lcKey, bankBalanceKey string
+	var letterOfCreditBytes []byte
+	var letterOfCredit *LetterOfCredit
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
 	}
 
-	// Record the E/L request
-	exporterBytes, err = stub.GetState(expKey)
-	if err != nil {
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
 		return shim.Error(err.Error())
 	}
 
-	// Lookup exporter
-	exporterBytes, err = stub.GetState(expKey)
+	// Lookup L/C from the ledger
+	lcKey, err = getLCKey(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	// Lookup carrier
-	carrierBytes, err = stub.GetState(carKey)
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// Lookup regulatory authority (license approver)
-	approverBytes, err = stub.GetState(raKey)
+	// Unmarshal the JSON
+	err = json.Unmarshal(letterOfCreditBytes, &letterOfCredit)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	exportLicense = &ExportLicense{"", "", string(exporterBytes), string(carrierBytes), tradeAgreement.DescriptionOfGoods, string(approverBytes), REQUESTED}
-	exportLicenseBytes, err = json.Marshal(exportLicense)
-	if err != nil {
-		return shim.Error("Error marshaling export license structure")
-	}
+	if letterOfCredit.ConfirmingBank == "" {
+		fmt.Printf("L/C for trade %s has no confirming bank", args[0])
+		return shim.Error("No confirming bank nominated")
+	} else if letterOfCredit.Confirmed {
+		fmt.Printf("L/C for trade %s already confirmed", args[0])
+	} else if letterOfCredit.Status == REQUESTED {
+		fmt.Printf("L/C for trade %s has not been issued", args[0])
+		return shim.Error("L/C not issued yet")
+	} else if letterOfCredit.Status == CANCELLED {
+		fmt.Printf("L/C for trade %s has been cancelled", args[0])
+		return shim.Error("L/C cancelled")
+	} else if letterOfCredit.Status == EXPIRED {
+		fmt.Printf("L/C for trade %s has expired", args[0])
+		return shim.Error("L/C expired")
+	} else if letterOfCredit.AdvisingBank != "" && !letterOfCredit.Advised {
+		fmt.Printf("L/C for trade %s has not been advised by %s", args[0], letterOfCredit.AdvisingBank)
+		return shim.Error("L/C not advised yet")
+	} else {
+		// Open an account for the confirming bank, from which it pays should the issuing bank default
+		bankBalanceKey, err = getBankBalanceKey(stub, letterOfCredit.ConfirmingBank)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = openAccount(stub, bankBalanceKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 
-	// Write the state to the ledger
-	elKey, err = getELKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	err = stub.PutState(elKey, exportLicenseBytes)
-	if err != nil {
-		return shim.Error(err.Error())
+		letterOfCredit.Confirmed = true
+		letterOfCreditBytes, err = json.Marshal(letterOfCredit)
+		if err != nil {
+			return shim.Error("Error marshaling L/C structure")
+		}
+		// Write the state to the ledger
+		err = putAssetState(stub, lcKey, letterOfCreditBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// The confirming bank charges its confirmation commission
+		err = assessFee(stub, args[0], CONFIRM_LC_SERVICE, letterOfCredit.ConfirmingBank, letterOfCredit.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
-	fmt.Printf("Export License request for trade %s recorded\n", args[0])
+	fmt.Printf("L/C confirmation for trade %s recorded\n", args[0])
 
 	return shim.Success(nil)
 }
 
-// Issue an E/L
+// Cancel an L/C; an L/C is irrevocable once the beneficiary's bank has accepted or confirmed it
+func (t *TradeWorkflowChaincode) cancelLC(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lcKey string
+	var letterOfCreditBytes []byte
+	var letterOfCredit *LetterOfCredit
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup L/C from the ledger
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(letterOfCreditBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No L/C found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(letterOfCreditBytes, &letterOfCredit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if letterOfCredit.Status == CANCELLED {
+		fmt.Printf("L/C for trade %s already cancelled", args[0])
+		return shim.Success(nil)
+	}
+	if letterOfCredit.Status == ACCEPTED {
+		fmt.Printf("L/C for trade %s has been accepted", args[0])
+		return shim.Error("L/C already accepted")
+	}
+	if letterOfCredit.Status == EXPIRED {
+		fmt.Printf("L/C for trade %s has expired", args[0])
+		return shim.Error("L/C expired")
+	}
+	if letterOfCredit.Confirmed {
+		fmt.Printf("L/C for trade %s has been confirmed", args[0])
+		return shim.Error("L/C already confirmed")
+	}
+
+	// Release the amount drawn on the importer's credit facility at issuance, and the funds escrowed
+	if letterOfCredit.Status == ISSUED {
+		err = releaseCredit(stub, args[0], letterOfCredit.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = releaseEscrow(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	letterOfCredit.Status = CANCELLED
+	letterOfCreditBytes, err = json.Marshal(letterOfCredit)
+	if err != nil {
+		return shim.Error("Error marshaling L/C structure")
+	}
+	// Write the state to the ledger
+	err = putAssetState(stub, lcKey, letterOfCreditBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("L/C cancellation for trade %s recorded\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Request an E/L
+func (t *TradeWorkflowChaincode) requestEL(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeKey, lcKey, elKey string
+	var tradeAgreementBytes, letterOfCreditBytes, exportLicenseBytes, exporterBytes, carrierBytes, approverBytes []byte
+	var tradeAgreement *TradeAgreement
+	var letterOfCredit *LetterOfCredit
+	var exportLicense *ExportLicense
+	var err error
+
+	// Access control: Only an Exporting Entity Org member, or a delegate of the exporter, can invoke this transaction
+	if !t.testMode && !authorizeExporterAction(stub, REQUEST_EL_ACTION, args, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org nor a delegate of the exporter. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup L/C from the ledger
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(letterOfCreditBytes, &letterOfCredit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Verify that the L/C has already been accepted
+	if letterOfCredit.Status != ACCEPTED {
+		fmt.Printf("L/C for trade %s has not been accepted", args[0])
+		return shim.Error("L/C not accepted yet")
+	}
+
+	// Lookup trade agreement from the ledger
+	tradeKey, err = getTradeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Record the E/L request
+	exporterBytes, err = stub.GetState(expKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup exporter
+	exporterBytes, err = stub.GetState(expKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup carrier
+	carrierBytes, err = stub.GetState(carKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup regulatory authority (license approver)
+	approverBytes, err = stub.GetState(raKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	exportLicense = &ExportLicense{"", "", string(exporterBytes), string(carrierBytes), tradeAgreement.DescriptionOfGoods, string(approverBytes), REQUESTED, nil}
+	exportLicenseBytes, err = json.Marshal(exportLicense)
+	if err != nil {
+		return shim.Error("Error marshaling export license structure")
+	}
+
+	// Write the state to the ledger
+	elKey, err = getELKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAssetState(stub, elKey, exportLicenseBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Export License request for trade %s recorded\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Issue an E/L
 func (t *TradeWorkflowChaincode) issueEL(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
 	var elKey string
 	var exportLicenseBytes []byte
 	var exportLicense *ExportLicense
+	var signature string
 	var err error
 
 	// Access control: Only a Regulator Org member can invoke this transaction
@@ -568,8 +1251,9 @@ func (t *TradeWorkflowChaincode) issueEL(stub shim.ChaincodeStubInterface, creat
 		return shim.Error("Caller not a member of Regulator Org. Access denied.")
 	}
 
+	args, signature = splitSignature(args)
 	if len(args) != 3 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Trade ID, L/C ID, Expiry Date}. Found %d", len(args)))
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Trade ID, L/C ID, Expiry Date} [Signature=<signature>]. Found %d", len(args)))
 		return shim.Error(err.Error())
 	}
 
@@ -578,7 +1262,7 @@ func (t *TradeWorkflowChaincode) issueEL(stub shim.ChaincodeStubInterface, creat
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	exportLicenseBytes, err = stub.GetState(elKey)
+	exportLicenseBytes, err = getAssetState(stub, elKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -596,12 +1280,18 @@ func (t *TradeWorkflowChaincode) issueEL(stub shim.ChaincodeStubInterface, creat
 		exportLicense.Id = args[1]
 		exportLicense.ExpirationDate = args[2]
 		exportLicense.Status = ISSUED
+		if signature != "" {
+			err = putDocumentSignature(stub, args[0], EXPORT_LICENSE_DOC, exportLicense, signature)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
 		exportLicenseBytes, err = json.Marshal(exportLicense)
 		if err != nil {
 			return shim.Error("Error marshaling E/L structure")
 		}
 		// Write the state to the ledger
-		err = stub.PutState(elKey, exportLicenseBytes)
+		err = putAssetState(stub, elKey, exportLicenseBytes)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -616,11 +1306,12 @@ func (t *TradeWorkflowChaincode) prepareShipment(stub shim.ChaincodeStubInterfac
 	var elKey, shipmentLocationKey string
 	var shipmentLocationBytes, exportLicenseBytes []byte
 	var exportLicense *ExportLicense
+	var lots []*Lot
 	var err error
 
-	// Access control: Only an Exporter Org member can invoke this transaction
-	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	// Access control: Only an Exporting Entity Org member, or a delegate of the exporter, can invoke this transaction
+	if !t.testMode && !authorizeExporterAction(stub, PREPARE_SHIPMENT_ACTION, args, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org nor a delegate of the exporter. Access denied.")
 	}
 
 	if len(args) != 1 {
@@ -628,6 +1319,16 @@ func (t *TradeWorkflowChaincode) prepareShipment(stub shim.ChaincodeStubInterfac
 		return shim.Error(err.Error())
 	}
 
+	// A trade already being shipped in lots cannot also ship in a single consignment
+	lots, err = getTradeLots(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(lots) != 0 {
+		err = errors.New(fmt.Sprintf("Trade %s is being shipped in lots", args[0]))
+		return shim.Error(err.Error())
+	}
+
 	// Lookup shipment location from the ledger
 	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
 	if err != nil {
@@ -654,7 +1355,7 @@ func (t *TradeWorkflowChaincode) prepareShipment(stub shim.ChaincodeStubInterfac
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	exportLicenseBytes, err = stub.GetState(elKey)
+	exportLicenseBytes, err = getAssetState(stub, elKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -691,6 +1392,8 @@ func (t *TradeWorkflowChaincode) acceptShipmentAndIssueBL(stub shim.ChaincodeStu
 	var shipmentLocationBytes, tradeAgreementBytes, billOfLadingBytes, exporterBytes, carrierBytes, beneficiaryBytes []byte
 	var billOfLading *BillOfLading
 	var tradeAgreement *TradeAgreement
+	var txTime time.Time
+	var signature string
 	var err error
 
 	// Access control: Only an Carrier Org member can invoke this transaction
@@ -698,8 +1401,15 @@ func (t *TradeWorkflowChaincode) acceptShipmentAndIssueBL(stub shim.ChaincodeStu
 		return shim.Error("Caller not a member of Carrier Org. Access denied.")
 	}
 
+	args, signature = splitSignature(args)
 	if len(args) != 5 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 5: {Trade ID, B/L ID, Expiration Date, Source Port, Destination Port}. Found %d", len(args)))
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 5: {Trade ID, B/L ID, Expiration Date, Source Port, Destination Port} [Signature=<signature>]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
+	if err != nil {
 		return shim.Error(err.Error())
 	}
 
@@ -728,7 +1438,7 @@ func (t *TradeWorkflowChaincode) acceptShipmentAndIssueBL(stub shim.ChaincodeStu
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	tradeAgreementBytes, err = stub.GetState(tradeKey)
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -738,62 +1448,620 @@ func (t *TradeWorkflowChaincode) acceptShipmentAndIssueBL(stub shim.ChaincodeStu
 		return shim.Error(err.Error())
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
-	if err != nil {
-		return shim.Error(err.Error())
+	// Unmarshal the JSON
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup exporter
+	exporterBytes, err = stub.GetState(expKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup carrier
+	carrierBytes, err = stub.GetState(carKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup importer's bank (beneficiary of the title to goods after paymen tis made)
+	beneficiaryBytes, err = stub.GetState(ibKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The B/L is dated with the transaction timestamp
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Create and record a B/L
+	billOfLading = &BillOfLading{args[1], args[2], string(exporterBytes), string(carrierBytes), tradeAgreement.DescriptionOfGoods,
+				     tradeAgreement.Amount, string(beneficiaryBytes), args[3], args[4], ISSUED, txTime.Format(time.RFC3339), nil}
+	if signature != "" {
+		err = putDocumentSignature(stub, args[0], BILL_OF_LADING_DOC, billOfLading, signature)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	billOfLadingBytes, err = json.Marshal(billOfLading)
+	if err != nil {
+		return shim.Error("Error marshaling bill of lading structure")
+	}
+
+	// Write the state to the ledger
+	blKey, err = getBLKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAssetState(stub, blKey, billOfLadingBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Bill of Lading for trade %s recorded\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Find the payment request for a trade that is still awaiting settlement, if any
+func getPendingPaymentRequest(stub shim.ChaincodeStubInterface, tradeID string) (*PaymentRequest, error) {
+	var paymentRequest *PaymentRequest
+
+	paymentsIterator, err := stub.GetStateByPartialCompositeKey("Payment", []string{tradeID})
+	if err != nil {
+		return nil, err
+	}
+	defer paymentsIterator.Close()
+
+	for paymentsIterator.HasNext() {
+		paymentKV, err := paymentsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := stub.SplitCompositeKey(paymentKV.Key)
+		if err != nil {
+			return nil, err
+		}
+		// Request markers left by the original chaincode carry no ID and must be migrated before the trade can proceed
+		if len(keyParts) < 2 {
+			return nil, errors.New(fmt.Sprintf("Payment request for trade %s predates request IDs and must be migrated first", tradeID))
+		}
+		value, err := upgradeAssetState(stub, paymentKV.Key, paymentKV.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(value, &paymentRequest)
+		if err != nil {
+			return nil, err
+		}
+		if paymentRequest.Status == REQUESTED {
+			return paymentRequest, nil
+		}
+	}
+	return nil, nil
+}
+
+// Request a payment; each request carries an ID and a fixed amount so that it can be settled exactly once
+func (t *TradeWorkflowChaincode) requestPayment(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var shipmentLocationKey, paymentKey, tradeKey, lcKey string
+	var paymentAmount int
+	var shipmentLocationBytes, paymentBytes, tradeAgreementBytes []byte
+	var tradeAgreement *TradeAgreement
+	var letterOfCredit *LetterOfCredit
+	var paymentRequest *PaymentRequest
+	var requiredTypes []string
+	var err error
+
+	// Access control: Only an Exporting Entity Org member, or a delegate of the exporter, can invoke this transaction
+	if !t.testMode && !authorizeExporterAction(stub, REQUEST_PAYMENT_ACTION, args, creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporting Entity Org nor a delegate of the exporter. Access denied.")
+	}
+
+	args, requiredTypes, err = splitRequiredCertificates(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Payment Request ID} [Require=<type>[,<type>...]]. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup trade agreement from the ledger
+	tradeKey, err = getTradeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup shipment location from the ledger
+	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(shipmentLocationBytes) == 0 {
+		fmt.Printf("Shipment for trade %s has not been prepared yet", args[0])
+		return shim.Error("Shipment not prepared yet")
+	}
+
+	// A resubmitted request is accepted as long as it has not been settled
+	paymentKey, err = getPaymentKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	paymentBytes, err = getAssetState(stub, paymentKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(paymentBytes) != 0 {
+		err = json.Unmarshal(paymentBytes, &paymentRequest)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if paymentRequest.Status == PAID {
+			err = errors.New(fmt.Sprintf("Payment request %s for trade %s already settled", args[1], args[0]))
+			return shim.Error(err.Error())
+		}
+		fmt.Printf("Payment request %s already pending for trade %s\n", args[1], args[0])
+		return shim.Success(nil)
+	}
+
+	// Check if there's already a pending payment request
+	paymentRequest, err = getPendingPaymentRequest(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if paymentRequest != nil {
+		err = errors.New(fmt.Sprintf("Payment request %s already pending for trade %s", paymentRequest.Id, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Check what has been paid up to this point
+	fmt.Printf("Amount paid thus far for trade %s = %d; total required = %d\n", args[0], tradeAgreement.Payment, tradeAgreement.Amount)
+	if tradeAgreement.Amount == tradeAgreement.Payment {	// Payment has already been settled
+		fmt.Printf("Payment already settled for trade %s\n", args[0])
+		return shim.Error("Payment already settled")
+	}
+	if string(shipmentLocationBytes) == SOURCE && tradeAgreement.Payment != 0 {	// Suppress duplicate requests for partial payment
+		fmt.Printf("Partial payment already made for trade %s\n", args[0])
+		return shim.Error("Partial payment already made")
+	}
+
+	// Half the amount is due on shipment, the remainder on arrival
+	if string(shipmentLocationBytes) == SOURCE {
+		paymentAmount = tradeAgreement.Amount/2
+	} else {
+		paymentAmount = tradeAgreement.Amount - tradeAgreement.Payment
+	}
+
+	// Amounts transferred to second beneficiaries are paid to them rather than to the exporter
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit != nil && paymentAmount > letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred {
+		paymentAmount = letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred
+	}
+	if paymentAmount <= 0 {
+		fmt.Printf("Nothing further payable to the exporter for trade %s\n", args[0])
+		return shim.Error("Payment already settled")
+	}
+
+	// An insurance certificate or third-party certificates called for by the L/C, and the required certificate types, must have been presented
+	err = checkDocumentsPresented(stub, args[0], letterOfCredit, requiredTypes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Record request on ledger
+	paymentRequest = &PaymentRequest{args[1], paymentAmount, REQUESTED, "", "", 0, 0, ""}
+	paymentBytes, err = json.Marshal(paymentRequest)
+	if err != nil {
+		return shim.Error("Error marshaling payment request structure")
+	}
+	err = putAssetState(stub, paymentKey, paymentBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Payment request %s for trade %s recorded: amount %d\n", args[1], args[0], paymentAmount)
+
+	return shim.Success(nil)
+}
+
+// Make a payment against a payment request
+func (t *TradeWorkflowChaincode) makePayment(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var shipmentLocationKey, paymentKey, tradeKey, lcKey string
+	var paymentAmount int
+	var shipmentLocationBytes, paymentBytes, tradeAgreementBytes, letterOfCreditBytes, proposalBytes []byte
+	var tradeAgreement *TradeAgreement
+	var letterOfCredit *LetterOfCredit
+	var draft *Draft
+	var paymentRequest *PaymentRequest
+	var err error
+
+	// Access control: Only an Importer Org member, or an Exporter Org member on behalf of a confirming bank, can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Payment Request ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup the payment request
+	paymentKey, err = getPaymentKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	paymentBytes, err = getAssetState(stub, paymentKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(paymentBytes) == 0 {
+		fmt.Printf("No payment request %s found for trade %s", args[1], args[0])
+		return shim.Error("No payment request found")
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(paymentBytes, &paymentRequest)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Reject replays of a payment that has already gone through
+	if paymentRequest.Status == PAID {
+		err = errors.New(fmt.Sprintf("Payment request %s for trade %s already settled", args[1], args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup trade agreement from the ledger
+	tradeKey, err = getTradeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(tradeAgreementBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lookup shipment location from the ledger
+	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(shipmentLocationBytes) == 0 {
+		fmt.Printf("Shipment for trade %s has not been prepared yet", args[0])
+		return shim.Error("Shipment not prepared yet")
+	}
+
+	paymentAmount = paymentRequest.Amount
+	if tradeAgreement.Payment + paymentAmount > tradeAgreement.Amount {
+		err = errors.New(fmt.Sprintf("Payment amount %d exceeds the amount outstanding %d for trade %s", paymentAmount, tradeAgreement.Amount - tradeAgreement.Payment, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup L/C from the ledger
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(letterOfCreditBytes) != 0 {
+		err = json.Unmarshal(letterOfCreditBytes, &letterOfCredit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	if letterOfCredit != nil && letterOfCredit.Status == EXPIRED {
+		err = errors.New(fmt.Sprintf("L/C for trade %s expired on %s", args[0], letterOfCredit.ExpirationDate))
+		return shim.Error(err.Error())
+	}
+
+	// Amounts transferred to second beneficiaries are no longer payable to the exporter
+	if letterOfCredit != nil && letterOfCredit.Drawn + letterOfCredit.Transferred + paymentAmount > letterOfCredit.Amount {
+		err = errors.New(fmt.Sprintf("Payment amount %d exceeds the balance %d available under the L/C for trade %s", paymentAmount, letterOfCredit.Amount - letterOfCredit.Drawn - letterOfCredit.Transferred, args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Payment under a usance L/C is only due once the accepted draft has matured
+	draft, err = checkDraftMatured(stub, args[0], letterOfCredit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Settle the payment, unless it is held for the approval of the importer's bank
+	proposalBytes, err = t.settlePayment(stub, creatorOrg, creatorCertIssuer, MAKE_PAYMENT_ACTION, args, tradeKey, tradeAgreement, lcKey, letterOfCredit, draft, paymentKey, paymentRequest)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if proposalBytes != nil {
+		return awaitingApproval(proposalBytes)
+	}
+	fmt.Printf("Payment %s of %d for trade %s settled\n", args[1], paymentAmount, args[0])
+
+	return shim.Success(nil)
+}
+
+// Settle a payment drawn under a trade's L/C, unless it is held for the approval of the importer's bank.
+// The trade, the L/C and the settled payment record are written to the ledger; the marshaled proposal is returned if the payment must wait.
+func (t *TradeWorkflowChaincode) settlePayment(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, action string, args []string,
+					       tradeKey string, tradeAgreement *TradeAgreement, lcKey string, letterOfCredit *LetterOfCredit, draft *Draft, paymentKey string, paymentRequest *PaymentRequest) ([]byte, error) {
+	var payerBalKey, payeeBalKey, settledCurrency, invoiceKey string
+	var settledAmount, rate, debitAmount, payerBal int
+	var paymentBytes, payeeBytes, payerBytes, proposalBytes []byte
+	var invoice *Invoice
+	var err error
+
+	tradeID := args[0]
+	paymentAmount := paymentRequest.Amount
+
+	// High-value payments wait for the approval of the importer's bank
+	proposalBytes, err = t.holdForApproval(stub, action, args, ibKey, paymentAmount)
+	if err != nil {
+		return nil, err
+	}
+	if proposalBytes != nil {
+		return proposalBytes, nil
+	}
+
+	// The proceeds of a discounted draft go to the bank that discounted it, and those of a financed receivable to its financier
+	invoiceKey, invoice, err = lookupFinancedInvoice(stub, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if draft != nil && draft.Status == DISCOUNTED {
+		payeeBalKey, err = getBankBalanceKey(stub, draft.DiscountedBy)
+		if err != nil {
+			return nil, err
+		}
+		paymentRequest.PaidTo = draft.DiscountedBy
+	} else if invoice != nil {
+		payeeBalKey, err = getBankBalanceKey(stub, invoice.Financier)
+		if err != nil {
+			return nil, err
+		}
+		paymentRequest.PaidTo = invoice.Financier
+	} else {
+		payeeBalKey = expBalKey
+		payeeBytes, err = stub.GetState(expKey)
+		if err != nil {
+			return nil, err
+		}
+		paymentRequest.PaidTo = string(payeeBytes)
+	}
+
+	// The importer's account is debited in its own currency, converted at the latest published rate
+	settledAmount, rate, settledCurrency, err = convertImporterPayment(stub, paymentAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	// The confirming bank pays under its confirmation once the issuing bank has defaulted, from the funds in its own account
+	if letterOfCredit != nil && letterOfCredit.Confirmed && tradeAgreement.Status == DEFAULTED {
+		payerBalKey, err = getBankBalanceKey(stub, letterOfCredit.ConfirmingBank)
+		if err != nil {
+			return nil, err
+		}
+		payerBal, err = getBalance(stub, payerBalKey)
+		if err != nil {
+			return nil, err
+		}
+		if payerBal < paymentAmount {
+			return nil, errors.New(fmt.Sprintf("Confirming bank's balance %d is insufficient to pay %d for trade %s", payerBal, paymentAmount, tradeID))
+		}
+		debitAmount = paymentAmount
+		paymentRequest.PaidBy = letterOfCredit.ConfirmingBank
+		fmt.Printf("Issuing bank has defaulted; payment %s for trade %s charged to confirming bank %s\n", paymentRequest.Id, tradeID, letterOfCredit.ConfirmingBank)
+	} else {
+		// Access control: Only an Importer Org member can pay on the issuing bank's account
+		if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+			return nil, errors.New("Caller not a member of Importer Org. Access denied.")
+		}
+		payerBalKey = impBalKey
+		payerBytes, err = stub.GetState(ibKey)
+		if err != nil {
+			return nil, err
+		}
+		paymentRequest.PaidBy = string(payerBytes)
+
+		// Record the rate used when the payment was converted
+		debitAmount = settledAmount
+		if rate != 0 {
+			paymentRequest.Rate = rate
+			paymentRequest.SettledAmount = settledAmount
+			paymentRequest.SettledCurrency = settledCurrency
+		}
+	}
+
+	// Payments on the issuing bank's account draw first on the funds escrowed for the L/C
+	if payerBalKey == impBalKey {
+		err = drawEscrow(stub, tradeID, debitAmount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Transfer the funds, converted if the payer's account is in another currency
+	if debitAmount == paymentAmount {
+		err = transferFunds(stub, payerBalKey, payeeBalKey, paymentAmount)
+	} else {
+		err = exchangeFunds(stub, payerBalKey, debitAmount, payeeBalKey, paymentAmount)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Update ledger state
+	tradeAgreement.Payment += paymentAmount
+	err = putTradeAgreement(stub, tradeKey, tradeAgreement)
+	if err != nil {
+		return nil, err
+	}
+
+	if letterOfCredit != nil {
+		letterOfCredit.Drawn += paymentAmount
+		err = putLetterOfCredit(stub, lcKey, letterOfCredit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if invoice != nil {
+		err = repayFinancier(stub, invoiceKey, invoice, paymentAmount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The amount paid is released back into the importer's credit facility, unless the confirming bank paid in its stead
+	if payerBalKey == impBalKey {
+		err = releaseCredit(stub, tradeID, paymentAmount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Retain the settled request on the ledger as the record of this payment
+	paymentRequest.Status = PAID
+	paymentBytes, err = json.Marshal(paymentRequest)
+	if err != nil {
+		return nil, errors.New("Error marshaling payment request structure")
+	}
+	err = putAssetState(stub, paymentKey, paymentBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// The paying bank charges its payment commission
+	err = assessFee(stub, tradeID, MAKE_PAYMENT_ACTION, paymentRequest.PaidBy, paymentAmount)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Update shipment location; we will only allow SOURCE and DESTINATION as valid locations for this contract
+func (t *TradeWorkflowChaincode) updateShipmentLocation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var shipmentLocationKey string
+	var shipmentLocationBytes []byte
+	var err error
+
+	// Access control: Only a Carrier Org member can invoke this transaction
+	if !t.testMode && !authenticateCarrierOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Carrier Org. Access denied.")
 	}
 
-	// Lookup exporter
-	exporterBytes, err = stub.GetState(expKey)
-	if err != nil {
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID, Location}. Found %d", len(args)))
 		return shim.Error(err.Error())
 	}
 
-	// Lookup carrier
-	carrierBytes, err = stub.GetState(carKey)
+	// Lookup shipment location from the ledger
+	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// Lookup importer's bank (beneficiary of the title to goods after paymen tis made)
-	beneficiaryBytes, err = stub.GetState(ibKey)
+	shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// Create and record a B/L
-	billOfLading = &BillOfLading{args[1], args[2], string(exporterBytes), string(carrierBytes), tradeAgreement.DescriptionOfGoods,
-				     tradeAgreement.Amount, string(beneficiaryBytes), args[3], args[4]}
-	billOfLadingBytes, err = json.Marshal(billOfLading)
-	if err != nil {
-		return shim.Error("Error marshaling bill of lading structure")
+	if len(shipmentLocationBytes) == 0 {
+		fmt.Printf("Shipment for trade %s has not been prepared yet", args[0])
+		return shim.Error("Shipment not prepared yet")
+	}
+	if string(shipmentLocationBytes) == args[1] {
+		fmt.Printf("Shipment for trade %s is already in location %s", args[0], args[1])
 	}
 
 	// Write the state to the ledger
-	blKey, err = getBLKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	err = stub.PutState(blKey, billOfLadingBytes)
+	err = stub.PutState(shipmentLocationKey, []byte(args[1]))
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	fmt.Printf("Bill of Lading for trade %s recorded\n", args[0])
+	fmt.Printf("Shipment location for trade %s recorded\n", args[0])
 
 	return shim.Success(nil)
 }
 
-// Request a payment
-func (t *TradeWorkflowChaincode) requestPayment(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var shipmentLocationKey, paymentKey, tradeKey string
-	var shipmentLocationBytes, paymentBytes, tradeAgreementBytes []byte
+// Surrender the B/L to the carrier, or the B/Ls of all its lots if the trade ships in lots; title to the goods passes
+// to the importer only after full payment
+func (t *TradeWorkflowChaincode) surrenderBL(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeKey string
+	var tradeAgreementBytes, billOfLadingBytes []byte
 	var tradeAgreement *TradeAgreement
+	var lots []*Lot
+	var blKeys []string
+	var billsOfLading []*BillOfLading
+	var surrendered bool
 	var err error
 
-	// Access control: Only an Exporter Org member can invoke this transaction
-	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
 	}
 
 	if len(args) != 1 {
@@ -801,88 +2069,97 @@ func (t *TradeWorkflowChaincode) requestPayment(stub shim.ChaincodeStubInterface
 		return shim.Error(err.Error())
 	}
 
-	// Lookup trade agreement from the ledger
-	tradeKey, err = getTradeKey(stub, args[0])
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	tradeAgreementBytes, err = stub.GetState(tradeKey)
+
+	// Lookup B/Ls from the ledger
+	lots, err = getTradeLots(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	if len(tradeAgreementBytes) == 0 {
-		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
+	blKeys, billsOfLading, err = lookupTradeBillsOfLading(stub, args[0], lots)
+	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
-	if err != nil {
-		return shim.Error(err.Error())
+	surrendered = true
+	for _, billOfLading := range billsOfLading {
+		if billOfLading == nil {
+			fmt.Printf("B/L for trade %s has not been issued", args[0])
+			return shim.Error("B/L not issued yet")
+		}
+		if billOfLading.Status != SURRENDERED {
+			surrendered = false
+		}
+	}
+	if surrendered {
+		fmt.Printf("B/L for trade %s already surrendered", args[0])
+		return shim.Success(nil)
 	}
 
-	// Lookup shipment location from the ledger
-	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
+	// Lookup trade agreement from the ledger
+	tradeKey, err = getTradeKey(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	if len(shipmentLocationBytes) == 0 {
-		fmt.Printf("Shipment for trade %s has not been prepared yet", args[0])
-		return shim.Error("Shipment not prepared yet")
+	if len(tradeAgreementBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
+		return shim.Error(err.Error())
 	}
 
-	// Check if there's already a pending payment request
-	paymentKey, err = getPaymentKey(stub, args[0])
+	// Unmarshal the JSON
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	paymentBytes, err = stub.GetState(paymentKey)
-	if err != nil {
-		return shim.Error(err.Error())
+
+	// The holder can only surrender the B/L once the goods have been paid for in full
+	if tradeAgreement.Payment != tradeAgreement.Amount {
+		fmt.Printf("Payment for trade %s has not been settled: paid %d of %d\n", args[0], tradeAgreement.Payment, tradeAgreement.Amount)
+		return shim.Error("Payment not settled yet")
 	}
 
-	if len(paymentBytes) != 0 {	// The value doesn't matter as this is a temporary key used as a marker
-		fmt.Printf("Payment request already pending for trade %s\n", args[0])
-	} else {
-		// Check what has been paid up to this point
-		fmt.Printf("Amount paid thus far for trade %s = %d; total required = %d\n", args[0], tradeAgreement.Payment, tradeAgreement.Amount)
-		if tradeAgreement.Amount == tradeAgreement.Payment {	// Payment has already been settled
-			fmt.Printf("Payment already settled for trade %s\n", args[0])
-			return shim.Error("Payment already settled")
+	for i, billOfLading := range billsOfLading {
+		if billOfLading.Status == SURRENDERED {
+			continue
 		}
-		if string(shipmentLocationBytes) == SOURCE && tradeAgreement.Payment != 0 {	// Suppress duplicate requests for partial payment
-			fmt.Printf("Partial payment already made for trade %s\n", args[0])
-			return shim.Error("Partial payment already made")
+		billOfLading.Status = SURRENDERED
+		billOfLadingBytes, err = json.Marshal(billOfLading)
+		if err != nil {
+			return shim.Error("Error marshaling bill of lading structure")
 		}
-
-		// Record request on ledger
-		err = stub.PutState(paymentKey, []byte(REQUESTED))
+		// Write the state to the ledger
+		err = putAssetState(stub, blKeys[i], billOfLadingBytes)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		fmt.Printf("Payment request for trade %s recorded\n", args[0])
 	}
+	fmt.Printf("B/L surrender for trade %s recorded\n", args[0])
+
 	return shim.Success(nil)
 }
 
-// Make a payment
-func (t *TradeWorkflowChaincode) makePayment(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var shipmentLocationKey, paymentKey, tradeKey string
-	var paymentAmount, expBal, impBal int
-	var shipmentLocationBytes, paymentBytes, tradeAgreementBytes, impBalBytes, expBalBytes []byte
-	var tradeAgreement *TradeAgreement
+// Deliver a shipment at its destination, or all its lots if the trade ships in lots; the carrier may only release
+// the goods against a surrendered B/L
+func (t *TradeWorkflowChaincode) deliverShipment(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var shipmentLocationKey, deliveryKey string
+	var shipmentLocationBytes, deliveryBytes []byte
+	var lots []*Lot
+	var billsOfLading []*BillOfLading
+	var delivery *Delivery
 	var err error
 
-	// Access control: Only an Importer Org member can invoke this transaction
-	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	// Access control: Only a Carrier Org member can invoke this transaction
+	if !t.testMode && !authenticateCarrierOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Carrier Org. Access denied.")
 	}
 
 	if len(args) != 1 {
@@ -890,158 +2167,190 @@ func (t *TradeWorkflowChaincode) makePayment(stub shim.ChaincodeStubInterface, c
 		return shim.Error(err.Error())
 	}
 
-	// Check if there's already a pending payment request
-	paymentKey, err = getPaymentKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	paymentBytes, err = stub.GetState(paymentKey)
+	// Payment and B/L transactions are frozen while a dispute is pending
+	err = checkNoOpenDispute(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	if len(paymentBytes) == 0 {
-		fmt.Printf("No payment request found for trade %s", args[0])
-		return shim.Error("No payment request found")
-	}
-
-	// Lookup trade agreement from the ledger
-	tradeKey, err = getTradeKey(stub, args[0])
+	// Check if the shipment has already been delivered
+	deliveryKey, err = getDeliveryKey(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	tradeAgreementBytes, err = stub.GetState(tradeKey)
+	deliveryBytes, err = getAssetState(stub, deliveryKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	if len(tradeAgreementBytes) == 0 {
-		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
-		return shim.Error(err.Error())
+	if len(deliveryBytes) != 0 {
+		fmt.Printf("Shipment for trade %s has already been delivered", args[0])
+		return shim.Success(nil)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
+	// Lookup shipment location, or the location of each lot, from the ledger
+	lots, err = getTradeLots(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if len(lots) == 0 {
+		shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 
-	// Lookup shipment location from the ledger
-	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
+		shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if string(shipmentLocationBytes) != DESTINATION {
+			fmt.Printf("Shipment for trade %s has not reached its destination", args[0])
+			return shim.Error("Shipment not at destination yet")
+		}
+	}
+	for _, lot := range lots {
+		if lot.Location != DESTINATION {
+			fmt.Printf("Lot %s for trade %s has not reached its destination", lot.Id, args[0])
+			return shim.Error("Shipment not at destination yet")
+		}
 	}
 
-	shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
+	// Lookup B/Ls from the ledger
+	_, billsOfLading, err = lookupTradeBillsOfLading(stub, args[0], lots)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	if len(shipmentLocationBytes) == 0 {
-		fmt.Printf("Shipment for trade %s has not been prepared yet", args[0])
-		return shim.Error("Shipment not prepared yet")
+	for _, billOfLading := range billsOfLading {
+		if billOfLading == nil {
+			fmt.Printf("B/L for trade %s has not been issued", args[0])
+			return shim.Error("B/L not issued yet")
+		}
+
+		// Verify that the B/L has been surrendered by its holder
+		if billOfLading.Status != SURRENDERED {
+			fmt.Printf("B/L for trade %s has not been surrendered", args[0])
+			return shim.Error("B/L not surrendered yet")
+		}
 	}
 
-	// Lookup account balances
-	expBalBytes, err = stub.GetState(expBalKey)
+	delivery = &Delivery{DELIVERED, "", ""}
+	deliveryBytes, err = json.Marshal(delivery)
 	if err != nil {
-		return shim.Error(err.Error())
+		return shim.Error("Error marshaling delivery structure")
 	}
-	expBal, err = strconv.Atoi(string(expBalBytes))
+	// Write the state to the ledger
+	err = putAssetState(stub, deliveryKey, deliveryBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	impBalBytes, err = stub.GetState(impBalKey)
-	if err != nil {
-		return shim.Error(err.Error())
+	fmt.Printf("Shipment delivery for trade %s recorded\n", args[0])
+
+	return shim.Success(nil)
+}
+
+// Confirm receipt of delivered goods, optionally noting damage or shortage; this completes the trade
+func (t *TradeWorkflowChaincode) confirmReceipt(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var tradeKey, deliveryKey, condition, note string
+	var tradeAgreementBytes, deliveryBytes []byte
+	var tradeAgreement *TradeAgreement
+	var delivery *Delivery
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
 	}
-	impBal, err = strconv.Atoi(string(impBalBytes))
-	if err != nil {
+
+	if len(args) != 1 && len(args) != 3 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1 or 3: {Trade ID} [Condition, Note]. Found %d", len(args)))
 		return shim.Error(err.Error())
 	}
 
-	// Record transfer of funds
-	if string(shipmentLocationBytes) == SOURCE {
-		paymentAmount = tradeAgreement.Amount/2
-	} else {
-		paymentAmount = tradeAgreement.Amount - tradeAgreement.Payment
-	}
-	tradeAgreement.Payment += paymentAmount
-	expBal += paymentAmount
-	if impBal < paymentAmount {
-		fmt.Printf("Importer's bank balance %d is insufficient to cover payment amount %d\n", impBal, paymentAmount)
+	condition = GOOD
+	if len(args) == 3 {
+		condition = args[1]
+		note = args[2]
+		if condition != GOOD && condition != DAMAGED && condition != SHORT {
+			err = errors.New(fmt.Sprintf("Invalid condition %s; Permissible values: {%s, %s, %s}", condition, GOOD, DAMAGED, SHORT))
+			return shim.Error(err.Error())
+		}
 	}
-	impBal -= paymentAmount
 
-	// Update ledger state
-	tradeAgreementBytes, err = json.Marshal(tradeAgreement)
-	if err != nil {
-		return shim.Error("Error marshaling trade agreement structure")
-	}
-	err = stub.PutState(tradeKey, tradeAgreementBytes)
+	// Lookup delivery record from the ledger
+	deliveryKey, err = getDeliveryKey(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	err = stub.PutState(expBalKey, []byte(strconv.Itoa(expBal)))
+	deliveryBytes, err = getAssetState(stub, deliveryKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	err = stub.PutState(impBalKey, []byte(strconv.Itoa(impBal)))
+
+	if len(deliveryBytes) == 0 {
+		fmt.Printf("Shipment for trade %s has not been delivered", args[0])
+		return shim.Error("Shipment not delivered yet")
+	}
+
+	// Unmarshal the JSON
+	err = json.Unmarshal(deliveryBytes, &delivery)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// Delete request key from ledger
-	err = stub.DelState(paymentKey)
+	// Lookup trade agreement from the ledger
+	tradeKey, err = getTradeKey(stub, args[0])
 	if err != nil {
-		fmt.Println(err.Error())
-		return shim.Error("Failed to delete payment request from ledger")
+		return shim.Error(err.Error())
 	}
-
-	return shim.Success(nil)
-}
-
-// Update shipment location; we will only allow SOURCE and DESTINATION as valid locations for this contract
-func (t *TradeWorkflowChaincode) updateShipmentLocation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var shipmentLocationKey string
-	var shipmentLocationBytes []byte
-	var err error
-
-	// Access control: Only a Carrier Org member can invoke this transaction
-	if !t.testMode && !authenticateCarrierOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Carrier Org. Access denied.")
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	if len(args) != 2 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID, Location}. Found %d", len(args)))
+	if len(tradeAgreementBytes) == 0 {
+		err = errors.New(fmt.Sprintf("No record found for trade ID %s", args[0]))
 		return shim.Error(err.Error())
 	}
 
-	// Lookup shipment location from the ledger
-	shipmentLocationKey, err = getShipmentLocationKey(stub, args[0])
+	// Unmarshal the JSON
+	err = json.Unmarshal(tradeAgreementBytes, &tradeAgreement)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	shipmentLocationBytes, err = stub.GetState(shipmentLocationKey)
-	if err != nil {
+	if tradeAgreement.Status == COMPLETED {
+		fmt.Printf("Trade %s already completed", args[0])
+		return shim.Success(nil)
+	}
+	if isTradeLate(tradeAgreement) && tradeAgreement.Payment < tradeAgreement.Amount {
+		err = errors.New(fmt.Sprintf("Trade %s is marked %s and has not been paid in full", args[0], tradeAgreement.Status))
 		return shim.Error(err.Error())
 	}
 
-	if len(shipmentLocationBytes) == 0 {
-		fmt.Printf("Shipment for trade %s has not been prepared yet", args[0])
-		return shim.Error("Shipment not prepared yet")
+	delivery.Condition = condition
+	delivery.Note = note
+	deliveryBytes, err = json.Marshal(delivery)
+	if err != nil {
+		return shim.Error("Error marshaling delivery structure")
 	}
-	if string(shipmentLocationBytes) == args[1] {
-		fmt.Printf("Shipment for trade %s is already in location %s", args[0], args[1])
+	tradeAgreement.Status = COMPLETED
+	tradeAgreementBytes, err = json.Marshal(tradeAgreement)
+	if err != nil {
+		return shim.Error("Error marshaling trade agreement structure")
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(shipmentLocationKey, []byte(args[1]))
+	err = putAssetState(stub, deliveryKey, deliveryBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	fmt.Printf("Shipment location for trade %s recorded\n", args[0])
+	err = putAssetState(stub, tradeKey, tradeAgreementBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Receipt of goods for trade %s recorded with condition %s\n", args[0], condition)
 
 	return shim.Success(nil)
 }
@@ -1069,18 +2378,22 @@ func (t *TradeWorkflowChaincode) delete(stub shim.ChaincodeStubInterface, creato
 
 // Get current state of a trade agreement
 func (t *TradeWorkflowChaincode) getTradeStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var tradeKey, jsonResp string
+	var tradeKey, jsonResp, format string
 	var tradeAgreement TradeAgreement
 	var tradeAgreementBytes []byte
 	var err error
 
-	// Access control: Only an Importer or Exporter Org member can invoke this transaction
-	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	// Access control: Only an Importer or Exporter or Exporting Entity Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity Org. Access denied.")
 	}
 
+	args, format, err = splitFormat(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1: <trade ID>")
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2: <trade ID> [Format=json|protobuf]")
 	}
 
 	// Get the state from the ledger
@@ -1088,7 +2401,7 @@ func (t *TradeWorkflowChaincode) getTradeStatus(stub shim.ChaincodeStubInterface
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	tradeAgreementBytes, err = stub.GetState(tradeKey)
+	tradeAgreementBytes, err = getAssetState(stub, tradeKey)
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + tradeKey + "\"}"
 		return shim.Error(jsonResp)
@@ -1106,24 +2419,29 @@ func (t *TradeWorkflowChaincode) getTradeStatus(stub shim.ChaincodeStubInterface
 	}
 
 	jsonResp = "{\"Status\":\"" + tradeAgreement.Status + "\"}"
-	fmt.Printf("Query Response:%s\n", jsonResp)
-	return shim.Success([]byte(jsonResp))
+	return formatQueryResponse(format, []byte(jsonResp), func() (proto.Message, error) {
+		return &tradepb.StatusResponse{Status: tradeAgreement.Status}, nil
+	})
 }
 
 // Get current state of a Letter of Credit
 func (t *TradeWorkflowChaincode) getLCStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var lcKey, jsonResp string
+	var lcKey, jsonResp, format string
 	var letterOfCredit LetterOfCredit
 	var letterOfCreditBytes []byte
 	var err error
 
-	// Access control: Only an Importer or Exporter Org member can invoke this transaction
-	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	// Access control: Only an Importer or Exporter or Exporting Entity Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity Org. Access denied.")
 	}
 
+	args, format, err = splitFormat(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1: <trade ID>")
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2: <trade ID> [Format=json|protobuf]")
 	}
 
 	// Get the state from the ledger
@@ -1131,7 +2449,7 @@ func (t *TradeWorkflowChaincode) getLCStatus(stub shim.ChaincodeStubInterface, c
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	letterOfCreditBytes, err = stub.GetState(lcKey)
+	letterOfCreditBytes, err = getAssetState(stub, lcKey)
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + lcKey + "\"}"
 		return shim.Error(jsonResp)
@@ -1149,24 +2467,29 @@ func (t *TradeWorkflowChaincode) getLCStatus(stub shim.ChaincodeStubInterface, c
 	}
 
 	jsonResp = "{\"Status\":\"" + letterOfCredit.Status + "\"}"
-	fmt.Printf("Query Response:%s\n", jsonResp)
-	return shim.Success([]byte(jsonResp))
+	return formatQueryResponse(format, []byte(jsonResp), func() (proto.Message, error) {
+		return &tradepb.StatusResponse{Status: letterOfCredit.Status}, nil
+	})
 }
 
 // Get current state of an Export License
 func (t *TradeWorkflowChaincode) getELStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var elKey, jsonResp string
+	var elKey, jsonResp, format string
 	var exportLicense ExportLicense
 	var exportLicenseBytes []byte
 	var err error
 
-	// Access control: Only an Exporter or Regulator Org member can invoke this transaction
-	if !t.testMode && !(authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateRegulatorOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Exporter or Regulator Org. Access denied.")
+	// Access control: Only an Exporting Entity or Regulator Org member can invoke this transaction
+	if !t.testMode && !(authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) || authenticateRegulatorOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Exporting Entity or Regulator Org. Access denied.")
 	}
 
+	args, format, err = splitFormat(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1: <trade ID>")
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2: <trade ID> [Format=json|protobuf]")
 	}
 
 	// Get the state from the ledger
@@ -1174,7 +2497,7 @@ func (t *TradeWorkflowChaincode) getELStatus(stub shim.ChaincodeStubInterface, c
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	exportLicenseBytes, err = stub.GetState(elKey)
+	exportLicenseBytes, err = getAssetState(stub, elKey)
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + elKey + "\"}"
 		return shim.Error(jsonResp)
@@ -1192,23 +2515,28 @@ func (t *TradeWorkflowChaincode) getELStatus(stub shim.ChaincodeStubInterface, c
 	}
 
 	jsonResp = "{\"Status\":\"" + exportLicense.Status + "\"}"
-	fmt.Printf("Query Response:%s\n", jsonResp)
-	return shim.Success([]byte(jsonResp))
+	return formatQueryResponse(format, []byte(jsonResp), func() (proto.Message, error) {
+		return &tradepb.StatusResponse{Status: exportLicense.Status}, nil
+	})
 }
 
 // Get current location of a shipment
 func (t *TradeWorkflowChaincode) getShipmentLocation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var slKey, jsonResp string
+	var slKey, jsonResp, format string
 	var shipmentLocationBytes []byte
 	var err error
 
-	// Access control: Only an Importer or Exporter or Carrier Org member can invoke this transaction
-	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateCarrierOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Importer or Exporter or Carrier Org. Access denied.")
+	// Access control: Only an Importer or Exporter or Exporting Entity or Carrier Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) || authenticateCarrierOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity or Carrier Org. Access denied.")
 	}
 
+	args, format, err = splitFormat(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1: <trade ID>")
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2: <trade ID> [Format=json|protobuf]")
 	}
 
 	// Get the state from the ledger
@@ -1228,31 +2556,40 @@ func (t *TradeWorkflowChaincode) getShipmentLocation(stub shim.ChaincodeStubInte
 	}
 
 	jsonResp = "{\"Location\":\"" + string(shipmentLocationBytes) + "\"}"
-	fmt.Printf("Query Response:%s\n", jsonResp)
-	return shim.Success([]byte(jsonResp))
+	return formatQueryResponse(format, []byte(jsonResp), func() (proto.Message, error) {
+		return &tradepb.LocationResponse{Location: string(shipmentLocationBytes)}, nil
+	})
 }
 
 // Get Bill of Lading
 func (t *TradeWorkflowChaincode) getBillOfLading(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var blKey, jsonResp string
+	var blKey, jsonResp, format string
 	var billOfLadingBytes []byte
 	var err error
 
-	// Access control: Only an Importer or Exporter or Carrier Org member can invoke this transaction
-	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateCarrierOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Importer or Exporter or Carrier Org. Access denied.")
+	// Access control: Only an Importer or Exporter or Exporting Entity or Carrier Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer) || authenticateCarrierOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter or Exporting Entity or Carrier Org. Access denied.")
 	}
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1: <trade ID>")
+	args, format, err = splitFormat(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 to 3: <trade ID> [lot ID] [Format=json|protobuf]")
 	}
 
-	// Get the state from the ledger
-	blKey, err = getBLKey(stub, args[0])
+	// Get the state from the ledger; each lot of a trade shipped in lots has its own B/L
+	if len(args) == 2 {
+		blKey, err = getLotBLKey(stub, args[0], args[1])
+	} else {
+		blKey, err = getBLKey(stub, args[0])
+	}
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	billOfLadingBytes, err = stub.GetState(blKey)
+	billOfLadingBytes, err = getAssetState(stub, blKey)
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + blKey + "\"}"
 		return shim.Error(jsonResp)
@@ -1262,25 +2599,32 @@ func (t *TradeWorkflowChaincode) getBillOfLading(stub shim.ChaincodeStubInterfac
 		jsonResp = "{\"Error\":\"No record found for " + blKey + "\"}"
 		return shim.Error(jsonResp)
 	}
-	fmt.Printf("Query Response:%s\n", string(billOfLadingBytes))
-	return shim.Success(billOfLadingBytes)
+	return formatQueryResponse(format, billOfLadingBytes, func() (proto.Message, error) {
+		return encodeProtoMessage("BillOfLading", billOfLadingBytes)
+	})
 }
 
 // Get current account balance for a given participant
 func (t *TradeWorkflowChaincode) getAccountBalance(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var entity, balanceKey, jsonResp string
-	var balanceBytes []byte
+	var entity, lcKey, balanceKey, jsonResp, format string
+	var letterOfCreditBytes []byte
+	var letterOfCredit *LetterOfCredit
+	var balance int
 	var err error
 
+	args, format, err = splitFormat(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2: {Trade ID, Entity}")
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3: {Trade ID, Entity} [Format=json|protobuf]")
 	}
 
 	entity = strings.ToLower(args[1])
 	if entity == "exporter" {
-		// Access control: Only an Exporter Org member can invoke this transaction
-		if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
-			return shim.Error("Caller not a member of Exporter Org. Access denied.")
+		// Access control: Only an Exporter or Exporting Entity Org member can invoke this transaction
+		if !t.testMode && !(authenticateExporterOrg(creatorOrg, creatorCertIssuer) || authenticateExportingEntity(stub, creatorOrg, creatorCertIssuer)) {
+			return shim.Error("Caller not a member of Exporter or Exporting Entity Org. Access denied.")
 		}
 		balanceKey = expBalKey
 	} else if entity == "importer" {
@@ -1289,25 +2633,48 @@ func (t *TradeWorkflowChaincode) getAccountBalance(stub shim.ChaincodeStubInterf
 			return shim.Error("Caller not a member of Importer Org. Access denied.")
 		}
 		balanceKey = impBalKey
+	} else if entity == "confirmingbank" {
+		// Access control: Only an Exporter Org member can invoke this transaction
+		if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+			return shim.Error("Caller not a member of Exporter Org. Access denied.")
+		}
+
+		// Lookup the confirming bank of the trade's L/C
+		lcKey, err = getLCKey(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		letterOfCreditBytes, err = getAssetState(stub, lcKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(letterOfCreditBytes) == 0 {
+			jsonResp = "{\"Error\":\"No record found for " + lcKey + "\"}"
+			return shim.Error(jsonResp)
+		}
+		err = json.Unmarshal(letterOfCreditBytes, &letterOfCredit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		balanceKey, err = getBankBalanceKey(stub, letterOfCredit.ConfirmingBank)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	} else {
-		err = errors.New(fmt.Sprintf("Invalid entity %s; Permissible values: {exporter, importer}", args[1]))
+		err = errors.New(fmt.Sprintf("Invalid entity %s; Permissible values: {exporter, importer, confirmingbank}", args[1]))
 		return shim.Error(err.Error())
 	}
 
-	// Get the account balances from the ledger
-	balanceBytes, err = stub.GetState(balanceKey)
+	// Get the account balance from the ledger or the token chaincode holding the funds
+	balance, err = getBalance(stub, balanceKey)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + balanceKey + "\"}"
-		return shim.Error(jsonResp)
-	}
-
-	if len(balanceBytes) == 0 {
-		jsonResp = "{\"Error\":\"No record found for " + balanceKey + "\"}"
+		jsonResp = "{\"Error\":\"" + err.Error() + "\"}"
 		return shim.Error(jsonResp)
 	}
-	jsonResp = "{\"Balance\":\"" + string(balanceBytes) + "\"}"
-	fmt.Printf("Query Response:%s\n", jsonResp)
-	return shim.Success([]byte(jsonResp))
+	jsonResp = "{\"Balance\":\"" + strconv.Itoa(balance) + "\"}"
+	return formatQueryResponse(format, []byte(jsonResp), func() (proto.Message, error) {
+		return &tradepb.BalanceResponse{Balance: int64(balance)}, nil
+	})
 }
 
 func main() {
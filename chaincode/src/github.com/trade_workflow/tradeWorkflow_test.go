@@ -19,10 +19,31 @@ package main
 import (
 	"fmt"
 	"testing"
+	"reflect"
+	"regexp"
+	"io/ioutil"
 	"strconv"
+	"strings"
+	"time"
+	"math/big"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/attrmgr"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/trade_workflow/tradepb"
 )
 
 const (
@@ -44,6 +65,14 @@ func checkInit(t *testing.T, stub *shim.MockStub, args [][]byte) {
 	}
 }
 
+func checkBadInit(t *testing.T, stub *shim.MockStub, args [][]byte) {
+	res := stub.MockInit("1", args)
+	if res.Status == shim.OK {
+		fmt.Println("Init", args, "unexpectedly succeeded")
+		t.FailNow()
+	}
+}
+
 func checkNoState(t *testing.T, stub *shim.MockStub, name string) {
 	bytes := stub.State[name]
 	if bytes != nil {
@@ -64,6 +93,19 @@ func checkState(t *testing.T, stub *shim.MockStub, name string, value string) {
 	}
 }
 
+// Expected ledger value of an asset, stamped with the current schema version of its type
+func versionedAsset(objectType string, assetBytes []byte) string {
+	value, _ := stampSchemaVersion(objectType, assetBytes)
+	return string(value)
+}
+
+// Write state directly, e.g. to simulate conditions that cannot be reached through the chaincode in a test run
+func putState(stub *shim.MockStub, name string, value []byte) {
+	stub.MockTransactionStart("put")
+	stub.PutState(name, value)
+	stub.MockTransactionEnd("put")
+}
+
 func checkBadQuery(t *testing.T, stub *shim.MockStub, function string, name string) {
 	res := stub.MockInvoke("1", [][]byte{[]byte(function), []byte(name)})
 	if res.Status == shim.OK {
@@ -134,11 +176,29 @@ func getInitArguments() [][]byte {
 			[]byte("ForestryDepartment")}
 }
 
+// Drive a trade through the workflow up to the issuance of the B/L
+func checkTradeShipped(t *testing.T, stub *shim.MockStub, tradeID string, amount int, descGoods string) {
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+}
+
 func TestTradeWorkflow_Init(t *testing.T) {
 	scc := new(TradeWorkflowChaincode)
 	scc.testMode = true
 	stub := shim.NewMockStub("Trade Workflow", scc)
 
+	// Init without roles on an empty ledger and verify failure
+	checkBadInit(t, stub, [][]byte{[]byte("init")})
+	checkBadInit(t, stub, [][]byte{[]byte("init"), []byte("LumberInc")})
+	checkNoState(t, stub, "Importer")
+
 	// Init
 	checkInit(t, stub, getInitArguments())
 
@@ -166,10 +226,10 @@ func TestTradeWorkflow_Agreement(t *testing.T) {
 	descGoods := "Wood for Toys"
 	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods)})
 
-	tradeAgreement := &TradeAgreement{amount, descGoods, REQUESTED, 0}
+	tradeAgreement := &TradeAgreement{amount, descGoods, REQUESTED, 0, nil, 0}
 	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
 	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
-	checkState(t, stub, tradeKey, string(tradeAgreementBytes))
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
 
 	expectedResp := "{\"Status\":\"REQUESTED\"}"
 	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
@@ -178,14 +238,14 @@ func TestTradeWorkflow_Agreement(t *testing.T) {
 	checkBadInvoke(t, stub, [][]byte{[]byte("acceptTrade")})
 	badTradeID := "abcd"
 	checkBadInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(badTradeID)})
-	checkState(t, stub, tradeKey, string(tradeAgreementBytes))
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
 	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
 
 	// Invoke 'acceptTrade' and verify state change
 	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
 	tradeAgreement.Status = ACCEPTED
 	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
-	checkState(t, stub, tradeKey, string(tradeAgreementBytes))
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
 
 	expectedResp = "{\"Status\":\"ACCEPTED\"}"
 	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
@@ -208,10 +268,10 @@ func TestTradeWorkflow_LetterOfCredit(t *testing.T) {
 
 	// Invoke 'requestLC'
 	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
-	letterOfCredit := &LetterOfCredit{"", "", EXPORTER, amount, []string{}, REQUESTED}
+	letterOfCredit := &LetterOfCredit{"", "", EXPORTER, amount, []string{}, REQUESTED, "", "", false, false, false, "", "", 0, 0, 0, 0, false, nil}
 	letterOfCreditBytes, _ := json.Marshal(letterOfCredit)
 	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
-	checkState(t, stub, lcKey, string(letterOfCreditBytes))
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
 
 	expectedResp := "{\"Status\":\"REQUESTED\"}"
 	checkQuery(t, stub, "getLCStatus", tradeID, expectedResp)
@@ -220,11 +280,11 @@ func TestTradeWorkflow_LetterOfCredit(t *testing.T) {
 	checkBadInvoke(t, stub, [][]byte{[]byte("issueLC")})
 	badTradeID := "abcd"
 	checkBadInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(badTradeID)})
-	checkState(t, stub, lcKey, string(letterOfCreditBytes))
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
 
 	// Invoke 'acceptLC' prematurely and verify failure and unchanged state
 	checkBadInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(badTradeID)})
-	checkState(t, stub, lcKey, string(letterOfCreditBytes))
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
 	checkQuery(t, stub, "getLCStatus", tradeID, expectedResp)
 
 	// Invoke 'issueLC'
@@ -233,18 +293,18 @@ func TestTradeWorkflow_LetterOfCredit(t *testing.T) {
 	doc1 := "E/L"
 	doc2 := "B/L"
 	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte(lcID), []byte(expirationDate), []byte(doc1), []byte(doc2)})
-	letterOfCredit = &LetterOfCredit{lcID, expirationDate, EXPORTER, amount, []string{doc1, doc2}, ISSUED}
+	letterOfCredit = &LetterOfCredit{lcID, expirationDate, EXPORTER, amount, []string{doc1, doc2}, ISSUED, "", "", false, false, false, "", "", 0, 0, 0, 0, false, nil}
 	letterOfCreditBytes, _ = json.Marshal(letterOfCredit)
-	checkState(t, stub, lcKey, string(letterOfCreditBytes))
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
 
 	expectedResp = "{\"Status\":\"ISSUED\"}"
 	checkQuery(t, stub, "getLCStatus", tradeID, expectedResp)
 
 	// Invoke 'acceptLC'
 	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
-	letterOfCredit = &LetterOfCredit{lcID, expirationDate, EXPORTER, amount, []string{doc1, doc2}, ACCEPTED}
+	letterOfCredit = &LetterOfCredit{lcID, expirationDate, EXPORTER, amount, []string{doc1, doc2}, ACCEPTED, "", "", false, false, false, "", "", 0, 0, 0, 0, false, nil}
 	letterOfCreditBytes, _ = json.Marshal(letterOfCredit)
-	checkState(t, stub, lcKey, string(letterOfCreditBytes))
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
 
 	expectedResp = "{\"Status\":\"ACCEPTED\"}"
 	checkQuery(t, stub, "getLCStatus", tradeID, expectedResp)
@@ -274,10 +334,10 @@ func TestTradeWorkflow_ExportLicense(t *testing.T) {
 
 	// Issue 'requestEL'
 	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
-	exportLicense := &ExportLicense{"", "", EXPORTER, CARRIER, descGoods, REGAUTH, REQUESTED}
+	exportLicense := &ExportLicense{"", "", EXPORTER, CARRIER, descGoods, REGAUTH, REQUESTED, nil}
 	exportLicenseBytes, _ := json.Marshal(exportLicense)
 	elKey, _ := stub.CreateCompositeKey("ExportLicense", []string{tradeID})
-	checkState(t, stub, elKey, string(exportLicenseBytes))
+	checkState(t, stub, elKey, versionedAsset("ExportLicense", exportLicenseBytes))
 
 	expectedResp := "{\"Status\":\"REQUESTED\"}"
 	checkQuery(t, stub, "getELStatus", tradeID, expectedResp)
@@ -289,14 +349,14 @@ func TestTradeWorkflow_ExportLicense(t *testing.T) {
 	checkBadInvoke(t, stub, [][]byte{[]byte("issueEL")})
 	badTradeID := "abcd"
 	checkBadInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(badTradeID), []byte(elID), []byte(elExpirationDate)})
-	checkState(t, stub, elKey, string(exportLicenseBytes))
+	checkState(t, stub, elKey, versionedAsset("ExportLicense", exportLicenseBytes))
 	checkQuery(t, stub, "getELStatus", tradeID, expectedResp)
 
 	// Invoke 'issueEL' and verify state change
 	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte(elID), []byte(elExpirationDate)})
-	exportLicense = &ExportLicense{elID, elExpirationDate, EXPORTER, CARRIER, descGoods, REGAUTH, ISSUED}
+	exportLicense = &ExportLicense{elID, elExpirationDate, EXPORTER, CARRIER, descGoods, REGAUTH, ISSUED, nil}
 	exportLicenseBytes, _ = json.Marshal(exportLicense)
-	checkState(t, stub, elKey, string(exportLicenseBytes))
+	checkState(t, stub, elKey, versionedAsset("ExportLicense", exportLicenseBytes))
 
 	expectedResp = "{\"Status\":\"ISSUED\"}"
 	checkQuery(t, stub, "getELStatus", tradeID, expectedResp)
@@ -350,10 +410,12 @@ func TestTradeWorkflow_ShipmentInitiation(t *testing.T) {
 
 	// Invoke 'acceptShipmentAndIssueBL' and verify state change
 	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte(blID), []byte(blExpirationDate), []byte(sourcePort), []byte(destinationPort)})
-	billOfLading := &BillOfLading{blID, blExpirationDate, EXPORTER, CARRIER, descGoods, amount, IMPBANK, sourcePort, destinationPort}
+	var storedBillOfLading *BillOfLading
+	json.Unmarshal(stub.State[blKey], &storedBillOfLading)
+	billOfLading := &BillOfLading{blID, blExpirationDate, EXPORTER, CARRIER, descGoods, amount, IMPBANK, sourcePort, destinationPort, ISSUED, storedBillOfLading.IssueDate, nil}
 	billOfLadingBytes, _ := json.Marshal(billOfLading)
-	checkState(t, stub, blKey, string(billOfLadingBytes))
-	checkQuery(t, stub, "getBillOfLading", tradeID, string(billOfLadingBytes))
+	checkState(t, stub, blKey, versionedAsset("BillOfLading", billOfLadingBytes))
+	checkQuery(t, stub, "getBillOfLading", tradeID, versionedAsset("BillOfLading", billOfLadingBytes))
 }
 
 func TestTradeWorkflow_PaymentFulfilment(t *testing.T) {
@@ -389,23 +451,38 @@ func TestTradeWorkflow_PaymentFulfilment(t *testing.T) {
 	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte(blID), []byte(blExpirationDate), []byte(sourcePort), []byte(destinationPort)})
 
 	// Invoke 'requestPayment'
-	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID)})
-	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID})
-	checkState(t, stub, paymentKey, REQUESTED)
-
-	// Invoke 'makePayment'
-	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID)})
-	checkNoState(t, stub, paymentKey)
-	// Verify account and payment balances
+	paymentRequestID := "pr001"
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte(paymentRequestID)})
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, paymentRequestID})
 	payment := amount/2
+	paymentRequest := &PaymentRequest{paymentRequestID, payment, REQUESTED, "", "", 0, 0, ""}
+	paymentRequestBytes, _ := json.Marshal(paymentRequest)
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+
+	// Invoke a second 'requestPayment' while the first is pending and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+
+	// Invoke 'makePayment' and verify that the settled request is retained
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte(paymentRequestID)})
+	paymentRequest.Status = PAID
+	paymentRequest.PaidBy = IMPBANK
+	paymentRequest.PaidTo = EXPORTER
+	paymentRequestBytes, _ = json.Marshal(paymentRequest)
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+
+	// Resubmit 'makePayment' and 'requestPayment' and verify that they are rejected
+	checkBadInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte(paymentRequestID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte(paymentRequestID)})
+
+	// Verify account and payment balances; the rest of the L/C amount is still held in escrow
 	expBalanceStr := strconv.Itoa(EXPBALANCE + payment)
-	impBalanceStr := strconv.Itoa(IMPBALANCE - payment)
+	impBalanceStr := strconv.Itoa(IMPBALANCE - amount)
 	checkState(t, stub, expBalKey, expBalanceStr)
 	checkState(t, stub, impBalKey, impBalanceStr)
-	tradeAgreement := &TradeAgreement{amount, descGoods, ACCEPTED, payment}
+	tradeAgreement := &TradeAgreement{amount, descGoods, ACCEPTED, payment, nil, 0}
 	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
 	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
-	checkState(t, stub, tradeKey, string(tradeAgreementBytes))
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
 
 	// Check queries
 	checkBadQuery(t, stub, "getAccountBalance", tradeID)
@@ -421,19 +498,29 @@ func TestTradeWorkflow_PaymentFulfilment(t *testing.T) {
 	checkState(t, stub, slKey, DESTINATION)
 
 	// Invoke 'requestPayment' and 'makePayment'
-	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID)})
-	checkState(t, stub, paymentKey, REQUESTED)
-	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID)})
-	checkNoState(t, stub, paymentKey)
+	paymentRequestID2 := "pr002"
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte(paymentRequestID2)})
+	paymentKey2, _ := stub.CreateCompositeKey("Payment", []string{tradeID, paymentRequestID2})
+	paymentRequest2 := &PaymentRequest{paymentRequestID2, amount - payment, REQUESTED, "", "", 0, 0, ""}
+	paymentRequestBytes2, _ := json.Marshal(paymentRequest2)
+	checkState(t, stub, paymentKey2, versionedAsset("Payment", paymentRequestBytes2))
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte(paymentRequestID2)})
+	paymentRequest2.Status = PAID
+	paymentRequest2.PaidBy = IMPBANK
+	paymentRequest2.PaidTo = EXPORTER
+	paymentRequestBytes2, _ = json.Marshal(paymentRequest2)
+	checkState(t, stub, paymentKey2, versionedAsset("Payment", paymentRequestBytes2))
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte(paymentRequestID2)})
 
 	// Verify account and payment balances, and check queries
 	expBalanceStr = strconv.Itoa(EXPBALANCE + amount)
 	impBalanceStr = strconv.Itoa(IMPBALANCE - amount)
 	checkState(t, stub, expBalKey, expBalanceStr)
 	checkState(t, stub, impBalKey, impBalanceStr)
-	tradeAgreement = &TradeAgreement{amount, descGoods, ACCEPTED, amount}
+	tradeAgreement = &TradeAgreement{amount, descGoods, ACCEPTED, amount, nil, 0}
 	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
-	checkState(t, stub, tradeKey, string(tradeAgreementBytes))
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
 
 	expectedResp = "{\"Balance\":\"" + expBalanceStr + "\"}"
 	checkQueryArgs(t, stub, [][]byte{[]byte("getAccountBalance"), []byte(tradeID), []byte("exporter")}, expectedResp)
@@ -441,3 +528,2828 @@ func TestTradeWorkflow_PaymentFulfilment(t *testing.T) {
 	expectedResp = "{\"Balance\":\"" + impBalanceStr + "\"}"
 	checkQueryArgs(t, stub, [][]byte{[]byte("getAccountBalance"), []byte(tradeID), []byte("importer")}, expectedResp)
 }
+
+func TestTradeWorkflow_Delivery(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Invoke 'requestTrade', 'acceptTrade', 'requestLC', 'issueLC', 'acceptLC', 'requestEL', 'issueEL', 'prepareShipment', 'acceptShipmentAndIssueBL'
+	tradeID := "2ks89j9"
+	amount := 50000
+	descGoods := "Wood for Toys"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	lcID := "lc8349"
+	lcExpirationDate := "12/31/2018"
+	doc1 := "E/L"
+	doc2 := "B/L"
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte(lcID), []byte(lcExpirationDate), []byte(doc1), []byte(doc2)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	elID := "el979"
+	elExpirationDate := "4/30/2019"
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte(elID), []byte(elExpirationDate)})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	blID := "bl06678"
+	blExpirationDate := "8/31/2018"
+	sourcePort := "Woodlands Port"
+	destinationPort := "Market Port"
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte(blID), []byte(blExpirationDate), []byte(sourcePort), []byte(destinationPort)})
+
+	// Invoke 'surrenderBL' before full payment and verify failure
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+
+	// Invoke 'deliverShipment' before arrival and verify failure
+	deliveryKey, _ := stub.CreateCompositeKey("Delivery", []string{tradeID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("deliverShipment"), []byte(tradeID)})
+	checkNoState(t, stub, deliveryKey)
+
+	// Ship to destination and settle the balance
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+
+	// Invoke 'deliverShipment' without B/L surrender and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("deliverShipment"), []byte(tradeID)})
+	checkNoState(t, stub, deliveryKey)
+
+	// Invoke 'confirmReceipt' prematurely and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("confirmReceipt"), []byte(tradeID)})
+
+	// Invoke 'surrenderBL' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+	blKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID})
+	var storedBillOfLading *BillOfLading
+	json.Unmarshal(stub.State[blKey], &storedBillOfLading)
+	billOfLading := &BillOfLading{blID, blExpirationDate, EXPORTER, CARRIER, descGoods, amount, IMPBANK, sourcePort, destinationPort, SURRENDERED, storedBillOfLading.IssueDate, nil}
+	billOfLadingBytes, _ := json.Marshal(billOfLading)
+	checkState(t, stub, blKey, versionedAsset("BillOfLading", billOfLadingBytes))
+
+	// Invoke 'deliverShipment' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("deliverShipment"), []byte(tradeID)})
+	delivery := &Delivery{DELIVERED, "", ""}
+	deliveryBytes, _ := json.Marshal(delivery)
+	checkState(t, stub, deliveryKey, versionedAsset("Delivery", deliveryBytes))
+
+	expectedResp := "{\"Status\":\"ACCEPTED\"}"
+	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
+
+	// Invoke bad 'confirmReceipt' and verify unchanged state
+	note := "3 crates water-damaged"
+	checkBadInvoke(t, stub, [][]byte{[]byte("confirmReceipt"), []byte(tradeID), []byte("BROKEN"), []byte(note)})
+	checkState(t, stub, deliveryKey, versionedAsset("Delivery", deliveryBytes))
+
+	// Invoke 'confirmReceipt' with a damage note and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("confirmReceipt"), []byte(tradeID), []byte(DAMAGED), []byte(note)})
+	delivery = &Delivery{DELIVERED, DAMAGED, note}
+	deliveryBytes, _ = json.Marshal(delivery)
+	checkState(t, stub, deliveryKey, versionedAsset("Delivery", deliveryBytes))
+
+	expectedResp = "{\"Status\":\"COMPLETED\"}"
+	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
+
+	// Invoke 'acceptTrade' on the completed trade and verify that it is not reopened
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
+}
+
+func TestTradeWorkflow_Dispute(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	descGoods := "Wood for Toys"
+	checkTradeShipped(t, stub, tradeID, amount, descGoods)
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke bad 'raiseDispute' and verify no state
+	disputeID := "d001"
+	evidence := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	disputeKey, _ := stub.CreateCompositeKey("Dispute", []string{tradeID, disputeID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte(disputeID), []byte("carrier"), []byte(GOODS_DAMAGED)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte(disputeID), []byte("importer"), []byte("UNHAPPY")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte(disputeID), []byte("importer"), []byte(GOODS_DAMAGED), []byte("not-a-hash")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte("abcd"), []byte(disputeID), []byte("importer"), []byte(GOODS_DAMAGED)})
+	checkNoState(t, stub, disputeKey)
+
+	// Invoke 'raiseDispute' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte(disputeID), []byte("importer"), []byte(GOODS_DAMAGED), []byte(evidence)})
+	dispute := &Dispute{IMPORTER_PARTY, GOODS_DAMAGED, []string{evidence}, OPEN, nil, nil, ""}
+	disputeBytes, _ := json.Marshal(dispute)
+	checkState(t, stub, disputeKey, versionedAsset("Dispute", disputeBytes))
+	checkQueryArgs(t, stub, [][]byte{[]byte("getDispute"), []byte(tradeID), []byte(disputeID)}, versionedAsset("Dispute", disputeBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte(disputeID), []byte("exporter"), []byte(OTHER)})
+
+	// Verify that payment and B/L transactions are frozen
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+
+	// Invoke 'proposeSettlement' and 'acceptSettlement' by the same side and verify failure
+	refund := 5000
+	checkInvoke(t, stub, [][]byte{[]byte("proposeSettlement"), []byte(tradeID), []byte(disputeID), []byte("exporter"), []byte(strconv.Itoa(refund / 2))})
+	checkInvoke(t, stub, [][]byte{[]byte("proposeSettlement"), []byte(tradeID), []byte(disputeID), []byte("importer"), []byte(strconv.Itoa(refund))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptSettlement"), []byte(tradeID), []byte(disputeID), []byte("importersbank")})
+	dispute.Status = PROPOSED
+	dispute.Proposal = &Settlement{IMPORTER_PARTY, refund, 0}
+	disputeBytes, _ = json.Marshal(dispute)
+	checkState(t, stub, disputeKey, versionedAsset("Dispute", disputeBytes))
+
+	// Invoke 'acceptSettlement' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("acceptSettlement"), []byte(tradeID), []byte(disputeID), []byte("exportersbank")})
+	dispute.Status = RESOLVED
+	dispute.Resolution = dispute.Proposal
+	dispute.ResolvedBy = EXPORTERS_BANK_PARTY
+	disputeBytes, _ = json.Marshal(dispute)
+	checkState(t, stub, disputeKey, versionedAsset("Dispute", disputeBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount - refund))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount + refund))
+	tradeAgreement := &TradeAgreement{amount - refund, descGoods, ACCEPTED, amount - refund, nil, 0}
+	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("decideDispute"), []byte(tradeID), []byte(disputeID), []byte("0")})
+
+	// Raise a second dispute and have it decided by the arbiter
+	disputeID2 := "d002"
+	disputeKey2, _ := stub.CreateCompositeKey("Dispute", []string{tradeID, disputeID2})
+	checkInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte(disputeID2), []byte("exportersbank"), []byte(DOCUMENT_DISCREPANCY)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("decideDispute"), []byte(tradeID), []byte(disputeID2), []byte(strconv.Itoa(amount))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("decideDispute"), []byte(tradeID), []byte(disputeID2), []byte("-1000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("proposeSettlement"), []byte(tradeID), []byte(disputeID2), []byte("importer"), []byte("-1000")})
+	checkInvoke(t, stub, [][]byte{[]byte("decideDispute"), []byte(tradeID), []byte(disputeID2), []byte("1000")})
+	dispute = &Dispute{EXPORTERS_BANK_PARTY, DOCUMENT_DISCREPANCY, []string{}, RESOLVED, nil, &Settlement{ARBITER_PARTY, 1000, 0}, ARBITER_PARTY}
+	disputeBytes, _ = json.Marshal(dispute)
+	checkState(t, stub, disputeKey2, versionedAsset("Dispute", disputeBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount - refund - 1000))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount + refund + 1000))
+
+	// Raise a third dispute and settle it with an additional payment to the exporter
+	disputeID3 := "d003"
+	disputeKey3, _ := stub.CreateCompositeKey("Dispute", []string{tradeID, disputeID3})
+	checkInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte(disputeID3), []byte("exporter"), []byte(OTHER)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("proposeSettlement"), []byte(tradeID), []byte(disputeID3), []byte("exporter"), []byte("1000"), []byte("2000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("proposeSettlement"), []byte(tradeID), []byte(disputeID3), []byte("exporter"), []byte("0"), []byte("-2000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("decideDispute"), []byte(tradeID), []byte(disputeID3), []byte("0"), []byte(strconv.Itoa(IMPBALANCE))})
+	checkInvoke(t, stub, [][]byte{[]byte("proposeSettlement"), []byte(tradeID), []byte(disputeID3), []byte("exporter"), []byte("0"), []byte("2000")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptSettlement"), []byte(tradeID), []byte(disputeID3), []byte("importer")})
+	dispute = &Dispute{EXPORTER_PARTY, OTHER, []string{}, RESOLVED, &Settlement{EXPORTER_PARTY, 0, 2000}, &Settlement{EXPORTER_PARTY, 0, 2000}, IMPORTER_PARTY}
+	disputeBytes, _ = json.Marshal(dispute)
+	checkState(t, stub, disputeKey3, versionedAsset("Dispute", disputeBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount - refund - 1000 + 2000))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount + refund + 1000 - 2000))
+	tradeAgreement = &TradeAgreement{amount - refund - 1000 + 2000, descGoods, ACCEPTED, amount - refund - 1000 + 2000, nil, 0}
+	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+
+	// A settlement recorded as a negative refund before adjustments were introduced reads as an adjustment
+	legacyDisputeBytes, _ := json.Marshal(map[string]interface{}{"raisedBy": EXPORTERS_BANK_PARTY, "reasonCode": DOCUMENT_DISCREPANCY, "evidenceHashes": []string{}, "status": RESOLVED,
+		"proposal": nil, "resolution": map[string]interface{}{"proposedBy": ARBITER_PARTY, "refund": -1000}, "resolvedBy": ARBITER_PARTY, "schemaVersion": 1})
+	putState(stub, disputeKey2, legacyDisputeBytes)
+	dispute = &Dispute{EXPORTERS_BANK_PARTY, DOCUMENT_DISCREPANCY, []string{}, RESOLVED, nil, &Settlement{ARBITER_PARTY, 0, 1000}, ARBITER_PARTY}
+	disputeBytes, _ = json.Marshal(dispute)
+	checkQueryArgs(t, stub, [][]byte{[]byte("getDispute"), []byte(tradeID), []byte(disputeID2)}, versionedAsset("Dispute", disputeBytes))
+
+	// Verify that B/L transactions are no longer frozen
+	checkInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+}
+
+func TestTradeWorkflow_Deadlines(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	descGoods := "Wood for Toys"
+	now := time.Now().UTC()
+	lcDeadline := now.AddDate(0, 0, 10).Format(time.RFC3339)
+	shipmentDeadline := now.AddDate(0, 0, 30).Format(time.RFC3339)
+	paymentDeadline := now.AddDate(0, 0, 90).Format(time.RFC3339)
+	pastDeadline := now.AddDate(0, 0, -1).Format(time.RFC3339)
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+
+	// Invoke bad 'requestTrade' and verify no state
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods), []byte(lcDeadline), []byte(shipmentDeadline)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods), []byte("12/31/2018"), []byte(shipmentDeadline), []byte(paymentDeadline)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods), []byte(pastDeadline), []byte(shipmentDeadline), []byte(paymentDeadline)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods), []byte(shipmentDeadline), []byte(lcDeadline), []byte(paymentDeadline)})
+	checkNoState(t, stub, tradeKey)
+
+	// Invoke 'requestTrade' with deadlines and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte(descGoods), []byte(lcDeadline), []byte(shipmentDeadline), []byte(paymentDeadline)})
+	deadlines := &Deadlines{lcDeadline, shipmentDeadline, paymentDeadline}
+	tradeAgreement := &TradeAgreement{amount, descGoods, REQUESTED, 0, deadlines, 0}
+	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+
+	// No trade is overdue yet
+	checkQueryArgs(t, stub, [][]byte{[]byte("getOverdueTrades")}, "[]")
+	checkBadInvoke(t, stub, [][]byte{[]byte("markOverdue"), []byte(tradeID)})
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+
+	// Let the L/C issuance deadline lapse
+	tradeAgreement.Deadlines = &Deadlines{pastDeadline, shipmentDeadline, paymentDeadline}
+	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
+	putState(stub, tradeKey, tradeAgreementBytes)
+
+	// Ship a second trade and let its payment deadline lapse
+	tradeID2 := "8dk23l1"
+	tradeKey2, _ := stub.CreateCompositeKey("Trade", []string{tradeID2})
+	checkTradeShipped(t, stub, tradeID2, amount, descGoods)
+	tradeAgreement2 := &TradeAgreement{amount, descGoods, ACCEPTED, 0, &Deadlines{pastDeadline, pastDeadline, pastDeadline}, 0}
+	tradeAgreementBytes2, _ := json.Marshal(tradeAgreement2)
+	putState(stub, tradeKey2, tradeAgreementBytes2)
+
+	// Query overdue trades
+	overdueTrades := []OverdueTrade{{tradeID, LC_ISSUANCE_STEP, pastDeadline, REQUESTED}, {tradeID2, PAYMENT_STEP, pastDeadline, ACCEPTED}}
+	overdueTradesBytes, _ := json.Marshal(overdueTrades)
+	checkQueryArgs(t, stub, [][]byte{[]byte("getOverdueTrades")}, string(overdueTradesBytes))
+
+	// Invoke 'markOverdue' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("markOverdue"), []byte(tradeID)})
+	tradeAgreement.Status = OVERDUE
+	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+	expectedResp := "{\"Status\":\"OVERDUE\"}"
+	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
+
+	// Invoke 'acceptTrade' on the late trade and verify that it stays overdue
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+
+	checkInvoke(t, stub, [][]byte{[]byte("markOverdue"), []byte(tradeID2)})
+	expectedResp = "{\"Status\":\"DEFAULTED\"}"
+	checkQuery(t, stub, "getTradeStatus", tradeID2, expectedResp)
+}
+
+func TestTradeWorkflow_Guarantee(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	descGoods := "Wood for Toys"
+	now := time.Now().UTC()
+	expirationDate := now.AddDate(1, 0, 0).Format(time.RFC3339)
+	pastDeadline := now.AddDate(0, 0, -1).Format(time.RFC3339)
+	checkTradeShipped(t, stub, tradeID, amount, descGoods)
+
+	// Invoke bad 'issueGuarantee' and verify no state
+	guaranteeID := "sblc001"
+	guaranteeAmount := 40000
+	guaranteeKey, _ := stub.CreateCompositeKey("Guarantee", []string{guaranteeID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueGuarantee"), []byte(guaranteeID), []byte("SURETY"), []byte(strconv.Itoa(guaranteeAmount)), []byte(expirationDate), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueGuarantee"), []byte(guaranteeID), []byte(STANDBY_LC), []byte(strconv.Itoa(guaranteeAmount)), []byte(pastDeadline), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueGuarantee"), []byte(guaranteeID), []byte(STANDBY_LC), []byte(strconv.Itoa(guaranteeAmount)), []byte(expirationDate), []byte("abcd")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueGuarantee"), []byte(guaranteeID), []byte(STANDBY_LC), []byte(strconv.Itoa(guaranteeAmount)), []byte(expirationDate), []byte("")})
+	checkNoState(t, stub, guaranteeKey)
+
+	// Invoke 'issueGuarantee' and 'acceptGuarantee' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("issueGuarantee"), []byte(guaranteeID), []byte(STANDBY_LC), []byte(strconv.Itoa(guaranteeAmount)), []byte(expirationDate), []byte(tradeID)})
+	guarantee := &Guarantee{guaranteeID, STANDBY_LC, tradeID, IMPORTER, EXPORTER, IMPBANK, guaranteeAmount, expirationDate, 0, ISSUED}
+	guaranteeBytes, _ := json.Marshal(guarantee)
+	checkState(t, stub, guaranteeKey, versionedAsset("Guarantee", guaranteeBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("claimGuarantee"), []byte(guaranteeID), []byte(strconv.Itoa(guaranteeAmount))})
+
+	checkInvoke(t, stub, [][]byte{[]byte("acceptGuarantee"), []byte(guaranteeID)})
+	guarantee.Status = ACCEPTED
+	guaranteeBytes, _ = json.Marshal(guarantee)
+	checkState(t, stub, guaranteeKey, versionedAsset("Guarantee", guaranteeBytes))
+	checkQuery(t, stub, "getGuarantee", guaranteeID, versionedAsset("Guarantee", guaranteeBytes))
+
+	// Invoke 'claimGuarantee' while the trade payment is not overdue and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("claimGuarantee"), []byte(guaranteeID), []byte(strconv.Itoa(guaranteeAmount))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("expireGuarantee"), []byte(guaranteeID)})
+
+	// Let the payment deadline lapse
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+	tradeAgreement := &TradeAgreement{amount, descGoods, ACCEPTED, 0, &Deadlines{pastDeadline, pastDeadline, pastDeadline}, 0}
+	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
+	putState(stub, tradeKey, tradeAgreementBytes)
+
+	// Invoke 'claimGuarantee' beyond the guaranteed amount and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("claimGuarantee"), []byte(guaranteeID), []byte(strconv.Itoa(amount))})
+
+	// Invoke 'claimGuarantee' and 'payGuarantee' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("claimGuarantee"), []byte(guaranteeID), []byte(strconv.Itoa(guaranteeAmount))})
+	guarantee.ClaimAmount = guaranteeAmount
+	guarantee.Status = CLAIMED
+	guaranteeBytes, _ = json.Marshal(guarantee)
+	checkState(t, stub, guaranteeKey, versionedAsset("Guarantee", guaranteeBytes))
+
+	// Invoke 'payGuarantee' after a part of the trade has been paid and verify failure
+	tradeAgreement.Payment = amount - guaranteeAmount + 10000
+	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
+	putState(stub, tradeKey, tradeAgreementBytes)
+	checkBadInvoke(t, stub, [][]byte{[]byte("payGuarantee"), []byte(guaranteeID)})
+	checkState(t, stub, guaranteeKey, versionedAsset("Guarantee", guaranteeBytes))
+	tradeAgreement.Payment = 0
+	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
+	putState(stub, tradeKey, tradeAgreementBytes)
+
+	// Invoke 'payGuarantee' before the guarantor has the funds and verify failure
+	guarantorBalKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{IMPBANK})
+	putState(stub, guarantorBalKey, []byte(strconv.Itoa(guaranteeAmount - 1)))
+	checkBadInvoke(t, stub, [][]byte{[]byte("payGuarantee"), []byte(guaranteeID)})
+	checkState(t, stub, guaranteeKey, versionedAsset("Guarantee", guaranteeBytes))
+	putState(stub, guarantorBalKey, []byte(strconv.Itoa(guaranteeAmount + 10000)))
+
+	// Invoke 'payGuarantee' and verify that the guarantor pays, and that the escrow for the amount paid returns to the importer
+	checkInvoke(t, stub, [][]byte{[]byte("payGuarantee"), []byte(guaranteeID)})
+	guarantee.Status = PAID
+	guaranteeBytes, _ = json.Marshal(guarantee)
+	checkState(t, stub, guaranteeKey, versionedAsset("Guarantee", guaranteeBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + guaranteeAmount))
+	checkState(t, stub, guarantorBalKey, "10000")
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount + guaranteeAmount))
+	tradeAgreement.Payment = guaranteeAmount
+	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("payGuarantee"), []byte(guaranteeID)})
+
+	// Let an unclaimed demand guarantee lapse and expire it
+	guaranteeID2 := "dg002"
+	guaranteeKey2, _ := stub.CreateCompositeKey("Guarantee", []string{guaranteeID2})
+	checkInvoke(t, stub, [][]byte{[]byte("issueGuarantee"), []byte(guaranteeID2), []byte(DEMAND_GUARANTEE), []byte(strconv.Itoa(guaranteeAmount)), []byte(expirationDate)})
+	guarantee2 := &Guarantee{guaranteeID2, DEMAND_GUARANTEE, "", IMPORTER, EXPORTER, IMPBANK, guaranteeAmount, pastDeadline, 0, ISSUED}
+	guaranteeBytes2, _ := json.Marshal(guarantee2)
+	putState(stub, guaranteeKey2, guaranteeBytes2)
+	checkInvoke(t, stub, [][]byte{[]byte("expireGuarantee"), []byte(guaranteeID2)})
+	guarantee2.Status = EXPIRED
+	guaranteeBytes2, _ = json.Marshal(guarantee2)
+	checkState(t, stub, guaranteeKey2, versionedAsset("Guarantee", guaranteeBytes2))
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptGuarantee"), []byte(guaranteeID2)})
+}
+
+func TestTradeWorkflow_CreditFacility(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Invoke bad 'setCreditFacility' and verify no state
+	creditFacilityKey, _ := stub.CreateCompositeKey("CreditFacility", []string{IMPORTER})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setCreditFacility"), []byte("100000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setCreditFacility"), []byte("100000"), []byte("60000"), []byte(EXPORTER)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setCreditFacility"), []byte("-1"), []byte("60000")})
+	checkNoState(t, stub, creditFacilityKey)
+	checkBadQuery(t, stub, "getCreditFacility", "")
+
+	// Invoke 'setCreditFacility' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("setCreditFacility"), []byte("100000"), []byte("60000"), []byte(EXPORTER), []byte("80000")})
+	creditFacility := &CreditFacility{IMPORTER, IMPBANK, 100000, 60000, map[string]int{EXPORTER: 80000}, 0, map[string]int{}, map[string]*FacilityDrawing{}}
+	creditFacilityBytes, _ := json.Marshal(creditFacility)
+	checkState(t, stub, creditFacilityKey, versionedAsset("CreditFacility", creditFacilityBytes))
+
+	// Invoke 'requestTrade' above the single trade cap and verify failure
+	tradeID := "2ks89j9"
+	descGoods := "Wood for Toys"
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte("70000"), []byte(descGoods)})
+	checkNoState(t, stub, tradeKey)
+
+	// Ship a trade and verify that its L/C is drawn on the facility
+	amount := 50000
+	checkTradeShipped(t, stub, tradeID, amount, descGoods)
+	creditFacility.Utilisation = amount
+	creditFacility.CounterpartyUtilisation[EXPORTER] = amount
+	creditFacility.Drawings[tradeID] = &FacilityDrawing{EXPORTER, amount}
+	creditFacilityBytes, _ = json.Marshal(creditFacility)
+	checkState(t, stub, creditFacilityKey, versionedAsset("CreditFacility", creditFacilityBytes))
+	creditFacilityStatusBytes, _ := json.Marshal(&CreditFacilityStatus{creditFacility, 100000 - amount})
+	checkQueryArgs(t, stub, [][]byte{[]byte("getCreditFacility")}, string(creditFacilityStatusBytes))
+
+	// Invoke 'requestTrade' above the counterparty headroom and verify failure
+	tradeID2 := "8dk23l1"
+	tradeKey2, _ := stub.CreateCompositeKey("Trade", []string{tradeID2})
+	res := stub.MockInvoke("1", [][]byte{[]byte("requestTrade"), []byte(tradeID2), []byte("40000"), []byte(descGoods)})
+	if res.Status == shim.OK || res.Message != "Amount 40000 exceeds the credit limit for importer " + IMPORTER + " with counterparty " + EXPORTER + "; remaining headroom 30000" {
+		fmt.Println("Invoke requestTrade did not report the headroom:", res.Message)
+		t.FailNow()
+	}
+	checkNoState(t, stub, tradeKey2)
+
+	// Issue and cancel a second L/C and verify that the facility is released
+	amount2 := 30000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID2), []byte(strconv.Itoa(amount2)), []byte(descGoods)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID2)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID2)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID2), []byte("lc9001"), []byte("12/31/2018")})
+	checkInvoke(t, stub, [][]byte{[]byte("cancelLC"), []byte(tradeID2)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID2)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("cancelLC"), []byte(tradeID)})
+	expectedResp := "{\"Status\":\"CANCELLED\"}"
+	checkQuery(t, stub, "getLCStatus", tradeID2, expectedResp)
+	checkState(t, stub, creditFacilityKey, versionedAsset("CreditFacility", creditFacilityBytes))
+
+	// Make a payment and verify that the facility is released
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	creditFacility.Utilisation = amount/2
+	creditFacility.CounterpartyUtilisation[EXPORTER] = amount/2
+	creditFacility.Drawings[tradeID].Amount = amount/2
+	creditFacilityBytes, _ = json.Marshal(creditFacility)
+	checkState(t, stub, creditFacilityKey, versionedAsset("CreditFacility", creditFacilityBytes))
+
+	// Settle a dispute with a refund and verify that the credit drawn for the refunded amount is released
+	checkInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte("d001"), []byte("importer"), []byte(GOODS_DAMAGED)})
+	checkInvoke(t, stub, [][]byte{[]byte("decideDispute"), []byte(tradeID), []byte("d001"), []byte("10000")})
+	creditFacility.Utilisation = amount/2 - 10000
+	creditFacility.CounterpartyUtilisation[EXPORTER] = amount/2 - 10000
+	creditFacility.Drawings[tradeID].Amount = amount/2 - 10000
+	creditFacilityBytes, _ = json.Marshal(creditFacility)
+	checkState(t, stub, creditFacilityKey, versionedAsset("CreditFacility", creditFacilityBytes))
+}
+
+func checkMigrate(t *testing.T, stub *shim.MockStub, args [][]byte, scanned int, migrated int, done bool) string {
+	var progress MigrationProgress
+
+	res := stub.MockInvoke("1", args)
+	if res.Status != shim.OK {
+		fmt.Println("Invoke", args, "failed", string(res.Message))
+		t.FailNow()
+	}
+	err := json.Unmarshal(res.Payload, &progress)
+	if err != nil || progress.Scanned != scanned || progress.Migrated != migrated || progress.Done != done || (progress.Cursor == "") != done {
+		fmt.Println("Invoke", args, "reported", string(res.Payload))
+		t.FailNow()
+	}
+	return progress.Cursor
+}
+
+func TestTradeWorkflow_SchemaMigration(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Write records in the shape used before schema versioning
+	tradeID := "2ks89j9"
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+	putState(stub, tradeKey, []byte("{\"amount\":50000,\"descriptionOfGoods\":\"Wood for Toys\",\"status\":\"ACCEPTED\",\"payment\":0}"))
+	blKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID})
+	putState(stub, blKey, []byte("{\"id\":\"bl06678\",\"expirationDate\":\"12/31/2018\",\"exporter\":\"LumberInc\",\"carrier\":\"UniversalFrieght\",\"descriptionOfGoods\":\"Wood for Toys\",\"amount\":50000,\"beneficiary\":\"ToyBank\",\"sourcePort\":\"Woodlands Port\",\"destinationPort\":\"Market Port\"}"))
+	legacyPaymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID})
+	putState(stub, legacyPaymentKey, []byte(REQUESTED))
+
+	// Query 'getSchemaInfo' and verify the versions present
+	schemaInfo := []SchemaInfo{}
+	for _, schema := range assetSchemas {
+		schemaInfo = append(schemaInfo, SchemaInfo{schema.ObjectType, len(schema.Migrations), map[int]int{}, 0, 0})
+	}
+	schemaInfo[0].Versions[0] = 1
+	schemaInfo[3].Versions[0] = 1
+	schemaInfo[4].Unstructured = 1
+	schemaInfoBytes, _ := json.Marshal(schemaInfo)
+	checkQueryArgs(t, stub, [][]byte{[]byte("getSchemaInfo")}, string(schemaInfoBytes))
+
+	// Verify that records are upgraded when read
+	expectedResp := "{\"Status\":\"ACCEPTED\"}"
+	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
+	expectedResp = "{\"amount\":50000,\"beneficiary\":\"ToyBank\",\"carrier\":\"UniversalFrieght\",\"descriptionOfGoods\":\"Wood for Toys\",\"destinationPort\":\"Market Port\",\"expirationDate\":\"12/31/2018\",\"exporter\":\"LumberInc\",\"id\":\"bl06678\",\"schemaVersion\":1,\"sourcePort\":\"Woodlands Port\",\"status\":\"ISSUED\"}"
+	checkQuery(t, stub, "getBillOfLading", tradeID, expectedResp)
+
+	// Invoke bad 'migrate' and verify no state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("migrate")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("migrate"), []byte("0")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("migrate"), []byte("1"), []byte("not a cursor")})
+	checkQueryArgs(t, stub, [][]byte{[]byte("getSchemaInfo")}, string(schemaInfoBytes))
+
+	// Invoke 'migrate' in batches and verify state change
+	cursor := checkMigrate(t, stub, [][]byte{[]byte("migrate"), []byte("1")}, 1, 1, false)
+	checkState(t, stub, tradeKey, "{\"amount\":50000,\"descriptionOfGoods\":\"Wood for Toys\",\"payment\":0,\"schemaVersion\":1,\"status\":\"ACCEPTED\"}")
+	checkMigrate(t, stub, [][]byte{[]byte("migrate"), []byte("10"), []byte(cursor)}, 2, 2, true)
+	checkState(t, stub, blKey, expectedResp)
+	checkNoState(t, stub, legacyPaymentKey)
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, LEGACY_PAYMENT_REQUEST_ID})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{LEGACY_PAYMENT_REQUEST_ID, 50000, REQUESTED, "", "", 0, 0, ""})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+
+	schemaInfo[0].Versions = map[int]int{1: 1}
+	schemaInfo[3].Versions = map[int]int{1: 1}
+	schemaInfo[4].Versions = map[int]int{1: 1}
+	schemaInfo[4].Unstructured = 0
+	schemaInfoBytes, _ = json.Marshal(schemaInfo)
+	checkQueryArgs(t, stub, [][]byte{[]byte("getSchemaInfo")}, string(schemaInfoBytes))
+
+	// Invoke 'migrate' again and verify that there is nothing left to do
+	checkMigrate(t, stub, [][]byte{[]byte("migrate"), []byte("10")}, 3, 0, true)
+
+	// Verify that a record written by a newer chaincode version is not misread
+	tradeID2 := "8dk23l1"
+	tradeKey2, _ := stub.CreateCompositeKey("Trade", []string{tradeID2})
+	putState(stub, tradeKey2, []byte("{\"amount\":50000,\"status\":\"REQUESTED\",\"schemaVersion\":99}"))
+	checkBadQuery(t, stub, "getTradeStatus", tradeID2)
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID2)})
+
+	// Verify that only the regulator can invoke 'migrate'
+	scc = new(TradeWorkflowChaincode)
+	icc := &identityChaincode{scc, nil}
+	stub = shim.NewMockStub("Trade Workflow", icc)
+	icc.creator = getTestIdentity(t, "ImporterOrgMSP", "User1@importerorg.trade.com", "ca.importerorg.trade.com", false)
+	checkInit(t, stub, getInitArguments())
+	checkBadInvoke(t, stub, [][]byte{[]byte("migrate"), []byte("10")})
+	icc.creator = getTestIdentity(t, "RegulatorOrgMSP", "User1@regulatororg.trade.com", "ca.regulatororg.trade.com", false)
+	checkMigrate(t, stub, [][]byte{[]byte("migrate"), []byte("10")}, 0, 0, true)
+}
+
+func TestTradeWorkflow_Upgrade(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Instantiate as the original four-organization chaincode
+	checkInit(t, stub, getInitArguments())
+	expectedResp := "{\"ExportingEntity\":\"off\",\"RoleReset\":\"off\"}"
+	checkQueryArgs(t, stub, [][]byte{[]byte("getFeatures")}, expectedResp)
+	if !authenticateExportingEntity(stub, "ExporterOrgMSP", "ca.exporterorg.trade.com") ||
+		authenticateExportingEntity(stub, "ExportingEntityOrgMSP", "ca.exportingentityorg.trade.com") {
+		fmt.Println("Exporting entity role not played by the Exporter Org")
+		t.FailNow()
+	}
+
+	tradeID := "2ks89j9"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte("50000"), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+
+	// Invoke bad upgrades and verify no state change
+	checkBadInit(t, stub, [][]byte{[]byte("init"), []byte("Unknown=on")})
+	checkBadInit(t, stub, [][]byte{[]byte("init"), []byte("ExportingEntity=maybe")})
+	checkBadInit(t, stub, [][]byte{[]byte("init"), []byte("ExportingEntity=off"), []byte("RoleReset")})
+	args := getInitArguments()
+	args[1] = []byte("TimberInc")
+	checkBadInit(t, stub, args)
+	checkState(t, stub, "Exporter", EXPORTER)
+	checkQueryArgs(t, stub, [][]byte{[]byte("getFeatures")}, expectedResp)
+
+	// Upgrade to a dedicated Exporting Entity Org and verify that the ledger state is kept
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("ExportingEntity=on")})
+	expectedResp = "{\"ExportingEntity\":\"on\",\"RoleReset\":\"off\"}"
+	checkQueryArgs(t, stub, [][]byte{[]byte("getFeatures")}, expectedResp)
+	if authenticateExportingEntity(stub, "ExporterOrgMSP", "ca.exporterorg.trade.com") ||
+		!authenticateExportingEntity(stub, "ExportingEntityOrgMSP", "ca.exportingentityorg.trade.com") {
+		fmt.Println("Exporting entity role not played by the Exporting Entity Org")
+		t.FailNow()
+	}
+	checkState(t, stub, "Exporter", EXPORTER)
+	checkState(t, stub, "ImportersAccountBalance", strconv.Itoa(IMPBALANCE))
+	expectedResp = "{\"Status\":\"ACCEPTED\"}"
+	checkQuery(t, stub, "getTradeStatus", tradeID, expectedResp)
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+
+	// Upgrade without arguments and verify that the ledger state is kept
+	checkInit(t, stub, [][]byte{[]byte("init")})
+	checkState(t, stub, "Exporter", EXPORTER)
+
+	// Allow role resets, then upgrade with new roles and verify state change
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("RoleReset=on")})
+	args = append(args, []byte("RoleReset=off"))
+	checkInit(t, stub, args)
+	checkState(t, stub, "Exporter", "TimberInc")
+	expectedResp = "{\"ExportingEntity\":\"on\",\"RoleReset\":\"off\"}"
+	checkQueryArgs(t, stub, [][]byte{[]byte("getFeatures")}, expectedResp)
+	expectedResp = "{\"Status\":\"REQUESTED\"}"
+	checkQuery(t, stub, "getLCStatus", tradeID, expectedResp)
+
+	// Leave a payment request pending as the original chaincode recorded it, without a request ID
+	slKey, _ := stub.CreateCompositeKey("Shipment", []string{"Location", tradeID})
+	putState(stub, slKey, []byte(SOURCE))
+	legacyPaymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID})
+	putState(stub, legacyPaymentKey, []byte(REQUESTED))
+
+	// Verify that no other payment can be requested until the pending request is migrated
+	paymentRequestID := "pr1"
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte(paymentRequestID)})
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, paymentRequestID})
+	checkNoState(t, stub, paymentKey)
+
+	// Invoke 'migrate' and verify that the pending request is recorded with a derived ID for half the amount
+	checkMigrate(t, stub, [][]byte{[]byte("migrate"), []byte("10")}, 3, 1, true)
+	checkNoState(t, stub, legacyPaymentKey)
+	migratedPaymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, LEGACY_PAYMENT_REQUEST_ID})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{LEGACY_PAYMENT_REQUEST_ID, 25000, REQUESTED, "", "", 0, 0, ""})
+	checkState(t, stub, migratedPaymentKey, versionedAsset("Payment", paymentRequestBytes))
+
+	// Verify that the migrated request is the pending one
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte(LEGACY_PAYMENT_REQUEST_ID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte(paymentRequestID)})
+	checkNoState(t, stub, paymentKey)
+}
+
+func checkDelegation(t *testing.T, stub *shim.MockStub, action string, tradeID string, mspID string, identity string, delegationID string) {
+	stub.MockTransactionStart("check")
+	delegation, err := findDelegation(stub, action, tradeID, mspID, identity)
+	stub.MockTransactionEnd("check")
+	if err != nil {
+		fmt.Println("Delegation lookup failed", err.Error())
+		t.FailNow()
+	}
+	if delegationID == "" && delegation != nil {
+		fmt.Println("Delegation", delegation.Id, "unexpectedly permits", action, "on", tradeID, "by", identity, "of", mspID)
+		t.FailNow()
+	}
+	if delegationID != "" && (delegation == nil || delegation.Id != delegationID) {
+		fmt.Println("Delegation", delegationID, "does not permit", action, "on", tradeID, "by", identity, "of", mspID)
+		t.FailNow()
+	}
+}
+
+func TestTradeWorkflow_Delegation(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	tradeID2 := "8dk23l1"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte("50000"), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID2), []byte("50000"), []byte("Wood for Toys")})
+
+	// Invoke bad 'grantDelegation' and verify no state change
+	delegationID := "dlg001"
+	delegationKey, _ := stub.CreateCompositeKey("Delegation", []string{delegationID})
+	validUntil := "2099-12-31T00:00:00Z"
+	checkBadInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte("CarrierOrgMSP"), []byte(""), []byte("acceptTrade")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte(""), []byte(""), []byte("acceptTrade"), []byte(tradeID), []byte(validUntil)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte("CarrierOrgMSP"), []byte(""), []byte("acceptTrade,issueLC"), []byte(tradeID), []byte(validUntil)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte("CarrierOrgMSP"), []byte(""), []byte("acceptTrade"), []byte("unknown"), []byte(validUntil)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte("CarrierOrgMSP"), []byte(""), []byte("acceptTrade"), []byte(tradeID), []byte("2018-01-01T00:00:00Z")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte("CarrierOrgMSP"), []byte(""), []byte("acceptTrade"), []byte(tradeID), []byte("12/31/2099")})
+	checkNoState(t, stub, delegationKey)
+
+	// Invoke 'grantDelegation' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte("CarrierOrgMSP"), []byte(""), []byte("acceptTrade, requestEL"), []byte(tradeID), []byte(validUntil)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID), []byte("CarrierOrgMSP"), []byte(""), []byte("acceptTrade"), []byte(tradeID), []byte(validUntil)})
+	var delegation *Delegation
+	json.Unmarshal(stub.State[delegationKey], &delegation)
+	expectedDelegation := &Delegation{delegationID, EXPORTER, "CarrierOrgMSP", "", []string{ACCEPT_TRADE_ACTION, REQUEST_EL_ACTION}, tradeID, delegation.ValidFrom, validUntil, ACTIVE}
+	delegationBytes, _ := json.Marshal(expectedDelegation)
+	checkState(t, stub, delegationKey, versionedAsset("Delegation", delegationBytes))
+	checkQuery(t, stub, "getDelegation", delegationID, versionedAsset("Delegation", delegationBytes))
+
+	// Verify the scope of the delegation
+	checkDelegation(t, stub, ACCEPT_TRADE_ACTION, tradeID, "CarrierOrgMSP", "User1@carrierorg.trade.com", delegationID)
+	checkDelegation(t, stub, REQUEST_EL_ACTION, tradeID, "CarrierOrgMSP", "Admin@carrierorg.trade.com", delegationID)
+	checkDelegation(t, stub, PREPARE_SHIPMENT_ACTION, tradeID, "CarrierOrgMSP", "User1@carrierorg.trade.com", "")
+	checkDelegation(t, stub, ACCEPT_TRADE_ACTION, tradeID2, "CarrierOrgMSP", "User1@carrierorg.trade.com", "")
+	checkDelegation(t, stub, ACCEPT_TRADE_ACTION, tradeID, "RegulatorOrgMSP", "User1@regulatororg.trade.com", "")
+
+	// Delegate to a single identity for all trades and verify its scope
+	delegationID2 := "dlg002"
+	checkInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte(delegationID2), []byte("CarrierOrgMSP"), []byte("User1@carrierorg.trade.com"), []byte("requestPayment"), []byte(""), []byte(validUntil)})
+	checkDelegation(t, stub, REQUEST_PAYMENT_ACTION, tradeID, "CarrierOrgMSP", "User1@carrierorg.trade.com", delegationID2)
+	checkDelegation(t, stub, REQUEST_PAYMENT_ACTION, tradeID2, "CarrierOrgMSP", "User1@carrierorg.trade.com", delegationID2)
+	checkDelegation(t, stub, REQUEST_PAYMENT_ACTION, tradeID, "CarrierOrgMSP", "Admin@carrierorg.trade.com", "")
+
+	// Verify that a delegation is only in force during its validity period
+	delegation.Status = ACTIVE
+	validFrom, _ := time.Parse(time.RFC3339, delegation.ValidFrom)
+	if !isDelegationInForce(delegation, ACCEPT_TRADE_ACTION, tradeID, "CarrierOrgMSP", "", validFrom) ||
+		isDelegationInForce(delegation, ACCEPT_TRADE_ACTION, tradeID, "CarrierOrgMSP", "", validFrom.Add(-time.Second)) ||
+		isDelegationInForce(delegation, ACCEPT_TRADE_ACTION, tradeID, "CarrierOrgMSP", "", time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		fmt.Println("Delegation in force outside its validity period")
+		t.FailNow()
+	}
+
+	// Invoke 'revokeDelegation' and verify state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("revokeDelegation"), []byte("unknown")})
+	checkInvoke(t, stub, [][]byte{[]byte("revokeDelegation"), []byte(delegationID)})
+	checkInvoke(t, stub, [][]byte{[]byte("revokeDelegation"), []byte(delegationID)})
+	expectedDelegation.Status = REVOKED
+	delegationBytes, _ = json.Marshal(expectedDelegation)
+	checkState(t, stub, delegationKey, versionedAsset("Delegation", delegationBytes))
+	checkDelegation(t, stub, ACCEPT_TRADE_ACTION, tradeID, "CarrierOrgMSP", "User1@carrierorg.trade.com", "")
+	checkDelegation(t, stub, REQUEST_PAYMENT_ACTION, tradeID, "CarrierOrgMSP", "User1@carrierorg.trade.com", delegationID2)
+
+	// Verify that the exporter's own organization needs no delegation
+	if !authorizeExporterAction(stub, PREPARE_SHIPMENT_ACTION, []string{tradeID}, "ExporterOrgMSP", "ca.exporterorg.trade.com") {
+		fmt.Println("Exporter not authorized for its own workflow step")
+		t.FailNow()
+	}
+}
+
+func checkAccessDenied(t *testing.T, stub *shim.MockStub, args [][]byte) {
+	res := stub.MockInvoke("1", args)
+	if res.Status == shim.OK || !strings.Contains(res.Message, "Access denied") {
+		fmt.Println("Invoke", string(args[0]), "was not denied:", res.Message)
+		t.FailNow()
+	}
+}
+
+func TestTradeWorkflow_ExportingEntityDelegation(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	icc := &identityChaincode{scc, nil}
+	stub := shim.NewMockStub("Trade Workflow", icc)
+
+	importer := getTestIdentity(t, "ImporterOrgMSP", "User1@importerorg.trade.com", "ca.importerorg.trade.com", false)
+	exporter := getTestIdentity(t, "ExporterOrgMSP", "User1@exporterorg.trade.com", "ca.exporterorg.trade.com", false)
+	exportingEntity := getTestIdentity(t, "ExportingEntityOrgMSP", "User1@exportingentityorg.trade.com", "ca.exportingentityorg.trade.com", false)
+
+	// Init without a dedicated Exporting Entity Org, so that its members are outside the trade
+	icc.creator = importer
+	checkInit(t, stub, getInitArguments())
+	tradeID := "2ks89j9"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte("50000"), []byte("Wood for Toys")})
+
+	// Without a delegation the Exporting Entity Org cannot perform the exporter's steps
+	icc.creator = exportingEntity
+	checkAccessDenied(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+
+	// Delegate only the acceptance of the trade to the exporting entity
+	icc.creator = exporter
+	checkInvoke(t, stub, [][]byte{[]byte("grantDelegation"), []byte("dlg001"), []byte("ExportingEntityOrgMSP"), []byte(""), []byte(ACCEPT_TRADE_ACTION), []byte(tradeID), []byte("2099-12-31T00:00:00Z")})
+	icc.creator = exportingEntity
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+
+	icc.creator = importer
+	checkQuery(t, stub, "getTradeStatus", tradeID, "{\"Status\":\"ACCEPTED\"}")
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	icc.creator = exporter
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+
+	// The step that was not delegated is denied to the exporting entity, but not to the exporter
+	elKey, _ := stub.CreateCompositeKey("ExportLicense", []string{tradeID})
+	icc.creator = exportingEntity
+	checkAccessDenied(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkNoState(t, stub, elKey)
+	icc.creator = exporter
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+
+	// Once revoked, the delegated step is denied as well
+	checkInvoke(t, stub, [][]byte{[]byte("revokeDelegation"), []byte("dlg001")})
+	icc.creator = exportingEntity
+	checkAccessDenied(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+
+	// Once the upgrade enables the exporting entity role, its members perform the exporter's steps without a delegation
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte(EXPORTING_ENTITY_FEATURE + "=on")})
+	icc.creator = importer
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte("2ks89j10"), []byte("50000"), []byte("Wood for Toys")})
+	icc.creator = exportingEntity
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte("2ks89j10")})
+	checkQuery(t, stub, "getTradeStatus", "2ks89j10", "{\"Status\":\"ACCEPTED\"}")
+}
+
+// MockStub has no transaction creator; this stub presents the identity set on the wrapping chaincode
+type identityStub struct {
+	shim.ChaincodeStubInterface
+	creator		[]byte
+}
+
+func (s *identityStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+// Chaincode wrapper that invokes the trade workflow as the identity in 'creator'
+type identityChaincode struct {
+	cc		*TradeWorkflowChaincode
+	creator		[]byte
+}
+
+func (c *identityChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return c.cc.Init(&identityStub{stub, c.creator})
+}
+
+func (c *identityChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	return c.cc.Invoke(&identityStub{stub, c.creator})
+}
+
+// Serialized identity of a member of an organization, with a certificate issued by the organization's CA
+func getTestIdentity(t *testing.T, mspID string, name string, caName string, approver bool) []byte {
+	creator, _ := getTestIdentityKey(t, mspID, name, caName, approver)
+	return creator
+}
+
+// Serialized identity of a member of an organization, and the private key of its certificate
+func getTestIdentityKey(t *testing.T, mspID string, name string, caName string, approver bool) ([]byte, *ecdsa.PrivateKey) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:		big.NewInt(1),
+		Subject:		pkix.Name{CommonName: caName},
+		NotBefore:		time.Now().Add(-time.Hour),
+		NotAfter:		time.Now().Add(time.Hour),
+		IsCA:			true,
+		BasicConstraintsValid:	true,
+		KeyUsage:		x509.KeyUsageCertSign,
+	}
+	caCertBytes, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		fmt.Println("Failed to create CA certificate", err.Error())
+		t.FailNow()
+	}
+	caCert, _ := x509.ParseCertificate(caCertBytes)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:		big.NewInt(2),
+		Subject:		pkix.Name{CommonName: name},
+		NotBefore:		time.Now().Add(-time.Hour),
+		NotAfter:		time.Now().Add(time.Hour),
+		KeyUsage:		x509.KeyUsageDigitalSignature,
+	}
+	if approver {
+		template.ExtraExtensions = []pkix.Extension{{Id: attrmgr.AttrOID, Value: []byte(`{"attrs":{"` + APPROVER_ATTRIBUTE + `":"true"}}`)}}
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		fmt.Println("Failed to create certificate", err.Error())
+		t.FailNow()
+	}
+
+	creator, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})})
+	return creator, key
+}
+
+func checkProposal(t *testing.T, stub *shim.MockStub, txID string, args [][]byte) *Proposal {
+	var proposal *Proposal
+
+	res := stub.MockInvoke(txID, args)
+	if res.Status != shim.OK {
+		fmt.Println("Invoke", args, "failed", string(res.Message))
+		t.FailNow()
+	}
+	err := json.Unmarshal(res.Payload, &proposal)
+	if err != nil || res.Message != PENDING || proposal == nil || proposal.Id != txID || proposal.Status != PENDING {
+		fmt.Println("Invoke", args, "did not record a pending proposal")
+		t.FailNow()
+	}
+	return proposal
+}
+
+func TestTradeWorkflow_Approval(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	icc := &identityChaincode{scc, nil}
+	stub := shim.NewMockStub("Trade Workflow", icc)
+
+	importerClerk := getTestIdentity(t, "ImporterOrgMSP", "User1@importerorg.trade.com", "ca.importerorg.trade.com", false)
+	importerApprover1 := getTestIdentity(t, "ImporterOrgMSP", "User2@importerorg.trade.com", "ca.importerorg.trade.com", true)
+	importerApprover2 := getTestIdentity(t, "ImporterOrgMSP", "Admin@importerorg.trade.com", "ca.importerorg.trade.com", true)
+	exporterClerk := getTestIdentity(t, "ExporterOrgMSP", "User1@exporterorg.trade.com", "ca.exporterorg.trade.com", false)
+	exporterApprover := getTestIdentity(t, "ExporterOrgMSP", "Admin@exporterorg.trade.com", "ca.exporterorg.trade.com", true)
+
+	// Init
+	icc.creator = importerClerk
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	icc.creator = importerClerk
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	icc.creator = exporterClerk
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	icc.creator = importerClerk
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+
+	// Invoke bad 'setApprovalPolicy' and verify no state change
+	approvalPolicyKey, _ := stub.CreateCompositeKey("ApprovalPolicy", []string{IMPBANK})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(IMPORTERS_BANK_PARTY), []byte("10000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte("carrier"), []byte("10000"), []byte("2")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(IMPORTERS_BANK_PARTY), []byte("-1"), []byte("2")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(IMPORTERS_BANK_PARTY), []byte("10000"), []byte("two")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(EXPORTERS_BANK_PARTY), []byte("10000"), []byte("1")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(IMPORTERS_BANK_PARTY), []byte("10000"), []byte("2")})
+	checkNoState(t, stub, approvalPolicyKey)
+
+	// Invoke 'setApprovalPolicy' as an approver and verify state change
+	icc.creator = importerApprover1
+	checkInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(IMPORTERS_BANK_PARTY), []byte("10000"), []byte("2")})
+	approvalPolicyBytes, _ := json.Marshal(&ApprovalPolicy{IMPBANK, 10000, 2})
+	checkState(t, stub, approvalPolicyKey, versionedAsset("ApprovalPolicy", approvalPolicyBytes))
+	icc.creator = exporterApprover
+	checkInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(EXPORTERS_BANK_PARTY), []byte("100000"), []byte("1")})
+
+	// Invoke 'issueLC' above the threshold and verify that only a proposal is recorded
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	lcBytes := stub.State[lcKey]
+	icc.creator = importerClerk
+	issueArgs := [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")}
+	proposal := checkProposal(t, stub, "tx001", issueArgs)
+	checkState(t, stub, lcKey, string(lcBytes))
+	checkBadInvoke(t, stub, issueArgs)
+	expectedProposal := &Proposal{"tx001", ISSUE_LC_ACTION, []string{tradeID, "lc8349", "12/31/2018", "E/L", "B/L"}, amount, IMPBANK, "User1@importerorg.trade.com", 2, []string{}, PENDING}
+	proposalBytes, _ := json.Marshal(expectedProposal)
+	proposalKey, _ := stub.CreateCompositeKey("Proposal", []string{proposal.Id})
+	checkState(t, stub, proposalKey, versionedAsset("Proposal", proposalBytes))
+	checkQueryArgs(t, stub, [][]byte{[]byte("getPendingApprovals")}, "[" + string(proposalBytes) + "]")
+
+	// Invoke bad 'approveProposal' and verify no state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte("unknown")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	icc.creator = exporterApprover
+	checkBadInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	checkState(t, stub, proposalKey, versionedAsset("Proposal", proposalBytes))
+
+	// Invoke 'approveProposal' and verify that the L/C is issued only after the second approval
+	icc.creator = importerApprover1
+	checkInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	checkState(t, stub, lcKey, string(lcBytes))
+	icc.creator = importerApprover2
+	checkInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	expectedLC := &LetterOfCredit{}
+	json.Unmarshal(lcBytes, &expectedLC)
+	expectedLC.Id = "lc8349"
+	expectedLC.ExpirationDate = "12/31/2018"
+	expectedLC.Documents = []string{"E/L", "B/L"}
+	expectedLC.Status = ISSUED
+	lcBytes, _ = json.Marshal(expectedLC)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", lcBytes))
+	expectedProposal.Approvals = []string{"User2@importerorg.trade.com", "Admin@importerorg.trade.com"}
+	expectedProposal.Status = APPROVED
+	proposalBytes, _ = json.Marshal(expectedProposal)
+	checkState(t, stub, proposalKey, versionedAsset("Proposal", proposalBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	checkQueryArgs(t, stub, [][]byte{[]byte("getPendingApprovals")}, "[]")
+
+	// Invoke 'acceptLC' below the exporter's bank threshold and verify that it is performed rather than held
+	icc.creator = exporterClerk
+	res := stub.MockInvoke("1", [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	if res.Status != shim.OK || res.Message == PENDING || res.Payload != nil {
+		fmt.Println("Invoke acceptLC was not performed:", res.Message)
+		t.FailNow()
+	}
+	expectedLC.Status = ACCEPTED
+	lcBytes, _ = json.Marshal(expectedLC)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", lcBytes))
+}
+
+func TestTradeWorkflow_WithdrawProposal(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	icc := &identityChaincode{scc, nil}
+	stub := shim.NewMockStub("Trade Workflow", icc)
+
+	importerClerk := getTestIdentity(t, "ImporterOrgMSP", "User1@importerorg.trade.com", "ca.importerorg.trade.com", false)
+	importerClerk2 := getTestIdentity(t, "ImporterOrgMSP", "User3@importerorg.trade.com", "ca.importerorg.trade.com", false)
+	importerApprover := getTestIdentity(t, "ImporterOrgMSP", "Admin@importerorg.trade.com", "ca.importerorg.trade.com", true)
+	exporterClerk := getTestIdentity(t, "ExporterOrgMSP", "User1@exporterorg.trade.com", "ca.exporterorg.trade.com", false)
+
+	// Init and hold an L/C issuance for approval
+	icc.creator = importerClerk
+	checkInit(t, stub, getInitArguments())
+	tradeID := "2ks89j9"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte("50000"), []byte("Wood for Toys")})
+	icc.creator = exporterClerk
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	icc.creator = importerClerk
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	icc.creator = importerApprover
+	checkInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(IMPORTERS_BANK_PARTY), []byte("10000"), []byte("1")})
+	icc.creator = importerClerk
+	proposal := checkProposal(t, stub, "tx001", [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	proposalKey, _ := stub.CreateCompositeKey("Proposal", []string{proposal.Id})
+
+	// Cancel the L/C meanwhile and verify that the approval which would issue it fails and leaves the proposal pending
+	checkInvoke(t, stub, [][]byte{[]byte("cancelLC"), []byte(tradeID)})
+	proposalBytes := stub.State[proposalKey]
+	icc.creator = importerApprover
+	checkBadInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	checkState(t, stub, proposalKey, string(proposalBytes))
+
+	// Invoke bad 'withdrawProposal' and verify no state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("withdrawProposal")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("withdrawProposal"), []byte("unknown")})
+	icc.creator = importerClerk2
+	checkBadInvoke(t, stub, [][]byte{[]byte("withdrawProposal"), []byte(proposal.Id)})
+	checkState(t, stub, proposalKey, string(proposalBytes))
+
+	// Invoke 'withdrawProposal' as an approver other than the proposer and verify state change
+	icc.creator = importerApprover
+	checkInvoke(t, stub, [][]byte{[]byte("withdrawProposal"), []byte(proposal.Id)})
+	proposal.Status = WITHDRAWN
+	withdrawnBytes, _ := json.Marshal(proposal)
+	checkState(t, stub, proposalKey, versionedAsset("Proposal", withdrawnBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("withdrawProposal"), []byte(proposal.Id)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	checkQueryArgs(t, stub, [][]byte{[]byte("getPendingApprovals")}, "[]")
+}
+
+func TestTradeWorkflow_ConfirmedLC(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init without escrow, so that payments are debited directly from the issuing bank's account
+	checkInit(t, stub, append(getInitArguments(), []byte(ESCROW_MARGIN_SETTING + "=0")))
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	advisingBank := "PortBank"
+	confirmingBank := "CityBank"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+
+	// Invoke 'requestLC' with advising and confirming banks
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(advisingBank), []byte(confirmingBank), []byte("OtherBank")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(advisingBank), []byte(confirmingBank)})
+	letterOfCredit := &LetterOfCredit{"", "", EXPORTER, amount, []string{}, REQUESTED, advisingBank, confirmingBank, false, false, false, "", "", 0, 0, 0, 0, false, nil}
+	letterOfCreditBytes, _ := json.Marshal(letterOfCredit)
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+
+	// Invoke 'adviseLC' and 'confirmLC' prematurely and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("adviseLC"), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("confirmLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("confirmLC"), []byte(tradeID)})
+	letterOfCredit = &LetterOfCredit{"lc8349", "12/31/2018", EXPORTER, amount, []string{"E/L", "B/L"}, ISSUED, advisingBank, confirmingBank, false, false, false, "", "", 0, 0, 0, 0, false, nil}
+	letterOfCreditBytes, _ = json.Marshal(letterOfCredit)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+
+	// Invoke 'setFeeSchedule' for the nominated banks' services
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte(advisingBank), []byte("issueLC"), []byte("flat"), []byte("100"), []byte("0"), []byte("0"), []byte("beneficiary")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte(""), []byte("adviseLC"), []byte("flat"), []byte("100"), []byte("0"), []byte("0"), []byte("beneficiary")})
+	checkInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte(advisingBank), []byte("adviseLC"), []byte("flat"), []byte("100"), []byte("0"), []byte("0"), []byte("beneficiary")})
+	checkInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte(confirmingBank), []byte("confirmLC"), []byte("percentage"), []byte("10"), []byte("0"), []byte("0"), []byte("beneficiary")})
+	advisingFee := 100
+	confirmationFee := amount * 10 / 10000
+
+	// Invoke 'adviseLC' and 'confirmLC' and verify state change and the fees charged to the exporter
+	checkInvoke(t, stub, [][]byte{[]byte("adviseLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("confirmLC"), []byte(tradeID)})
+	advisingBankBalanceKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{advisingBank})
+	checkState(t, stub, advisingBankBalanceKey, strconv.Itoa(advisingFee))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE - advisingFee - confirmationFee))
+	letterOfCredit.Advised = true
+	letterOfCredit.Confirmed = true
+	letterOfCreditBytes, _ = json.Marshal(letterOfCredit)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+	bankBalanceKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{confirmingBank})
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(confirmationFee))
+
+	// A confirmed L/C cannot be cancelled
+	checkBadInvoke(t, stub, [][]byte{[]byte("cancelLC"), []byte(tradeID)})
+
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+
+	// Invoke 'makePayment' and verify that the issuing bank pays while it can
+	payment := amount/2
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "pr001"})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{"pr001", payment, PAID, IMPBANK, EXPORTER, 0, 0, ""})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - payment))
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(confirmationFee))
+
+	// Invoke 'makePayment' once the issuing bank has defaulted and verify that the confirming bank is charged, if it has the funds
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	paymentKey2, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "pr002"})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+	var tradeAgreement *TradeAgreement
+	json.Unmarshal(stub.State[tradeKey], &tradeAgreement)
+	tradeAgreement.Status = DEFAULTED
+	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
+	putState(stub, tradeKey, []byte(versionedAsset("Trade", tradeAgreementBytes)))
+	checkBadInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(confirmationFee))
+	putState(stub, bankBalanceKey, []byte(strconv.Itoa(amount)))
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	paymentRequestBytes, _ = json.Marshal(&PaymentRequest{"pr002", amount - payment, PAID, confirmingBank, EXPORTER, 0, 0, ""})
+	checkState(t, stub, paymentKey2, versionedAsset("Payment", paymentRequestBytes))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - payment))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE - advisingFee - confirmationFee + amount))
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(payment))
+
+	// Check queries
+	expectedResp := "{\"Balance\":\"" + strconv.Itoa(payment) + "\"}"
+	checkQueryArgs(t, stub, [][]byte{[]byte("getAccountBalance"), []byte(tradeID), []byte("confirmingbank")}, expectedResp)
+}
+
+func TestTradeWorkflow_TransferableLC(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	lcID := "lc8349"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte("maybe")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte("true")})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte(lcID), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+
+	// Invoke 'transferLC' before the L/C is accepted and verify failure
+	transferredLCID := "lc8349-t1"
+	transferredLCKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID, transferredLCID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte(transferredLCID), []byte("SawMill"), []byte("20000")})
+	checkNoState(t, stub, transferredLCKey)
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+
+	// Invoke bad 'transferLC' and verify no state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte(transferredLCID), []byte("SawMill")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte(transferredLCID), []byte("SawMill"), []byte("0")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte(transferredLCID), []byte("SawMill"), []byte(strconv.Itoa(amount + 1))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte(lcID), []byte("SawMill"), []byte("20000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte("unknown"), []byte(transferredLCID), []byte("SawMill"), []byte("20000")})
+	checkNoState(t, stub, transferredLCKey)
+
+	// Invoke 'transferLC' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte(transferredLCID), []byte("SawMill"), []byte("20000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte(transferredLCID), []byte("SawMill"), []byte("10000")})
+	transferredLC := &LetterOfCredit{transferredLCID, "12/31/2018", "SawMill", 20000, []string{"E/L", "B/L"}, ISSUED, "", "", false, false, false, TRANSFERRED, lcID, 0, 0, 0, 0, false, nil}
+	transferredLCBytes, _ := json.Marshal(transferredLC)
+	checkState(t, stub, transferredLCKey, versionedAsset("LetterOfCredit", transferredLCBytes))
+	sawMillBalanceKey, _ := stub.CreateCompositeKey("BeneficiaryAccountBalance", []string{"SawMill"})
+	checkState(t, stub, sawMillBalanceKey, "0")
+
+	// Invoke 'issueBackToBackLC' and verify that the L/Cs never exceed the original amount
+	backToBackLCID := "lc8349-b1"
+	backToBackLCKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID, backToBackLCID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueBackToBackLC"), []byte(tradeID), []byte(backToBackLCID), []byte("TimberYard"), []byte("30001"), []byte("11/30/2018")})
+	checkNoState(t, stub, backToBackLCKey)
+	checkInvoke(t, stub, [][]byte{[]byte("issueBackToBackLC"), []byte(tradeID), []byte(backToBackLCID), []byte("TimberYard"), []byte("30000"), []byte("11/30/2018"), []byte("B/L")})
+	backToBackLC := &LetterOfCredit{backToBackLCID, "11/30/2018", "TimberYard", 30000, []string{"B/L"}, ISSUED, "", "", false, false, false, BACK_TO_BACK, lcID, 0, 0, 0, 0, false, nil}
+	backToBackLCBytes, _ := json.Marshal(backToBackLC)
+	checkState(t, stub, backToBackLCKey, versionedAsset("LetterOfCredit", backToBackLCBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueBackToBackLC"), []byte(tradeID), []byte("lc8349-b2"), []byte("TimberYard"), []byte("1"), []byte("11/30/2018")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("transferLC"), []byte(tradeID), []byte("lc8349-t2"), []byte("SawMill"), []byte("1")})
+
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	letterOfCredit := &LetterOfCredit{lcID, "12/31/2018", EXPORTER, amount, []string{"E/L", "B/L"}, ACCEPTED, "", "", false, false, true, "", "", 20000, 30000, 0, 0, false, nil}
+	letterOfCreditBytes, _ := json.Marshal(letterOfCredit)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+	checkQuery(t, stub, "getChildLCs", tradeID, "[" + string(backToBackLCBytes) + "," + string(transferredLCBytes) + "]")
+
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+
+	// Invoke 'requestPayment' and 'makePayment' on shipment
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke 'payChildLC' and verify payments to the beneficiaries
+	checkBadInvoke(t, stub, [][]byte{[]byte("payChildLC"), []byte(tradeID), []byte(transferredLCID), []byte("20001")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("payChildLC"), []byte(tradeID), []byte("unknown"), []byte("20000")})
+	checkInvoke(t, stub, [][]byte{[]byte("payChildLC"), []byte(tradeID), []byte(transferredLCID), []byte("20000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("payChildLC"), []byte(tradeID), []byte(transferredLCID), []byte("1")})
+	checkInvoke(t, stub, [][]byte{[]byte("payChildLC"), []byte(tradeID), []byte(backToBackLCID), []byte("10000")})
+	transferredLC.Drawn = 20000
+	transferredLC.Status = PAID
+	transferredLCBytes, _ = json.Marshal(transferredLC)
+	checkState(t, stub, transferredLCKey, versionedAsset("LetterOfCredit", transferredLCBytes))
+	backToBackLC.Drawn = 10000
+	backToBackLCBytes, _ = json.Marshal(backToBackLC)
+	checkState(t, stub, backToBackLCKey, versionedAsset("LetterOfCredit", backToBackLCBytes))
+	timberYardBalanceKey, _ := stub.CreateCompositeKey("BeneficiaryAccountBalance", []string{"TimberYard"})
+	checkState(t, stub, sawMillBalanceKey, "20000")
+	checkState(t, stub, timberYardBalanceKey, "10000")
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount/2 - 10000))
+
+	// Invoke 'requestPayment' and 'makePayment' on arrival and verify that the exporter is paid only the untransferred balance
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr003")})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{"pr002", amount/2 - 20000, PAID, IMPBANK, EXPORTER, 0, 0, ""})
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "pr002"})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+	letterOfCredit.Drawn = amount - 20000
+	letterOfCreditBytes, _ = json.Marshal(letterOfCredit)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE - 10000 + amount - 20000))
+	tradeAgreement := &TradeAgreement{amount, "Wood for Toys", ACCEPTED, amount, nil, 0}
+	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+}
+
+func TestTradeWorkflow_UsanceLC(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+
+	// Invoke 'requestLC' with a tenor
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte(""), []byte("-1")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte(""), []byte("90 days")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte(""), []byte("90")})
+	letterOfCredit := &LetterOfCredit{"", "", EXPORTER, amount, []string{}, REQUESTED, "", "", false, false, false, "", "", 0, 0, 0, 90, false, nil}
+	letterOfCreditBytes, _ := json.Marshal(letterOfCredit)
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+
+	// Invoke 'acceptDraft' before the B/L is issued and verify failure
+	draftKey, _ := stub.CreateCompositeKey("Draft", []string{tradeID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptDraft"), []byte(tradeID)})
+	checkNoState(t, stub, draftKey)
+
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+
+	// Invoke 'makePayment' without an accepted draft and verify failure
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke 'acceptDraft' and verify that the draft matures at the end of the tenor from the B/L date
+	checkInvoke(t, stub, [][]byte{[]byte("acceptDraft"), []byte(tradeID)})
+	var billOfLading *BillOfLading
+	var draft *Draft
+	blKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID})
+	json.Unmarshal(stub.State[blKey], &billOfLading)
+	json.Unmarshal(stub.State[draftKey], &draft)
+	blDate, _ := time.Parse(time.RFC3339, billOfLading.IssueDate)
+	expectedDraft := &Draft{tradeID, amount, draft.AcceptanceDate, blDate.AddDate(0, 0, 90).Format(time.RFC3339), "", 0, ACCEPTED}
+	draftBytes, _ := json.Marshal(expectedDraft)
+	checkState(t, stub, draftKey, versionedAsset("Draft", draftBytes))
+	checkQuery(t, stub, "getDraft", tradeID, versionedAsset("Draft", draftBytes))
+
+	// Invoke 'makePayment' before maturity and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE))
+
+	// Invoke bad 'discountDraft' and verify no state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("discountDraft"), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("discountDraft"), []byte(tradeID), []byte("-600")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("discountDraft"), []byte("unknown"), []byte("600")})
+	checkState(t, stub, draftKey, versionedAsset("Draft", draftBytes))
+
+	// Invoke 'discountDraft' before the exporter's bank has the funds to advance and verify failure
+	bankBalanceKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{EXPBANK})
+	putState(stub, bankBalanceKey, []byte("30000"))
+	checkBadInvoke(t, stub, [][]byte{[]byte("discountDraft"), []byte(tradeID), []byte("600")})
+	checkState(t, stub, draftKey, versionedAsset("Draft", draftBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE))
+	putState(stub, bankBalanceKey, []byte(strconv.Itoa(amount)))
+
+	// Invoke 'discountDraft' and verify that the exporter is paid the amount less 90 days of discount
+	checkInvoke(t, stub, [][]byte{[]byte("discountDraft"), []byte(tradeID), []byte("600")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("discountDraft"), []byte(tradeID), []byte("600")})
+	discount := amount * 600 * 90 / (360 * 10000)
+	expectedDraft.DiscountedBy = EXPBANK
+	expectedDraft.Discount = discount
+	expectedDraft.Status = DISCOUNTED
+	draftBytes, _ = json.Marshal(expectedDraft)
+	checkState(t, stub, draftKey, versionedAsset("Draft", draftBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount - discount))
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(discount))
+
+	// Let the draft mature, invoke 'makePayment' and verify that the proceeds go to the discounting bank
+	expectedDraft.MaturityDate = time.Now().UTC().AddDate(0, 0, -1).Format(time.RFC3339)
+	draftBytes, _ = json.Marshal(expectedDraft)
+	putState(stub, draftKey, draftBytes)
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{"pr001", amount/2, PAID, IMPBANK, EXPBANK, 0, 0, ""})
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "pr001"})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(discount + amount/2))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount - discount))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount))
+}
+
+func TestTradeWorkflow_PartialShipments(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Invoke 'requestTrade' with a quantity and verify the trade agreement
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys"), []byte("0")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys"), []byte("3")})
+	tradeAgreement := &TradeAgreement{amount, "Wood for Toys", REQUESTED, 0, nil, 3}
+	tradeAgreementBytes, _ := json.Marshal(tradeAgreement)
+	tradeKey, _ := stub.CreateCompositeKey("Trade", []string{tradeID})
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+
+	// Invoke 'requestLC' allowing partial shipments
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte(""), []byte("0"), []byte("sometimes")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte(""), []byte("0"), []byte("true")})
+	letterOfCredit := &LetterOfCredit{"", "", EXPORTER, amount, []string{}, REQUESTED, "", "", false, false, false, "", "", 0, 0, 0, 0, true, nil}
+	letterOfCreditBytes, _ := json.Marshal(letterOfCredit)
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+
+	// Invoke 'prepareLot' before the E/L is issued and verify failure
+	lot1Key, _ := stub.CreateCompositeKey("Lot", []string{tradeID, "lot1"})
+	lot2Key, _ := stub.CreateCompositeKey("Lot", []string{tradeID, "lot2"})
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1"), []byte("1")})
+	checkNoState(t, stub, lot1Key)
+
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+
+	// Invoke bad 'prepareLot' and verify no state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1"), []byte("0")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1"), []byte("4")})
+	checkNoState(t, stub, lot1Key)
+
+	// Invoke 'prepareLot' for two lots and verify that the amount is apportioned by quantity
+	checkInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1"), []byte("1")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot2"), []byte("3")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot2"), []byte("2")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot3"), []byte("1")})
+	lot1 := &Lot{"lot1", tradeID, 1, 16666, SOURCE, 0}
+	lot2 := &Lot{"lot2", tradeID, 2, 33334, SOURCE, 0}
+	lot1Bytes, _ := json.Marshal(lot1)
+	lot2Bytes, _ := json.Marshal(lot2)
+	checkState(t, stub, lot1Key, versionedAsset("Lot", lot1Bytes))
+	checkState(t, stub, lot2Key, versionedAsset("Lot", lot2Bytes))
+	lotsBytes, _ := json.Marshal([]*Lot{lot1, lot2})
+	checkQuery(t, stub, "getLots", tradeID, string(lotsBytes))
+
+	// Invoke 'prepareShipment' for the whole trade and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	shipmentLocationKey, _ := stub.CreateCompositeKey("Shipment", []string{"Location", tradeID})
+	checkNoState(t, stub, shipmentLocationKey)
+
+	// Invoke 'payLot' before the lot's B/L is issued and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("payLot"), []byte(tradeID), []byte("lot1")})
+
+	// Invoke 'acceptLotAndIssueBL' and verify that the B/L covers the lot's amount
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLotAndIssueBL"), []byte(tradeID), []byte("lot1"), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	var billOfLading *BillOfLading
+	lot1BLKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID, "lot1"})
+	json.Unmarshal(stub.State[lot1BLKey], &billOfLading)
+	if billOfLading == nil || billOfLading.Amount != lot1.Amount {
+		fmt.Println("B/L for lot1 not issued for the lot's amount")
+		t.FailNow()
+	}
+	checkQueryArgs(t, stub, [][]byte{[]byte("getBillOfLading"), []byte(tradeID), []byte("lot1")}, string(stub.State[lot1BLKey]))
+	lot1BLBytes := stub.State[lot1BLKey]
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptLotAndIssueBL"), []byte(tradeID), []byte("lot1"), []byte("bl06680"), []byte("9/30/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	checkState(t, stub, lot1BLKey, string(lot1BLBytes))
+
+	// Invoke 'payLot' at the source and on arrival, and verify the payments apportioned to the lot
+	checkInvoke(t, stub, [][]byte{[]byte("payLot"), []byte(tradeID), []byte("lot1")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("payLot"), []byte(tradeID), []byte("lot1")})
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + 8333))
+	lotPaymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "lot1-1"})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{"lot1-1", 8333, PAID, IMPBANK, EXPORTER, 0, 0, ""})
+	checkState(t, stub, lotPaymentKey, versionedAsset("Payment", paymentRequestBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("updateLotLocation"), []byte(tradeID), []byte("lot1"), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("payLot"), []byte(tradeID), []byte("lot1")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("payLot"), []byte(tradeID), []byte("lot1")})
+	lotPaymentKey, _ = stub.CreateCompositeKey("Payment", []string{tradeID, "lot1-2"})
+	paymentRequestBytes, _ = json.Marshal(&PaymentRequest{"lot1-2", lot1.Amount - 8333, PAID, IMPBANK, EXPORTER, 0, 0, ""})
+	checkState(t, stub, lotPaymentKey, versionedAsset("Payment", paymentRequestBytes))
+	lot1.Location = DESTINATION
+	lot1.Payment = lot1.Amount
+	lot1Bytes, _ = json.Marshal(lot1)
+	checkState(t, stub, lot1Key, versionedAsset("Lot", lot1Bytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + lot1.Amount))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount))
+
+	// Invoke 'surrenderBL' before the trade is paid in full and verify that no lot's B/L is surrendered
+	checkBadInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+	checkState(t, stub, lot1BLKey, string(lot1BLBytes))
+
+	// Ship and pay for the second lot and verify that the trade is paid in full
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLotAndIssueBL"), []byte(tradeID), []byte("lot2"), []byte("bl06679"), []byte("9/30/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	checkInvoke(t, stub, [][]byte{[]byte("updateLotLocation"), []byte(tradeID), []byte("lot2"), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("payLot"), []byte(tradeID), []byte("lot2")})
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount))
+	letterOfCredit = &LetterOfCredit{"lc8349", "12/31/2018", EXPORTER, amount, []string{"E/L", "B/L"}, ACCEPTED, "", "", false, false, false, "", "", 0, 0, amount, 0, true, nil}
+	letterOfCreditBytes, _ = json.Marshal(letterOfCredit)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+	tradeAgreement = &TradeAgreement{amount, "Wood for Toys", ACCEPTED, amount, nil, 3}
+	tradeAgreementBytes, _ = json.Marshal(tradeAgreement)
+	checkState(t, stub, tradeKey, versionedAsset("Trade", tradeAgreementBytes))
+
+	// Invoke 'surrenderBL', 'deliverShipment' and 'confirmReceipt' and verify that the B/Ls of all lots are surrendered and the trade completed
+	checkBadInvoke(t, stub, [][]byte{[]byte("deliverShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+	lot2BLKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID, "lot2"})
+	for _, blKey := range []string{lot1BLKey, lot2BLKey} {
+		billOfLading = nil
+		json.Unmarshal(stub.State[blKey], &billOfLading)
+		if billOfLading == nil || billOfLading.Status != SURRENDERED {
+			fmt.Println("B/L", blKey, "not surrendered")
+			t.FailNow()
+		}
+	}
+	checkInvoke(t, stub, [][]byte{[]byte("deliverShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("confirmReceipt"), []byte(tradeID)})
+	checkQuery(t, stub, "getTradeStatus", tradeID, "{\"Status\":\"COMPLETED\"}")
+
+	// An L/C that prohibits partial shipments only allows a single lot of the whole quantity
+	tradeID = "2ks89j10"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys"), []byte("3")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8350"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el980"), []byte("4/30/2019")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1"), []byte("1")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1"), []byte("3")})
+	lot1Key, _ = stub.CreateCompositeKey("Lot", []string{tradeID, "lot1"})
+	lot1Bytes, _ = json.Marshal(&Lot{"lot1", tradeID, 3, amount, SOURCE, 0})
+	checkState(t, stub, lot1Key, versionedAsset("Lot", lot1Bytes))
+}
+
+func TestTradeWorkflow_Fees(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Invoke bad 'setFeeSchedule' and verify no state change
+	feeScheduleKey, _ := stub.CreateCompositeKey("FeeSchedule", []string{IMPBANK})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("issueLC"), []byte("percentage"), []byte("100"), []byte("100")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("carrier"), []byte("issueLC"), []byte("percentage"), []byte("100"), []byte("100"), []byte("400"), []byte("applicant")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("amendLC"), []byte("percentage"), []byte("100"), []byte("100"), []byte("400"), []byte("applicant")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("issueLC"), []byte("tiered"), []byte("100"), []byte("100"), []byte("400"), []byte("applicant")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("issueLC"), []byte("percentage"), []byte("100"), []byte("500"), []byte("400"), []byte("applicant")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("issueLC"), []byte("percentage"), []byte("100"), []byte("100"), []byte("400"), []byte("carrier")})
+	checkNoState(t, stub, feeScheduleKey)
+
+	// Invoke 'setFeeSchedule' for both banks and verify the schedules
+	checkInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("issueLC"), []byte("percentage"), []byte("100"), []byte("100"), []byte("400"), []byte("applicant")})
+	checkInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("makePayment"), []byte("percentage"), []byte("10"), []byte("0"), []byte("0"), []byte("applicant")})
+	checkInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("exportersbank"), []byte("acceptLC"), []byte("flat"), []byte("250"), []byte("0"), []byte("0"), []byte("beneficiary")})
+	feeSchedule := &FeeSchedule{IMPBANK, map[string]*Fee{"issueLC": &Fee{PERCENTAGE_FEE, 100, 100, 400, APPLICANT}, "makePayment": &Fee{PERCENTAGE_FEE, 10, 0, 0, APPLICANT}}}
+	feeScheduleBytes, _ := json.Marshal(feeSchedule)
+	checkState(t, stub, feeScheduleKey, versionedAsset("FeeSchedule", feeScheduleBytes))
+	checkQuery(t, stub, "getFeeSchedule", IMPBANK, versionedAsset("FeeSchedule", feeScheduleBytes))
+
+	// Run a trade through to the first payment
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+
+	// Invoke 'issueLC' and verify that the issuance commission is capped at its maximum
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	impBankBalanceKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{IMPBANK})
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 400 - amount))
+	checkState(t, stub, impBankBalanceKey, strconv.Itoa(400))
+
+	// Invoke 'acceptLC' and verify that the exporter bears the flat fee of its bank
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	expBankBalanceKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{EXPBANK})
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE - 250))
+	checkState(t, stub, expBankBalanceKey, strconv.Itoa(250))
+
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke 'makePayment' and verify the payment commission on the amount paid
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 400 - amount - 25))
+	checkState(t, stub, impBankBalanceKey, strconv.Itoa(425))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE - 250 + amount/2))
+
+	// Verify the charges statement of the trade
+	var charges []*Charge
+	for i := 1; i <= 3; i++ {
+		var charge *Charge
+		chargeKey, _ := stub.CreateCompositeKey("Charge", []string{tradeID, fmt.Sprintf("%06d", i)})
+		json.Unmarshal(stub.State[chargeKey], &charge)
+		charges = append(charges, charge)
+	}
+	if charges[0] == nil || charges[1] == nil || charges[2] == nil {
+		fmt.Println("Charges for trade", tradeID, "not recorded")
+		t.FailNow()
+	}
+	expectedCharges := []*Charge{
+		&Charge{ISSUE_LC_ACTION, IMPBANK, 400, APPLICANT, charges[0].Date},
+		&Charge{ACCEPT_LC_ACTION, EXPBANK, 250, BENEFICIARY, charges[1].Date},
+		&Charge{MAKE_PAYMENT_ACTION, IMPBANK, 25, APPLICANT, charges[2].Date},
+	}
+	statementBytes, _ := json.Marshal(&ChargesStatement{tradeID, expectedCharges, 425, 250})
+	checkQuery(t, stub, "getCharges", tradeID, string(statementBytes))
+
+	// Remove the payment commission and verify that no further fee is charged
+	checkInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte("importersbank"), []byte("makePayment"), []byte("percentage"), []byte("0"), []byte("0"), []byte("0"), []byte("applicant")})
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 400 - amount - 25))
+	checkState(t, stub, impBankBalanceKey, strconv.Itoa(425))
+	checkQuery(t, stub, "getCharges", tradeID, string(statementBytes))
+}
+
+// Sign a hash with an ECDSA key, encoding the signature in ASN.1 DER
+func signECDSA(key *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ecdsaSignature{r, s})
+}
+
+func signFXRate(t *testing.T, key *ecdsa.PrivateKey, args []string) string {
+	signature, err := signECDSA(key, getFXRateMessage(args[0], args[1], args[2], args[3], args[4], args[5]))
+	if err != nil {
+		fmt.Println("Error signing rate", err)
+		t.FailNow()
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestTradeWorkflow_FXConversion(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	publisherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicKeyDER, _ := x509.MarshalPKIXPublicKey(&publisherKey.PublicKey)
+	publicKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// Invoke bad 'registerRatePublisher' and verify no state change
+	ratePublisherKey, _ := stub.CreateCompositeKey("RatePublisher", []string{"FXOracle"})
+	checkBadInvoke(t, stub, [][]byte{[]byte("registerRatePublisher"), []byte("FXOracle")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("registerRatePublisher"), []byte("FXOracle"), []byte("not a key")})
+	checkNoState(t, stub, ratePublisherKey)
+
+	checkInvoke(t, stub, [][]byte{[]byte("registerRatePublisher"), []byte("FXOracle"), []byte(publicKeyPEM)})
+	ratePublisherBytes, _ := json.Marshal(&RatePublisher{"FXOracle", publicKeyPEM, ACTIVE})
+	checkState(t, stub, ratePublisherKey, versionedAsset("RatePublisher", ratePublisherBytes))
+
+	// Invoke 'postFXRate' with bad rates and signatures and verify failure
+	validFrom := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	validUntil := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	rateArgs := []string{"FXOracle", "EUR", "USD", "1100000", validFrom, validUntil}
+	signature := signFXRate(t, publisherKey, rateArgs)
+	checkBadInvoke(t, stub, [][]byte{[]byte("postFXRate"), []byte("FXOracle"), []byte("EUR"), []byte("USD"), []byte("1100000"), []byte(validFrom), []byte(validUntil), []byte(signFXRate(t, otherKey, rateArgs))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("postFXRate"), []byte("FXOracle"), []byte("EUR"), []byte("USD"), []byte("1200000"), []byte(validFrom), []byte(validUntil), []byte(signature)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("postFXRate"), []byte("FXOracle"), []byte("EUR"), []byte("USD"), []byte("1100000"), []byte(validUntil), []byte(validFrom), []byte(signature)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("postFXRate"), []byte("Unknown"), []byte("EUR"), []byte("USD"), []byte("1100000"), []byte(validFrom), []byte(validUntil), []byte(signature)})
+	checkBadQuery(t, stub, "getFXRate", "EUR")
+
+	// Invoke 'postFXRate' and verify the rate
+	checkInvoke(t, stub, [][]byte{[]byte("postFXRate"), []byte("FXOracle"), []byte("EUR"), []byte("USD"), []byte("1100000"), []byte(validFrom), []byte(validUntil), []byte(signature)})
+	fxRateBytes, _ := json.Marshal(&FXRate{"FXOracle", "EUR", "USD", 1100000, validFrom, validUntil, signature})
+	fxRateKey, _ := stub.CreateCompositeKey("FXRate", []string{"EUR", "USD", validFrom})
+	checkState(t, stub, fxRateKey, versionedAsset("FXRate", fxRateBytes))
+	checkQueryArgs(t, stub, [][]byte{[]byte("getFXRate"), []byte("EUR"), []byte("USD")}, versionedAsset("FXRate", fxRateBytes))
+
+	// Invoke 'setAccountCurrency' for both accounts
+	checkBadInvoke(t, stub, [][]byte{[]byte("setAccountCurrency"), []byte("carrier"), []byte("EUR")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("setAccountCurrency"), []byte("exporter"), []byte("euro")})
+	checkInvoke(t, stub, [][]byte{[]byte("setAccountCurrency"), []byte("exporter"), []byte("EUR")})
+	checkInvoke(t, stub, [][]byte{[]byte("setAccountCurrency"), []byte("importer"), []byte("USD")})
+
+	// Run a trade through to the first payment and verify that the importer is debited in its own currency
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{"pr001", amount/2, PAID, IMPBANK, EXPORTER, 1100000, 27500, "USD"})
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "pr001"})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 55000))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount/2))
+
+	// Revoke the publisher and verify that payments cannot be converted without a trusted rate
+	checkInvoke(t, stub, [][]byte{[]byte("revokeRatePublisher"), []byte("FXOracle")})
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 55000))
+
+	// Register a new key and post the rate quoted the other way round, then verify the inverted conversion
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicKeyDER, _ = x509.MarshalPKIXPublicKey(&newKey.PublicKey)
+	publicKeyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+	checkInvoke(t, stub, [][]byte{[]byte("registerRatePublisher"), []byte("FXOracle"), []byte(publicKeyPEM)})
+	rateArgs = []string{"FXOracle", "USD", "EUR", "800000", validFrom, validUntil}
+	checkInvoke(t, stub, [][]byte{[]byte("postFXRate"), []byte("FXOracle"), []byte("USD"), []byte("EUR"), []byte("800000"), []byte(validFrom), []byte(validUntil), []byte(signFXRate(t, newKey, rateArgs))})
+
+	// Charge a fee on the payment to the importer and verify that it is also debited in the importer's currency
+	checkInvoke(t, stub, [][]byte{[]byte("setFeeSchedule"), []byte(IMPORTERS_BANK_PARTY), []byte(MAKE_PAYMENT_ACTION), []byte(FLAT_FEE), []byte("400"), []byte("0"), []byte("0"), []byte(APPLICANT)})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	paymentRequestBytes, _ = json.Marshal(&PaymentRequest{"pr002", amount/2, PAID, IMPBANK, EXPORTER, 1250000, 31250, "USD"})
+	paymentKey, _ = stub.CreateCompositeKey("Payment", []string{tradeID, "pr002"})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+	impBankBalanceKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{IMPBANK})
+	checkState(t, stub, impBankBalanceKey, "400")
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 27500 - 31250 - 500))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount))
+
+	// Settle a dispute with a refund and verify that the importer is credited in its own currency
+	checkInvoke(t, stub, [][]byte{[]byte("raiseDispute"), []byte(tradeID), []byte("d001"), []byte("importer"), []byte(GOODS_DAMAGED)})
+	checkInvoke(t, stub, [][]byte{[]byte("decideDispute"), []byte(tradeID), []byte("d001"), []byte("1000")})
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 27500 - 31250 - 500 + 1250))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount - 1000))
+}
+
+func TestTradeWorkflow_ReceivablesFinancing(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+
+	// Invoke 'issueInvoice' before the B/L is issued and verify failure
+	invoiceKey, _ := stub.CreateCompositeKey("Invoice", []string{tradeID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueInvoice"), []byte(tradeID), []byte("inv001")})
+	checkNoState(t, stub, invoiceKey)
+
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke 'issueInvoice' and verify that the invoice is for the amount still payable under the L/C
+	checkInvoke(t, stub, [][]byte{[]byte("issueInvoice"), []byte(tradeID), []byte("inv001")})
+	var invoice *Invoice
+	json.Unmarshal(stub.State[invoiceKey], &invoice)
+	if invoice == nil {
+		fmt.Println("Invoice for trade", tradeID, "not issued")
+		t.FailNow()
+	}
+	expectedInvoice := &Invoice{"inv001", tradeID, EXPORTER, IMPORTER, "Wood for Toys", amount/2, invoice.IssueDate, 0, "", 0, "", 0, ISSUED}
+	invoiceBytes, _ := json.Marshal(expectedInvoice)
+	checkState(t, stub, invoiceKey, versionedAsset("Invoice", invoiceBytes))
+	checkQuery(t, stub, "getInvoice", tradeID, versionedAsset("Invoice", invoiceBytes))
+
+	// Invoke 'financeReceivable' before it is offered, and bad 'offerReceivable', and verify no state change
+	checkBadInvoke(t, stub, [][]byte{[]byte("financeReceivable"), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("offerReceivable"), []byte(tradeID), []byte("0")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("offerReceivable"), []byte(tradeID), []byte(strconv.Itoa(amount))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("offerReceivable"), []byte("unknown"), []byte("24000")})
+	checkState(t, stub, invoiceKey, versionedAsset("Invoice", invoiceBytes))
+
+	// Invoke 'financeReceivable' by an unregistered financier, or one without the funds, and verify no state change
+	checkInvoke(t, stub, [][]byte{[]byte("offerReceivable"), []byte(tradeID), []byte("24000")})
+	expectedInvoice.AskingPrice = 24000
+	expectedInvoice.Status = OFFERED
+	invoiceBytes, _ = json.Marshal(expectedInvoice)
+	checkBadInvoke(t, stub, [][]byte{[]byte("financeReceivable"), []byte(tradeID), []byte("FactorCo")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("financeReceivable"), []byte(tradeID)})
+	checkState(t, stub, invoiceKey, versionedAsset("Invoice", invoiceBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount/2))
+
+	// Invoke 'financeReceivable' once the exporter's bank has the funds and verify that the exporter is paid the asking price
+	bankBalanceKey, _ := stub.CreateCompositeKey("BankAccountBalance", []string{EXPBANK})
+	putState(stub, bankBalanceKey, []byte("30000"))
+	checkInvoke(t, stub, [][]byte{[]byte("financeReceivable"), []byte(tradeID), []byte("exportersbank")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("financeReceivable"), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("offerReceivable"), []byte(tradeID), []byte("23000")})
+	invoice = nil
+	json.Unmarshal(stub.State[invoiceKey], &invoice)
+	expectedInvoice.Financier = EXPBANK
+	expectedInvoice.PurchasePrice = 24000
+	expectedInvoice.AssignmentDate = invoice.AssignmentDate
+	expectedInvoice.Status = FINANCED
+	invoiceBytes, _ = json.Marshal(expectedInvoice)
+	checkState(t, stub, invoiceKey, versionedAsset("Invoice", invoiceBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount/2 + 24000))
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(30000 - 24000))
+
+	// Invoke 'makePayment' on arrival and verify that the proceeds are redirected to the financier
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	paymentRequestBytes, _ := json.Marshal(&PaymentRequest{"pr002", amount/2, PAID, IMPBANK, EXPBANK, 0, 0, ""})
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "pr002"})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentRequestBytes))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount/2 + 24000))
+	checkState(t, stub, bankBalanceKey, strconv.Itoa(30000 - 24000 + amount/2))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount))
+	expectedInvoice.Repaid = amount/2
+	expectedInvoice.Status = REPAID
+	invoiceBytes, _ = json.Marshal(expectedInvoice)
+	checkState(t, stub, invoiceKey, versionedAsset("Invoice", invoiceBytes))
+}
+
+// Minimal fungible-token chaincode holding balances by account name
+type tokenChaincode struct {
+}
+
+func (c *tokenChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	for i := 0; i+1 < len(args); i += 2 {
+		stub.PutState(args[i], []byte(args[i+1]))
+	}
+	return shim.Success(nil)
+}
+
+func (c *tokenChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function == "balanceOf" && len(args) == 1 {
+		balanceBytes, _ := stub.GetState(args[0])
+		if len(balanceBytes) == 0 {
+			balanceBytes = []byte("0")
+		}
+		return shim.Success(balanceBytes)
+	}
+	if function == "transfer" && len(args) == 3 {
+		amount, err := strconv.Atoi(args[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fromBytes, _ := stub.GetState(args[0])
+		toBytes, _ := stub.GetState(args[1])
+		fromBal, _ := strconv.Atoi(string(fromBytes))
+		toBal, _ := strconv.Atoi(string(toBytes))
+		if fromBal < amount {
+			return shim.Error("Insufficient tokens")
+		}
+		stub.PutState(args[0], []byte(strconv.Itoa(fromBal - amount)))
+		stub.PutState(args[1], []byte(strconv.Itoa(toBal + amount)))
+		return shim.Success(nil)
+	}
+	return shim.Error("Invalid token function " + function)
+}
+
+func TestTradeWorkflow_TokenSettlement(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	tokenStub := shim.NewMockStub("Token", new(tokenChaincode))
+	checkInit(t, tokenStub, [][]byte{[]byte("init"), []byte(EXPORTER), []byte("1000"), []byte(IMPORTER), []byte("60000")})
+	stub.MockPeerChaincode("token/trade", tokenStub)
+
+	// Init with the funds held by the token chaincode
+	initArgs := append(getInitArguments(), []byte(TOKEN_CHAINCODE_SETTING + "=token/trade"))
+	checkInit(t, stub, initArgs)
+	settingKey, _ := stub.CreateCompositeKey("Setting", []string{TOKEN_CHAINCODE_SETTING})
+	checkState(t, stub, settingKey, "token/trade")
+	checkQueryArgs(t, stub, [][]byte{[]byte("getAccountBalance"), []byte("2ks89j9"), []byte("importer")}, "{\"Balance\":\"60000\"}")
+
+	// Run a trade through to the first payment and verify that it is settled in tokens
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	checkState(t, tokenStub, IMPORTER, strconv.Itoa(60000 - amount))
+	checkState(t, tokenStub, "escrow:" + tradeID, strconv.Itoa(amount/2))
+	checkState(t, tokenStub, EXPORTER, strconv.Itoa(1000 + amount/2))
+	checkQueryArgs(t, stub, [][]byte{[]byte("getAccountBalance"), []byte(tradeID), []byte("exporter")}, "{\"Balance\":\"" + strconv.Itoa(1000 + amount/2) + "\"}")
+
+	// The ledger balances are left untouched
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE))
+
+	// A payment the token chaincode refuses leaves the trade unpaid
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	tokenStub.MockInvoke("1", [][]byte{[]byte("transfer"), []byte("escrow:" + tradeID), []byte("Elsewhere"), []byte("20000")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	checkState(t, tokenStub, EXPORTER, strconv.Itoa(1000 + amount/2))
+}
+
+func TestTradeWorkflow_Escrow(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init with a bad margin and verify failure
+	checkBadInit(t, shim.NewMockStub("Trade Workflow", scc), append(getInitArguments(), []byte(ESCROW_MARGIN_SETTING + "=150")))
+
+	// Init with 40% of the L/C amount escrowed
+	checkInit(t, stub, append(getInitArguments(), []byte(ESCROW_MARGIN_SETTING + "=40")))
+
+	// Invoke 'issueLC' beyond the applicant's means and verify failure
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte("big001"), []byte(strconv.Itoa(IMPBALANCE * 3)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte("big001")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte("big001")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte("big001"), []byte("lc0001"), []byte("12/31/2099"), []byte("E/L"), []byte("B/L")})
+	bigEscrowKey, _ := stub.CreateCompositeKey("Escrow", []string{"big001"})
+	checkNoState(t, stub, bigEscrowKey)
+
+	// Invoke 'issueLC' and verify that the margin is escrowed
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2099"), []byte("E/L"), []byte("B/L")})
+	escrow := &Escrow{tradeID, "lc8349", 40, 20000, 20000, ACTIVE}
+	escrowBytes, _ := json.Marshal(escrow)
+	escrowKey, _ := stub.CreateCompositeKey("Escrow", []string{tradeID})
+	escrowBalanceKey, _ := stub.CreateCompositeKey("EscrowAccountBalance", []string{tradeID})
+	checkState(t, stub, escrowKey, versionedAsset("Escrow", escrowBytes))
+	checkQuery(t, stub, "getEscrow", tradeID, versionedAsset("Escrow", escrowBytes))
+	checkState(t, stub, escrowBalanceKey, "20000")
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - 20000))
+
+	// Invoke 'expireLC' before the expiry date and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("expireLC"), []byte(tradeID)})
+
+	// Invoke 'makePayment' and verify that it draws on escrow before the applicant's account
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	escrow.Balance = 0
+	escrowBytes, _ = json.Marshal(escrow)
+	checkState(t, stub, escrowKey, versionedAsset("Escrow", escrowBytes))
+	checkState(t, stub, escrowBalanceKey, "0")
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount/2))
+	checkState(t, stub, expBalKey, strconv.Itoa(EXPBALANCE + amount/2))
+
+	// Invoke 'cancelLC' on an issued L/C and verify that the escrow is released
+	cancelledTradeID := "cx7d1"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(cancelledTradeID), []byte("30000"), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(cancelledTradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(cancelledTradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(cancelledTradeID), []byte("lc8350"), []byte("12/31/2099"), []byte("E/L"), []byte("B/L")})
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount/2 - 12000))
+	checkInvoke(t, stub, [][]byte{[]byte("cancelLC"), []byte(cancelledTradeID)})
+	cancelledEscrowKey, _ := stub.CreateCompositeKey("Escrow", []string{cancelledTradeID})
+	escrowBytes, _ = json.Marshal(&Escrow{cancelledTradeID, "lc8350", 40, 12000, 0, RELEASED})
+	checkState(t, stub, cancelledEscrowKey, versionedAsset("Escrow", escrowBytes))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount/2))
+
+	// Invoke 'expireLC' on a lapsed L/C and verify that the escrow is released and the L/C can no longer be used
+	expiredTradeID := "ex5e2"
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(expiredTradeID), []byte("10000"), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(expiredTradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(expiredTradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(expiredTradeID), []byte("lc8351"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount/2 - 4000))
+	checkInvoke(t, stub, [][]byte{[]byte("expireLC"), []byte(expiredTradeID)})
+	expiredEscrowKey, _ := stub.CreateCompositeKey("Escrow", []string{expiredTradeID})
+	escrowBytes, _ = json.Marshal(&Escrow{expiredTradeID, "lc8351", 40, 4000, 0, RELEASED})
+	checkState(t, stub, expiredEscrowKey, versionedAsset("Escrow", escrowBytes))
+	checkState(t, stub, impBalKey, strconv.Itoa(IMPBALANCE - amount/2))
+	expiredLCKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{expiredTradeID})
+	letterOfCreditBytes, _ := json.Marshal(&LetterOfCredit{"lc8351", "12/31/2018", EXPORTER, 10000, []string{"E/L", "B/L"}, EXPIRED, "", "", false, false, false, "", "", 0, 0, 0, 0, false, nil})
+	checkState(t, stub, expiredLCKey, versionedAsset("LetterOfCredit", letterOfCreditBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("expireLC"), []byte(expiredTradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(expiredTradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("cancelLC"), []byte(expiredTradeID)})
+}
+
+func TestTradeWorkflow_InsuranceCertificate(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init with an insurer
+	insurer := "MarineAssurance"
+	checkInit(t, stub, append(getInitArguments(), []byte(insurer)))
+	checkState(t, stub, "Insurer", insurer)
+	if !authenticateInsurerOrg(stub, "InsurerOrgMSP", "ca.insurerorg.trade.com") {
+		fmt.Println("Insurer named in init not authenticated as a member of InsurerOrg")
+		t.FailNow()
+	}
+
+	// Invoke bad 'registerInsurer' and verify unchanged state
+	checkBadInvoke(t, stub, [][]byte{[]byte("registerInsurer"), []byte(insurer), []byte("MarineOrgMSP")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("registerInsurer"), []byte(insurer), []byte(""), []byte("ca.marineorg.trade.com")})
+	checkState(t, stub, "Insurer", insurer)
+	checkNoState(t, stub, "InsurerMSP")
+
+	// Invoke 'registerInsurer' and verify that the insurer's organization is the registered one
+	insurer = "MarineAssurance"
+	checkInvoke(t, stub, [][]byte{[]byte("registerInsurer"), []byte(insurer), []byte("MarineOrgMSP"), []byte("ca.marineorg.trade.com")})
+	checkState(t, stub, "Insurer", insurer)
+	checkState(t, stub, "InsurerMSP", "MarineOrgMSP")
+	checkState(t, stub, "InsurerCA", "ca.marineorg.trade.com")
+	if !authenticateInsurerOrg(stub, "MarineOrgMSP", "ca.marineorg.trade.com") || authenticateInsurerOrg(stub, "InsurerOrgMSP", "ca.insurerorg.trade.com") {
+		fmt.Println("Registered insurer's organization not authenticated in place of InsurerOrg")
+		t.FailNow()
+	}
+
+	// Request an L/C calling for an insurance certificate and a certificate of origin
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L"), []byte("I/C"), []byte("C/O")})
+	presentationBytes, _ := json.Marshal(&Presentation{tradeID, []string{}, []string{"E/L", "B/L", "I/C"}, []string{"C/O"}})
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(presentationBytes))
+
+	// Ship the goods and verify that payment cannot be requested without the insurance certificate
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	presentationBytes, _ = json.Marshal(&Presentation{tradeID, []string{"E/L", "B/L"}, []string{"I/C"}, []string{"C/O"}})
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(presentationBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke bad 'issueInsuranceCertificate' and verify no state
+	validFrom := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	validUntil := time.Now().UTC().AddDate(1, 0, 0).Format(time.RFC3339)
+	insuranceCertificateKey, _ := stub.CreateCompositeKey("InsuranceCertificate", []string{tradeID})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueInsuranceCertificate"), []byte(tradeID), []byte("ic001"), []byte("POL-77"), []byte("0"), []byte("ICC(A)"), []byte(validFrom), []byte(validUntil)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueInsuranceCertificate"), []byte(tradeID), []byte("ic001"), []byte("POL-77"), []byte("55000"), []byte("ICC(A)"), []byte(validUntil), []byte(validFrom)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueInsuranceCertificate"), []byte("unknown"), []byte("ic001"), []byte("POL-77"), []byte("55000"), []byte("ICC(A)"), []byte(validFrom), []byte(validUntil)})
+	checkNoState(t, stub, insuranceCertificateKey)
+
+	// Invoke 'issueInsuranceCertificate' and verify the certificate and the presentation
+	checkInvoke(t, stub, [][]byte{[]byte("issueInsuranceCertificate"), []byte(tradeID), []byte("ic001"), []byte("POL-77"), []byte("55000"), []byte("ICC(A)"), []byte(validFrom), []byte(validUntil)})
+	insuranceCertificate := &InsuranceCertificate{"ic001", tradeID, insurer, "POL-77", 55000, "ICC(A)", validFrom, validUntil, 0, "", ISSUED}
+	insuranceCertificateBytes, _ := json.Marshal(insuranceCertificate)
+	checkState(t, stub, insuranceCertificateKey, versionedAsset("InsuranceCertificate", insuranceCertificateBytes))
+	checkQuery(t, stub, "getInsuranceCertificate", tradeID, versionedAsset("InsuranceCertificate", insuranceCertificateBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueInsuranceCertificate"), []byte(tradeID), []byte("ic002"), []byte("POL-77"), []byte("55000"), []byte("ICC(A)"), []byte(validFrom), []byte(validUntil)})
+	presentationBytes, _ = json.Marshal(&Presentation{tradeID, []string{"E/L", "B/L", "I/C"}, []string{}, []string{"C/O"}})
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(presentationBytes))
+
+	// Verify that an expired certificate, or one not yet in force when the B/L was issued, is not presented
+	missingBytes, _ := json.Marshal(&Presentation{tradeID, []string{"E/L", "B/L"}, []string{"I/C"}, []string{"C/O"}})
+	expiredCertificate := *insuranceCertificate
+	expiredCertificate.ValidFrom = time.Now().UTC().AddDate(0, 0, -2).Format(time.RFC3339)
+	expiredCertificate.ValidUntil = time.Now().UTC().AddDate(0, 0, -1).Format(time.RFC3339)
+	expiredCertificateBytes, _ := json.Marshal(&expiredCertificate)
+	putState(stub, insuranceCertificateKey, []byte(versionedAsset("InsuranceCertificate", expiredCertificateBytes)))
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(missingBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	lateCertificate := *insuranceCertificate
+	lateCertificate.ValidFrom = time.Now().UTC().Add(time.Minute).Format(time.RFC3339)
+	lateCertificateBytes, _ := json.Marshal(&lateCertificate)
+	putState(stub, insuranceCertificateKey, []byte(versionedAsset("InsuranceCertificate", lateCertificateBytes)))
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(missingBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	putState(stub, insuranceCertificateKey, []byte(versionedAsset("InsuranceCertificate", insuranceCertificateBytes)))
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(presentationBytes))
+
+	// Invoke 'raiseInsuranceClaim' before delivery and verify failure
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseInsuranceClaim"), []byte(tradeID), []byte("5000"), []byte("Water damage")})
+
+	// Pay for and deliver the goods, and report them damaged
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("deliverShipment"), []byte(tradeID)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseInsuranceClaim"), []byte(tradeID), []byte("5000"), []byte("Water damage")})
+	checkInvoke(t, stub, [][]byte{[]byte("confirmReceipt"), []byte(tradeID), []byte(DAMAGED), []byte("3 crates water-damaged")})
+
+	// Invoke bad 'raiseInsuranceClaim' and verify unchanged state
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseInsuranceClaim"), []byte(tradeID), []byte("55001"), []byte("Water damage")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseInsuranceClaim"), []byte(tradeID), []byte("0"), []byte("Water damage")})
+	checkState(t, stub, insuranceCertificateKey, versionedAsset("InsuranceCertificate", insuranceCertificateBytes))
+
+	// Invoke 'raiseInsuranceClaim' and verify state change
+	checkInvoke(t, stub, [][]byte{[]byte("raiseInsuranceClaim"), []byte(tradeID), []byte("5000"), []byte("Water damage")})
+	insuranceCertificate.ClaimAmount = 5000
+	insuranceCertificate.ClaimReason = "Water damage"
+	insuranceCertificate.Status = CLAIMED
+	insuranceCertificateBytes, _ = json.Marshal(insuranceCertificate)
+	checkState(t, stub, insuranceCertificateKey, versionedAsset("InsuranceCertificate", insuranceCertificateBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("raiseInsuranceClaim"), []byte(tradeID), []byte("1000"), []byte("Water damage")})
+}
+
+func checkTradeCertificate(t *testing.T, stub *shim.MockStub, tradeCertificate *TradeCertificate, issuedAfter time.Time) {
+	tradeCertificateKey, _ := stub.CreateCompositeKey("TradeCertificate", []string{tradeCertificate.TradeId, tradeCertificate.Id})
+	value, _ := upgradeAssetState(stub, tradeCertificateKey, stub.State[tradeCertificateKey])
+	var stored *TradeCertificate
+	err := json.Unmarshal(value, &stored)
+	if err != nil {
+		fmt.Println("Certificate", tradeCertificate.Id, "not found")
+		t.FailNow()
+	}
+	issueDate, err := time.Parse(time.RFC3339, stored.IssueDate)
+	if err != nil || issueDate.Before(issuedAfter.Truncate(time.Second)) || issueDate.After(time.Now()) {
+		fmt.Println("Certificate", tradeCertificate.Id, "issued at", stored.IssueDate, "and not after", issuedAfter)
+		t.FailNow()
+	}
+	tradeCertificate.IssueDate = stored.IssueDate
+	tradeCertificateBytes, _ := json.Marshal(tradeCertificate)
+	checkState(t, stub, tradeCertificateKey, versionedAsset("TradeCertificate", tradeCertificateBytes))
+}
+
+func TestTradeWorkflow_ThirdPartyCertificates(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Invoke bad 'registerCertificateIssuer' and verify no state
+	checkBadInvoke(t, stub, [][]byte{[]byte("registerCertificateIssuer"), []byte("chamber"), []byte("ChamberOrgMSP"), []byte("ca.chamberorg.trade.com")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("registerCertificateIssuer"), []byte("chamber"), []byte("ChamberOrgMSP"), []byte("ca.chamberorg.trade.com"), []byte("B/L")})
+	chamberKey, _ := stub.CreateCompositeKey("CertificateIssuer", []string{"chamber"})
+	checkNoState(t, stub, chamberKey)
+
+	// Invoke 'registerCertificateIssuer' for a chamber of commerce and an inspection agency
+	checkInvoke(t, stub, [][]byte{[]byte("registerCertificateIssuer"), []byte("chamber"), []byte("ChamberOrgMSP"), []byte("ca.chamberorg.trade.com"), []byte("C/O")})
+	checkInvoke(t, stub, [][]byte{[]byte("registerCertificateIssuer"), []byte("inspector"), []byte("InspectorOrgMSP"), []byte("ca.inspectororg.trade.com"), []byte("Q/C"), []byte("P/C")})
+	chamberBytes, _ := json.Marshal(&CertificateIssuer{"chamber", "ChamberOrgMSP", "ca.chamberorg.trade.com", []string{"C/O"}, ACTIVE})
+	checkState(t, stub, chamberKey, versionedAsset("CertificateIssuer", chamberBytes))
+
+	// Request an L/C calling for a certificate of origin and a quality certificate
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L"), []byte("C/O"), []byte("Q/C"), []byte("F/C")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	presentationBytes, _ := json.Marshal(&Presentation{tradeID, []string{"E/L", "B/L"}, []string{"C/O", "Q/C"}, []string{"F/C"}})
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(presentationBytes))
+	checkQuery(t, stub, "getCertificates", tradeID, "[]")
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke bad 'issueCertificate' and verify no state
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	originKey, _ := stub.CreateCompositeKey("TradeCertificate", []string{tradeID, "co001"})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("co001"), []byte("inspector"), []byte("C/O"), []byte(hash)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("co001"), []byte("chamber"), []byte("C/O"), []byte("not-a-hash")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte("unknown"), []byte("co001"), []byte("chamber"), []byte("C/O"), []byte(hash)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("co001"), []byte("customs"), []byte("C/O"), []byte(hash)})
+	checkNoState(t, stub, originKey)
+
+	// Invoke 'issueCertificate' for the certificate of origin and verify that payment still cannot be requested
+	issuedAfter := time.Now()
+	checkInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("co001"), []byte("chamber"), []byte("C/O"), []byte(hash)})
+	origin := &TradeCertificate{"co001", tradeID, "C/O", "chamber", hash, "", ISSUED}
+	checkTradeCertificate(t, stub, origin, issuedAfter)
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("co001"), []byte("chamber"), []byte("C/O"), []byte(hash)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+
+	// Invoke 'issueCertificate' for the quality certificate, revoke it, and verify that payment cannot be requested
+	checkInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("qc001"), []byte("inspector"), []byte("Q/C"), []byte(hash)})
+	quality := &TradeCertificate{"qc001", tradeID, "Q/C", "inspector", hash, "", ISSUED}
+	checkTradeCertificate(t, stub, quality, issuedAfter)
+	presentationBytes, _ = json.Marshal(&Presentation{tradeID, []string{"E/L", "B/L", "C/O", "Q/C"}, []string{}, []string{"F/C"}})
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(presentationBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("revokeCertificate"), []byte(tradeID), []byte("qc999")})
+	checkInvoke(t, stub, [][]byte{[]byte("revokeCertificate"), []byte(tradeID), []byte("qc001")})
+	quality.Status = REVOKED
+	checkTradeCertificate(t, stub, quality, issuedAfter)
+	presentationBytes, _ = json.Marshal(&Presentation{tradeID, []string{"E/L", "B/L", "C/O"}, []string{"Q/C"}, []string{"F/C"}})
+	checkQuery(t, stub, "getDocumentPresentation", tradeID, string(presentationBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+
+	// Revoke the inspection agency and verify that it can no longer issue certificates
+	checkInvoke(t, stub, [][]byte{[]byte("revokeCertificateIssuer"), []byte("inspector")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("qc002"), []byte("inspector"), []byte("Q/C"), []byte(hash)})
+	checkBadInvoke(t, stub, [][]byte{[]byte("revokeCertificateIssuer"), []byte("unknown")})
+
+	// Register a new inspection agency, issue a fresh quality certificate and verify that payment can be requested
+	checkInvoke(t, stub, [][]byte{[]byte("registerCertificateIssuer"), []byte("surveyor"), []byte("SurveyorOrgMSP"), []byte("ca.surveyororg.trade.com"), []byte("Q/C")})
+	checkInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("qc002"), []byte("surveyor"), []byte("Q/C"), []byte(hash)})
+	replacement := &TradeCertificate{"qc002", tradeID, "Q/C", "surveyor", hash, "", ISSUED}
+	checkTradeCertificate(t, stub, replacement, issuedAfter)
+	tradeCertificatesBytes, _ := json.Marshal([]*TradeCertificate{origin, quality, replacement})
+	checkQuery(t, stub, "getCertificates", tradeID, string(tradeCertificatesBytes))
+
+	// Verify that a required certificate type blocks payment until it is certified, whether or not an issuer is registered for it
+	presentationBytes, _ = json.Marshal(&Presentation{tradeID, []string{"E/L", "B/L", "C/O", "Q/C"}, []string{"F/C", "P/C"}, []string{}})
+	checkQueryArgs(t, stub, [][]byte{[]byte("getDocumentPresentation"), []byte(tradeID), []byte("Require=F/C,P/C")}, string(presentationBytes))
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001"), []byte("Require=F/C")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001"), []byte("Require=P/C")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001"), []byte("Require=B/L")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001"), []byte("Require=")})
+	paymentKey, _ := stub.CreateCompositeKey("Payment", []string{tradeID, "pr001"})
+	checkNoState(t, stub, paymentKey)
+
+	// Invoke 'requestPayment' requiring certified types and verify that payment can be requested
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001"), []byte("Require=C/O,Q/C")})
+	paymentBytes, _ := json.Marshal(&PaymentRequest{"pr001", amount/2, REQUESTED, "", "", 0, 0, ""})
+	checkState(t, stub, paymentKey, versionedAsset("Payment", paymentBytes))
+}
+
+func TestTradeWorkflow_DocumentAnchoring(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Issue the L/C and the E/L for a trade
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+	lcHash := fmt.Sprintf("%064x", 1)
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte(lcHash), []byte("application/pdf"), []byte("https://docs.toybank.com/lc8349.pdf")})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	elHash := fmt.Sprintf("%064x", 2)
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("E/L"), []byte(elHash), []byte("application/pdf"), []byte("https://docs.forestry.gov/el979.pdf")})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+
+	// Invoke bad 'anchorDocument' and verify no state
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte("not-a-hash"), []byte("application/pdf"), []byte("https://docs.toybank.com/lc8349.pdf")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte(lcHash), []byte("pdf;"), []byte("https://docs.toybank.com/lc8349.pdf")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte(lcHash), []byte("application/pdf"), []byte("lc8349.pdf")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("B/L"), []byte(lcHash), []byte("application/pdf"), []byte("https://docs.freight.com/bl06678.pdf")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte("unknown"), []byte("Packing List"), []byte(lcHash), []byte("application/pdf"), []byte("https://docs.lumberinc.com/pl.pdf")})
+	lcAnchorKey, _ := stub.CreateCompositeKey("DocumentAnchor", []string{lcHash, tradeID, "LetterOfCredit", "lc8349"})
+	checkNoState(t, stub, lcAnchorKey)
+	checkBadQuery(t, stub, "verifyDocument", lcHash)
+
+	// Invoke 'anchorDocument' for the L/C, the E/L and a packing list, and verify state
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte(strings.ToUpper(lcHash)), []byte("application/pdf"), []byte("https://docs.toybank.com/lc8349.pdf")})
+	lcContent := &DocumentContent{lcHash, "application/pdf", "https://docs.toybank.com/lc8349.pdf"}
+	expectedLC := &LetterOfCredit{"lc8349", "12/31/2018", EXPORTER, amount, []string{"E/L", "B/L"}, ACCEPTED, "", "", false, false, false, "", "", 0, 0, 0, 0, false, lcContent}
+	expectedLCBytes, _ := json.Marshal(expectedLC)
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", expectedLCBytes))
+	lcAnchorBytes, _ := json.Marshal(&DocumentAnchor{tradeID, "LetterOfCredit", "L/C", "lc8349", lcContent, ""})
+	checkState(t, stub, lcAnchorKey, versionedAsset("DocumentAnchor", lcAnchorBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("E/L"), []byte(elHash), []byte("application/pdf"), []byte("https://docs.forestry.gov/el979.pdf")})
+	plHash := fmt.Sprintf("%064x", 3)
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("Packing List"), []byte(plHash), []byte("text/csv; charset=utf-8"), []byte("https://docs.lumberinc.com/pl.csv")})
+	attachmentKey, _ := stub.CreateCompositeKey("Attachment", []string{tradeID, "Packing List"})
+	attachmentBytes, _ := json.Marshal(&Attachment{tradeID, "Packing List", &DocumentContent{plHash, "text/csv; charset=utf-8", "https://docs.lumberinc.com/pl.csv"}})
+	checkState(t, stub, attachmentKey, versionedAsset("Attachment", attachmentBytes))
+
+	// Query 'verifyDocument' and verify the documents stand
+	verificationsBytes, _ := json.Marshal([]*DocumentVerification{{lcHash, tradeID, "L/C", "lc8349", "application/pdf", "https://docs.toybank.com/lc8349.pdf", ACCEPTED, true}})
+	checkQuery(t, stub, "verifyDocument", strings.ToUpper(lcHash), string(verificationsBytes))
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{elHash, tradeID, "E/L", "el979", "application/pdf", "https://docs.forestry.gov/el979.pdf", ISSUED, true}})
+	checkQuery(t, stub, "verifyDocument", elHash, string(verificationsBytes))
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{plHash, tradeID, "Packing List", "Packing List", "text/csv; charset=utf-8", "https://docs.lumberinc.com/pl.csv", "", true}})
+	checkQuery(t, stub, "verifyDocument", plHash, string(verificationsBytes))
+
+	// Replace the packing list and verify that the earlier file is superseded
+	revisedHash := fmt.Sprintf("%064x", 4)
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("Packing List"), []byte(revisedHash), []byte("application/pdf"), []byte("https://docs.lumberinc.com/pl-rev1.pdf")})
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{plHash, tradeID, "Packing List", "Packing List", "text/csv; charset=utf-8", "https://docs.lumberinc.com/pl.csv", SUPERSEDED, false}})
+	checkQuery(t, stub, "verifyDocument", plHash, string(verificationsBytes))
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{revisedHash, tradeID, "Packing List", "Packing List", "application/pdf", "https://docs.lumberinc.com/pl-rev1.pdf", "", true}})
+	checkQuery(t, stub, "verifyDocument", revisedHash, string(verificationsBytes))
+
+	// Ship the goods, anchor the B/L, and verify that it no longer stands once surrendered
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+	blHash := fmt.Sprintf("%064x", 5)
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("B/L"), []byte(blHash), []byte("application/pdf"), []byte("https://docs.freight.com/bl06678.pdf")})
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{blHash, tradeID, "B/L", "bl06678", "application/pdf", "https://docs.freight.com/bl06678.pdf", ISSUED, true}})
+	checkQuery(t, stub, "verifyDocument", blHash, string(verificationsBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr002")})
+	checkInvoke(t, stub, [][]byte{[]byte("surrenderBL"), []byte(tradeID)})
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{blHash, tradeID, "B/L", "bl06678", "application/pdf", "https://docs.freight.com/bl06678.pdf", SURRENDERED, false}})
+	checkQuery(t, stub, "verifyDocument", blHash, string(verificationsBytes))
+
+	// Issue and revoke a third-party certificate and verify its document
+	coHash := fmt.Sprintf("%064x", 6)
+	checkInvoke(t, stub, [][]byte{[]byte("registerCertificateIssuer"), []byte("chamber"), []byte("ChamberOrgMSP"), []byte("ca.chamberorg.trade.com"), []byte("C/O")})
+	checkInvoke(t, stub, [][]byte{[]byte("issueCertificate"), []byte(tradeID), []byte("co001"), []byte("chamber"), []byte("C/O"), []byte(coHash)})
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{coHash, tradeID, "C/O", "co001", "", "", ISSUED, true}})
+	checkQuery(t, stub, "verifyDocument", coHash, string(verificationsBytes))
+	checkInvoke(t, stub, [][]byte{[]byte("revokeCertificate"), []byte(tradeID), []byte("co001")})
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{coHash, tradeID, "C/O", "co001", "", "", REVOKED, false}})
+	checkQuery(t, stub, "verifyDocument", coHash, string(verificationsBytes))
+}
+
+func TestTradeWorkflow_DocumentAnchoringLotsAndChildLCs(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init
+	checkInit(t, stub, getInitArguments())
+
+	// Issue a transferable L/C allowing partial shipments, a back-to-back L/C against it, and the B/L of a lot
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys"), []byte("3")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID), []byte(""), []byte(""), []byte("true"), []byte("0"), []byte("true")})
+	checkInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueBackToBackLC"), []byte(tradeID), []byte("lc8349-b1"), []byte("TimberYard"), []byte("30000"), []byte("11/30/2018"), []byte("B/L")})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019")})
+	checkInvoke(t, stub, [][]byte{[]byte("prepareLot"), []byte(tradeID), []byte("lot1"), []byte("1")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLotAndIssueBL"), []byte(tradeID), []byte("lot1"), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port")})
+
+	// Invoke bad 'anchorDocument' and verify no state
+	childLCHash := fmt.Sprintf("%064x", 1)
+	lotBLHash := fmt.Sprintf("%064x", 2)
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("E/L"), []byte(childLCHash), []byte("application/pdf"), []byte("https://docs.forestry.gov/el979.pdf"), []byte("lot1")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte(childLCHash), []byte("application/pdf"), []byte("https://docs.lumberbank.com/lc8349-b2.pdf"), []byte("lc8349-b2")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("B/L"), []byte(lotBLHash), []byte("application/pdf"), []byte("https://docs.freight.com/bl06679.pdf"), []byte("lot2")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("B/L"), []byte(lotBLHash), []byte("application/pdf"), []byte("https://docs.freight.com/bl06678.pdf")})
+	checkBadQuery(t, stub, "verifyDocument", childLCHash)
+	checkBadQuery(t, stub, "verifyDocument", lotBLHash)
+
+	// Invoke 'anchorDocument' for the back-to-back L/C and verify that it, and not the trade's L/C, carries the file
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte(childLCHash), []byte("application/pdf"), []byte("https://docs.lumberbank.com/lc8349-b1.pdf"), []byte("lc8349-b1")})
+	childLCContent := &DocumentContent{childLCHash, "application/pdf", "https://docs.lumberbank.com/lc8349-b1.pdf"}
+	var childLC, letterOfCredit *LetterOfCredit
+	childLCKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID, "lc8349-b1"})
+	json.Unmarshal(stub.State[childLCKey], &childLC)
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	json.Unmarshal(stub.State[lcKey], &letterOfCredit)
+	if childLC == nil || childLC.Content == nil || *childLC.Content != *childLCContent || letterOfCredit.Content != nil {
+		fmt.Println("File not anchored to the back-to-back L/C")
+		t.FailNow()
+	}
+	verificationsBytes, _ := json.Marshal([]*DocumentVerification{{childLCHash, tradeID, "L/C", "lc8349-b1", "application/pdf", "https://docs.lumberbank.com/lc8349-b1.pdf", ISSUED, true}})
+	checkQuery(t, stub, "verifyDocument", childLCHash, string(verificationsBytes))
+
+	// Invoke 'anchorDocument' for the B/L of the lot and verify that it, and not a B/L of the whole trade, carries the file
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("B/L"), []byte(lotBLHash), []byte("application/pdf"), []byte("https://docs.freight.com/bl06678.pdf"), []byte("lot1")})
+	lotBLContent := &DocumentContent{lotBLHash, "application/pdf", "https://docs.freight.com/bl06678.pdf"}
+	var billOfLading *BillOfLading
+	lot1BLKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID, "lot1"})
+	json.Unmarshal(stub.State[lot1BLKey], &billOfLading)
+	if billOfLading == nil || billOfLading.Content == nil || *billOfLading.Content != *lotBLContent {
+		fmt.Println("File not anchored to the B/L of lot1")
+		t.FailNow()
+	}
+	blKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID})
+	checkNoState(t, stub, blKey)
+	lotBLAnchorKey, _ := stub.CreateCompositeKey("DocumentAnchor", []string{lotBLHash, tradeID, "BillOfLading", "bl06678"})
+	lotBLAnchorBytes, _ := json.Marshal(&DocumentAnchor{tradeID, "BillOfLading", "B/L", "bl06678", lotBLContent, "lot1"})
+	checkState(t, stub, lotBLAnchorKey, versionedAsset("DocumentAnchor", lotBLAnchorBytes))
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{lotBLHash, tradeID, "B/L", "bl06678", "application/pdf", "https://docs.freight.com/bl06678.pdf", ISSUED, true}})
+	checkQuery(t, stub, "verifyDocument", lotBLHash, string(verificationsBytes))
+
+	// Anchor the trade's L/C and verify that the back-to-back L/C's file still stands
+	lcHash := fmt.Sprintf("%064x", 3)
+	checkInvoke(t, stub, [][]byte{[]byte("anchorDocument"), []byte(tradeID), []byte("L/C"), []byte(lcHash), []byte("application/pdf"), []byte("https://docs.toybank.com/lc8349.pdf")})
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{lcHash, tradeID, "L/C", "lc8349", "application/pdf", "https://docs.toybank.com/lc8349.pdf", ACCEPTED, true}})
+	checkQuery(t, stub, "verifyDocument", lcHash, string(verificationsBytes))
+	verificationsBytes, _ = json.Marshal([]*DocumentVerification{{childLCHash, tradeID, "L/C", "lc8349-b1", "application/pdf", "https://docs.lumberbank.com/lc8349-b1.pdf", ISSUED, true}})
+	checkQuery(t, stub, "verifyDocument", childLCHash, string(verificationsBytes))
+}
+
+func signDocument(t *testing.T, key *ecdsa.PrivateKey, payload []byte) string {
+	digest := sha256.Sum256(payload)
+	signature, err := signECDSA(key, digest[:])
+	if err != nil {
+		fmt.Println("Failed to sign document", err.Error())
+		t.FailNow()
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func checkSignedDocument(t *testing.T, stub *shim.MockStub, tradeID string, document string, recordBytes []byte, signers []string) {
+	res := stub.MockInvoke("1", [][]byte{[]byte("getSignedDocument"), []byte(tradeID), []byte(document)})
+	if res.Status != shim.OK {
+		fmt.Println("Query", document, "failed", string(res.Message))
+		t.FailNow()
+	}
+	var signedDocument *SignedDocument
+	json.Unmarshal(res.Payload, &signedDocument)
+	if signedDocument == nil || signedDocument.TradeId != tradeID || signedDocument.Document != document || string(signedDocument.Record) != string(recordBytes) {
+		fmt.Println("Signed document", document, "was", string(res.Payload), "and not", string(recordBytes), "as expected")
+		t.FailNow()
+	}
+	if len(signedDocument.Signatures) != len(signers) {
+		fmt.Println("Document", document, "has", len(signedDocument.Signatures), "signatures and not", len(signers), "as expected")
+		t.FailNow()
+	}
+	for i, signer := range signers {
+		if signedDocument.Signatures[i].Signer != signer {
+			fmt.Println("Document", document, "signed by", signedDocument.Signatures[i].Signer, "and not", signer, "as expected")
+			t.FailNow()
+		}
+	}
+}
+
+func TestTradeWorkflow_DocumentSignatures(t *testing.T) {
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	icc := &identityChaincode{scc, nil}
+	stub := shim.NewMockStub("Trade Workflow", icc)
+
+	bankOfficer, bankOfficerKey := getTestIdentityKey(t, "ImporterOrgMSP", "User1@importerorg.trade.com", "ca.importerorg.trade.com", false)
+	regulator, regulatorKey := getTestIdentityKey(t, "RegulatorOrgMSP", "User1@regulatororg.trade.com", "ca.regulatororg.trade.com", false)
+	carrier, carrierKey := getTestIdentityKey(t, "CarrierOrgMSP", "User1@carrierorg.trade.com", "ca.carrierorg.trade.com", false)
+
+	// Init and request an L/C
+	icc.creator = bankOfficer
+	checkInit(t, stub, getInitArguments())
+	tradeID := "2ks89j9"
+	amount := 50000
+	checkInvoke(t, stub, [][]byte{[]byte("requestTrade"), []byte(tradeID), []byte(strconv.Itoa(amount)), []byte("Wood for Toys")})
+	checkInvoke(t, stub, [][]byte{[]byte("acceptTrade"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestLC"), []byte(tradeID)})
+
+	// The canonical serialisation of the L/C to be issued
+	lcPayload := []byte(`["L/C","2ks89j9","lc8349","12/31/2018","LumberInc","50000",["E/L","B/L"],"","","false","0","false"]`)
+	expectedLC := &LetterOfCredit{"lc8349", "12/31/2018", EXPORTER, amount, []string{"E/L", "B/L"}, ISSUED, "", "", false, false, false, "", "", 0, 0, 0, 0, false, nil}
+	payload, _ := getSigningPayload(tradeID, LETTER_OF_CREDIT_DOC, expectedLC, CANONICAL_SIGNING_PAYLOAD)
+	if string(payload) != string(lcPayload) {
+		fmt.Println("L/C signing payload was", string(payload), "and not", string(lcPayload), "as expected")
+		t.FailNow()
+	}
+
+	// Invoke bad 'issueLC' and verify unchanged state
+	lcKey, _ := stub.CreateCompositeKey("LetterOfCredit", []string{tradeID})
+	requestedLCBytes := stub.State[lcKey]
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L"), []byte("Signature=" + signDocument(t, carrierKey, lcPayload))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("Signature=" + signDocument(t, bankOfficerKey, lcPayload))})
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L"), []byte("Signature=not-base64")})
+	checkState(t, stub, lcKey, string(requestedLCBytes))
+
+	// Invoke signed 'issueLC' above the approval threshold and verify that the signature is not recorded while the issuance is held
+	icc.creator = getTestIdentity(t, "ImporterOrgMSP", "Admin@importerorg.trade.com", "ca.importerorg.trade.com", true)
+	checkInvoke(t, stub, [][]byte{[]byte("setApprovalPolicy"), []byte(IMPORTERS_BANK_PARTY), []byte("10000"), []byte("1")})
+	icc.creator = bankOfficer
+	issueArgs := [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8349"), []byte("12/31/2018"), []byte("E/L"), []byte("B/L"), []byte("Signature=" + signDocument(t, bankOfficerKey, lcPayload))}
+	proposal := checkProposal(t, stub, "tx001", issueArgs)
+	checkState(t, stub, lcKey, string(requestedLCBytes))
+	signatureKeyPrefix, _ := stub.CreateCompositeKey("DocumentSignature", []string{tradeID})
+	for key := range stub.State {
+		if strings.HasPrefix(key, signatureKeyPrefix) {
+			fmt.Println("Signature of a held L/C issuance recorded")
+			t.FailNow()
+		}
+	}
+
+	// A held signature can only be carried by an approved proposal
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueLC"), []byte(tradeID), []byte("lc8350"), []byte("12/31/2018"), []byte("E/L"), []byte(proposal.Args[len(proposal.Args) - 1])})
+	checkState(t, stub, lcKey, string(requestedLCBytes))
+
+	// Approve the issuance and verify the signed document
+	icc.creator = getTestIdentity(t, "ImporterOrgMSP", "Admin@importerorg.trade.com", "ca.importerorg.trade.com", true)
+	checkInvoke(t, stub, [][]byte{[]byte("approveProposal"), []byte(proposal.Id)})
+	icc.creator = bankOfficer
+	expectedLCBytes, _ := json.Marshal(expectedLC)
+	checkState(t, stub, lcKey, versionedAsset("LetterOfCredit", expectedLCBytes))
+	checkSignedDocument(t, stub, tradeID, LETTER_OF_CREDIT_DOC, []byte(versionedAsset("LetterOfCredit", expectedLCBytes)), []string{"User1@importerorg.trade.com"})
+	checkBadQuery(t, stub, "getSignedDocument", tradeID)
+	checkBadInvoke(t, stub, [][]byte{[]byte("getSignedDocument"), []byte(tradeID), []byte("E/L")})
+	checkBadInvoke(t, stub, [][]byte{[]byte("getSignedDocument"), []byte(tradeID), []byte("C/O")})
+
+	// Invoke signed 'issueEL' and verify that the signature must be the invoker's
+	checkInvoke(t, stub, [][]byte{[]byte("acceptLC"), []byte(tradeID)})
+	checkInvoke(t, stub, [][]byte{[]byte("requestEL"), []byte(tradeID)})
+	icc.creator = regulator
+	expectedEL := &ExportLicense{"el979", "4/30/2019", EXPORTER, CARRIER, "Wood for Toys", REGAUTH, ISSUED, nil}
+	payload, _ = getSigningPayload(tradeID, EXPORT_LICENSE_DOC, expectedEL, CANONICAL_SIGNING_PAYLOAD)
+	checkBadInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019"), []byte("Signature=" + signDocument(t, bankOfficerKey, payload))})
+	checkInvoke(t, stub, [][]byte{[]byte("issueEL"), []byte(tradeID), []byte("el979"), []byte("4/30/2019"), []byte("Signature=" + signDocument(t, regulatorKey, payload))})
+	expectedELBytes, _ := json.Marshal(expectedEL)
+	checkSignedDocument(t, stub, tradeID, EXPORT_LICENSE_DOC, []byte(versionedAsset("ExportLicense", expectedELBytes)), []string{"User1@regulatororg.trade.com"})
+
+	// Invoke signed 'acceptShipmentAndIssueBL' and verify the signed document
+	checkInvoke(t, stub, [][]byte{[]byte("prepareShipment"), []byte(tradeID)})
+	icc.creator = carrier
+	expectedBL := &BillOfLading{"bl06678", "8/31/2018", EXPORTER, CARRIER, "Wood for Toys", amount, IMPBANK, "Woodlands Port", "Market Port", ISSUED, "", nil}
+	payload, _ = getSigningPayload(tradeID, BILL_OF_LADING_DOC, expectedBL, CANONICAL_SIGNING_PAYLOAD)
+	checkInvoke(t, stub, [][]byte{[]byte("acceptShipmentAndIssueBL"), []byte(tradeID), []byte("bl06678"), []byte("8/31/2018"), []byte("Woodlands Port"), []byte("Market Port"), []byte("Signature=" + signDocument(t, carrierKey, payload))})
+	blKey, _ := stub.CreateCompositeKey("BillOfLading", []string{tradeID})
+	checkSignedDocument(t, stub, tradeID, BILL_OF_LADING_DOC, stub.State[blKey], []string{"User1@carrierorg.trade.com"})
+
+	// Alter the L/C behind the chaincode's back and verify that its signature no longer holds
+	expectedLC.Status = ACCEPTED
+	expectedLC.Amount = 60000
+	expectedLCBytes, _ = json.Marshal(expectedLC)
+	putState(stub, lcKey, []byte(versionedAsset("LetterOfCredit", expectedLCBytes)))
+	checkSignedDocument(t, stub, tradeID, LETTER_OF_CREDIT_DOC, []byte(versionedAsset("LetterOfCredit", expectedLCBytes)), []string{})
+
+	// A signature recorded before the payload was versioned was made over the plain JSON serialisation, which escapes '&'
+	var issuedBL *BillOfLading
+	json.Unmarshal(stub.State[blKey], &issuedBL)
+	issuedBL.DescriptionOfGoods = "Wood for Toys & Games"
+	issuedBLBytes, _ := json.Marshal(issuedBL)
+	putState(stub, blKey, []byte(versionedAsset("BillOfLading", issuedBLBytes)))
+	legacyPayload, _ := getSigningPayload(tradeID, BILL_OF_LADING_DOC, issuedBL, JSON_SIGNING_PAYLOAD)
+	payload, _ = getSigningPayload(tradeID, BILL_OF_LADING_DOC, issuedBL, CANONICAL_SIGNING_PAYLOAD)
+	if string(legacyPayload) == string(payload) {
+		fmt.Println("B/L signing payloads do not differ:", string(payload))
+		t.FailNow()
+	}
+	var legacySignature map[string]interface{}
+	blSignatureKeyPrefix, _ := stub.CreateCompositeKey("DocumentSignature", []string{tradeID, BILL_OF_LADING_DOC})
+	for key, value := range stub.State {
+		if strings.HasPrefix(key, blSignatureKeyPrefix) {
+			json.Unmarshal(value, &legacySignature)
+		}
+	}
+	delete(legacySignature, "payloadVersion")
+	legacySignature["schemaVersion"] = 1
+	legacySignature["signature"] = signDocument(t, carrierKey, legacyPayload)
+	legacySignatureBytes, _ := json.Marshal(legacySignature)
+	legacySignatureKey, _ := stub.CreateCompositeKey("DocumentSignature", []string{tradeID, BILL_OF_LADING_DOC, "legacy"})
+	putState(stub, legacySignatureKey, legacySignatureBytes)
+	checkSignedDocument(t, stub, tradeID, BILL_OF_LADING_DOC, []byte(versionedAsset("BillOfLading", issuedBLBytes)), []string{"User1@carrierorg.trade.com"})
+
+	// The same signature recorded as made over the canonical serialisation does not hold
+	legacySignature["schemaVersion"] = 2
+	legacySignature["payloadVersion"] = CANONICAL_SIGNING_PAYLOAD
+	legacySignatureBytes, _ = json.Marshal(legacySignature)
+	putState(stub, legacySignatureKey, legacySignatureBytes)
+	checkSignedDocument(t, stub, tradeID, BILL_OF_LADING_DOC, []byte(versionedAsset("BillOfLading", issuedBLBytes)), []string{})
+}
+
+func checkCanonicalEncoding(t *testing.T, objectType string, asset interface{}, expected string) {
+	assetBytes, _ := json.Marshal(asset)
+	value, err := stampSchemaVersion(objectType, assetBytes)
+	if err != nil {
+		fmt.Println("Failed to encode", objectType, err.Error())
+		t.FailNow()
+	}
+	if string(value) != expected {
+		fmt.Println(objectType, "encoded as", string(value), "and not", expected, "as expected")
+		t.FailNow()
+	}
+}
+
+func TestTradeWorkflow_CanonicalEncoding(t *testing.T) {
+	// Pin the stored bytes of the core assets; a change here changes the hashes and signatures of stored records
+	checkCanonicalEncoding(t, "Trade", &TradeAgreement{50000, "Wood for Toys & Games", ACCEPTED, 0, nil, 0},
+		`{"amount":50000,"descriptionOfGoods":"Wood for Toys & Games","payment":0,"schemaVersion":1,"status":"ACCEPTED"}`)
+	checkCanonicalEncoding(t, "LetterOfCredit", &LetterOfCredit{"lc8349", "12/31/2018", EXPORTER, 50000, []string{"E/L", "B/L"}, ISSUED, "", "", false, false, false, "", "", 0, 0, 0, 30, false,
+		&DocumentContent{fmt.Sprintf("%064x", 1), "application/pdf", "https://docs.toybank.com/lc8349.pdf"}},
+		`{"amount":50000,"beneficiary":"LumberInc","content":{"hash":"0000000000000000000000000000000000000000000000000000000000000001","mimeType":"application/pdf","uri":"https://docs.toybank.com/lc8349.pdf"},` +
+		`"documents":["E/L","B/L"],"expirationDate":"12/31/2018","id":"lc8349","schemaVersion":1,"status":"ISSUED","tenorDays":30}`)
+	checkCanonicalEncoding(t, "ExportLicense", &ExportLicense{"el979", "4/30/2019", EXPORTER, CARRIER, "Wood for Toys", REGAUTH, ISSUED, nil},
+		`{"approver":"ForestryDepartment","carrier":"UniversalFrieght","descriptionOfGoods":"Wood for Toys","expirationDate":"4/30/2019","exporter":"LumberInc","id":"el979","schemaVersion":1,"status":"ISSUED"}`)
+	checkCanonicalEncoding(t, "BillOfLading", &BillOfLading{"bl06678", "8/31/2018", EXPORTER, CARRIER, "Wood for Toys", 50000, IMPBANK, "Woodlands Port", "Market Port", ISSUED, "2018-08-01T10:00:00Z", nil},
+		`{"amount":50000,"beneficiary":"ToyBank","carrier":"UniversalFrieght","descriptionOfGoods":"Wood for Toys","destinationPort":"Market Port",` +
+		`"expirationDate":"8/31/2018","exporter":"LumberInc","id":"bl06678","issueDate":"2018-08-01T10:00:00Z","schemaVersion":1,"sourcePort":"Woodlands Port","status":"ISSUED"}`)
+
+	// The encoding does not depend on the order or spacing of the marshaled fields
+	value, _ := stampSchemaVersion("Trade", []byte(`{ "status": "ACCEPTED", "payment": 0, "descriptionOfGoods": "Wood for Toys & Games", "amount": 50000 }`))
+	if string(value) != `{"amount":50000,"descriptionOfGoods":"Wood for Toys & Games","payment":0,"schemaVersion":1,"status":"ACCEPTED"}` {
+		fmt.Println("Reordered trade encoded as", string(value))
+		t.FailNow()
+	}
+
+	// Fractional numbers are rejected
+	_, err := stampSchemaVersion("Trade", []byte(`{"amount":50000.5}`))
+	if err == nil {
+		fmt.Println("Fractional amount unexpectedly encoded")
+		t.FailNow()
+	}
+	_, err = stampSchemaVersion("Trade", []byte(`{"amount":5e4}`))
+	if err == nil {
+		fmt.Println("Exponent amount unexpectedly encoded")
+		t.FailNow()
+	}
+
+	// Records written by earlier versions of the chaincode are re-encoded canonically when upgraded
+	value, _, _ = upgradeRecord(getAssetSchema("BillOfLading"), "legacy", []byte(`{"id":"bl06678","amount":50000}`))
+	if string(value) != `{"amount":50000,"id":"bl06678","schemaVersion":1,"status":"ISSUED"}` {
+		fmt.Println("Legacy B/L upgraded to", string(value))
+		t.FailNow()
+	}
+}
+
+func checkProtoRoundTrip(t *testing.T, objectType string, asset interface{}, message proto.Message) {
+	assetBytes, _ := json.Marshal(asset)
+	value, _ := stampSchemaVersion(objectType, assetBytes)
+	protoBytes, err := encodeProtoRecord(objectType, value)
+	if err != nil || isStructuredRecord(protoBytes) || !isProtoRecord(objectType, protoBytes) {
+		fmt.Println("Error encoding", objectType, "in protobuf", err)
+		t.FailNow()
+	}
+	err = proto.Unmarshal(protoBytes, message)
+	if err != nil {
+		fmt.Println("Error decoding", objectType, "message", err)
+		t.FailNow()
+	}
+	jsonBytes, err := decodeProtoRecord(objectType, protoBytes)
+	if err != nil || string(jsonBytes) != string(value) {
+		fmt.Println(objectType, "decoded from protobuf as", string(jsonBytes), "and not", string(value), "as expected", err)
+		t.FailNow()
+	}
+}
+
+func checkProtoQuery(t *testing.T, stub *shim.MockStub, args [][]byte, message proto.Message, expected proto.Message) {
+	res := stub.MockInvoke("1", args)
+	if res.Status != shim.OK {
+		fmt.Println("Query", string(args[1]), "failed", string(res.Message))
+		t.FailNow()
+	}
+	err := proto.Unmarshal(res.Payload, message)
+	if err != nil || !proto.Equal(message, expected) {
+		fmt.Println("Query value", string(args[1]), "was", message, "and not", expected, "as expected", err)
+		t.FailNow()
+	}
+}
+
+func checkFormatMigration(t *testing.T, stub *shim.MockStub, migrated int) {
+	var progress MigrationProgress
+
+	res := stub.MockInvoke("1", [][]byte{[]byte("migrate"), []byte("100")})
+	if res.Status != shim.OK {
+		fmt.Println("Invoke migrate failed", string(res.Message))
+		t.FailNow()
+	}
+	err := json.Unmarshal(res.Payload, &progress)
+	if err != nil || progress.Migrated != migrated || !progress.Done {
+		fmt.Println("Invoke migrate reported", string(res.Payload))
+		t.FailNow()
+	}
+}
+
+func TestTradeWorkflow_ProtobufFormat(t *testing.T) {
+	// Every asset with a protobuf encoding converts to its message and back to the same canonical JSON
+	var tradeMessage tradepb.TradeAgreement
+	checkProtoRoundTrip(t, "Trade", &TradeAgreement{50000, "Wood for Toys & Games", ACCEPTED, 0, &Deadlines{"2018-06-30T00:00:00Z", "2018-07-31T00:00:00Z", "2018-09-30T00:00:00Z"}, 100}, &tradeMessage)
+	if tradeMessage.Amount != 50000 || tradeMessage.Deadlines.Shipment != "2018-07-31T00:00:00Z" || tradeMessage.SchemaVersion != 1 {
+		fmt.Println("Trade message was", tradeMessage.String())
+		t.FailNow()
+	}
+	var lcMessage tradepb.LetterOfCredit
+	checkProtoRoundTrip(t, "LetterOfCredit", &LetterOfCredit{"lc8349", "12/31/2018", EXPORTER, 50000, []string{"E/L", "B/L"}, ISSUED, "", "", false, false, false, "", "", 0, 0, 0, 30, false,
+		&DocumentContent{fmt.Sprintf("%064x", 1), "application/pdf", "https://docs.toybank.com/lc8349.pdf"}}, &lcMessage)
+	if len(lcMessage.Documents) != 2 || lcMessage.TenorDays != 30 || lcMessage.Content.MimeType != "application/pdf" {
+		fmt.Println("L/C message was", lcMessage.String())
+		t.FailNow()
+	}
+	checkProtoRoundTrip(t, "LetterOfCredit", &LetterOfCredit{"", "", EXPORTER, 50000, []string{}, REQUESTED, EXPBANK, "", false, false, true, "", "", 0, 0, 0, 0, true, nil}, &lcMessage)
+	var elMessage tradepb.ExportLicense
+	checkProtoRoundTrip(t, "ExportLicense", &ExportLicense{"el979", "4/30/2019", EXPORTER, CARRIER, "Wood for Toys", REGAUTH, ISSUED, nil}, &elMessage)
+	var blMessage tradepb.BillOfLading
+	checkProtoRoundTrip(t, "BillOfLading", &BillOfLading{"bl06678", "8/31/2018", EXPORTER, CARRIER, "Wood for Toys", 50000, IMPBANK, "Woodlands Port", "Market Port", ISSUED, "2018-08-01T10:00:00Z", nil}, &blMessage)
+	if blMessage.Beneficiary != IMPBANK || blMessage.DestinationPort != "Market Port" {
+		fmt.Println("B/L message was", blMessage.String())
+		t.FailNow()
+	}
+
+	scc := new(TradeWorkflowChaincode)
+	scc.testMode = true
+	stub := shim.NewMockStub("Trade Workflow", scc)
+
+	// Init with records stored in JSON, and ship a trade
+	checkInit(t, stub, getInitArguments())
+	tradeID := "2ks89j9"
+	checkTradeShipped(t, stub, tradeID, 50000, "Wood for Toys")
+
+	keys := []string{}
+	jsonRecords := map[string]string{}
+	for _, objectType := range []string{"Trade", "LetterOfCredit", "ExportLicense", "BillOfLading"} {
+		key, _ := stub.CreateCompositeKey(objectType, []string{tradeID})
+		keys = append(keys, key)
+		jsonRecords[key] = string(stub.State[key])
+		if !isStructuredRecord(stub.State[key]) {
+			fmt.Println(objectType, "not stored in JSON")
+			t.FailNow()
+		}
+	}
+
+	// Switch to protobuf in an upgrade and migrate the stored records
+	checkBadInit(t, stub, [][]byte{[]byte("init"), []byte("StateFormat=xml")})
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("StateFormat=protobuf")})
+	checkState(t, stub, keys[0], jsonRecords[keys[0]])
+	checkFormatMigration(t, stub, 4)
+	for _, key := range keys {
+		objectType, _, _ := stub.SplitCompositeKey(key)
+		if !isProtoRecord(objectType, stub.State[key]) {
+			fmt.Println(objectType, "not stored in protobuf")
+			t.FailNow()
+		}
+		value, _ := decodeProtoRecord(objectType, stub.State[key])
+		if string(value) != jsonRecords[key] {
+			fmt.Println(objectType, "migrated to", string(value), "and not", jsonRecords[key], "as expected")
+			t.FailNow()
+		}
+	}
+	checkFormatMigration(t, stub, 0)
+
+	schemaInfo := []SchemaInfo{}
+	res := stub.MockInvoke("1", [][]byte{[]byte("getSchemaInfo")})
+	json.Unmarshal(res.Payload, &schemaInfo)
+	for _, info := range schemaInfo[:4] {
+		if info.Protobuf != 1 || info.Versions[info.CurrentVersion] != 1 || info.Unstructured != 0 {
+			fmt.Println("Schema info of", info.ObjectType, "was", info)
+			t.FailNow()
+		}
+	}
+
+	// Queries answer in JSON unless protobuf is requested
+	checkInvoke(t, stub, [][]byte{[]byte("updateShipmentLocation"), []byte(tradeID), []byte(DESTINATION)})
+	checkQuery(t, stub, "getTradeStatus", tradeID, "{\"Status\":\"ACCEPTED\"}")
+	checkQuery(t, stub, "getBillOfLading", tradeID, jsonRecords[keys[3]])
+	checkQueryArgs(t, stub, [][]byte{[]byte("getLCStatus"), []byte(tradeID), []byte("Format=json")}, "{\"Status\":\"ACCEPTED\"}")
+	checkProtoQuery(t, stub, [][]byte{[]byte("getTradeStatus"), []byte(tradeID), []byte("Format=protobuf")}, &tradepb.StatusResponse{}, &tradepb.StatusResponse{Status: ACCEPTED})
+	checkProtoQuery(t, stub, [][]byte{[]byte("getLCStatus"), []byte(tradeID), []byte("Format=protobuf")}, &tradepb.StatusResponse{}, &tradepb.StatusResponse{Status: ACCEPTED})
+	checkProtoQuery(t, stub, [][]byte{[]byte("getELStatus"), []byte(tradeID), []byte("Format=protobuf")}, &tradepb.StatusResponse{}, &tradepb.StatusResponse{Status: ISSUED})
+	checkProtoQuery(t, stub, [][]byte{[]byte("getShipmentLocation"), []byte(tradeID), []byte("Format=protobuf")}, &tradepb.LocationResponse{}, &tradepb.LocationResponse{Location: DESTINATION})
+	var balanceResp struct {
+		Balance		string
+	}
+	res = stub.MockInvoke("1", [][]byte{[]byte("getAccountBalance"), []byte(tradeID), []byte("importer")})
+	json.Unmarshal(res.Payload, &balanceResp)
+	balance, _ := strconv.ParseInt(balanceResp.Balance, 10, 64)
+	checkProtoQuery(t, stub, [][]byte{[]byte("getAccountBalance"), []byte(tradeID), []byte("importer"), []byte("Format=protobuf")}, &tradepb.BalanceResponse{}, &tradepb.BalanceResponse{Balance: balance})
+	blMessage = tradepb.BillOfLading{}
+	proto.Unmarshal(stub.State[keys[3]], &blMessage)
+	checkProtoQuery(t, stub, [][]byte{[]byte("getBillOfLading"), []byte(tradeID), []byte("Format=protobuf")}, &tradepb.BillOfLading{}, &blMessage)
+
+	// Query with an invalid format and verify failure
+	res = stub.MockInvoke("1", [][]byte{[]byte("getTradeStatus"), []byte(tradeID), []byte("Format=xml")})
+	if res.Status == shim.OK {
+		fmt.Println("Query with format xml unexpectedly succeeded")
+		t.FailNow()
+	}
+
+	// Records are written in protobuf as the trade progresses
+	checkInvoke(t, stub, [][]byte{[]byte("requestPayment"), []byte(tradeID), []byte("pr001")})
+	checkInvoke(t, stub, [][]byte{[]byte("makePayment"), []byte(tradeID), []byte("pr001")})
+	if !isProtoRecord("Trade", stub.State[keys[0]]) {
+		fmt.Println("Paid trade not stored in protobuf")
+		t.FailNow()
+	}
+	tradeMessage = tradepb.TradeAgreement{}
+	proto.Unmarshal(stub.State[keys[0]], &tradeMessage)
+	if tradeMessage.Payment != 50000 {
+		fmt.Println("Paid trade stored as", tradeMessage.String())
+		t.FailNow()
+	}
+
+	// Switch back to JSON and verify that the records are restored as they were decoded
+	for _, key := range keys {
+		objectType, _, _ := stub.SplitCompositeKey(key)
+		value, _ := decodeProtoRecord(objectType, stub.State[key])
+		jsonRecords[key] = string(value)
+	}
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("StateFormat=json")})
+	checkFormatMigration(t, stub, 4)
+	for _, key := range keys {
+		checkState(t, stub, key, jsonRecords[key])
+	}
+}
+
+// A field of a message declared in trade.proto
+type protoField struct {
+	Name			string
+	Type			string
+	Number			int
+	Repeated		bool
+}
+
+// Read the messages declared in trade.proto, with their fields in declaration order
+func parseProtoMessages(t *testing.T, path string) (map[string][]protoField, []string) {
+	protoBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println("Failed to read", path, err.Error())
+		t.FailNow()
+	}
+
+	messageRegexp := regexp.MustCompile(`^message (\w+) \{$`)
+	fieldRegexp := regexp.MustCompile(`^(repeated )?(\w+) (\w+) = (\d+);$`)
+	messages := map[string][]protoField{}
+	names := []string{}
+	message := ""
+	for _, line := range strings.Split(string(protoBytes), "\n") {
+		line = strings.TrimSpace(line)
+		if match := messageRegexp.FindStringSubmatch(line); match != nil {
+			message = match[1]
+			messages[message] = []protoField{}
+			names = append(names, message)
+		} else if line == "}" {
+			message = ""
+		} else if match := fieldRegexp.FindStringSubmatch(line); match != nil && message != "" {
+			number, _ := strconv.Atoi(match[4])
+			messages[message] = append(messages[message], protoField{match[3], match[2], number, match[1] != ""})
+		}
+	}
+	return messages, names
+}
+
+// The lowerCamelCase JSON name protoc gives a field
+func protoJSONName(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func TestTradeWorkflow_ProtobufTypes(t *testing.T) {
+	// The Go types in tradepb are maintained by hand; verify that they carry the tags protoc would give them
+	messages, names := parseProtoMessages(t, "tradepb/trade.proto")
+	if len(names) == 0 {
+		fmt.Println("No messages found in trade.proto")
+		t.FailNow()
+	}
+	scalarKinds := map[string]reflect.Kind{"string": reflect.String, "int64": reflect.Int64, "int32": reflect.Int32, "bool": reflect.Bool}
+	wireTypes := map[string]string{"string": "bytes", "int64": "varint", "int32": "varint", "bool": "varint"}
+
+	for _, name := range names {
+		messageType := proto.MessageType("tradepb." + name)
+		if messageType == nil {
+			fmt.Println("Message", name, "not registered in tradepb")
+			t.FailNow()
+		}
+		properties := proto.GetProperties(messageType.Elem())
+		if len(properties.Prop) != len(messages[name]) {
+			fmt.Println("Message", name, "has", len(properties.Prop), "fields in tradepb and", len(messages[name]), "in trade.proto")
+			t.FailNow()
+		}
+
+		for i, field := range messages[name] {
+			prop := properties.Prop[i]
+			goType := messageType.Elem().Field(i).Type
+			if field.Repeated {
+				goType = goType.Elem()
+			}
+			wire, scalar := wireTypes[field.Type]
+			if !scalar {
+				wire = "bytes"
+			}
+			jsonName := protoJSONName(field.Name)
+			if jsonName == field.Name {
+				jsonName = ""
+			}
+			if prop.OrigName != field.Name || prop.Tag != field.Number || prop.Wire != wire || prop.Repeated != field.Repeated || prop.Optional == field.Repeated || prop.JSONName != jsonName {
+				fmt.Println("Field", prop.Name, "of", name, "is tagged", messageType.Elem().Field(i).Tag, "and not as", field.Name, "=", field.Number, "in trade.proto")
+				t.FailNow()
+			}
+			if scalar && goType.Kind() != scalarKinds[field.Type] || !scalar && (goType.Kind() != reflect.Ptr || goType.Elem().Name() != field.Type) {
+				fmt.Println("Field", prop.Name, "of", name, "is a", goType, "and not a", field.Type, "as in trade.proto")
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Go types of the messages in trade.proto. protoc is not part of the chaincode build, so these are
+// maintained by hand in the layout protoc-gen-go produces; keep them in step with trade.proto.
+// TestTradeWorkflow_ProtobufTypes fails when a message, field number, name, wire type or Go type differs.
+
+package tradepb
+
+import proto "github.com/golang/protobuf/proto"
+
+type DocumentContent struct {
+	Hash     string `protobuf:"bytes,1,opt,name=hash" json:"hash,omitempty"`
+	MimeType string `protobuf:"bytes,2,opt,name=mime_type,json=mimeType" json:"mime_type,omitempty"`
+	Uri      string `protobuf:"bytes,3,opt,name=uri" json:"uri,omitempty"`
+}
+
+func (m *DocumentContent) Reset()         { *m = DocumentContent{} }
+func (m *DocumentContent) String() string { return proto.CompactTextString(m) }
+func (*DocumentContent) ProtoMessage()    {}
+
+type Deadlines struct {
+	LcIssuance string `protobuf:"bytes,1,opt,name=lc_issuance,json=lcIssuance" json:"lc_issuance,omitempty"`
+	Shipment   string `protobuf:"bytes,2,opt,name=shipment" json:"shipment,omitempty"`
+	Payment    string `protobuf:"bytes,3,opt,name=payment" json:"payment,omitempty"`
+}
+
+func (m *Deadlines) Reset()         { *m = Deadlines{} }
+func (m *Deadlines) String() string { return proto.CompactTextString(m) }
+func (*Deadlines) ProtoMessage()    {}
+
+type TradeAgreement struct {
+	Amount             int64      `protobuf:"varint,1,opt,name=amount" json:"amount,omitempty"`
+	DescriptionOfGoods string     `protobuf:"bytes,2,opt,name=description_of_goods,json=descriptionOfGoods" json:"description_of_goods,omitempty"`
+	Status             string     `protobuf:"bytes,3,opt,name=status" json:"status,omitempty"`
+	Payment            int64      `protobuf:"varint,4,opt,name=payment" json:"payment,omitempty"`
+	Deadlines          *Deadlines `protobuf:"bytes,5,opt,name=deadlines" json:"deadlines,omitempty"`
+	Quantity           int64      `protobuf:"varint,6,opt,name=quantity" json:"quantity,omitempty"`
+	SchemaVersion      int32      `protobuf:"varint,100,opt,name=schema_version,json=schemaVersion" json:"schema_version,omitempty"`
+}
+
+func (m *TradeAgreement) Reset()         { *m = TradeAgreement{} }
+func (m *TradeAgreement) String() string { return proto.CompactTextString(m) }
+func (*TradeAgreement) ProtoMessage()    {}
+
+type LetterOfCredit struct {
+	Id               string           `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	ExpirationDate   string           `protobuf:"bytes,2,opt,name=expiration_date,json=expirationDate" json:"expiration_date,omitempty"`
+	Beneficiary      string           `protobuf:"bytes,3,opt,name=beneficiary" json:"beneficiary,omitempty"`
+	Amount           int64            `protobuf:"varint,4,opt,name=amount" json:"amount,omitempty"`
+	Documents        []string         `protobuf:"bytes,5,rep,name=documents" json:"documents,omitempty"`
+	Status           string           `protobuf:"bytes,6,opt,name=status" json:"status,omitempty"`
+	AdvisingBank     string           `protobuf:"bytes,7,opt,name=advising_bank,json=advisingBank" json:"advising_bank,omitempty"`
+	ConfirmingBank   string           `protobuf:"bytes,8,opt,name=confirming_bank,json=confirmingBank" json:"confirming_bank,omitempty"`
+	Advised          bool             `protobuf:"varint,9,opt,name=advised" json:"advised,omitempty"`
+	Confirmed        bool             `protobuf:"varint,10,opt,name=confirmed" json:"confirmed,omitempty"`
+	Transferable     bool             `protobuf:"varint,11,opt,name=transferable" json:"transferable,omitempty"`
+	Type             string           `protobuf:"bytes,12,opt,name=type" json:"type,omitempty"`
+	ParentId         string           `protobuf:"bytes,13,opt,name=parent_id,json=parentId" json:"parent_id,omitempty"`
+	Transferred      int64            `protobuf:"varint,14,opt,name=transferred" json:"transferred,omitempty"`
+	BackToBack       int64            `protobuf:"varint,15,opt,name=back_to_back,json=backToBack" json:"back_to_back,omitempty"`
+	Drawn            int64            `protobuf:"varint,16,opt,name=drawn" json:"drawn,omitempty"`
+	TenorDays        int64            `protobuf:"varint,17,opt,name=tenor_days,json=tenorDays" json:"tenor_days,omitempty"`
+	PartialShipments bool             `protobuf:"varint,18,opt,name=partial_shipments,json=partialShipments" json:"partial_shipments,omitempty"`
+	Content          *DocumentContent `protobuf:"bytes,19,opt,name=content" json:"content,omitempty"`
+	SchemaVersion    int32            `protobuf:"varint,100,opt,name=schema_version,json=schemaVersion" json:"schema_version,omitempty"`
+}
+
+func (m *LetterOfCredit) Reset()         { *m = LetterOfCredit{} }
+func (m *LetterOfCredit) String() string { return proto.CompactTextString(m) }
+func (*LetterOfCredit) ProtoMessage()    {}
+
+type ExportLicense struct {
+	Id                 string           `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	ExpirationDate     string           `protobuf:"bytes,2,opt,name=expiration_date,json=expirationDate" json:"expiration_date,omitempty"`
+	Exporter           string           `protobuf:"bytes,3,opt,name=exporter" json:"exporter,omitempty"`
+	Carrier            string           `protobuf:"bytes,4,opt,name=carrier" json:"carrier,omitempty"`
+	DescriptionOfGoods string           `protobuf:"bytes,5,opt,name=description_of_goods,json=descriptionOfGoods" json:"description_of_goods,omitempty"`
+	Approver           string           `protobuf:"bytes,6,opt,name=approver" json:"approver,omitempty"`
+	Status             string           `protobuf:"bytes,7,opt,name=status" json:"status,omitempty"`
+	Content            *DocumentContent `protobuf:"bytes,8,opt,name=content" json:"content,omitempty"`
+	SchemaVersion      int32            `protobuf:"varint,100,opt,name=schema_version,json=schemaVersion" json:"schema_version,omitempty"`
+}
+
+func (m *ExportLicense) Reset()         { *m = ExportLicense{} }
+func (m *ExportLicense) String() string { return proto.CompactTextString(m) }
+func (*ExportLicense) ProtoMessage()    {}
+
+type BillOfLading struct {
+	Id                 string           `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	ExpirationDate     string           `protobuf:"bytes,2,opt,name=expiration_date,json=expirationDate" json:"expiration_date,omitempty"`
+	Exporter           string           `protobuf:"bytes,3,opt,name=exporter" json:"exporter,omitempty"`
+	Carrier            string           `protobuf:"bytes,4,opt,name=carrier" json:"carrier,omitempty"`
+	DescriptionOfGoods string           `protobuf:"bytes,5,opt,name=description_of_goods,json=descriptionOfGoods" json:"description_of_goods,omitempty"`
+	Amount             int64            `protobuf:"varint,6,opt,name=amount" json:"amount,omitempty"`
+	Beneficiary        string           `protobuf:"bytes,7,opt,name=beneficiary" json:"beneficiary,omitempty"`
+	SourcePort         string           `protobuf:"bytes,8,opt,name=source_port,json=sourcePort" json:"source_port,omitempty"`
+	DestinationPort    string           `protobuf:"bytes,9,opt,name=destination_port,json=destinationPort" json:"destination_port,omitempty"`
+	Status             string           `protobuf:"bytes,10,opt,name=status" json:"status,omitempty"`
+	IssueDate          string           `protobuf:"bytes,11,opt,name=issue_date,json=issueDate" json:"issue_date,omitempty"`
+	Content            *DocumentContent `protobuf:"bytes,12,opt,name=content" json:"content,omitempty"`
+	SchemaVersion      int32            `protobuf:"varint,100,opt,name=schema_version,json=schemaVersion" json:"schema_version,omitempty"`
+}
+
+func (m *BillOfLading) Reset()         { *m = BillOfLading{} }
+func (m *BillOfLading) String() string { return proto.CompactTextString(m) }
+func (*BillOfLading) ProtoMessage()    {}
+
+type StatusResponse struct {
+	Status string `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *StatusResponse) Reset()         { *m = StatusResponse{} }
+func (m *StatusResponse) String() string { return proto.CompactTextString(m) }
+func (*StatusResponse) ProtoMessage()    {}
+
+type LocationResponse struct {
+	Location string `protobuf:"bytes,1,opt,name=location" json:"location,omitempty"`
+}
+
+func (m *LocationResponse) Reset()         { *m = LocationResponse{} }
+func (m *LocationResponse) String() string { return proto.CompactTextString(m) }
+func (*LocationResponse) ProtoMessage()    {}
+
+type BalanceResponse struct {
+	Balance int64 `protobuf:"varint,1,opt,name=balance" json:"balance,omitempty"`
+}
+
+func (m *BalanceResponse) Reset()         { *m = BalanceResponse{} }
+func (m *BalanceResponse) String() string { return proto.CompactTextString(m) }
+func (*BalanceResponse) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterType((*DocumentContent)(nil), "tradepb.DocumentContent")
+	proto.RegisterType((*Deadlines)(nil), "tradepb.Deadlines")
+	proto.RegisterType((*TradeAgreement)(nil), "tradepb.TradeAgreement")
+	proto.RegisterType((*LetterOfCredit)(nil), "tradepb.LetterOfCredit")
+	proto.RegisterType((*ExportLicense)(nil), "tradepb.ExportLicense")
+	proto.RegisterType((*BillOfLading)(nil), "tradepb.BillOfLading")
+	proto.RegisterType((*StatusResponse)(nil), "tradepb.StatusResponse")
+	proto.RegisterType((*LocationResponse)(nil), "tradepb.LocationResponse")
+	proto.RegisterType((*BalanceResponse)(nil), "tradepb.BalanceResponse")
+}
@@ -0,0 +1,310 @@
+/*
+ * Copyright 2018 IBM All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the 'License');
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an 'AS IS' BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"time"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func lookupDraft(stub shim.ChaincodeStubInterface, tradeID string) (string, *Draft, error) {
+	var draft *Draft
+
+	draftKey, err := getDraftKey(stub, tradeID)
+	if err != nil {
+		return "", nil, err
+	}
+	draftBytes, err := getAssetState(stub, draftKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(draftBytes) == 0 {
+		return draftKey, nil, nil
+	}
+
+	err = json.Unmarshal(draftBytes, &draft)
+	if err != nil {
+		return "", nil, err
+	}
+	return draftKey, draft, nil
+}
+
+func putDraft(stub shim.ChaincodeStubInterface, draftKey string, draft *Draft) error {
+	draftBytes, err := json.Marshal(draft)
+	if err != nil {
+		return errors.New("Error marshaling draft structure")
+	}
+	return putAssetState(stub, draftKey, draftBytes)
+}
+
+// Payment under a usance L/C needs an accepted draft that has reached maturity; L/Cs payable at sight need no draft
+func checkDraftMatured(stub shim.ChaincodeStubInterface, tradeID string, letterOfCredit *LetterOfCredit) (*Draft, error) {
+	if letterOfCredit == nil || letterOfCredit.TenorDays == 0 {
+		return nil, nil
+	}
+
+	_, draft, err := lookupDraft(stub, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if draft == nil {
+		return nil, errors.New(fmt.Sprintf("No draft accepted under the usance L/C for trade %s", tradeID))
+	}
+
+	maturityDate, err := time.Parse(time.RFC3339, draft.MaturityDate)
+	if err != nil {
+		return nil, err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.Before(maturityDate) {
+		return nil, errors.New(fmt.Sprintf("Draft for trade %s not payable before its maturity on %s", tradeID, draft.MaturityDate))
+	}
+	return draft, nil
+}
+
+// Accept the draft drawn under a usance L/C; the draft matures at the end of the L/C's tenor, counted from the B/L date
+func (t *TradeWorkflowChaincode) acceptDraft(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var lcKey, blKey, draftKey string
+	var billOfLadingBytes []byte
+	var letterOfCredit *LetterOfCredit
+	var billOfLading *BillOfLading
+	var draft *Draft
+	var issueDate, txTime time.Time
+	var err error
+
+	// Access control: Only an Importer Org member can invoke this transaction
+	if !t.testMode && !authenticateImporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Importer Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	draftKey, draft, err = lookupDraft(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if draft != nil {
+		fmt.Printf("Draft for trade %s already accepted", args[0])
+		return shim.Success(nil)
+	}
+
+	lcKey, err = getLCKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	letterOfCredit, err = lookupLetterOfCredit(stub, lcKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit == nil || letterOfCredit.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("No accepted L/C found for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	if letterOfCredit.TenorDays == 0 {
+		err = errors.New(fmt.Sprintf("L/C for trade %s is payable at sight", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Lookup B/L from the ledger
+	blKey, err = getBLKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	billOfLadingBytes, err = getAssetState(stub, blKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(billOfLadingBytes) == 0 {
+		fmt.Printf("B/L for trade %s has not been issued", args[0])
+		return shim.Error("B/L not issued yet")
+	}
+	err = json.Unmarshal(billOfLadingBytes, &billOfLading)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	issueDate, err = time.Parse(time.RFC3339, billOfLading.IssueDate)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("B/L for trade %s has no valid issue date", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The draft is for the amount payable to the exporter, net of any transfers to second beneficiaries
+	draft = &Draft{args[0], letterOfCredit.Amount - letterOfCredit.Transferred, txTime.Format(time.RFC3339), issueDate.AddDate(0, 0, letterOfCredit.TenorDays).Format(time.RFC3339), "", 0, ACCEPTED}
+	err = putDraft(stub, draftKey, draft)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Draft for trade %s accepted, maturing on %s\n", args[0], draft.MaturityDate)
+
+	return shim.Success(nil)
+}
+
+// Discount an accepted draft: the exporter's bank pays the exporter now, less interest to maturity, and is paid at maturity instead
+func (t *TradeWorkflowChaincode) discountDraft(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var draftKey, bankBalanceKey string
+	var bankBytes []byte
+	var draft *Draft
+	var invoice *Invoice
+	var maturityDate, txTime time.Time
+	var rate, days, bankBal int
+	var err error
+
+	// Access control: Only an Exporter Org member can invoke this transaction
+	if !t.testMode && !authenticateExporterOrg(creatorOrg, creatorCertIssuer) {
+		return shim.Error("Caller not a member of Exporter Org. Access denied.")
+	}
+
+	if len(args) != 2 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Trade ID, Discount Rate (basis points per annum)}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	rate, err = strconv.Atoi(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rate < 0 {
+		return shim.Error("Discount rate may not be negative")
+	}
+
+	draftKey, draft, err = lookupDraft(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if draft == nil {
+		err = errors.New(fmt.Sprintf("No draft accepted for trade %s", args[0]))
+		return shim.Error(err.Error())
+	}
+	if draft.Status != ACCEPTED {
+		err = errors.New(fmt.Sprintf("Draft for trade %s is %s", args[0], draft.Status))
+		return shim.Error(err.Error())
+	}
+
+	// A receivable already sold to a financier cannot be discounted
+	_, invoice, err = lookupFinancedInvoice(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice != nil {
+		err = errors.New(fmt.Sprintf("Receivable for trade %s has been assigned to %s", args[0], invoice.Financier))
+		return shim.Error(err.Error())
+	}
+
+	maturityDate, err = time.Parse(time.RFC3339, draft.MaturityDate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !txTime.Before(maturityDate) {
+		err = errors.New(fmt.Sprintf("Draft for trade %s has matured", args[0]))
+		return shim.Error(err.Error())
+	}
+
+	// Interest is charged for every day, or part of a day, left to maturity
+	days = int((maturityDate.Sub(txTime) + 24 * time.Hour - 1) / (24 * time.Hour))
+	draft.Discount = draft.Amount * rate * days / (DAYS_PER_YEAR * 10000)
+
+	// The exporter's bank advances the discounted amount from its own account
+	bankBytes, err = stub.GetState(ebKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bankBalanceKey, err = getBankBalanceKey(stub, string(bankBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = openAccount(stub, bankBalanceKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bankBal, err = getBalance(stub, bankBalanceKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if bankBal < draft.Amount - draft.Discount {
+		err = errors.New(fmt.Sprintf("Exporter's bank's balance %d is insufficient to advance %d on the draft for trade %s", bankBal, draft.Amount - draft.Discount, args[0]))
+		return shim.Error(err.Error())
+	}
+	err = transferFunds(stub, bankBalanceKey, expBalKey, draft.Amount - draft.Discount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	draft.DiscountedBy = string(bankBytes)
+	draft.Status = DISCOUNTED
+	err = putDraft(stub, draftKey, draft)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("Draft for trade %s discounted by %s: %d paid to the exporter, discount %d\n", args[0], draft.DiscountedBy, draft.Amount - draft.Discount, draft.Discount)
+
+	return shim.Success(nil)
+}
+
+// Get the draft drawn under the usance L/C of a trade
+func (t *TradeWorkflowChaincode) getDraft(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+	var draftKey, jsonResp string
+	var draftBytes []byte
+	var err error
+
+	// Access control: Only an Importer or Exporter Org member can invoke this transaction
+	if !t.testMode && !(authenticateImporterOrg(creatorOrg, creatorCertIssuer) || authenticateExporterOrg(creatorOrg, creatorCertIssuer)) {
+		return shim.Error("Caller not a member of Importer or Exporter Org. Access denied.")
+	}
+
+	if len(args) != 1 {
+		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Trade ID}. Found %d", len(args)))
+		return shim.Error(err.Error())
+	}
+
+	draftKey, err = getDraftKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	draftBytes, err = getAssetState(stub, draftKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(draftBytes) == 0 {
+		jsonResp = "{\"Error\":\"No record found for " + draftKey + "\"}"
+		return shim.Error(jsonResp)
+	}
+	fmt.Printf("Query Response:%s\n", string(draftBytes))
+	return shim.Success(draftBytes)
+}
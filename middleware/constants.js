@@ -135,7 +135,7 @@ var CHANNEL_NAME = 'tradechannel';
 var CHAINCODE_PATH = 'github.com/trade_workflow';
 var CHAINCODE_ID = 'tradecc';
 var CHAINCODE_VERSION = 'v0';
-var CHAINCODE_UPGRADE_PATH = 'github.com/trade_workflow_v1';
+var CHAINCODE_UPGRADE_PATH = 'github.com/trade_workflow';
 var CHAINCODE_UPGRADE_VERSION = 'v1';
 
 var TRANSACTION_ENDORSEMENT_POLICY = ALL_FOUR_ORG_MEMBERS;
@@ -368,7 +368,7 @@ invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'r
 	console.log('\n');
 
 	// INVOKE: requestPayment (Exporter)
-	return invokeCC.invokeChaincode(Constants.EXPORTING_ENTITY_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID], 'ExportingEntity', Constants);
+	return invokeCC.invokeChaincode(Constants.EXPORTING_ENTITY_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID, 'pr001'], 'ExportingEntity', Constants);
 }, (err) => {
 	console.log('\n');
 	console.log('------------------------');
@@ -387,7 +387,7 @@ invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'r
 	console.log('\n');
 
 	// INVOKE: makePayment (Importer)
-	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID], 'Importer', Constants);
+	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID, 'pr001'], 'Importer', Constants);
 }, (err) => {
 	console.log('\n');
 	console.log('-----------------------------');
@@ -482,7 +482,7 @@ invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'r
 	console.log('\n');
 
 	// INVOKE: requestPayment (Exporter)
-	return invokeCC.invokeChaincode(Constants.EXPORTING_ENTITY_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID], 'ExportingEntity', Constants);
+	return invokeCC.invokeChaincode(Constants.EXPORTING_ENTITY_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID, 'pr002'], 'ExportingEntity', Constants);
 }, (err) => {
 	console.log('\n');
 	console.log('------------------------');
@@ -501,7 +501,7 @@ invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'r
 	console.log('\n');
 
 	// INVOKE: makePayment (Importer)
-	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID], 'Importer', Constants);
+	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID, 'pr002'], 'Importer', Constants);
 }, (err) => {
 	console.log('\n');
 	console.log('-----------------------------');
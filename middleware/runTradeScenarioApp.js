@@ -327,7 +327,7 @@ invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'a
 	console.log('\n');
 
 	// INVOKE: requestPayment (Exporter)
-	return invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID], 'Exporter');
+	return invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID, 'pr001'], 'Exporter');
 }, (err) => {
 	console.log('\n');
 	console.log('------------------------');
@@ -346,7 +346,7 @@ invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'a
 	console.log('\n');
 
 	// INVOKE: makePayment (Importer)
-	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID], 'Importer');
+	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID, 'pr001'], 'Importer');
 }, (err) => {
 	console.log('\n');
 	console.log('-----------------------------');
@@ -441,7 +441,7 @@ invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'a
 	console.log('\n');
 
 	// INVOKE: requestPayment (Exporter)
-	return invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID], 'Exporter');
+	return invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'requestPayment', [tradeID, 'pr002'], 'Exporter');
 }, (err) => {
 	console.log('\n');
 	console.log('------------------------');
@@ -460,7 +460,7 @@ invokeCC.invokeChaincode(Constants.EXPORTER_ORG, Constants.CHAINCODE_VERSION, 'a
 	console.log('\n');
 
 	// INVOKE: makePayment (Importer)
-	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID], 'Importer');
+	return invokeCC.invokeChaincode(Constants.IMPORTER_ORG, Constants.CHAINCODE_VERSION, 'makePayment', [tradeID, 'pr002'], 'Importer');
 }, (err) => {
 	console.log('\n');
 	console.log('-----------------------------');
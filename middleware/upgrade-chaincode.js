@@ -40,7 +40,7 @@ installCC.installChaincode(Constants.CHAINCODE_UPGRADE_PATH, Constants.CHAINCODE
 		Constants.CHAINCODE_UPGRADE_PATH,
 		Constants.CHAINCODE_UPGRADE_VERSION,
 		'init',
-		[],
+		['ExportingEntity=on'],
 		true,
 		Constants
 	);